@@ -12,6 +12,7 @@ require (
 	github.com/gofrs/uuid v4.2.0+incompatible
 	github.com/google/go-cmp v0.5.6
 	github.com/magefile/mage v1.13.0
+	github.com/oschwald/maxminddb-golang v1.3.1
 	github.com/rs/xid v1.4.0
 	github.com/spf13/cobra v1.3.0
 	github.com/stretchr/testify v1.7.0
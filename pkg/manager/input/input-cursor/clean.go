@@ -5,9 +5,9 @@
 package cursor
 
 import (
+	"sync"
 	"time"
 
-	"github.com/elastic/go-concert/timed"
 	"github.com/elastic/go-concert/unison"
 
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -15,13 +15,65 @@ import (
 
 // cleaner removes finished entries from the registry file.
 type cleaner struct {
-	log *logp.Logger
+	log     *logp.Logger
+	metrics ManagerMetrics
+	stats   *cleanerStats
+
+	// started is the time the cleanup loop has been started. It is used as
+	// reference for states that have not been updated since startup.
+	started time.Time
+
+	// requests triggers an immediate cleanup pass in the cleanup loop.
+	requests chan struct{}
+
+	mu      sync.Mutex
+	passes  uint64       // number of cleanup passes started
+	waiters []passWaiter // go-routines waiting for a pass to finish
+}
+
+// passWaiter is notified once the cleanup pass with the given generation has
+// finished.
+type passWaiter struct {
+	pass uint64
+	done chan struct{}
+}
+
+func newCleaner(log *logp.Logger, metrics ManagerMetrics, stats *cleanerStats) *cleaner {
+	return &cleaner{log: log, metrics: metrics, stats: stats, requests: make(chan struct{}, 1)}
+}
+
+// CleanerStats reports the progress of the store cleanup process.
+type CleanerStats struct {
+	// Runs is the number of cleanup passes run so far.
+	Runs uint64
+
+	// LastRun is the time the last cleanup pass has been started. It is zero
+	// if no pass has been run yet.
+	LastRun time.Time
+
+	// LastDuration is the duration of the last cleanup pass.
+	LastDuration time.Duration
+
+	// LastRemoved is the number of keys removed by the last cleanup pass.
+	LastRemoved int
+
+	// TotalRemoved is the number of keys removed by all cleanup passes.
+	TotalRemoved uint64
+}
+
+// cleanerStats collects the CleanerStats. The stats of a pass are updated at
+// once, such that readers never observe a partially updated pass.
+type cleanerStats struct {
+	mu    sync.Mutex
+	stats CleanerStats
 }
 
 // run starts a loop that tries to clean entries from the registry.
 // The cleaner locks the store, such that no new states can be created
 // during the cleanup phase. Only resources that are finished and whos TTL
-// (clean_timeout setting) has expired will be removed.
+// (clean_timeout setting, or TimedSource.CleanTimeout) has expired will be removed.
+// Resources with an expiry time set via ExpiringUpdate are removed once the
+// expiry time has passed, even if they have been updated recently.
 //
 // Resources are considered "Finished" if they do not have a current owner (active input), and
 // if they have no pending updates that still need to be written to the registry file after associated
@@ -29,12 +81,101 @@ type cleaner struct {
 // The event acquisition timestamp is used as reference to clean resources. If a resources was blocked
 // for a long time, and the life time has been exhausted, then the resource will be removed immediately
 // once the last event has been ACKed.
+//
+// Besides the periodic passes, a pass can be requested via trigger.
 func (c *cleaner) run(canceler unison.Canceler, store *store, interval time.Duration) {
-	started := time.Now()
-	_ = timed.Periodic(canceler, interval, func() error {
-		gcStore(c.log, started, store)
-		return nil
-	})
+	c.started = time.Now()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// check for cancel first, like timed.Periodic, to not run another
+		// pass if the cleaner has been stopped already
+		select {
+		case <-canceler.Done():
+			return
+		default:
+		}
+
+		select {
+		case <-canceler.Done():
+			return
+		case <-ticker.C:
+		case <-c.requests:
+		}
+		c.runOnce(store)
+	}
+}
+
+// runOnce runs a single cleanup pass, and returns the number of keys that
+// have been removed. Go-routines waiting for the pass via waitPass are woken
+// up once the stats have been updated.
+func (c *cleaner) runOnce(store *store) int {
+	c.mu.Lock()
+	c.passes++
+	pass := c.passes
+	c.mu.Unlock()
+
+	start := time.Now()
+	removed := gcStore(c.log, c.started, store)
+	if c.stats != nil {
+		c.stats.update(start, time.Since(start), removed)
+	}
+	if c.metrics != nil {
+		c.metrics.CleanupRun(removed)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.pass <= pass {
+			close(w.done)
+		} else {
+			waiters = append(waiters, w)
+		}
+	}
+	c.waiters = waiters
+	return removed
+}
+
+// waitPass returns a channel that is closed once the next cleanup pass has
+// finished. A pass that is already running when waitPass is called does not
+// close the channel, such that the pass observes all changes made before.
+func (c *cleaner) waitPass() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w := passWaiter{pass: c.passes + 1, done: make(chan struct{})}
+	c.waiters = append(c.waiters, w)
+	return w.done
+}
+
+// trigger requests an immediate cleanup pass from the cleanup loop. The
+// returned channel is closed once a pass started after the request has
+// finished. Requests are coalesced if a pass has already been requested.
+func (c *cleaner) trigger() <-chan struct{} {
+	passed := c.waitPass()
+	select {
+	case c.requests <- struct{}{}:
+	default:
+	}
+	return passed
+}
+
+func (s *cleanerStats) update(start time.Time, duration time.Duration, removed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stats.Runs++
+	s.stats.LastRun = start
+	s.stats.LastDuration = duration
+	s.stats.LastRemoved = removed
+	s.stats.TotalRemoved += uint64(removed)
+}
+
+func (s *cleanerStats) get() CleanerStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
 }
 
 // gcStore looks for resources to remove and deletes these. `gcStore` receives
@@ -43,7 +184,8 @@ func (c *cleaner) run(canceler unison.Canceler, store *store, interval time.Dura
 // + ttl` to decide if an entry will be removed. This way old entries are not
 // removed immediately on startup if the Beat is down for a longer period of
 // time.
-func gcStore(log *logp.Logger, started time.Time, store *store) {
+// The number of keys that have been removed is returned.
+func gcStore(log *logp.Logger, started time.Time, store *store) int {
 	log.Debugf("Start store cleanup")
 	defer log.Debugf("Done store cleanup")
 
@@ -51,21 +193,28 @@ func gcStore(log *logp.Logger, started time.Time, store *store) {
 	states.mu.Lock()
 	defer states.mu.Unlock()
 
-	keys := gcFind(states.table, started, time.Now())
+	keys := gcFind(states.table, started, time.Now(), store.cleanupExclude)
 	if len(keys) == 0 {
 		log.Debug("No entries to remove were found")
-		return
+		return 0
 	}
 
-	if err := gcClean(store, keys); err != nil {
+	removed, err := gcClean(store, keys)
+	if err != nil {
 		log.Errorf("Failed to remove all entries from the registry: %+v", err)
 	}
+	return removed
 }
 
 // gcFind searches the store of resources that can be removed. A set of keys to delete is returned.
-func gcFind(table map[string]*resource, started, now time.Time) map[string]struct{} {
+// Keys for which exclude returns true are never removed.
+func gcFind(table map[string]*resource, started, now time.Time, exclude func(string) bool) map[string]struct{} {
 	keys := map[string]struct{}{}
 	for key, resource := range table {
+		if exclude != nil && exclude(key) {
+			continue
+		}
+
 		clean := checkCleanResource(started, now, resource)
 		if !clean {
 			// do not clean the resource if it is still live or not serialized to the persistent store yet.
@@ -79,15 +228,17 @@ func gcFind(table map[string]*resource, started, now time.Time) map[string]struc
 
 // gcClean removes key value pairs in the removeSet from the store.
 // If deletion in the persistent store fails the entry is kept in memory and
-// eventually cleaned up later.
-func gcClean(store *store, removeSet map[string]struct{}) error {
+// eventually cleaned up later. The number of removed keys is returned.
+func gcClean(store *store, removeSet map[string]struct{}) (int, error) {
+	removed := 0
 	for key := range removeSet {
 		if err := store.persistentStore.Remove(key); err != nil {
-			return err
+			return removed, err
 		}
 		delete(store.ephemeralStore.table, key)
+		removed++
 	}
-	return nil
+	return removed, nil
 }
 
 // checkCleanResource returns true for a key-value pair is assumed to be old,
@@ -101,6 +252,10 @@ func checkCleanResource(started, now time.Time, resource *resource) bool {
 	resource.stateMutex.Lock()
 	defer resource.stateMutex.Unlock()
 
+	if expiresAt := resource.internalState.ExpiresAt; !expiresAt.IsZero() && !now.Before(expiresAt) {
+		return resource.stored
+	}
+
 	ttl := resource.internalState.TTL
 	reference := resource.internalState.Updated
 	if started.After(reference) {
@@ -62,12 +62,40 @@ func TestGCStore(t *testing.T) {
 		store := testOpenStore(t, backend)
 		defer store.Release()
 
-		gcStore(logp.NewLogger("test"), started, store)
+		removed := gcStore(logp.NewLogger("test"), started, store)
+		require.Equal(t, 1, removed)
 
 		want := map[string]state{}
 		checkEqualStoreState(t, want, backend.snapshot())
 	})
 
+	t.Run("excluded state is not removed", func(t *testing.T) {
+		const ttl = 60 * time.Second
+		started := time.Now().Add(-5 * ttl) // cleanup process is running for a while already
+
+		initState := map[string]state{
+			"test::watermark": {
+				TTL:     ttl,
+				Updated: started.Add(-ttl),
+			},
+			"test::key": {
+				TTL:     ttl,
+				Updated: started.Add(-ttl),
+			},
+		}
+
+		backend := createSampleStore(t, initState)
+		store := testOpenStore(t, backend)
+		defer store.Release()
+		store.cleanupExclude = func(key string) bool { return key == "test::watermark" }
+
+		removed := gcStore(logp.NewLogger("test"), started, store)
+		require.Equal(t, 1, removed)
+
+		want := map[string]state{"test::watermark": initState["test::watermark"]}
+		checkEqualStoreState(t, want, backend.snapshot())
+	})
+
 	t.Run("old state is not removed if cleanup is not active long enough", func(t *testing.T) {
 		const ttl = 60 * time.Minute
 		started := time.Now()
@@ -146,4 +174,90 @@ func TestGCStore(t *testing.T) {
 		want := map[string]state{}
 		checkEqualStoreState(t, want, backend.snapshot())
 	})
+
+	t.Run("expired state is removed even if recently updated", func(t *testing.T) {
+		started := time.Now().Add(-time.Hour)
+
+		initState := map[string]state{
+			"test::expired": {
+				TTL:       time.Hour,
+				Updated:   time.Now(),
+				ExpiresAt: time.Now().Add(-time.Second),
+			},
+			"test::not-expired": {
+				TTL:       time.Hour,
+				Updated:   time.Now(),
+				ExpiresAt: time.Now().Add(time.Hour),
+			},
+		}
+
+		backend := createSampleStore(t, initState)
+		store := testOpenStore(t, backend)
+		defer store.Release()
+
+		removed := gcStore(logp.NewLogger("test"), started, store)
+		require.Equal(t, 1, removed)
+
+		want := map[string]state{"test::not-expired": initState["test::not-expired"]}
+		checkEqualStoreState(t, want, backend.snapshot())
+	})
+
+	t.Run("expired state is not removed while locked", func(t *testing.T) {
+		started := time.Now()
+
+		initState := map[string]state{
+			"test::key": {
+				TTL:       time.Hour,
+				Updated:   time.Now(),
+				ExpiresAt: time.Now().Add(-time.Second),
+			},
+		}
+
+		backend := createSampleStore(t, initState)
+		store := testOpenStore(t, backend)
+		defer store.Release()
+
+		res := store.Get("test::key")
+		gcStore(logp.NewLogger("test"), started, store)
+		checkEqualStoreState(t, initState, backend.snapshot())
+
+		res.Release()
+		gcStore(logp.NewLogger("test"), started, store)
+		checkEqualStoreState(t, map[string]state{}, backend.snapshot())
+	})
+}
+
+func TestCleanerTrigger(t *testing.T) {
+	backend := createSampleStore(t, nil)
+	store := testOpenStore(t, backend)
+	defer store.Release()
+
+	c := newCleaner(logp.NewLogger("test"), nil, nil)
+
+	// block the first pass while it is running
+	store.ephemeralStore.mu.Lock()
+	running := make(chan struct{})
+	go func() {
+		defer close(running)
+		c.runOnce(store)
+	}()
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.passes == 1
+	}, time.Second, time.Millisecond)
+
+	passed := c.trigger()
+	store.ephemeralStore.mu.Unlock()
+	<-running
+
+	select {
+	case <-passed:
+		t.Fatal("trigger must not be satisfied by a pass started before the request")
+	default:
+	}
+
+	<-c.requests
+	c.runOnce(store)
+	<-passed
 }
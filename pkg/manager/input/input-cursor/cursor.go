@@ -16,8 +16,8 @@ func makeCursor(store *store, res *resource) Cursor {
 }
 
 // IsNew returns true if no cursor information has been stored
-// for the current Source.
-func (c Cursor) IsNew() bool { return c.resource.IsNew() }
+// for the current Source. IsNew is always true for stateless sources.
+func (c Cursor) IsNew() bool { return c.resource == nil || c.resource.IsNew() }
 
 // Unpack deserialized the cursor state into to. Unpack fails if no pointer is
 // given, or if the structure to points to is not compatible with the document
@@ -53,6 +53,14 @@ func TestCursor_IsNew(t *testing.T) {
 		cursor := makeCursor(store, res)
 		require.False(t, cursor.IsNew())
 	})
+
+	t.Run("true for stateless source", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		cursor := makeCursor(store, nil)
+		require.True(t, cursor.IsNew())
+	})
 }
 
 func TestCursor_Unpack(t *testing.T) {
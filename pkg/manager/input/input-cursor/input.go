@@ -6,8 +6,12 @@ package cursor
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"runtime/debug"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/urso/sderr"
@@ -18,6 +22,9 @@ import (
 	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
 	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
 	"github.com/elastic/elastic-agent-inputs/pkg/publisher/acker"
+	"github.com/elastic/elastic-agent-inputs/pkg/statestore"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
 )
 
 // Input interface for cursor based inputs. This interface must be implemented
@@ -35,9 +42,47 @@ type Input interface {
 	// Run starts the data collection. Run must return an error only if the
 	// error is fatal making it impossible for the input to recover.
 	// The input run a go-routine can call Run per configured Source.
+	// The logger of the context is labeled with the `input_source` and
+	// `input_id`, and the context carries both as attributes, see
+	// input.Context.GoContext.
 	Run(input.Context, Source, Cursor, Publisher) error
 }
 
+// YieldingInput is implemented by inputs that can be collected by a worker
+// pool, see InputManager.WorkerPoolSize. Instead of collecting a source
+// until it is finished, the input collects a batch of events and yields, such
+// that the worker can collect other sources in the meantime.
+type YieldingInput interface {
+	Input
+
+	// Collect publishes at most batchLimit events from source, and returns.
+	// Collect must return done=true once the source is finished. Otherwise
+	// Collect is called again for the next batch, with a Cursor holding the
+	// state of the last event published. Collect must return an error only
+	// if the error is fatal, like Run.
+	Collect(ctx input.Context, source Source, cursor Cursor, pub Publisher, batchLimit int) (done bool, err error)
+}
+
+// SourceReporter is implemented by the input.Input instances returned by
+// InputManager.Create. It can be used to inspect the sources an input is
+// collecting from at runtime.
+type SourceReporter interface {
+	// ActiveSources returns the names of the sources that are currently
+	// being collected. Sources still waiting for their resource lock are not
+	// included.
+	ActiveSources() []string
+}
+
+// DuplicateReporter is implemented by the input.Input instances returned by
+// InputManager.Create. It reports sources that are not collected, because
+// they have been configured more than once.
+type DuplicateReporter interface {
+	// DuplicateSources returns the names of the sources that have been
+	// skipped, because another source with the same name was configured
+	// already.
+	DuplicateSources() []string
+}
+
 // managedInput implements the v2.Input interface, integrating cursor Inputs
 // with the v2 input API.
 // The managedInput starts go-routines per configured source.
@@ -47,18 +92,377 @@ type Input interface {
 type managedInput struct {
 	manager      *InputManager
 	userID       string
-	sources      []Source
 	input        Input
 	cleanTimeout time.Duration
+
+	// runMu protects sources, duplicateSources, and running, which are
+	// updated by Reload.
+	runMu            sync.Mutex
+	sources          []Source
+	duplicateSources []string
+	running          *inputRun
+
+	activeMu sync.Mutex
+	active   map[string]struct{}
+
+	// pauseMu protects the pause state. pauseCh is closed by Pause, and
+	// resumeCh is closed by Resume. Both are replaced once closed.
+	pauseMu  sync.Mutex
+	paused   bool
+	pauseCh  chan struct{}
+	resumeCh chan struct{}
+}
+
+// inputRun keeps track of the go-routines started by a call to Run.
+type inputRun struct {
+	ctx      input.Context
+	cancel   context.CancelFunc
+	pipeline publisher.PipelineConnector
+	grp      unison.MultiErrGroup
+
+	// active is the number of go-routines that have not returned yet.
+	active int
+
+	// workers holds the go-routines per source name. Go-routines that have
+	// returned are removed.
+	workers map[string]*sourceWorker
+
+	// pool collects the sources if InputManager.WorkerPoolSize is set. The
+	// errors of the sources collected by the pool are stored in errs.
+	pool *sourcePool
+	errs []error
 }
 
+type sourceWorker struct {
+	cancel context.CancelFunc
+}
+
+// Reloader is implemented by the input.Input instances returned by
+// InputManager.Create. It allows the set of sources to be updated without
+// restarting the input.
+type Reloader interface {
+	Reload(config *conf.C) error
+}
+
+// Pauser is implemented by the input.Input instances returned by
+// InputManager.Create. It allows collection to be stopped temporarily
+// without stopping the input.
+//
+// On Pause the context passed to Input.Run is cancelled for all sources, but
+// the sources keep their resource locks. Sources that are in the middle of a
+// read when paused are expected to return from Run like on shutdown. Events
+// published before Pause are still ACKed and their cursor updates are
+// persisted. Publishing after Pause fails, such that the events must be
+// collected again after Resume. Errors returned by Run after Pause are
+// ignored.
+// On Resume, Input.Run is called again for all sources, with a Cursor
+// holding the state of the last event published before Pause.
+// Sources starting while the input is paused acquire their resource lock and
+// wait for Resume.
+type Pauser interface {
+	Pause()
+	Resume()
+}
+
+// SourceStopper is implemented by the input.Input instances returned by
+// InputManager.Create. It allows a single source to be stopped, while the
+// other sources of the input keep running.
+type SourceStopper interface {
+	StopSource(name string) error
+}
+
+// CursorReporter is implemented by the input.Input instances returned by
+// InputManager.Create. It can be used to monitor the progress of each
+// source, e.g. to compute how far a source is behind.
+type CursorReporter interface {
+	// CursorSnapshot returns the cursor state of the last ACKed event per
+	// source name. If CursorFlushInterval is set, the cursor can be ahead of
+	// the value written to the persistent store, until the next flush.
+	// Sources without any cursor, and stateless sources, are not included.
+	// CursorSnapshot is safe to call while the input is running.
+	CursorSnapshot() map[string]interface{}
+}
+
+// CursorSeeker is implemented by the input.Input instances returned by
+// InputManager.Create. It allows the cursor of a source to be replaced, e.g.
+// to replay events from a checkpoint taken earlier.
+type CursorSeeker interface {
+	// SeekTo overwrites the persisted cursor of the named source. The next
+	// go-routine collecting the source starts from cursor. SeekTo fails if
+	// the source is not configured, is stateless, is currently being
+	// collected, or if cursor can not be serialized.
+	SeekTo(source string, cursor interface{}) error
+}
+
+// CursorTransactor is implemented by the input.Input instances returned by
+// InputManager.Create. It allows the cursors of multiple sources to be
+// replaced atomically.
+//
+// Isolation: the cursors are only written when the transaction is committed.
+// While committing, all sources updated in the transaction are locked, such
+// that a concurrent SeekTo, or a source being started, observes either none
+// or all of the updates. The commit fails without writing any cursor if one
+// of the sources has been started, or has cursor updates not yet written,
+// since it was updated in the transaction. Cursor updates published by
+// sources not part of the transaction are not affected.
+type CursorTransactor interface {
+	// WithTransaction calls fn with a new transaction. The cursors updated in
+	// the transaction are committed once fn returns. If fn returns an error,
+	// the transaction is rolled back and the error is returned.
+	// WithTransaction fails if the persistent store does not support batch
+	// writes.
+	WithTransaction(fn func(tx CursorTx) error) error
+}
+
+// CursorTx collects the cursor updates of a transaction started by
+// CursorTransactor.WithTransaction.
+type CursorTx interface {
+	// Update sets the cursor of the named source. Update fails if the source
+	// is not configured, is stateless, is currently being collected, or if
+	// cursor can not be serialized. Updating the same source twice replaces
+	// the cursor.
+	Update(source string, cursor interface{}) error
+}
+
+// cursorTx records the cursor updates of a transaction per source ID.
+type cursorTx struct {
+	inp     *managedInput
+	cursors map[string]interface{}
+	ttls    map[string]time.Duration
+	names   map[string]string
+}
+
+var (
+	_ SourceReporter    = (*managedInput)(nil)
+	_ DuplicateReporter = (*managedInput)(nil)
+	_ Reloader          = (*managedInput)(nil)
+	_ Pauser            = (*managedInput)(nil)
+	_ SourceStopper     = (*managedInput)(nil)
+	_ CursorReporter    = (*managedInput)(nil)
+	_ CursorSeeker      = (*managedInput)(nil)
+	_ CursorTransactor  = (*managedInput)(nil)
+)
+
 // Name is required to implement the v2.Input interface
 func (inp *managedInput) Name() string { return inp.input.Name() }
 
+// DuplicateSources returns the names of the sources that have been skipped,
+// because another source with the same name was configured already.
+func (inp *managedInput) DuplicateSources() []string {
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+	return inp.duplicateSources
+}
+
+// ActiveSources returns the sorted names of all sources that are currently
+// being collected.
+func (inp *managedInput) ActiveSources() []string {
+	inp.activeMu.Lock()
+	defer inp.activeMu.Unlock()
+
+	names := make([]string, 0, len(inp.active))
+	for name := range inp.active {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CursorSnapshot returns the ACKed cursor state of all configured sources.
+// Cursor updates that have not been ACKed yet are not included. ACKed updates
+// not yet flushed to the persistent store are included.
+func (inp *managedInput) CursorSnapshot() map[string]interface{} {
+	inp.runMu.Lock()
+	sources := inp.sources
+	inp.runMu.Unlock()
+
+	snapshot := map[string]interface{}{}
+	for _, source := range sources {
+		if isStateless(source) {
+			continue
+		}
+
+		res := inp.manager.store.ephemeralStore.Find(inp.createSourceID(source), false)
+		if res == nil {
+			continue
+		}
+		res.stateMutex.Lock()
+		cursor := res.cursor
+		res.stateMutex.Unlock()
+		res.Release()
+
+		if cursor != nil {
+			snapshot[source.Name()] = cursor
+		}
+	}
+	return snapshot
+}
+
+// SeekTo overwrites the persisted cursor of the named source, if the source
+// is not active. runMu is held while the cursor is written, such that the
+// source can not be started concurrently. The cursor is validated by
+// encoding it to JSON, like the persistent store does.
+func (inp *managedInput) SeekTo(name string, cursor interface{}) error {
+	if _, err := json.Marshal(cursor); err != nil {
+		return fmt.Errorf("cursor for source '%v' can not be serialized: %w", name, err)
+	}
+
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+
+	source, err := inp.seekableSource(name)
+	if err != nil {
+		return err
+	}
+	return inp.manager.store.Seek(inp.createSourceID(source), cursor, inp.sourceCleanTimeout(source))
+}
+
+// seekableSource returns the configured source with the given name, if its
+// cursor can be overwritten. runMu must be held.
+func (inp *managedInput) seekableSource(name string) (Source, error) {
+	var source Source
+	for _, s := range inp.sources {
+		if s.Name() == name {
+			source = s
+			break
+		}
+	}
+	if source == nil {
+		return nil, fmt.Errorf("source '%v' is not configured", name)
+	}
+	if isStateless(source) {
+		return nil, fmt.Errorf("source '%v' is stateless", name)
+	}
+	if run := inp.running; run != nil {
+		if _, active := run.workers[name]; active {
+			return nil, fmt.Errorf("source '%v' is active", name)
+		}
+	}
+	return source, nil
+}
+
+// WithTransaction calls fn with a new transaction, and writes all cursors
+// updated by fn in a single batch. runMu is held while the cursors are
+// written, such that no source can be started concurrently. The sources are
+// checked again on commit, as they might have been started or removed while
+// fn was running.
+func (inp *managedInput) WithTransaction(fn func(tx CursorTx) error) error {
+	if _, ok := inp.manager.store.persistentStore.(batchWriter); !ok {
+		return statestore.ErrBatchNotSupported
+	}
+
+	tx := &cursorTx{
+		inp:     inp,
+		cursors: map[string]interface{}{},
+		ttls:    map[string]time.Duration{},
+		names:   map[string]string{},
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.cursors) == 0 {
+		return nil
+	}
+
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+	for _, name := range tx.names {
+		if _, err := inp.seekableSource(name); err != nil {
+			return err
+		}
+	}
+	return inp.manager.store.SeekAll(tx.cursors, tx.ttls)
+}
+
+// Update records the cursor of the named source, to be written once the
+// transaction is committed.
+func (tx *cursorTx) Update(name string, cursor interface{}) error {
+	if _, err := json.Marshal(cursor); err != nil {
+		return fmt.Errorf("cursor for source '%v' can not be serialized: %w", name, err)
+	}
+
+	inp := tx.inp
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+
+	source, err := inp.seekableSource(name)
+	if err != nil {
+		return err
+	}
+	id := inp.createSourceID(source)
+	tx.cursors[id] = cursor
+	tx.ttls[id] = inp.sourceCleanTimeout(source)
+	tx.names[id] = name
+	return nil
+}
+
+func (inp *managedInput) markActive(source Source, active bool) {
+	inp.activeMu.Lock()
+	defer inp.activeMu.Unlock()
+
+	if !active {
+		delete(inp.active, source.Name())
+		return
+	}
+	if inp.active == nil {
+		inp.active = map[string]struct{}{}
+	}
+	inp.active[source.Name()] = struct{}{}
+}
+
+// Pause stops collection for all sources. Pause is a no-op if the input is
+// already paused.
+func (inp *managedInput) Pause() {
+	inp.pauseMu.Lock()
+	defer inp.pauseMu.Unlock()
+	inp.initPauseState()
+	if inp.paused {
+		return
+	}
+	inp.paused = true
+	close(inp.pauseCh)
+	inp.resumeCh = make(chan struct{})
+}
+
+// Resume continues collection for all sources. Resume is a no-op if the
+// input is not paused.
+func (inp *managedInput) Resume() {
+	inp.pauseMu.Lock()
+	defer inp.pauseMu.Unlock()
+	inp.initPauseState()
+	if !inp.paused {
+		return
+	}
+	inp.paused = false
+	close(inp.resumeCh)
+	inp.pauseCh = make(chan struct{})
+}
+
+// pauseState returns whether the input is paused, the channel closed by the
+// next Pause, and the channel closed by the next Resume.
+func (inp *managedInput) pauseState() (paused bool, pauseCh, resumeCh <-chan struct{}) {
+	inp.pauseMu.Lock()
+	defer inp.pauseMu.Unlock()
+	inp.initPauseState()
+	return inp.paused, inp.pauseCh, inp.resumeCh
+}
+
+// initPauseState creates the pause channels. pauseMu must be held.
+func (inp *managedInput) initPauseState() {
+	if inp.pauseCh == nil {
+		inp.pauseCh = make(chan struct{})
+		inp.resumeCh = make(chan struct{})
+	}
+}
+
 // Test runs the Test method for each configured source.
 func (inp *managedInput) Test(ctx input.TestContext) error {
+	inp.runMu.Lock()
+	sources := inp.sources
+	inp.runMu.Unlock()
+
 	var grp unison.MultiErrGroup
-	for _, source := range inp.sources {
+	for _, source := range sources {
 		source := source
 		grp.Go(func() (err error) {
 			return inp.testSource(ctx, source)
@@ -96,28 +500,190 @@ func (inp *managedInput) Run(
 	defer cancel()
 	ctx.Cancelation = cancelCtx
 
-	var grp unison.MultiErrGroup
+	run := &inputRun{
+		ctx:      ctx,
+		cancel:   cancel,
+		pipeline: pipeline,
+		workers:  map[string]*sourceWorker{},
+	}
+	if inp.manager.WorkerPoolSize > 0 {
+		run.pool = newSourcePool()
+	}
+
+	inp.runMu.Lock()
+	inp.running = run
 	for _, source := range inp.sources {
-		source := source
-		grp.Go(func() (err error) {
-			// refine per worker context
-			inpCtx := ctx
-			inpCtx.ID = ctx.ID + "::" + source.Name()
-			inpCtx.Logger = ctx.Logger.With("input_source", source.Name())
+		inp.startSource(run, source)
+	}
+	if run.pool != nil {
+		for i := 0; i < inp.manager.WorkerPoolSize; i++ {
+			run.grp.Go(func() error {
+				inp.runPoolWorker(run)
+				return nil
+			})
+		}
+	}
+	inp.runMu.Unlock()
 
-			if err = inp.runSource(inpCtx, inp.manager.store, source, pipeline); err != nil {
-				cancel()
-			}
-			return err
-		})
+	errs := run.grp.Wait()
+
+	inp.runMu.Lock()
+	if inp.running == run {
+		inp.running = nil
 	}
+	errs = append(errs, run.errs...)
+	inp.runMu.Unlock()
 
-	if errs := grp.Wait(); len(errs) > 0 {
+	if len(errs) > 0 {
 		return sderr.WrapAll(errs, "input %{id} failed", ctx.ID)
 	}
 	return nil
 }
 
+// startSource starts the go-routine collecting source, or adds the source to
+// the worker pool of run. runMu must be held by the caller.
+func (inp *managedInput) startSource(run *inputRun, source Source) {
+	name := source.Name()
+
+	// refine per worker context
+	inpCtx := run.ctx
+	inpCtx.ID = run.ctx.ID + "::" + name
+	inpCtx.Logger = run.ctx.Logger.With("input_source", name, "input_id", run.ctx.ID)
+	sourceCtx, cancel := context.WithCancel(ctxtool.FromCanceller(run.ctx.Cancelation))
+	inpCtx.Cancelation = input.WithAttributes(sourceCtx, run.ctx.ID, name)
+
+	worker := &sourceWorker{cancel: cancel}
+	run.workers[name] = worker
+	run.active++
+
+	if run.pool != nil {
+		run.pool.add(&poolTask{
+			source:  source,
+			ctx:     inpCtx,
+			worker:  worker,
+			backoff: inp.manager.panicBackoff(),
+		})
+		return
+	}
+
+	run.grp.Go(func() (err error) {
+		defer cancel()
+
+		if fn := inp.manager.OnSourceStart; fn != nil {
+			fn(source)
+		}
+		if fn := inp.manager.OnSourceStop; fn != nil {
+			defer func() { fn(source, err) }()
+		}
+
+		err = inp.runSource(inpCtx, inp.manager.store, source, run.pipeline)
+		return inp.sourceStopped(run, name, worker, err)
+	})
+}
+
+// sourceStopped removes the worker of the named source from run, once the
+// source has been stopped with err. The error is returned, unless the
+// source has been removed by Reload or StopSource already.
+func (inp *managedInput) sourceStopped(run *inputRun, name string, worker *sourceWorker, err error) error {
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+	run.active--
+	if run.workers[name] != worker {
+		// the source has been removed by Reload or StopSource
+		return nil
+	}
+	delete(run.workers, name)
+
+	// Sources that timed out waiting for their lock are skipped,
+	// without stopping the other sources.
+	if err != nil && !errors.Is(err, ErrLockTimeout) {
+		run.cancel()
+	}
+	return err
+}
+
+// Reload updates the sources of the input by running the InputManager's
+// Configure function with config. If the input is running, go-routines for
+// sources that are not configured anymore are stopped, and go-routines for new
+// sources are started. Sources configured before and after the reload are not
+// interrupted and keep their resource lock.
+// Only the set of sources is updated. The input runner and clean_timeout
+// setting from the initial configuration are kept. Reload fails if the
+// input id has been changed.
+func (inp *managedInput) Reload(config *conf.C) error {
+	settings, sources, _, err := inp.manager.configure(config)
+	if err != nil {
+		return err
+	}
+	if settings.ID != inp.userID {
+		return fmt.Errorf("input id can not be changed from '%v' to '%v' on reload", inp.userID, settings.ID)
+	}
+
+	sources, duplicates := dedupSources(sources)
+	if len(duplicates) > 0 {
+		inp.manager.Logger.With("input_type", inp.manager.Type).Warnf(
+			"Input configures sources with the same name multiple times, duplicates will be skipped: %v", duplicates)
+	}
+
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+
+	old := make(map[string]struct{}, len(inp.sources))
+	for _, source := range inp.sources {
+		old[source.Name()] = struct{}{}
+	}
+	configured := make(map[string]struct{}, len(sources))
+	for _, source := range sources {
+		configured[source.Name()] = struct{}{}
+	}
+	inp.sources = sources
+	inp.duplicateSources = duplicates
+
+	// No new go-routines can be added to the run once all go-routines have
+	// returned. The new sources are collected on the next call to Run.
+	run := inp.running
+	if run == nil || run.active == 0 {
+		return nil
+	}
+
+	for name, worker := range run.workers {
+		if _, exists := configured[name]; !exists {
+			delete(run.workers, name)
+			worker.cancel()
+		}
+	}
+	for _, source := range sources {
+		if _, exists := old[source.Name()]; !exists {
+			inp.startSource(run, source)
+		}
+	}
+	return nil
+}
+
+// StopSource cancels the go-routine collecting the named source. The
+// resource lock of the source is released once Input.Run has returned.
+// Errors returned by the stopped source are ignored, and the other sources
+// keep running. An error is returned if the input is not running, or if no
+// go-routine is collecting the source.
+// The source stays configured, and is collected again on the next call to
+// Run.
+func (inp *managedInput) StopSource(name string) error {
+	inp.runMu.Lock()
+	defer inp.runMu.Unlock()
+
+	run := inp.running
+	if run == nil {
+		return fmt.Errorf("source '%v' is not active, input is not running", name)
+	}
+	worker, exists := run.workers[name]
+	if !exists {
+		return fmt.Errorf("source '%v' is not active", name)
+	}
+	delete(run.workers, name)
+	worker.cancel()
+	return nil
+}
+
 func (inp *managedInput) runSource(
 	ctx input.Context,
 	store *store,
@@ -131,34 +697,228 @@ func (inp *managedInput) runSource(
 		}
 	}()
 
-	client, err := pipeline.ConnectWith(publisher.ClientConfig{
-		CloseRef:   ctx.Cancelation,
-		ACKHandler: newInputACKHandler(),
-	})
+	client, cursor, closeSource, err := inp.openSource(ctx, store, source, pipeline, true)
 	if err != nil {
 		return err
 	}
-	defer client.Close()
+	defer closeSource()
+
+	restarts := 0
+	backoff := inp.manager.panicBackoff()
+	for {
+		paused, pauseCh, resumeCh := inp.pauseState()
+		if paused {
+			select {
+			case <-resumeCh:
+				continue
+			case <-ctx.Cancelation.Done():
+				return nil
+			}
+		}
+
+		wasPaused, err := inp.runInput(ctx, source, cursor, client, pauseCh)
+		if wasPaused {
+			continue
+		}
+
+		var panicErr *sourcePanicError
+		if !errors.As(err, &panicErr) {
+			return err
+		}
+		ctx.Logger.Errorf("Input crashed with: %+v", err)
+		if inp.manager.OnPanic != nil {
+			inp.manager.OnPanic(source, panicErr.value)
+		}
+		if restarts >= inp.manager.maxPanicRestarts() {
+			return fmt.Errorf("source has been restarted %v times after panics: %w", restarts, err)
+		}
+		restarts++
+
+		ctx.Logger.Infof("Restarting source in %v (restart %v of %v)", backoff, restarts, inp.manager.maxPanicRestarts())
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Cancelation.Done():
+			timer.Stop()
+			return nil
+		}
+		backoff *= 2
+	}
+}
+
+// openSource prepares the collection of source. It waits for a source slot
+// if holdSlot is set, connects the client, locks the resource of stateful
+// sources, and marks the source as active. The returned function undoes these
+// steps in reverse order, and must be called once the source has been
+// collected. The worker pool does not hold the slot while a source is opened,
+// but acquires it per batch.
+func (inp *managedInput) openSource(
+	ctx input.Context,
+	store *store,
+	source Source,
+	pipeline publisher.PipelineConnector,
+	holdSlot bool,
+) (publisher.Client, Cursor, func(), error) {
+	var closers []func()
+	closeAll := func() {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}
+	opened := false
+	defer func() {
+		if !opened {
+			closeAll()
+		}
+	}()
 
-	resourceKey := inp.createSourceID(source)
-	resource, err := inp.manager.lock(ctx, resourceKey)
+	if holdSlot {
+		if err := inp.manager.acquireSourceSlot(ctx.Logger, ctx.Cancelation, source); err != nil {
+			return nil, Cursor{}, nil, err
+		}
+		closers = append(closers, inp.manager.releaseSourceSlot)
+	}
+
+	conn, err := pipeline.ConnectWith(inp.clientConfig(ctx, source))
 	if err != nil {
-		return err
+		return nil, Cursor{}, nil, err
+	}
+	closers = append(closers, func() { conn.Close() })
+
+	cursor := makeCursor(store, nil)
+	if !isStateless(source) {
+		resourceKey := inp.createSourceID(source)
+		resource, err := inp.manager.lock(ctx, resourceKey)
+		if err != nil {
+			return nil, Cursor{}, nil, err
+		}
+		closers = append(closers, func() { releaseResource(resource) })
+
+		store.UpdateTTL(resource, inp.sourceCleanTimeout(source))
+		cursor = makeCursor(store, resource)
 	}
-	defer releaseResource(resource)
 
-	store.UpdateTTL(resource, inp.cleanTimeout)
+	metrics := inp.manager.metrics()
+	metrics.SourceActive(1)
+	closers = append(closers, func() { metrics.SourceActive(-1) })
+
+	inp.markActive(source, true)
+	closers = append(closers, func() { inp.markActive(source, false) })
+
+	opened = true
+	return conn, cursor, closeAll, nil
+}
+
+// sourcePanicError is returned by runInput if Input.Run has panicked and
+// RecoverPanics is set.
+type sourcePanicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *sourcePanicError) Error() string {
+	return fmt.Sprintf("input panic with: %+v\n%s", e.value, e.stack)
+}
 
-	cursor := makeCursor(store, resource)
-	p := &cursorPublisher{canceler: ctx.Cancelation, client: client, cursor: &cursor}
+// callRun calls Input.Run. Panics are returned as sourcePanicError if
+// RecoverPanics is set.
+func (inp *managedInput) callRun(ctx input.Context, source Source, cursor Cursor, p Publisher) (err error) {
+	if inp.manager.RecoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				err = &sourcePanicError{value: v, stack: debug.Stack()}
+			}
+		}()
+	}
 	return inp.input.Run(ctx, source, cursor, p)
 }
 
-func (inp *managedInput) createSourceID(s Source) string {
-	if inp.userID != "" {
-		return fmt.Sprintf("%v::%v::%v", inp.manager.Type, inp.userID, s.Name())
+// runInput runs the input for source until Run returns. The context passed
+// to Run is cancelled if pauseCh is closed. runInput reports whether Run has
+// returned due to the input being paused.
+func (inp *managedInput) runInput(
+	ctx input.Context,
+	source Source,
+	cursor Cursor,
+	client publisher.Client,
+	pauseCh <-chan struct{},
+) (paused bool, err error) {
+	runCtx, cancel := context.WithCancel(ctxtool.FromCanceller(ctx.Cancelation))
+	defer cancel()
+	go func() {
+		select {
+		case <-pauseCh:
+			cancel()
+		case <-runCtx.Done():
+		}
+	}()
+
+	inpCtx := ctx
+	inpCtx.Cancelation = runCtx
+	p := &cursorPublisher{canceler: runCtx, client: client, cursor: &cursor}
+	err = inp.callRun(inpCtx, source, cursor, p)
+
+	select {
+	case <-pauseCh:
+		return ctx.Cancelation.Err() == nil, nil
+	default:
+		return false, err
 	}
-	return fmt.Sprintf("%v::%v", inp.manager.Type, s.Name())
+}
+
+// clientConfig returns the ClientConfig for the client of source. The
+// configuration of sources implementing ClientSource is used as base.
+func (inp *managedInput) clientConfig(ctx input.Context, source Source) publisher.ClientConfig {
+	var cfg publisher.ClientConfig
+	if cs, ok := source.(ClientSource); ok {
+		cfg = cs.ClientConfig()
+	}
+
+	cfg.Context = ctxtool.FromCanceller(ctx.Cancelation)
+	cfg.CloseRef = nil
+	if cfg.ACKHandler == nil {
+		cfg.ACKHandler = newInputACKHandler()
+	} else {
+		cfg.ACKHandler = acker.Combine(newInputACKHandler(), cfg.ACKHandler)
+	}
+	cfg.Processing = inp.processingConfig(cfg.Processing)
+	return cfg
+}
+
+// processingConfig returns cfg with the input ID added to the fields, if
+// InjectInputID is set. The fields of cfg are not modified.
+func (inp *managedInput) processingConfig(cfg publisher.ProcessingConfig) publisher.ProcessingConfig {
+	if inp.manager.InjectInputID && inp.userID != "" {
+		if cfg.Fields == nil {
+			cfg.Fields = mapstr.M{}
+		} else {
+			cfg.Fields = cfg.Fields.Clone()
+		}
+		_, _ = cfg.Fields.Put(inp.manager.inputIDField(), inp.userID)
+	}
+	return cfg
+}
+
+// sourceCleanTimeout returns the clean timeout for source. The input its clean
+// timeout is used, unless the source implements TimedSource.
+func (inp *managedInput) sourceCleanTimeout(source Source) time.Duration {
+	if ts, ok := source.(TimedSource); ok {
+		if timeout := ts.CleanTimeout(); timeout > 0 {
+			return timeout
+		}
+	}
+	return inp.cleanTimeout
+}
+
+// isStateless returns true if source implements StatelessSource and has
+// opted out of state persistence.
+func isStateless(source Source) bool {
+	ss, ok := source.(StatelessSource)
+	return ok && ss.Stateless()
+}
+
+func (inp *managedInput) createSourceID(s Source) string {
+	return inp.manager.formatKey(inp.userID, s.Name())
 }
 
 func newInputACKHandler() publisher.ACKer {
@@ -6,15 +6,22 @@ package cursor
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/urso/sderr"
 
+	"github.com/elastic/go-concert/ctxtool"
+	"github.com/elastic/go-concert/timed"
 	"github.com/elastic/go-concert/unison"
 
 	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
 	"github.com/elastic/elastic-agent-inputs/pkg/statestore"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -32,7 +39,9 @@ import (
 // The Type field is used to create the key name in the persistent store. Users
 // are allowed to add a custome per input configuration ID using the `id`
 // setting, to collect the same source multiple times, but with different
-// state. The key name in the persistent store becomes <Type>-[<ID>]-<Source Name>
+// state. The key name in the persistent store becomes <Type>::<ID>::<Source Name>,
+// or <Type>::<Source Name> if no ID is configured, unless a custom
+// KeyFormatter is configured.
 type InputManager struct {
 	Logger *logp.Logger
 
@@ -51,9 +60,180 @@ type InputManager struct {
 	// that will be used to collect events from each source.
 	Configure func(cfg *conf.C) ([]Source, Input, error)
 
-	initOnce sync.Once
-	initErr  error
-	store    *store
+	// StateVersion is the version of the cursor state format. The version is
+	// persisted with the state of each source.
+	StateVersion int
+
+	// MigrateState converts the JSON encoded cursor of a source from an older
+	// state version to the format of StateVersion. MigrateState is called
+	// once per key, when the state is loaded from the persistent store, if
+	// the persisted version differs from StateVersion.
+	// If MigrateState returns an error, the cursor of the key is ignored and
+	// the input will start collecting from the beginning of the source. The
+	// input is not failed. The key is kept, such that it is removed by the
+	// cleaner once its clean_timeout has expired, unless the source is
+	// collected again.
+	// If MigrateState is nil, the persisted state is assumed to be compatible
+	// with the current version.
+	MigrateState func(oldVersion int, raw []byte) ([]byte, error)
+
+	// MaxConcurrentSources limits the number of sources collected
+	// concurrently by all inputs created by the InputManager. Sources beyond
+	// the limit wait for a slot to become available. No limit is applied if
+	// MaxConcurrentSources is <= 0.
+	MaxConcurrentSources int
+
+	// WorkerPoolSize runs the sources of each input on a fixed number of
+	// worker go-routines, instead of a go-routine per source. The Input
+	// returned by Configure must implement YieldingInput. A worker picks up
+	// the next ready source, collects a batch of events via Collect, and puts
+	// the source back into the queue of ready sources. Sources keep their
+	// client and resource lock in between batches. Sources waiting for their
+	// resource lock, or for a slot if MaxConcurrentSources is set, block the
+	// worker.
+	// If the input is paused, sources finish their current batch, and are not
+	// collected until the input is resumed. Sources are collected via
+	// Input.Run if WorkerPoolSize is <= 0.
+	WorkerPoolSize int
+
+	// WorkerBatchLimit is the batch limit passed to YieldingInput.Collect, if
+	// WorkerPoolSize is set. It defaults to 1024.
+	WorkerBatchLimit int
+
+	// OnSourceStart is called by the go-routine collecting a source, when
+	// the go-routine is started.
+	OnSourceStart func(Source)
+
+	// OnSourceStop is called by the go-routine collecting a source, when
+	// the go-routine is about to return. The error that stopped the
+	// source is passed to OnSourceStop. The error is nil if the source has
+	// finished without error. OnSourceStop is also called if the source has
+	// been stopped due to the input being cancelled.
+	OnSourceStop func(Source, error)
+
+	// Metrics receives updates about the number of active and blocked
+	// sources, and about store cleanup runs. Metrics is optional.
+	Metrics ManagerMetrics
+
+	// DrainTimeout configures how long the InputManager waits on shutdown
+	// for pending cursor updates to be written to the persistent store,
+	// before the store is closed. Pending updates are written once the
+	// associated events have been ACKed. No drain phase is run if
+	// DrainTimeout is <= 0.
+	DrainTimeout time.Duration
+
+	// LockTimeout limits how long a source waits for its resource lock, if
+	// the resource is in use by another input. The source is skipped with
+	// ErrLockTimeout if the lock can not be acquired in time. Other sources
+	// of the input continue to run. Sources wait until the input is stopped
+	// if LockTimeout is <= 0.
+	LockTimeout time.Duration
+
+	// SnapshotInterval configures how often a full snapshot of the state of
+	// all keys is written via SnapshotWriter. Snapshots use the same JSON
+	// format as ExportState. No snapshots are written if SnapshotInterval is
+	// <= 0 or SnapshotWriter is nil.
+	SnapshotInterval time.Duration
+
+	// SnapshotWriter is called for each snapshot and returns the writer the
+	// snapshot is written to. The writer is closed after the snapshot has
+	// been written.
+	SnapshotWriter func() (io.WriteCloser, error)
+
+	// SourcePriority assigns a priority to sources waiting for a slot, if
+	// MaxConcurrentSources is set. Once a slot becomes available, it is
+	// assigned to the waiting source with the highest priority. Sources with
+	// equal priority get slots in the order they started waiting (FIFO). All
+	// sources have the priority 0 if SourcePriority is nil.
+	SourcePriority func(Source) int
+
+	// InjectInputID adds the input id configured via the `id` setting to all
+	// events published by the input, using ProcessingConfig.Fields. No field
+	// is added if the input has no id.
+	InjectInputID bool
+
+	// InputIDField is the field the input id is written to if InjectInputID
+	// is set. It defaults to `input.id`.
+	InputIDField string
+
+	// KeyFormatter creates the key name in the persistent store from the
+	// input Type, the input ID (empty if not configured), and the source
+	// name. DefaultKeyFormatter is used if KeyFormatter is nil.
+	// Only keys starting with `<Type>::` are read from the persistent store
+	// on startup, and considered by the cleaner. Create and Validate fail if
+	// the formatter returns a key without this prefix. Changing the formatter
+	// changes the keys of existing states, such that the states must be
+	// migrated to the new keys, e.g. using ExportState and ImportState.
+	KeyFormatter func(typ, id, source string) string
+
+	// EagerStoreCheck opens the persistent store in Init, even if the mode is
+	// not input.ModeRun. Errors accessing the store are returned by Init,
+	// instead of by Create. No background tasks are started in modes other
+	// than input.ModeRun.
+	EagerStoreCheck bool
+
+	// RecoverPanics restarts a source if Input.Run panics, instead of
+	// stopping the source with an error. The panic and its stack trace are
+	// logged, and OnPanic is called. The source is restarted after
+	// PanicBackoff, keeping its resource lock and client. The backoff is
+	// doubled for each restart. The source is stopped with an error once it
+	// has been restarted MaxPanicRestarts times.
+	RecoverPanics bool
+
+	// OnPanic is called with the source and the value passed to panic, if
+	// RecoverPanics is set.
+	OnPanic func(Source, interface{})
+
+	// MaxPanicRestarts limits the number of restarts per source if
+	// RecoverPanics is set. It defaults to 3.
+	MaxPanicRestarts int
+
+	// PanicBackoff is the wait time before the first restart of a source
+	// that has panicked. It defaults to 1s.
+	PanicBackoff time.Duration
+
+	// CursorFlushInterval is the minimum interval between two writes of the
+	// cursor of a source to the persistent store. Cursor updates ACKed
+	// within the interval are coalesced into a single write. The in memory
+	// cursor, as seen by inputs and CursorSnapshot, is always up to date;
+	// only the persistence is throttled. Deferred writes are flushed when
+	// the manager shuts down. If the process crashes, cursor updates ACKed
+	// within the last interval are lost, such that the events are collected
+	// again after restart. Cursor writes are not throttled if
+	// CursorFlushInterval is 0.
+	CursorFlushInterval time.Duration
+
+	// CleanupExclude reports keys the cleaner must never remove, e.g. a
+	// global watermark that must survive periods without updates. Keys for
+	// which CleanupExclude returns true are kept, even if their clean_timeout
+	// or expiry time has passed. Compact does not remove excluded keys either.
+	// Excluded keys can still be removed explicitly, e.g. by deleting them
+	// from the registry while the InputManager is not running.
+	CleanupExclude func(key string) bool
+
+	// OnStateRead is called with the key and the current cursor whenever the
+	// state of a key is accessed, e.g. when a source is started. The cursor
+	// is nil for keys without state.
+	//
+	// OnStateWrite is called with the key and the cursor whenever a cursor is
+	// written to the persistent store, e.g. after events have been ACKed.
+	//
+	// Both hooks are meant for debugging. They are called synchronously while
+	// the state of the key is locked, and must not block or call into the
+	// InputManager. The cursor must not be modified.
+	OnStateRead  func(key string, cursor interface{})
+	OnStateWrite func(key string, cursor interface{})
+
+	initOnce     sync.Once
+	initErr      error
+	store        *store
+	loadedStates int
+	sourceSlots  *sourceSlots
+	cleanerStats cleanerStats
+	cleaner      *cleaner // set by Init in input.ModeRun
+
+	compactMu      sync.Mutex // serializes Compact calls
+	lastCompaction CompactionStats
 }
 
 // Source describe a source the input can collect data from.
@@ -63,6 +243,184 @@ type Source interface {
 	Name() string
 }
 
+// namedSource is the Source returned by StringSource.
+type namedSource string
+
+func (s namedSource) Name() string { return string(s) }
+
+// StringSource returns a Source identified by name only, for inputs that do
+// not need any other information about their sources.
+func StringSource(name string) Source { return namedSource(name) }
+
+// StringSources returns a Source per name, see StringSource.
+func StringSources(names ...string) []Source {
+	sources := make([]Source, len(names))
+	for i, name := range names {
+		sources[i] = StringSource(name)
+	}
+	return sources
+}
+
+// TimedSource can be implemented by a Source to override the clean_timeout
+// setting of the input for the source's state. If CleanTimeout returns a
+// value <= 0, the clean_timeout setting is used.
+type TimedSource interface {
+	Source
+	CleanTimeout() time.Duration
+}
+
+// PartitionedSource can be implemented by a Source that contains multiple
+// sub-streams, each requiring its own cursor. The InputManager collects each
+// partition as a separate SourcePartition, with its own key and lock in the
+// persistent store. The partition is named <Source Name>::<Partition>, such
+// that DefaultKeyFormatter creates the key <Type>::<ID>::<Source Name>::<Partition>,
+// or <Type>::<Source Name>::<Partition> if the input has no ID.
+// Partitions is called when the input is configured or reloaded. The input
+// fails to be configured if the name of a partition collides with the name of
+// another source, e.g. partition 'p' of source 'a' and a source named 'a::p'.
+type PartitionedSource interface {
+	Source
+	Partitions() []string
+}
+
+// SourcePartition is passed to Input.Test and Input.Run for each partition
+// of a PartitionedSource. CleanTimeout, Stateless, and ClientConfig are
+// forwarded to Source, if Source implements TimedSource, StatelessSource, or
+// ClientSource.
+type SourcePartition struct {
+	Source    Source
+	Partition string
+}
+
+var (
+	_ TimedSource     = SourcePartition{}
+	_ StatelessSource = SourcePartition{}
+	_ ClientSource    = SourcePartition{}
+)
+
+// Name returns the name of the source and partition, separated by '::'.
+func (p SourcePartition) Name() string { return p.Source.Name() + "::" + p.Partition }
+
+func (p SourcePartition) CleanTimeout() time.Duration {
+	if ts, ok := p.Source.(TimedSource); ok {
+		return ts.CleanTimeout()
+	}
+	return 0
+}
+
+func (p SourcePartition) Stateless() bool { return isStateless(p.Source) }
+
+func (p SourcePartition) ClientConfig() publisher.ClientConfig {
+	if cs, ok := p.Source.(ClientSource); ok {
+		return cs.ClientConfig()
+	}
+	return publisher.ClientConfig{}
+}
+
+// expandPartitions replaces each PartitionedSource with the SourcePartitions
+// of its partitions. An error is returned if the name of a partition collides
+// with the name of another source, or with a partition of another source.
+// Sources configured more than once are not reported, but are removed by
+// dedupSources later.
+func expandPartitions(sources []Source) ([]Source, error) {
+	// origins stores the PartitionedSource name per partition name. Sources
+	// without partitions are stored with partitioned set to false.
+	type origin struct {
+		partitioned bool
+		source      string
+	}
+	origins := map[string]origin{}
+	add := func(name string, origin origin) error {
+		if other, exists := origins[name]; exists && other != origin {
+			return fmt.Errorf("source name '%v' collides with a partition of another source", name)
+		}
+		origins[name] = origin
+		return nil
+	}
+
+	expanded := make([]Source, 0, len(sources))
+	for _, source := range sources {
+		ps, ok := source.(PartitionedSource)
+		if !ok {
+			if err := add(source.Name(), origin{}); err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, source)
+			continue
+		}
+		for _, partition := range ps.Partitions() {
+			sp := SourcePartition{Source: source, Partition: partition}
+			if err := add(sp.Name(), origin{partitioned: true, source: source.Name()}); err != nil {
+				return nil, err
+			}
+			expanded = append(expanded, sp)
+		}
+	}
+	return expanded, nil
+}
+
+// ManagerMetrics is used by the InputManager to report the state of the
+// sources and of the store cleanup process. Implementations must be safe for
+// concurrent use.
+type ManagerMetrics interface {
+	// SourceActive is called with delta 1 when a source has acquired its
+	// resource lock and starts collecting, and with delta -1 once the source
+	// is done.
+	SourceActive(delta int)
+
+	// SourceBlocked is called with delta 1 when a source has to wait for its
+	// resource lock, because the resource is in use by another input. It is
+	// called with delta -1 once waiting ends.
+	SourceBlocked(delta int)
+
+	// CleanupRun is called after each run of the store cleaner, with the
+	// number of keys that have been removed.
+	CleanupRun(keys int)
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) SourceActive(int)  {}
+func (nopMetrics) SourceBlocked(int) {}
+func (nopMetrics) CleanupRun(int)    {}
+
+// StatelessSource can be implemented by a Source that has no meaningful
+// cursor. If Stateless returns true, the InputManager does not create or lock
+// any state in the persistent store for the source. The Cursor passed to the
+// input is always new, and cursor updates passed to Publish are ignored.
+type StatelessSource interface {
+	Source
+	Stateless() bool
+}
+
+// ClientSource can be implemented by a Source to configure the pipeline
+// client its events are published with, e.g. to use another PublishMode or
+// other processors than the other sources of the input. Sources that do not
+// implement ClientSource use an empty ClientConfig, such that the pipeline
+// defaults apply.
+//
+// The client is closed by the InputManager, so Context and CloseRef are
+// ignored. The ACKHandler is combined with the ACKer of the InputManager,
+// which persists cursor updates. If InjectInputID is set, the input ID is
+// added to Processing.Fields.
+type ClientSource interface {
+	Source
+	ClientConfig() publisher.ClientConfig
+}
+
+// ErrLockTimeout is returned for a source if its resource lock could not be
+// acquired within the configured LockTimeout.
+var ErrLockTimeout = errors.New("timeout while waiting for resource lock")
+
+const defaultInputIDField = "input.id"
+
+const (
+	defaultMaxPanicRestarts = 3
+	defaultPanicBackoff     = time.Second
+
+	defaultWorkerBatchLimit = 1024
+)
+
 var (
 	errNoSourceConfigured = errors.New("no source has been configured")
 	errNoInputRunner      = errors.New("no input runner available")
@@ -70,10 +428,35 @@ var (
 
 // StateStore interface and configurations used to give the Manager access to the persistent store.
 type StateStore interface {
-	Access() (*statestore.Store, error)
+	Access() (PersistentStore, error)
 	CleanupInterval() time.Duration
 }
 
+// PersistentStore is the key value store the InputManager persists the
+// state of all sources in. All keys written by the InputManager are prefixed
+// with the InputManager its Type. *statestore.Store implements
+// PersistentStore.
+//
+// The InputManager keeps an in-memory copy of the state, and reads all keys
+// only once when the store is opened. Store operations are serialized per
+// key, but operations on different keys can be executed concurrently.
+type PersistentStore interface {
+	// Each iterates over all key value pairs in the store. The iteration
+	// stops if fn returns false or an error.
+	Each(fn func(string, statestore.ValueDecoder) (bool, error)) error
+
+	// Set inserts or overwrites the value for key.
+	Set(key string, from interface{}) error
+
+	// Remove removes key from the store. Remove must not fail if key is unknown.
+	Remove(key string) error
+
+	// Close is called once the InputManager does not access the store anymore.
+	Close() error
+}
+
+var _ PersistentStore = (*statestore.Store)(nil)
+
 func (cim *InputManager) init() error {
 	cim.initOnce.Do(func() {
 		if cim.DefaultCleanTimeout <= 0 {
@@ -81,13 +464,23 @@ func (cim *InputManager) init() error {
 		}
 
 		log := cim.Logger.With("input_type", cim.Type)
+		start := time.Now()
 		var store *store
-		store, cim.initErr = openStore(log, cim.StateStore, cim.Type)
+		store, cim.initErr = openStore(log, cim.StateStore, cim.Type, cim.StateVersion, cim.MigrateState)
 		if cim.initErr != nil {
 			return
 		}
+		cim.loadedStates = len(store.ephemeralStore.table)
+		log.Infof("State store loaded: %v states read in %v", cim.loadedStates, time.Since(start))
 
+		store.flushInterval = cim.CursorFlushInterval
+		store.onRead = cim.OnStateRead
+		store.onWrite = cim.OnStateWrite
+		store.cleanupExclude = cim.CleanupExclude
 		cim.store = store
+		if cim.MaxConcurrentSources > 0 {
+			cim.sourceSlots = newSourceSlots(cim.MaxConcurrentSources)
+		}
 	})
 
 	return cim.initErr
@@ -97,6 +490,9 @@ func (cim *InputManager) init() error {
 // persistent store if mode is ModeRun.
 func (cim *InputManager) Init(group unison.Group, mode input.Mode) error {
 	if mode != input.ModeRun {
+		if cim.EagerStoreCheck {
+			return cim.init()
+		}
 		return nil
 	}
 
@@ -107,11 +503,13 @@ func (cim *InputManager) Init(group unison.Group, mode input.Mode) error {
 	log := cim.Logger.With("input_type", cim.Type)
 
 	store := cim.store
-	cleaner := &cleaner{log: log}
+	cleaner := newCleaner(log, cim.metrics(), &cim.cleanerStats)
+	cim.cleaner = cleaner
 	store.Retain()
 	err := group.Go(func(canceler context.Context) error {
 		defer cim.shutdown()
 		defer store.Release()
+		defer cim.drain(log, store)
 		interval := cim.StateStore.CleanupInterval()
 		if interval <= 0 {
 			interval = 5 * time.Minute
@@ -125,53 +523,367 @@ func (cim *InputManager) Init(group unison.Group, mode input.Mode) error {
 		return sderr.Wrap(err, "Can not start registry cleanup process")
 	}
 
+	if cim.SnapshotInterval > 0 && cim.SnapshotWriter != nil {
+		store.Retain()
+		err := group.Go(func(canceler context.Context) error {
+			defer store.Release()
+			_ = timed.Periodic(canceler, cim.SnapshotInterval, func() error {
+				cim.snapshot(log, store)
+				return nil
+			})
+			return nil
+		})
+		if err != nil {
+			store.Release()
+			return sderr.Wrap(err, "Can not start registry snapshot process")
+		}
+	}
+
 	return nil
 }
 
+// snapshot writes the state of all keys to a new writer created by
+// SnapshotWriter. The in memory store is only locked while the states are
+// copied, such that cursor updates are not blocked while the snapshot is
+// encoded and written.
+func (cim *InputManager) snapshot(log *logp.Logger, store *store) {
+	start := time.Now()
+	states := store.Export()
+
+	w, err := cim.SnapshotWriter()
+	if err != nil {
+		log.Errorf("Failed to create state snapshot writer: %v", err)
+		return
+	}
+
+	counter := &countingWriter{w: w}
+	err = json.NewEncoder(counter).Encode(states)
+	if closeErr := w.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Errorf("Failed to write state snapshot: %v", err)
+		return
+	}
+	log.Infof("Wrote state snapshot of %v keys (%v bytes) in %v",
+		len(states), counter.n, time.Since(start))
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// CleanerStats returns the progress of the store cleanup process. The
+// cleanup process is started by Init in input.ModeRun.
+func (cim *InputManager) CleanerStats() CleanerStats {
+	return cim.cleanerStats.get()
+}
+
+// metrics returns the configured ManagerMetrics, or a no-op implementation if
+// Metrics is not set.
+func (cim *InputManager) metrics() ManagerMetrics {
+	if cim.Metrics == nil {
+		return nopMetrics{}
+	}
+	return cim.Metrics
+}
+
+func (cim *InputManager) maxPanicRestarts() int {
+	if cim.MaxPanicRestarts > 0 {
+		return cim.MaxPanicRestarts
+	}
+	return defaultMaxPanicRestarts
+}
+
+func (cim *InputManager) panicBackoff() time.Duration {
+	if cim.PanicBackoff > 0 {
+		return cim.PanicBackoff
+	}
+	return defaultPanicBackoff
+}
+
+func (cim *InputManager) workerBatchLimit() int {
+	if cim.WorkerBatchLimit > 0 {
+		return cim.WorkerBatchLimit
+	}
+	return defaultWorkerBatchLimit
+}
+
+// DefaultKeyFormatter creates the key name in the persistent store as
+// <Type>::<ID>::<Source Name>, or <Type>::<Source Name> if id is empty.
+func DefaultKeyFormatter(typ, id, source string) string {
+	if id != "" {
+		return fmt.Sprintf("%v::%v::%v", typ, id, source)
+	}
+	return fmt.Sprintf("%v::%v", typ, source)
+}
+
+func (cim *InputManager) formatKey(id, source string) string {
+	if cim.KeyFormatter != nil {
+		return cim.KeyFormatter(cim.Type, id, source)
+	}
+	return DefaultKeyFormatter(cim.Type, id, source)
+}
+
+// inputIDField returns the field used by InjectInputID.
+func (cim *InputManager) inputIDField() string {
+	if cim.InputIDField != "" {
+		return cim.InputIDField
+	}
+	return defaultInputIDField
+}
+
+// drain waits up to DrainTimeout for all pending cursor updates to be
+// written to the persistent store.
+func (cim *InputManager) drain(log *logp.Logger, store *store) {
+	if cim.DrainTimeout <= 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cim.DrainTimeout)
+	defer cancel()
+	if err := store.waitPendingUpdates(ctx); err != nil {
+		log.Warnf("Timeout after %v while waiting for pending state updates, %v updates will not be persisted",
+			cim.DrainTimeout, store.pendingUpdates())
+	}
+}
+
 func (cim *InputManager) shutdown() {
 	cim.store.Release()
 }
 
 // Create builds a new input.Input using the provided Configure function.
-// The Input will run a go-routine per source that has been configured.
+// The Input will run a go-routine per source that has been configured, or a
+// worker pool if WorkerPoolSize is set.
+// The returned Input implements SourceReporter, DuplicateReporter, Reloader,
+// Pauser, SourceStopper, CursorReporter, CursorSeeker, and CursorTransactor.
 func (cim *InputManager) Create(config *conf.C) (input.Input, error) {
 	if err := cim.init(); err != nil {
 		return nil, err
 	}
 
-	settings := struct {
-		ID           string        `config:"id"`
-		CleanTimeout time.Duration `config:"clean_timeout"`
-	}{ID: "", CleanTimeout: cim.DefaultCleanTimeout}
-	if err := config.Unpack(&settings); err != nil {
+	settings, sources, inp, err := cim.configure(config)
+	if err != nil {
 		return nil, err
 	}
 
+	sources, duplicates := dedupSources(sources)
+	if len(duplicates) > 0 {
+		cim.Logger.With("input_type", cim.Type).Warnf(
+			"Input configures sources with the same name multiple times, duplicates will be skipped: %v", duplicates)
+	}
+
+	return &managedInput{
+		manager:          cim,
+		userID:           settings.ID,
+		sources:          sources,
+		duplicateSources: duplicates,
+		input:            inp,
+		cleanTimeout:     settings.CleanTimeout,
+	}, nil
+}
+
+// dedupSources removes sources with the same name from the list of sources.
+// Only the first source with a given name is kept. The names of the
+// sources that have been removed are returned.
+func dedupSources(sources []Source) (unique []Source, duplicates []string) {
+	seen := make(map[string]struct{}, len(sources))
+	unique = make([]Source, 0, len(sources))
+	for _, source := range sources {
+		name := source.Name()
+		if _, exists := seen[name]; exists {
+			duplicates = append(duplicates, name)
+			continue
+		}
+		seen[name] = struct{}{}
+		unique = append(unique, source)
+	}
+	return unique, duplicates
+}
+
+// ExportState writes the state of all keys known to the InputManager as JSON
+// to w. Only state that has been written to the persistent store is
+// exported.
+func (cim *InputManager) ExportState(w io.Writer) error {
+	if err := cim.init(); err != nil {
+		return err
+	}
+	return json.NewEncoder(w).Encode(cim.store.Export())
+}
+
+// ImportState reads state previously written by ExportState from r, and
+// writes it to the persistent store. All keys must belong to the
+// InputManager's Type. ImportState fails without modifying the store if any
+// of the keys is currently locked by an active input.
+func (cim *InputManager) ImportState(r io.Reader) error {
+	if err := cim.init(); err != nil {
+		return err
+	}
+
+	var states map[string]state
+	if err := json.NewDecoder(r).Decode(&states); err != nil {
+		return fmt.Errorf("failed to decode state: %w", err)
+	}
+
+	prefix := cim.Type + "::"
+	for key := range states {
+		if !strings.HasPrefix(key, prefix) {
+			return fmt.Errorf("key '%v' does not belong to input type '%v'", key, cim.Type)
+		}
+	}
+	return cim.store.Import(states)
+}
+
+// Prewarm opens the persistent store and reads the states of all keys of the
+// InputManager's Type into memory, if the store has not been opened yet.
+// Prewarm does nothing beyond the store initialization done by Init in
+// input.ModeRun, or by the first call to Create otherwise, but does not start
+// the cleaner. The number of states and the time taken to read them are
+// logged once, when the store is opened.
+//
+// Once read, states are served from memory, and all writes go through the
+// in memory state first, such that Get and lock never access the persistent
+// store. Prewarm allows the cost of reading large registries to be paid
+// before any input is created, such that the startup of the first sources is
+// not delayed.
+func (cim *InputManager) Prewarm() error {
+	return cim.init()
+}
+
+// CompactionStats reports the outcome of a store compaction.
+type CompactionStats struct {
+	// Started is the time the compaction has been started.
+	Started time.Time
+
+	// Duration is the time the compaction has taken.
+	Duration time.Duration
+
+	// KeysBefore and KeysAfter are the number of keys of the InputManager's
+	// Type in the persistent store before and after compaction.
+	KeysBefore int
+	KeysAfter  int
+
+	// SizeReported is set if the persistent store reports its size, like the
+	// memlog backend does. The byte sizes below are zero otherwise.
+	SizeReported bool
+
+	// LogBytesBefore and LogBytesAfter are the sizes in bytes of the update
+	// log of the persistent store before and after compaction.
+	// CheckpointBytesBefore and CheckpointBytesAfter are the sizes of the last
+	// checkpoint, e.g. the active memlog data file. The sizes cover the
+	// complete store, including the keys of other input types.
+	LogBytesBefore        int64
+	LogBytesAfter         int64
+	CheckpointBytesBefore int64
+	CheckpointBytesAfter  int64
+
+	// Removed is the number of expired keys that have been removed.
+	Removed int
+
+	// Skipped is the number of keys that have not been compacted, because
+	// they are in use by an input, or have updates not yet written.
+	Skipped int
+}
+
+// Compact rewrites the states of the InputManager's Type in the persistent
+// store, and asks the store to write a compact snapshot, if supported, e.g.
+// to shrink the memlog registry files. Keys locked by an input, or with
+// pending updates, are left untouched. Expired keys the cleaner would
+// remove are removed instead of being rewritten. The outcome is logged and
+// reported by CompactionStats.
+func (cim *InputManager) Compact() error {
+	if err := cim.init(); err != nil {
+		return err
+	}
+
+	cim.compactMu.Lock()
+	defer cim.compactMu.Unlock()
+
+	stats, err := cim.store.Compact(cim.Type + "::")
+	cim.lastCompaction = stats
+	if err != nil {
+		return err
+	}
+
+	log := cim.Logger.With("input_type", cim.Type)
+	log.Infof(
+		"Compacted state store in %v: %v keys before, %v keys after, %v removed, %v skipped",
+		stats.Duration, stats.KeysBefore, stats.KeysAfter, stats.Removed, stats.Skipped)
+	if stats.SizeReported {
+		log.Infof(
+			"State store size: %v bytes log and %v bytes checkpoint before, %v bytes log and %v bytes checkpoint after compaction",
+			stats.LogBytesBefore, stats.CheckpointBytesBefore, stats.LogBytesAfter, stats.CheckpointBytesAfter)
+	}
+	return nil
+}
+
+// CompactionStats returns the outcome of the last call to Compact. The zero
+// value is returned if Compact has not been called yet.
+func (cim *InputManager) CompactionStats() CompactionStats {
+	cim.compactMu.Lock()
+	defer cim.compactMu.Unlock()
+	return cim.lastCompaction
+}
+
+// Validate checks that the configuration produces a valid input, without
+// creating the input. Validate does not require access to the persistent store.
+func (cim *InputManager) Validate(config *conf.C) error {
+	_, _, _, err := cim.configure(config)
+	return err
+}
+
+type inputSettings struct {
+	ID           string        `config:"id"`
+	CleanTimeout time.Duration `config:"clean_timeout"`
+}
+
+// configure reads the common input settings and runs the Configure function.
+// An error is returned if no sources or no input runner have been configured,
+// if the input does not implement YieldingInput while WorkerPoolSize is set,
+// or if the KeyFormatter creates a key not starting with `<Type>::`.
+func (cim *InputManager) configure(config *conf.C) (inputSettings, []Source, Input, error) {
+	settings := inputSettings{ID: "", CleanTimeout: cim.DefaultCleanTimeout}
+	if err := config.Unpack(&settings); err != nil {
+		return settings, nil, nil, err
+	}
+
 	sources, inp, err := cim.Configure(config)
 	if err != nil {
-		return nil, err
+		return settings, nil, nil, err
+	}
+	sources, err = expandPartitions(sources)
+	if err != nil {
+		return settings, nil, nil, err
 	}
 	if len(sources) == 0 {
-		return nil, errNoSourceConfigured
+		return settings, nil, nil, errNoSourceConfigured
 	}
 	if inp == nil {
-		return nil, errNoInputRunner
+		return settings, nil, nil, errNoInputRunner
 	}
-
-	return &managedInput{
-		manager:      cim,
-		userID:       settings.ID,
-		sources:      sources,
-		input:        inp,
-		cleanTimeout: settings.CleanTimeout,
-	}, nil
+	if _, ok := inp.(YieldingInput); cim.WorkerPoolSize > 0 && !ok {
+		return settings, nil, nil, fmt.Errorf("input '%v' does not implement YieldingInput, required by WorkerPoolSize", inp.Name())
+	}
+	for _, source := range sources {
+		if key := cim.formatKey(settings.ID, source.Name()); !strings.HasPrefix(key, cim.Type+"::") {
+			return settings, nil, nil, fmt.Errorf("key '%v' for source '%v' does not start with '%v::'", key, source.Name(), cim.Type)
+		}
+	}
+	return settings, sources, inp, nil
 }
 
 // Lock locks a key for exclusive access and returns an resource that can be used to modify
 // the cursor state and unlock the key.
 func (cim *InputManager) lock(ctx input.Context, key string) (*resource, error) {
 	resource := cim.store.Get(key)
-	err := lockResource(ctx.Logger, resource, ctx.Cancelation)
+	err := lockResource(ctx.Logger, cim.metrics(), resource, ctx.Cancelation, cim.LockTimeout)
 	if err != nil {
 		resource.Release()
 		return nil, err
@@ -179,18 +891,74 @@ func (cim *InputManager) lock(ctx input.Context, key string) (*resource, error)
 	return resource, nil
 }
 
-func lockResource(log *logp.Logger, resource *resource, canceler input.Canceler) error {
-	if !resource.lock.TryLock() {
-		log.Infof("Resource '%v' currently in use, waiting...", resource.key)
-		err := resource.lock.LockContext(canceler)
-		if err != nil {
-			log.Infof("Input for resource '%v' has been stopped while waiting", resource.key)
-			return err
+// lockResource locks the resource, waiting until the resource is available.
+// If timeout is > 0, ErrLockTimeout is returned if the resource can not be
+// locked in time.
+func lockResource(
+	log *logp.Logger,
+	metrics ManagerMetrics,
+	resource *resource,
+	canceler input.Canceler,
+	timeout time.Duration,
+) error {
+	if resource.lock.TryLock() {
+		return nil
+	}
+
+	log.Infof("Resource '%v' currently in use, waiting...", resource.key)
+	metrics.SourceBlocked(1)
+	defer metrics.SourceBlocked(-1)
+
+	waitCtx := ctxtool.FromCanceller(canceler)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(waitCtx, timeout)
+		defer cancel()
+	}
+
+	if err := resource.lock.LockContext(waitCtx); err != nil {
+		if canceler.Err() == nil && errors.Is(err, context.DeadlineExceeded) {
+			log.Warnf("Timeout after %v while waiting for resource '%v'", timeout, resource.key)
+			return ErrLockTimeout
 		}
+		log.Infof("Input for resource '%v' has been stopped while waiting", resource.key)
+		return err
 	}
 	return nil
 }
 
+// acquireSourceSlot blocks until the number of active sources is below
+// MaxConcurrentSources and no source with a higher priority is waiting, or
+// the input is stopped.
+func (cim *InputManager) acquireSourceSlot(log *logp.Logger, canceler input.Canceler, source Source) error {
+	if cim.sourceSlots == nil {
+		return nil
+	}
+	if cim.sourceSlots.tryAcquire() {
+		return nil
+	}
+
+	log.Infof("Maximum number of concurrent sources (%v) reached, waiting...", cim.MaxConcurrentSources)
+	if err := cim.sourceSlots.acquire(canceler, cim.sourcePriority(source)); err != nil {
+		log.Infof("Input has been stopped while waiting for a free source slot")
+		return err
+	}
+	return nil
+}
+
+func (cim *InputManager) sourcePriority(source Source) int {
+	if cim.SourcePriority != nil {
+		return cim.SourcePriority(source)
+	}
+	return 0
+}
+
+func (cim *InputManager) releaseSourceSlot() {
+	if cim.sourceSlots != nil {
+		cim.sourceSlots.Release()
+	}
+}
+
 func releaseResource(resource *resource) {
 	resource.lock.Unlock()
 	resource.Release()
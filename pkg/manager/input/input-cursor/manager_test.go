@@ -5,22 +5,29 @@
 package cursor
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"runtime"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/atomic"
 
 	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
 	"github.com/elastic/elastic-agent-inputs/pkg/manager/internal/resources"
 	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher/acker"
 	pubtest "github.com/elastic/elastic-agent-inputs/pkg/publisher/testing"
+	"github.com/elastic/elastic-agent-inputs/pkg/statestore"
+	"github.com/elastic/elastic-agent-inputs/pkg/statestore/storetest"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -32,8 +39,37 @@ type fakeTestInput struct {
 	OnRun  func(input.Context, Source, Cursor, Publisher) error
 }
 
+type yieldingTestInput struct {
+	fakeTestInput
+	OnCollect func(input.Context, Source, Cursor, Publisher, int) (bool, error)
+}
+
 type stringSource string
 
+type timedSource struct {
+	name    string
+	timeout time.Duration
+}
+
+type statelessSource string
+
+type partitionedSource struct {
+	name       string
+	partitions []string
+}
+
+type clientSource struct {
+	name string
+	cfg  publisher.ClientConfig
+}
+
+type testMetrics struct {
+	mu       sync.Mutex
+	active   int
+	blocked  int
+	cleanups []int
+}
+
 func TestManager_Init(t *testing.T) {
 	// Integration style tests for the InputManager and the state garbage collector
 
@@ -91,6 +127,294 @@ func TestManager_Init(t *testing.T) {
 	})
 }
 
+func TestManager_CleanerStats(t *testing.T) {
+	store := createSampleStore(t, map[string]state{
+		"test::key": {
+			TTL:     1 * time.Millisecond,
+			Updated: time.Now().Add(-24 * time.Hour),
+		},
+	})
+	store.GCPeriod = 10 * time.Millisecond
+
+	var grp unison.TaskGroup
+	defer func() {
+		_ = grp.Stop()
+	}()
+	manager := &InputManager{
+		Logger:     logp.NewLogger("test"),
+		StateStore: store,
+		Type:       "test",
+	}
+	require.Equal(t, CleanerStats{}, manager.CleanerStats())
+
+	started := time.Now()
+	require.NoError(t, manager.Init(&grp, input.ModeRun))
+
+	for manager.CleanerStats().TotalRemoved == 0 {
+		time.Sleep(1 * time.Millisecond)
+	}
+
+	stats := manager.CleanerStats()
+	require.GreaterOrEqual(t, stats.Runs, uint64(1))
+	require.Equal(t, uint64(1), stats.TotalRemoved)
+	require.False(t, stats.LastRun.Before(started))
+}
+
+func TestManager_TriggerCleanup(t *testing.T) {
+	store := createSampleStore(t, map[string]state{
+		"test::key": {
+			TTL:       1 * time.Hour,
+			Updated:   time.Now().Add(-24 * time.Hour),
+			ExpiresAt: time.Now().Add(-1 * time.Hour),
+		},
+	})
+	store.GCPeriod = 24 * time.Hour
+
+	var grp unison.TaskGroup
+	defer func() {
+		_ = grp.Stop()
+	}()
+	manager := &InputManager{
+		Logger:     logp.NewLogger("test"),
+		StateStore: store,
+		Type:       "test",
+	}
+	require.NoError(t, manager.Init(&grp, input.ModeRun))
+
+	<-manager.cleaner.trigger()
+	require.NotContains(t, manager.store.Export(), "test::key")
+
+	stats := manager.CleanerStats()
+	require.Equal(t, uint64(1), stats.Runs)
+	require.Equal(t, uint64(1), stats.TotalRemoved)
+
+	// passes are run directly via runOnce, without waiting for the cleaner loop
+	passed := manager.cleaner.waitPass()
+	require.Equal(t, 0, manager.cleaner.runOnce(manager.store))
+	<-passed
+	require.Equal(t, uint64(2), manager.CleanerStats().Runs)
+}
+
+func TestManager_Prewarm(t *testing.T) {
+	t.Run("states are read into memory", func(t *testing.T) {
+		manager := &InputManager{
+			Logger: logp.NewLogger("test"),
+			StateStore: createSampleStore(t, map[string]state{
+				"test::a":  {TTL: time.Hour, Cursor: "a"},
+				"test::b":  {TTL: time.Hour, Cursor: "b"},
+				"other::c": {TTL: time.Hour, Cursor: "c"},
+			}),
+			Type: "test",
+		}
+		require.Nil(t, manager.store)
+
+		require.NoError(t, manager.Prewarm())
+		require.NotNil(t, manager.store)
+		require.Equal(t, 2, manager.loadedStates)
+		require.Len(t, manager.store.ephemeralStore.table, 2)
+
+		// the store is only read once
+		store := manager.store
+		require.NoError(t, manager.Prewarm())
+		require.Same(t, store, manager.store)
+	})
+
+	t.Run("store errors are returned", func(t *testing.T) {
+		manager := &InputManager{Logger: logp.NewLogger("test"), StateStore: testStateStore{}, Type: "test"}
+		require.Error(t, manager.Prewarm())
+	})
+}
+
+func TestManager_EagerStoreCheck(t *testing.T) {
+	newManager := func(store StateStore, eager bool) *InputManager {
+		return &InputManager{
+			Logger:          logp.NewLogger("test"),
+			StateStore:      store,
+			Type:            "test",
+			EagerStoreCheck: eager,
+		}
+	}
+
+	t.Run("store is not accessed in test mode by default", func(t *testing.T) {
+		var grp unison.TaskGroup
+		defer func() { _ = grp.Stop() }()
+		require.NoError(t, newManager(testStateStore{}, false).Init(&grp, input.ModeTest))
+	})
+
+	t.Run("store errors are returned in test mode", func(t *testing.T) {
+		var grp unison.TaskGroup
+		defer func() { _ = grp.Stop() }()
+		require.Error(t, newManager(testStateStore{}, true).Init(&grp, input.ModeTest))
+	})
+
+	t.Run("store is opened in test mode", func(t *testing.T) {
+		var grp unison.TaskGroup
+		defer func() { _ = grp.Stop() }()
+		manager := newManager(createSampleStore(t, nil), true)
+		require.NoError(t, manager.Init(&grp, input.ModeOther))
+		require.NotNil(t, manager.store)
+	})
+}
+
+func TestManager_DrainTimeout(t *testing.T) {
+	newManager := func(store StateStore, timeout time.Duration) *InputManager {
+		return &InputManager{
+			Logger:              logp.NewLogger("test"),
+			StateStore:          store,
+			Type:                "test",
+			DefaultCleanTimeout: time.Minute,
+			DrainTimeout:        timeout,
+		}
+	}
+
+	t.Run("pending updates are persisted before shutdown", func(t *testing.T) {
+		store := createSampleStore(t, nil)
+		manager := newManager(store, 5*time.Second)
+
+		var grp unison.TaskGroup
+		require.NoError(t, manager.Init(&grp, input.ModeRun))
+
+		res := manager.store.Get("test::key")
+		op, err := createUpdateOp(manager.store, res, "test-cursor-state")
+		require.NoError(t, err)
+		res.Release()
+
+		go func() {
+			time.Sleep(200 * time.Millisecond)
+			op.Execute(1)
+		}()
+
+		// give the cleaner go-routine time to start before stopping
+		time.Sleep(100 * time.Millisecond)
+		_ = grp.Stop()
+
+		require.Equal(t, "test-cursor-state", manager.store.Export()["test::key"].Cursor)
+	})
+
+	t.Run("shutdown continues after timeout", func(t *testing.T) {
+		store := createSampleStore(t, nil)
+		manager := newManager(store, 10*time.Millisecond)
+
+		var grp unison.TaskGroup
+		require.NoError(t, manager.Init(&grp, input.ModeRun))
+
+		res := manager.store.Get("test::key")
+		op, err := createUpdateOp(manager.store, res, "test-cursor-state")
+		require.NoError(t, err)
+		res.Release()
+		defer op.done(1)
+
+		// give the cleaner go-routine time to start before stopping
+		time.Sleep(100 * time.Millisecond)
+		_ = grp.Stop()
+		require.Equal(t, uint(1), manager.store.pendingUpdates())
+		require.Empty(t, manager.store.Export())
+	})
+}
+
+func TestManager_CursorFlushInterval(t *testing.T) {
+	reg := statestore.NewRegistry(storetest.NewMemoryStoreBackend())
+	persistentStore, err := reg.Get("test")
+	require.NoError(t, err)
+	store := testStateStore{Store: persistentStore}
+
+	// second handle to the persistent store, staying open after the manager has closed its store
+	inspectStore, err := reg.Get("test")
+	require.NoError(t, err)
+	defer inspectStore.Close()
+	backend := testStateStore{Store: inspectStore}
+
+	manager := &InputManager{
+		Logger:              logp.NewLogger("test"),
+		StateStore:          store,
+		Type:                "test",
+		DefaultCleanTimeout: time.Minute,
+		CursorFlushInterval: time.Hour,
+	}
+
+	var grp unison.TaskGroup
+	require.NoError(t, manager.Init(&grp, input.ModeRun))
+
+	res := manager.store.Get("test::key")
+	for _, cursor := range []string{"test-cursor-state1", "test-cursor-state2"} {
+		op, err := createUpdateOp(manager.store, res, cursor)
+		require.NoError(t, err)
+		op.Execute(1)
+	}
+	res.Release()
+	require.Equal(t, "test-cursor-state1", backend.snapshot()["test::key"].Cursor)
+
+	// give the cleaner go-routine time to start before stopping
+	time.Sleep(100 * time.Millisecond)
+
+	// deferred writes are flushed on shutdown
+	require.NoError(t, grp.Stop())
+	require.Equal(t, "test-cursor-state2", backend.snapshot()["test::key"].Cursor)
+}
+
+type snapshotBuffer struct {
+	bytes.Buffer
+	closed chan struct{}
+}
+
+func (b *snapshotBuffer) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func TestManager_Snapshot(t *testing.T) {
+	updated := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	states := map[string]state{
+		"test::a": {TTL: time.Hour, Updated: updated, Cursor: "cursor-a"},
+	}
+
+	t.Run("snapshots are written periodically", func(t *testing.T) {
+		snapshots := make(chan *snapshotBuffer, 10)
+		manager := constInput(t, nil, nil)
+		manager.StateStore = createSampleStore(t, states)
+		manager.SnapshotInterval = 10 * time.Millisecond
+		manager.SnapshotWriter = func() (io.WriteCloser, error) {
+			buf := &snapshotBuffer{closed: make(chan struct{})}
+			select {
+			case snapshots <- buf:
+			default:
+			}
+			return buf, nil
+		}
+
+		var grp unison.TaskGroup
+		require.NoError(t, manager.Init(&grp, input.ModeRun))
+		defer grp.Stop()
+
+		for i := 0; i < 2; i++ {
+			buf := <-snapshots
+			<-buf.closed
+
+			target := constInput(t, nil, nil)
+			store := createSampleStore(t, nil)
+			target.StateStore = store
+			require.NoError(t, target.ImportState(&buf.Buffer))
+			checkEqualStoreState(t, states, store.snapshot())
+		}
+	})
+
+	t.Run("writer errors do not stop snapshots", func(t *testing.T) {
+		var calls atomic.Int32
+		manager := constInput(t, nil, nil)
+		manager.SnapshotInterval = 10 * time.Millisecond
+		manager.SnapshotWriter = func() (io.WriteCloser, error) {
+			calls.Inc()
+			return nil, errors.New("oops")
+		}
+
+		var grp unison.TaskGroup
+		require.NoError(t, manager.Init(&grp, input.ModeRun))
+		defer grp.Stop()
+
+		require.Eventually(t, func() bool { return calls.Load() >= 2 }, time.Second, 10*time.Millisecond)
+	})
+}
+
 func TestManager_Create(t *testing.T) {
 	t.Run("fail if no source is configured", func(t *testing.T) {
 		manager := constInput(t, nil, &fakeTestInput{})
@@ -133,6 +457,47 @@ func TestManager_Create(t *testing.T) {
 		}))
 		require.NoError(t, err)
 	})
+
+	t.Run("duplicate sources are reported", func(t *testing.T) {
+		manager := constInput(t, sourceList("a", "b", "a", "c", "b"), &fakeTestInput{})
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+
+		managed := inp.(*managedInput)
+		require.Equal(t, sourceList("a", "b", "c"), managed.sources)
+		require.Equal(t, []string{"a", "b"}, inp.(DuplicateReporter).DuplicateSources())
+	})
+}
+
+func TestManager_Validate(t *testing.T) {
+	t.Run("fail if no source is configured", func(t *testing.T) {
+		manager := constInput(t, nil, &fakeTestInput{})
+		err := manager.Validate(conf.NewConfig())
+		require.ErrorIs(t, err, errNoSourceConfigured)
+	})
+
+	t.Run("fail if config error", func(t *testing.T) {
+		manager := failingManager(t, errors.New("oops"))
+		require.Error(t, manager.Validate(conf.NewConfig()))
+	})
+
+	t.Run("fail if no input runner is returned", func(t *testing.T) {
+		manager := constInput(t, sourceList("test"), nil)
+		err := manager.Validate(conf.NewConfig())
+		require.ErrorIs(t, err, errNoInputRunner)
+	})
+
+	t.Run("validate does not access the store", func(t *testing.T) {
+		manager := constInput(t, sourceList("test"), &fakeTestInput{})
+		manager.StateStore = testStateStore{}
+		require.NoError(t, manager.Validate(conf.NewConfig()))
+	})
+
+	t.Run("fail if worker pool is used without YieldingInput", func(t *testing.T) {
+		manager := constInput(t, sourceList("test"), &fakeTestInput{})
+		manager.WorkerPoolSize = 1
+		require.Error(t, manager.Validate(conf.NewConfig()))
+	})
 }
 
 func TestManager_InputsTest(t *testing.T) {
@@ -480,115 +845,1710 @@ func TestManager_InputsRun(t *testing.T) {
 	})
 }
 
-func mustPublish(p Publisher, e publisher.Event, cursor interface{}) {
-	err := p.Publish(e, cursor)
-	if err != nil {
-		panic(err)
-	}
-}
-
-func TestLockResource(t *testing.T) {
-	t.Run("can lock unused resource", func(t *testing.T) {
-		store := testOpenStore(t, createSampleStore(t, nil))
-		defer store.Release()
+func TestManager_MaxConcurrentSources(t *testing.T) {
+	t.Run("number of active sources is limited", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
 
-		res := store.Get("test::key")
-		err := lockResource(logp.NewLogger("test"), res, context.TODO())
-		require.NoError(t, err)
-	})
+		var mu sync.Mutex
+		var active, maxActive int
+		var seen []string
+		manager := constInput(t, sourceList("a", "b", "c"), &fakeTestInput{
+			OnRun: func(_ input.Context, source Source, _ Cursor, _ Publisher) error {
+				mu.Lock()
+				active++
+				if active > maxActive {
+					maxActive = active
+				}
+				seen = append(seen, source.Name())
+				mu.Unlock()
 
-	t.Run("fail to lock resource in use when context is cancelled", func(t *testing.T) {
-		log := logp.NewLogger("test")
+				time.Sleep(10 * time.Millisecond)
 
-		store := testOpenStore(t, createSampleStore(t, nil))
-		defer store.Release()
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return nil
+			},
+		})
+		manager.MaxConcurrentSources = 1
 
-		resUsed := store.Get("test::key")
-		err := lockResource(log, resUsed, context.TODO())
+		inp, err := manager.Create(conf.NewConfig())
 		require.NoError(t, err)
 
-		// fail to lock resource in use
-		ctx, cancel := context.WithCancel(context.TODO())
-		cancel()
-		resFail := store.Get("test::key")
-		err = lockResource(log, resFail, ctx)
-		require.Error(t, err)
-		resFail.Release()
+		err = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		require.NoError(t, err)
 
-		// unlock and release resource in use -> it should be marked finished now
-		releaseResource(resUsed)
-		require.True(t, resUsed.Finished())
+		sort.Strings(seen)
+		require.Equal(t, []string{"a", "b", "c"}, seen)
+		require.Equal(t, 1, maxActive)
 	})
 
-	t.Run("succeed to lock resource after it has been released", func(t *testing.T) {
-		log := logp.NewLogger("test")
+	t.Run("stop while waiting for a free slot", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
 
-		store := testOpenStore(t, createSampleStore(t, nil))
-		defer store.Release()
+		manager := constInput(t, sourceList("a", "b"), &fakeTestInput{
+			OnRun: func(ctx input.Context, _ Source, _ Cursor, _ Publisher) error {
+				<-ctx.Cancelation.Done()
+				return nil
+			},
+		})
+		manager.MaxConcurrentSources = 1
 
-		resUsed := store.Get("test::key")
-		err := lockResource(log, resUsed, context.TODO())
+		inp, err := manager.Create(conf.NewConfig())
 		require.NoError(t, err)
 
+		cancelCtx, cancel := context.WithCancel(context.Background())
 		var wg sync.WaitGroup
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			resOther := store.Get("test::key")
-			err := lockResource(log, resOther, context.TODO())
-			if err == nil {
-				releaseResource(resOther)
-			}
-		}()
-
-		go func() {
-			time.Sleep(100 * time.Millisecond)
-			releaseResource(resUsed)
+			err = inp.Run(input.Context{
+				Logger:      manager.Logger,
+				Cancelation: cancelCtx,
+			}, pubtest.ConstClient(&pubtest.FakeClient{}))
 		}()
 
-		wg.Wait() // <- block forever if waiting go-routine can not acquire lock
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+		wg.Wait()
+		require.NoError(t, err)
 	})
-}
 
-func (s stringSource) Name() string { return string(s) }
+	t.Run("higher priority sources get slots first", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
 
-func simpleManagerWithConfigure(t *testing.T, configure func(*conf.C) ([]Source, Input, error)) *InputManager {
-	return &InputManager{
-		Logger:     logp.NewLogger("test"),
-		StateStore: createSampleStore(t, nil),
-		Type:       "test",
-		Configure:  configure,
-	}
-}
+		slots := newSourceSlots(1)
+		require.True(t, slots.tryAcquire())
 
-func constConfigureResult(t *testing.T, sources []Source, inp Input, err error) *InputManager {
-	return simpleManagerWithConfigure(t, func(cfg *conf.C) ([]Source, Input, error) {
-		return sources, inp, err
+		var mu sync.Mutex
+		var order []string
+		var wg sync.WaitGroup
+		waiters := []struct {
+			name     string
+			priority int
+		}{{"low", 0}, {"high-1", 10}, {"mid", 5}, {"high-2", 10}}
+		for i, w := range waiters {
+			w := w
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				require.NoError(t, slots.acquire(context.Background(), w.priority))
+				mu.Lock()
+				order = append(order, w.name)
+				mu.Unlock()
+				slots.Release()
+			}()
+
+			// wait for the source to be queued, to get a deterministic FIFO order
+			require.Eventually(t, func() bool {
+				slots.mu.Lock()
+				defer slots.mu.Unlock()
+				return len(slots.waiting) == i+1
+			}, time.Second, time.Millisecond)
+		}
+
+		slots.Release()
+		wg.Wait()
+		require.Equal(t, []string{"high-1", "high-2", "mid", "low"}, order)
+		require.True(t, slots.tryAcquire())
 	})
-}
 
-func failingManager(t *testing.T, err error) *InputManager {
-	return constConfigureResult(t, nil, nil, err)
-}
+	t.Run("cancelled waiters are removed from the queue", func(t *testing.T) {
+		slots := newSourceSlots(1)
+		require.True(t, slots.tryAcquire())
 
-func constInput(t *testing.T, sources []Source, inp Input) *InputManager {
-	return constConfigureResult(t, sources, inp, nil)
+		ctx, cancel := context.WithCancel(context.Background())
+		errc := make(chan error, 1)
+		go func() { errc <- slots.acquire(ctx, 0) }()
+		require.Eventually(t, func() bool {
+			slots.mu.Lock()
+			defer slots.mu.Unlock()
+			return len(slots.waiting) == 1
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		require.ErrorIs(t, <-errc, context.Canceled)
+		slots.Release()
+		require.True(t, slots.tryAcquire())
+	})
 }
 
-func (f *fakeTestInput) Name() string { return "test" }
+func TestManager_SourceCallbacks(t *testing.T) {
+	defer resources.NewGoroutinesChecker().Check(t)
 
-func (f *fakeTestInput) Test(source Source, ctx input.TestContext) error {
-	if f.OnTest != nil {
-		return f.OnTest(source, ctx)
+	var mu sync.Mutex
+	var started []string
+	stopped := map[string]error{}
+
+	manager := constInput(t, sourceList("ok", "fail", "cancel"), &fakeTestInput{
+		OnRun: func(ctx input.Context, source Source, _ Cursor, _ Publisher) error {
+			switch source.Name() {
+			case "fail":
+				return errors.New("oops")
+			case "cancel":
+				<-ctx.Cancelation.Done()
+				return ctx.Cancelation.Err()
+			}
+			return nil
+		},
+	})
+	manager.OnSourceStart = func(source Source) {
+		mu.Lock()
+		defer mu.Unlock()
+		started = append(started, source.Name())
 	}
-	return nil
+	manager.OnSourceStop = func(source Source, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped[source.Name()] = err
+	}
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+
+	err = inp.Run(input.Context{
+		Logger:      manager.Logger,
+		Cancelation: context.Background(),
+	}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	require.Error(t, err)
+
+	sort.Strings(started)
+	require.Equal(t, []string{"cancel", "fail", "ok"}, started)
+	require.Len(t, stopped, 3)
+	require.NoError(t, stopped["ok"])
+	require.EqualError(t, stopped["fail"], "oops")
+	require.ErrorIs(t, stopped["cancel"], context.Canceled)
 }
 
-func (f *fakeTestInput) Run(ctx input.Context, source Source, cursor Cursor, pub Publisher) error {
-	if f.OnRun != nil {
-		return f.OnRun(ctx, source, cursor, pub)
-	}
-	return nil
+func TestManager_Metrics(t *testing.T) {
+	t.Run("active sources are reported", func(t *testing.T) {
+		metrics := &testMetrics{}
+		var activeDuringRun []int
+		manager := constInput(t, sourceList("a"), &fakeTestInput{
+			OnRun: func(_ input.Context, _ Source, _ Cursor, _ Publisher) error {
+				activeDuringRun = append(activeDuringRun, metrics.Active())
+				return nil
+			},
+		})
+		manager.Metrics = metrics
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+
+		err = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		require.NoError(t, err)
+
+		require.Equal(t, []int{1}, activeDuringRun)
+		require.Equal(t, 0, metrics.Active())
+	})
+
+	t.Run("blocked sources are reported", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		metrics := &testMetrics{}
+		manager := constInput(t, sourceList("a"), &fakeTestInput{})
+		manager.Metrics = metrics
+		require.NoError(t, manager.init())
+
+		res := manager.store.Get("test::a")
+		require.NoError(t, lockResource(manager.Logger, metrics, res, context.TODO(), 0))
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = inp.Run(input.Context{
+				Logger:      manager.Logger,
+				Cancelation: context.Background(),
+			}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		}()
+
+		require.Eventually(t, func() bool { return metrics.Blocked() == 1 }, time.Second, time.Millisecond)
+		releaseResource(res)
+		wg.Wait()
+		require.Equal(t, 0, metrics.Blocked())
+	})
+
+	t.Run("cleanup runs are reported", func(t *testing.T) {
+		metrics := &testMetrics{}
+		cleaner := &cleaner{log: logp.NewLogger("test"), metrics: metrics}
+
+		store := testOpenStore(t, createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Millisecond, Updated: time.Now().Add(-time.Hour)},
+		}))
+		defer store.Release()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			require.Eventually(t, func() bool { return len(metrics.Cleanups()) > 1 }, time.Second, time.Millisecond)
+			cancel()
+		}()
+		cleaner.run(ctx, store, time.Millisecond)
+
+		cleanups := metrics.Cleanups()
+		require.Equal(t, 1, cleanups[0])
+		require.Equal(t, 0, cleanups[1])
+	})
+}
+
+func TestManager_ActiveSources(t *testing.T) {
+	defer resources.NewGoroutinesChecker().Check(t)
+
+	stop := make(chan struct{})
+	manager := constInput(t, sourceList("a", "b"), &fakeTestInput{
+		OnRun: func(_ input.Context, _ Source, _ Cursor, _ Publisher) error {
+			<-stop
+			return nil
+		},
+	})
+	require.NoError(t, manager.init())
+
+	res := manager.store.Get("test::b")
+	require.NoError(t, lockResource(manager.Logger, nopMetrics{}, res, context.TODO(), 0))
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	reporter, ok := inp.(SourceReporter)
+	require.True(t, ok)
+	require.Empty(t, reporter.ActiveSources())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_ = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	}()
+
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"a"}, reporter.ActiveSources())
+	}, time.Second, time.Millisecond)
+
+	releaseResource(res)
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"a", "b"}, reporter.ActiveSources())
+	}, time.Second, time.Millisecond)
+
+	close(stop)
+	wg.Wait()
+	require.Empty(t, reporter.ActiveSources())
+}
+
+func TestManager_LockTimeout(t *testing.T) {
+	var mu sync.Mutex
+	stopped := map[string]error{}
+
+	manager := constInput(t, sourceList("a", "b"), &fakeTestInput{
+		OnRun: func(ctx input.Context, _ Source, _ Cursor, _ Publisher) error {
+			time.Sleep(100 * time.Millisecond)
+			return ctx.Cancelation.Err()
+		},
+	})
+	manager.LockTimeout = 10 * time.Millisecond
+	manager.OnSourceStop = func(source Source, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		stopped[source.Name()] = err
+	}
+	require.NoError(t, manager.init())
+
+	res := manager.store.Get("test::b")
+	require.NoError(t, lockResource(manager.Logger, nopMetrics{}, res, context.TODO(), 0))
+	defer releaseResource(res)
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+
+	err = inp.Run(input.Context{
+		Logger:      manager.Logger,
+		Cancelation: context.Background(),
+	}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	require.Error(t, err)
+
+	require.NoError(t, stopped["a"])
+	require.ErrorIs(t, stopped["b"], ErrLockTimeout)
+}
+
+func TestManager_Reload(t *testing.T) {
+	newManager := func(t *testing.T, runs map[string]int, mu *sync.Mutex) *InputManager {
+		inp := &fakeTestInput{
+			OnRun: func(ctx input.Context, source Source, _ Cursor, _ Publisher) error {
+				mu.Lock()
+				runs[source.Name()]++
+				mu.Unlock()
+
+				<-ctx.Cancelation.Done()
+				return ctx.Cancelation.Err()
+			},
+		}
+		return simpleManagerWithConfigure(t, func(cfg *conf.C) ([]Source, Input, error) {
+			config := struct{ Sources []string }{}
+			err := cfg.Unpack(&config)
+			return sourceList(config.Sources...), inp, err
+		})
+	}
+
+	sourcesConfig := func(id string, sources ...string) *conf.C {
+		return conf.MustNewConfigFrom(map[string]interface{}{"id": id, "sources": sources})
+	}
+
+	t.Run("sources are added and removed while running", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		runs := map[string]int{}
+		manager := newManager(t, runs, &mu)
+
+		inp, err := manager.Create(sourcesConfig("", "a", "b"))
+		require.NoError(t, err)
+		reporter := inp.(SourceReporter)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		}()
+
+		require.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"a", "b"}, reporter.ActiveSources())
+		}, time.Second, time.Millisecond)
+
+		require.NoError(t, inp.(Reloader).Reload(sourcesConfig("", "b", "c")))
+		require.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"b", "c"}, reporter.ActiveSources())
+		}, time.Second, time.Millisecond)
+
+		cancel()
+		wg.Wait()
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, map[string]int{"a": 1, "b": 1, "c": 1}, runs)
+	})
+
+	t.Run("sources are updated if input is not running", func(t *testing.T) {
+		var mu sync.Mutex
+		runs := map[string]int{}
+		manager := newManager(t, runs, &mu)
+
+		inp, err := manager.Create(sourcesConfig("", "a"))
+		require.NoError(t, err)
+		require.NoError(t, inp.(Reloader).Reload(sourcesConfig("", "b", "b")))
+		require.Equal(t, []string{"b"}, inp.(DuplicateReporter).DuplicateSources())
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		require.NoError(t, inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{})))
+		require.Equal(t, map[string]int{"b": 1}, runs)
+	})
+
+	t.Run("fail if input id is changed", func(t *testing.T) {
+		manager := newManager(t, map[string]int{}, &sync.Mutex{})
+		inp, err := manager.Create(sourcesConfig("id1", "a"))
+		require.NoError(t, err)
+		require.Error(t, inp.(Reloader).Reload(sourcesConfig("id2", "a")))
+	})
+
+	t.Run("fail if no source is configured", func(t *testing.T) {
+		manager := newManager(t, map[string]int{}, &sync.Mutex{})
+		inp, err := manager.Create(sourcesConfig("", "a"))
+		require.NoError(t, err)
+		require.Error(t, inp.(Reloader).Reload(sourcesConfig("")))
+	})
+}
+
+func TestManager_StatelessSource(t *testing.T) {
+	store := createSampleStore(t, nil)
+	var isNew bool
+	manager := constInput(t, []Source{statelessSource("stream")}, &fakeTestInput{
+		OnRun: func(_ input.Context, _ Source, cursor Cursor, pub Publisher) error {
+			isNew = cursor.IsNew()
+			return pub.Publish(publisher.Event{}, "ignored")
+		},
+	})
+	manager.StateStore = store
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+
+	var published []publisher.Event
+	err = inp.Run(input.Context{
+		Logger:      manager.Logger,
+		Cancelation: context.Background(),
+	}, pubtest.ConstClient(&pubtest.FakeClient{
+		PublishFunc: func(event publisher.Event) { published = append(published, event) },
+	}))
+	require.NoError(t, err)
+
+	require.True(t, isNew)
+	require.Len(t, published, 1)
+	require.Nil(t, published[0].Private)
+	require.Empty(t, store.snapshot())
+	require.Empty(t, storeMemorySnapshot(manager.store))
+}
+
+func TestManager_TimedSource(t *testing.T) {
+	store := createSampleStore(t, nil)
+	manager := constInput(t, []Source{
+		stringSource("default"),
+		timedSource{name: "timed", timeout: time.Hour},
+		timedSource{name: "unset"},
+	}, &fakeTestInput{})
+	manager.StateStore = store
+
+	inp, err := manager.Create(conf.MustNewConfigFrom(map[string]interface{}{
+		"clean_timeout": "1m",
+	}))
+	require.NoError(t, err)
+
+	err = inp.Run(input.Context{
+		Logger:      manager.Logger,
+		Cancelation: context.Background(),
+	}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	require.NoError(t, err)
+
+	snapshot := store.snapshot()
+	require.Equal(t, time.Minute, snapshot["test::default"].TTL)
+	require.Equal(t, time.Hour, snapshot["test::timed"].TTL)
+	require.Equal(t, time.Minute, snapshot["test::unset"].TTL)
+}
+
+func TestManager_PauseResume(t *testing.T) {
+	t.Run("input is restarted from the last cursor on resume", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		var cursors []int
+		var returned int
+		manager := constInput(t, sourceList("a"), &fakeTestInput{
+			OnRun: func(ctx input.Context, _ Source, cursor Cursor, pub Publisher) error {
+				var offset int
+				if err := cursor.Unpack(&offset); err != nil {
+					return err
+				}
+				mu.Lock()
+				cursors = append(cursors, offset)
+				mu.Unlock()
+
+				if err := pub.Publish(publisher.Event{}, offset+1); err != nil {
+					return err
+				}
+				<-ctx.Cancelation.Done()
+
+				mu.Lock()
+				returned++
+				mu.Unlock()
+				return ctx.Cancelation.Err()
+			},
+		})
+		runs := func() (int, int) {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(cursors), returned
+		}
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+		pauser := inp.(Pauser)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		}()
+
+		require.Eventually(t, func() bool { started, _ := runs(); return started == 1 }, time.Second, time.Millisecond)
+
+		pauser.Pause()
+		require.Eventually(t, func() bool { _, stopped := runs(); return stopped == 1 }, time.Second, time.Millisecond)
+		require.Equal(t, []string{"a"}, inp.(SourceReporter).ActiveSources(), "paused source must keep its lock")
+
+		res := manager.store.Get("test::a")
+		require.False(t, res.lock.TryLock())
+		res.Release()
+
+		pauser.Resume()
+		require.Eventually(t, func() bool { started, _ := runs(); return started == 2 }, time.Second, time.Millisecond)
+
+		cancel()
+		wg.Wait()
+		require.NoError(t, err)
+
+		mu.Lock()
+		defer mu.Unlock()
+		require.Equal(t, []int{0, 1}, cursors)
+	})
+
+	t.Run("sources wait for resume if started while paused", func(t *testing.T) {
+		var runs atomic.Int32
+		manager := constInput(t, sourceList("a"), &fakeTestInput{
+			OnRun: func(ctx input.Context, _ Source, _ Cursor, _ Publisher) error {
+				runs.Inc()
+				<-ctx.Cancelation.Done()
+				return nil
+			},
+		})
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+		inp.(Pauser).Pause()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		}()
+
+		require.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"a"}, inp.(SourceReporter).ActiveSources())
+		}, time.Second, time.Millisecond)
+		time.Sleep(50 * time.Millisecond)
+		require.Equal(t, int32(0), runs.Load())
+
+		inp.(Pauser).Resume()
+		require.Eventually(t, func() bool { return runs.Load() == 1 }, time.Second, time.Millisecond)
+
+		cancel()
+		wg.Wait()
+		require.NoError(t, err)
+	})
+}
+
+func TestManager_PartitionedSource(t *testing.T) {
+	t.Run("partitions are collected with independent cursors", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		cursors := map[string]string{}
+		manager := constInput(t, []Source{partitionedSource{name: "a", partitions: []string{"p1", "p2"}}}, &fakeTestInput{
+			OnRun: func(ctx input.Context, source Source, cursor Cursor, _ Publisher) error {
+				var state string
+				if err := cursor.Unpack(&state); err != nil {
+					return err
+				}
+				partition := source.(SourcePartition)
+				mu.Lock()
+				cursors[partition.Partition] = state
+				mu.Unlock()
+
+				<-ctx.Cancelation.Done()
+				return nil
+			},
+		})
+		manager.StateStore = createSampleStore(t, map[string]state{
+			"test::a::p1": {TTL: time.Hour, Cursor: "cursor-1"},
+			"test::a::p2": {TTL: time.Hour, Cursor: "cursor-2"},
+		})
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		}()
+
+		require.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"a::p1", "a::p2"}, inp.(SourceReporter).ActiveSources())
+		}, time.Second, time.Millisecond)
+
+		for _, key := range []string{"test::a::p1", "test::a::p2"} {
+			res := manager.store.Get(key)
+			require.False(t, res.lock.TryLock(), "key %v must be locked", key)
+			res.Release()
+		}
+
+		cancel()
+		wg.Wait()
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{"p1": "cursor-1", "p2": "cursor-2"}, cursors)
+	})
+
+	t.Run("fail if no partition is configured", func(t *testing.T) {
+		manager := constInput(t, []Source{partitionedSource{name: "a"}}, &fakeTestInput{})
+		_, err := manager.Create(conf.NewConfig())
+		require.Error(t, err)
+	})
+
+	t.Run("fail if partition collides with another source", func(t *testing.T) {
+		for name, sources := range map[string][]Source{
+			"source":    {partitionedSource{name: "a", partitions: []string{"p"}}, stringSource("a::p")},
+			"partition": {partitionedSource{name: "a", partitions: []string{"b::p"}}, partitionedSource{name: "a::b", partitions: []string{"p"}}},
+		} {
+			manager := constInput(t, sources, &fakeTestInput{})
+			_, err := manager.Create(conf.NewConfig())
+			require.Error(t, err, name)
+		}
+	})
+
+	t.Run("duplicate partitioned sources are removed", func(t *testing.T) {
+		sources := []Source{partitionedSource{name: "a", partitions: []string{"p"}}, partitionedSource{name: "a", partitions: []string{"p"}}}
+		manager := constInput(t, sources, &fakeTestInput{})
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+		require.Equal(t, []string{"a::p"}, inp.(DuplicateReporter).DuplicateSources())
+	})
+}
+
+func TestManager_InjectInputID(t *testing.T) {
+	run := func(t *testing.T, manager *InputManager, config map[string]interface{}) publisher.ProcessingConfig {
+		inp, err := manager.Create(conf.MustNewConfigFrom(config))
+		require.NoError(t, err)
+
+		var cfg publisher.ProcessingConfig
+		pipeline := &pubtest.FakeConnector{
+			ConnectFunc: func(c publisher.ClientConfig) (publisher.Client, error) {
+				cfg = c.Processing
+				return &pubtest.FakeClient{}, nil
+			},
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		require.NoError(t, inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pipeline))
+		return cfg
+	}
+	newManager := func(t *testing.T) *InputManager {
+		return constInput(t, sourceList("a"), &fakeTestInput{
+			OnRun: func(input.Context, Source, Cursor, Publisher) error { return nil },
+		})
+	}
+
+	t.Run("id is not injected by default", func(t *testing.T) {
+		cfg := run(t, newManager(t), map[string]interface{}{"id": "my-input"})
+		require.Nil(t, cfg.Fields)
+	})
+
+	t.Run("id is injected", func(t *testing.T) {
+		manager := newManager(t)
+		manager.InjectInputID = true
+		cfg := run(t, manager, map[string]interface{}{"id": "my-input"})
+		require.Equal(t, mapstr.M{"input": mapstr.M{"id": "my-input"}}, cfg.Fields)
+	})
+
+	t.Run("custom field", func(t *testing.T) {
+		manager := newManager(t)
+		manager.InjectInputID = true
+		manager.InputIDField = "meta.input_id"
+		cfg := run(t, manager, map[string]interface{}{"id": "my-input"})
+		require.Equal(t, mapstr.M{"meta": mapstr.M{"input_id": "my-input"}}, cfg.Fields)
+	})
+
+	t.Run("nothing is injected without id", func(t *testing.T) {
+		manager := newManager(t)
+		manager.InjectInputID = true
+		cfg := run(t, manager, map[string]interface{}{})
+		require.Nil(t, cfg.Fields)
+	})
+}
+
+func TestManager_ClientSource(t *testing.T) {
+	var acked int
+	fields := mapstr.M{"custom": "field"}
+	sources := []Source{
+		stringSource("default"),
+		clientSource{name: "guaranteed", cfg: publisher.ClientConfig{
+			PublishMode: publisher.GuaranteedSend,
+			ACKHandler:  acker.RawCounting(func(n int) { acked += n }),
+			Processing:  publisher.ProcessingConfig{Fields: fields},
+		}},
+		clientSource{name: "drop", cfg: publisher.ClientConfig{PublishMode: publisher.DropIfFull}},
+	}
+	manager := constInput(t, sources, &fakeTestInput{
+		OnRun: func(_ input.Context, source Source, _ Cursor, pub Publisher) error {
+			return pub.Publish(publisher.Event{Fields: mapstr.M{"source": source.Name()}}, "cursor")
+		},
+	})
+	manager.InjectInputID = true
+
+	var mu sync.Mutex
+	configs := map[string]publisher.ClientConfig{}
+	pipeline := &pubtest.FakeConnector{
+		ConnectFunc: func(cfg publisher.ClientConfig) (publisher.Client, error) {
+			return &pubtest.FakeClient{
+				PublishFunc: func(event publisher.Event) {
+					mu.Lock()
+					defer mu.Unlock()
+					configs[event.Fields["source"].(string)] = cfg
+					cfg.ACKHandler.AddEvent(event, true)
+					cfg.ACKHandler.ACKEvents(1)
+				},
+			}, nil
+		},
+	}
+
+	inp, err := manager.Create(conf.MustNewConfigFrom(map[string]interface{}{"id": "my-input"}))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pipeline))
+
+	require.Len(t, configs, 3)
+	require.Equal(t, publisher.DefaultGuarantees, configs["default"].PublishMode)
+	require.Equal(t, publisher.GuaranteedSend, configs["guaranteed"].PublishMode)
+	require.Equal(t, publisher.DropIfFull, configs["drop"].PublishMode)
+	for name, cfg := range configs {
+		require.NotNil(t, cfg.Context, "source %v must be closed by the manager", name)
+	}
+
+	// the ACKer of the source is combined with the ACKer of the manager
+	require.Equal(t, 1, acked)
+	require.Equal(t, map[string]interface{}{"default": "cursor", "guaranteed": "cursor", "drop": "cursor"},
+		inp.(CursorReporter).CursorSnapshot())
+
+	// the input ID is added without modifying the fields of the source
+	require.Equal(t, mapstr.M{"custom": "field", "input": mapstr.M{"id": "my-input"}}, configs["guaranteed"].Processing.Fields)
+	require.Equal(t, mapstr.M{"custom": "field"}, fields)
+}
+
+func TestManager_KeyFormatter(t *testing.T) {
+	run := func(t *testing.T, manager *InputManager, config map[string]interface{}) string {
+		var cursor string
+		manager.Configure = func(_ *conf.C) ([]Source, Input, error) {
+			return sourceList("a"), &fakeTestInput{
+				OnRun: func(_ input.Context, _ Source, c Cursor, _ Publisher) error {
+					return c.Unpack(&cursor)
+				},
+			}, nil
+		}
+		inp, err := manager.Create(conf.MustNewConfigFrom(config))
+		require.NoError(t, err)
+		require.NoError(t, inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pubtest.ConstClient(&pubtest.FakeClient{})))
+		return cursor
+	}
+	store := func(t *testing.T) StateStore {
+		return createSampleStore(t, map[string]state{
+			"test::a":           {TTL: time.Hour, Cursor: "default"},
+			"test::my-input::a": {TTL: time.Hour, Cursor: "default-id"},
+			"test::/my-input/a": {TTL: time.Hour, Cursor: "custom"},
+		})
+	}
+
+	t.Run("default key format", func(t *testing.T) {
+		manager := constInput(t, nil, nil)
+		manager.StateStore = store(t)
+		require.Equal(t, "default", run(t, manager, map[string]interface{}{}))
+
+		manager = constInput(t, nil, nil)
+		manager.StateStore = store(t)
+		require.Equal(t, "default-id", run(t, manager, map[string]interface{}{"id": "my-input"}))
+	})
+
+	t.Run("custom key format", func(t *testing.T) {
+		manager := constInput(t, nil, nil)
+		manager.StateStore = store(t)
+		manager.KeyFormatter = func(typ, id, source string) string {
+			return typ + "::/" + id + "/" + source
+		}
+		require.Equal(t, "custom", run(t, manager, map[string]interface{}{"id": "my-input"}))
+	})
+
+	t.Run("custom key format state is loaded on restart", func(t *testing.T) {
+		formatter := func(typ, id, source string) string {
+			return typ + "::/" + id + "/" + source
+		}
+		store := createSampleStore(t, nil)
+
+		manager := constInput(t, sourceList("a"), &fakeTestInput{
+			OnRun: func(_ input.Context, _ Source, _ Cursor, pub Publisher) error {
+				mustPublish(pub, publisher.Event{}, "published")
+				return nil
+			},
+		})
+		manager.StateStore = store
+		manager.KeyFormatter = formatter
+		pipeline := pubtest.NewTestPipeline()
+		pipeline.AutoACK = true
+		inp, err := manager.Create(conf.MustNewConfigFrom(map[string]interface{}{"id": "my-input"}))
+		require.NoError(t, err)
+		require.NoError(t, inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pipeline))
+
+		manager = constInput(t, nil, nil)
+		manager.StateStore = store
+		manager.KeyFormatter = formatter
+		require.Equal(t, "published", run(t, manager, map[string]interface{}{"id": "my-input"}))
+	})
+
+	t.Run("key without type prefix is rejected", func(t *testing.T) {
+		manager := constInput(t, sourceList("a"), &fakeTestInput{})
+		manager.StateStore = store(t)
+		manager.KeyFormatter = func(_, id, source string) string {
+			return id + "/" + source
+		}
+		config := conf.MustNewConfigFrom(map[string]interface{}{"id": "my-input"})
+		require.Error(t, manager.Validate(config))
+		_, err := manager.Create(config)
+		require.Error(t, err)
+	})
+}
+
+func TestManager_SourceAttributes(t *testing.T) {
+	require.NoError(t, logp.DevelopmentSetup(logp.ToObserverOutput()))
+
+	var mu sync.Mutex
+	attributes := map[string]string{}
+	manager := constInput(t, sourceList("a", "b"), &fakeTestInput{
+		OnRun: func(ctx input.Context, source Source, _ Cursor, _ Publisher) error {
+			ctx.Logger.Info("source started")
+			goCtx := ctx.GoContext()
+			inputID, ok := input.InputIDFromContext(goCtx)
+			require.True(t, ok)
+			name, ok := input.SourceFromContext(goCtx)
+			require.True(t, ok)
+
+			mu.Lock()
+			defer mu.Unlock()
+			attributes[name] = inputID
+			return nil
+		},
+	})
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	require.NoError(t, inp.Run(input.Context{
+		ID:          "my-input",
+		Logger:      manager.Logger,
+		Cancelation: context.Background(),
+	}, pubtest.ConstClient(&pubtest.FakeClient{})))
+	require.Equal(t, map[string]string{"a": "my-input", "b": "my-input"}, attributes)
+
+	logged := map[interface{}]interface{}{}
+	for _, entry := range logp.ObserverLogs().FilterMessage("source started").All() {
+		fields := entry.ContextMap()
+		logged[fields["input_source"]] = fields["input_id"]
+	}
+	require.Equal(t, map[interface{}]interface{}{"a": "my-input", "b": "my-input"}, logged)
+}
+
+func TestManager_CursorSnapshot(t *testing.T) {
+	defer resources.NewGoroutinesChecker().Check(t)
+
+	var wgSend sync.WaitGroup
+	wgSend.Add(1)
+	manager := constInput(t, []Source{stringSource("a"), stringSource("b"), statelessSource("c")}, &fakeTestInput{
+		OnRun: func(ctx input.Context, source Source, _ Cursor, pub Publisher) error {
+			if source.Name() == "b" {
+				mustPublish(pub, publisher.Event{Fields: mapstr.M{"source": "b"}}, "cursor-b")
+				wgSend.Done()
+			}
+			<-ctx.Cancelation.Done()
+			return nil
+		},
+	})
+	manager.StateStore = createSampleStore(t, map[string]state{
+		"test::a": {TTL: time.Hour, Cursor: "cursor-a"},
+		"test::c": {TTL: time.Hour, Cursor: "cursor-c"},
+	})
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	reporter := inp.(CursorReporter)
+	require.Equal(t, map[string]interface{}{"a": "cursor-a"}, reporter.CursorSnapshot())
+
+	// capture the ACKer of the client events have been published to
+	var mu sync.Mutex
+	var acker publisher.ACKer
+	pipeline := &pubtest.FakeConnector{
+		ConnectFunc: func(cfg publisher.ClientConfig) (publisher.Client, error) {
+			return &pubtest.FakeClient{
+				PublishFunc: func(event publisher.Event) {
+					cfg.ACKHandler.AddEvent(event, true)
+					mu.Lock()
+					defer mu.Unlock()
+					acker = cfg.ACKHandler
+				},
+			}, nil
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pipeline)
+	}()
+
+	// cursor updates are included once ACKed
+	wgSend.Wait()
+	require.Equal(t, map[string]interface{}{"a": "cursor-a"}, reporter.CursorSnapshot())
+	mu.Lock()
+	acker.ACKEvents(1)
+	mu.Unlock()
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(map[string]interface{}{"a": "cursor-a", "b": "cursor-b"}, reporter.CursorSnapshot())
+	}, time.Second, time.Millisecond)
+
+	cancel()
+	wg.Wait()
+	require.NoError(t, err)
+}
+
+func TestStringSource(t *testing.T) {
+	t.Run("source is named", func(t *testing.T) {
+		require.Equal(t, "a", StringSource("a").Name())
+	})
+
+	t.Run("sources are created in order", func(t *testing.T) {
+		sources := StringSources("a", "b", "c")
+		names := make([]string, len(sources))
+		for i, source := range sources {
+			names[i] = source.Name()
+		}
+		require.Equal(t, []string{"a", "b", "c"}, names)
+	})
+
+	t.Run("no sources", func(t *testing.T) {
+		require.Empty(t, StringSources())
+	})
+
+	t.Run("sources are stateful", func(t *testing.T) {
+		require.False(t, isStateless(StringSource("a")))
+	})
+}
+
+func TestManager_SeekTo(t *testing.T) {
+	defer resources.NewGoroutinesChecker().Check(t)
+
+	var mu sync.Mutex
+	cursors := map[string]string{}
+	started := make(chan struct{})
+	manager := constInput(t, []Source{stringSource("a"), stringSource("b"), statelessSource("c")}, &fakeTestInput{
+		OnRun: func(ctx input.Context, source Source, cursor Cursor, _ Publisher) error {
+			if isStateless(source) {
+				<-ctx.Cancelation.Done()
+				return nil
+			}
+
+			var value string
+			if err := cursor.Unpack(&value); err != nil {
+				return err
+			}
+			mu.Lock()
+			cursors[source.Name()] = value
+			if len(cursors) == 2 {
+				close(started)
+			}
+			mu.Unlock()
+			<-ctx.Cancelation.Done()
+			return nil
+		},
+	})
+	manager.StateStore = createSampleStore(t, map[string]state{
+		"test::a": {TTL: time.Hour, Cursor: "cursor-a"},
+	})
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	seeker := inp.(CursorSeeker)
+
+	require.NoError(t, seeker.SeekTo("a", "checkpoint-a"))
+	require.NoError(t, seeker.SeekTo("b", "checkpoint-b"))
+	require.Error(t, seeker.SeekTo("c", "checkpoint-c"), "stateless sources have no cursor")
+	require.Error(t, seeker.SeekTo("unknown", "checkpoint"))
+	require.Error(t, seeker.SeekTo("a", make(chan int)), "cursor must be serializable")
+	require.Equal(t, map[string]interface{}{"a": "checkpoint-a", "b": "checkpoint-b"}, inp.(CursorReporter).CursorSnapshot())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	}()
+
+	<-started
+	require.Error(t, seeker.SeekTo("a", "other"), "active sources can not seek")
+	cancel()
+	wg.Wait()
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"a": "checkpoint-a", "b": "checkpoint-b"}, cursors)
+}
+
+func TestManager_WithTransaction(t *testing.T) {
+	defer resources.NewGoroutinesChecker().Check(t)
+
+	started := make(chan struct{})
+	manager := constInput(t, []Source{stringSource("a"), stringSource("b"), stringSource("c"), statelessSource("d")}, &fakeTestInput{
+		OnRun: func(ctx input.Context, source Source, _ Cursor, _ Publisher) error {
+			if source.Name() == "c" {
+				close(started)
+			}
+			<-ctx.Cancelation.Done()
+			return nil
+		},
+	})
+	manager.StateStore = createSampleStore(t, map[string]state{
+		"test::a": {TTL: time.Hour, Cursor: "cursor-a"},
+		"test::b": {TTL: time.Hour, Cursor: "cursor-b"},
+	})
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	transactor := inp.(CursorTransactor)
+	reporter := inp.(CursorReporter)
+
+	t.Run("commit", func(t *testing.T) {
+		err := transactor.WithTransaction(func(tx CursorTx) error {
+			require.NoError(t, tx.Update("a", "checkpoint-a"))
+			require.NoError(t, tx.Update("b", "checkpoint-b"))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{"a": "checkpoint-a", "b": "checkpoint-b"}, reporter.CursorSnapshot())
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		errRollback := errors.New("oops")
+		err := transactor.WithTransaction(func(tx CursorTx) error {
+			require.NoError(t, tx.Update("a", "other-a"))
+			return errRollback
+		})
+		require.Equal(t, errRollback, err)
+		require.Equal(t, map[string]interface{}{"a": "checkpoint-a", "b": "checkpoint-b"}, reporter.CursorSnapshot())
+	})
+
+	t.Run("invalid updates", func(t *testing.T) {
+		err := transactor.WithTransaction(func(tx CursorTx) error {
+			require.Error(t, tx.Update("d", "checkpoint-d"), "stateless sources have no cursor")
+			require.Error(t, tx.Update("unknown", "checkpoint"))
+			require.Error(t, tx.Update("a", make(chan int)), "cursor must be serializable")
+			return nil
+		})
+		require.NoError(t, err)
+	})
+
+	t.Run("source started before commit", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var wg sync.WaitGroup
+		var runErr error
+		err := transactor.WithTransaction(func(tx CursorTx) error {
+			require.NoError(t, tx.Update("a", "other-a"))
+			require.NoError(t, tx.Update("c", "other-c"))
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				runErr = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+			}()
+			<-started
+			return nil
+		})
+		require.Error(t, err)
+		cancel()
+		wg.Wait()
+		require.NoError(t, runErr)
+		require.Equal(t, map[string]interface{}{"a": "checkpoint-a", "b": "checkpoint-b"}, reporter.CursorSnapshot())
+	})
+}
+
+func TestManager_RecoverPanics(t *testing.T) {
+	run := func(t *testing.T, panics int, maxRestarts int) (int, []interface{}, error) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		var runs int
+		var recovered []interface{}
+		manager := constInput(t, sourceList("a"), &fakeTestInput{
+			OnRun: func(_ input.Context, _ Source, _ Cursor, _ Publisher) error {
+				mu.Lock()
+				runs++
+				n := runs
+				mu.Unlock()
+				if n <= panics {
+					panic(fmt.Sprintf("oops %v", n))
+				}
+				return nil
+			},
+		})
+		manager.RecoverPanics = true
+		manager.MaxPanicRestarts = maxRestarts
+		manager.PanicBackoff = time.Millisecond
+		manager.OnPanic = func(source Source, v interface{}) {
+			require.Equal(t, "a", source.Name())
+			mu.Lock()
+			defer mu.Unlock()
+			recovered = append(recovered, v)
+		}
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+		err = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		return runs, recovered, err
+	}
+
+	t.Run("source is restarted after panic", func(t *testing.T) {
+		runs, recovered, err := run(t, 2, 3)
+		require.NoError(t, err)
+		require.Equal(t, 3, runs)
+		require.Equal(t, []interface{}{"oops 1", "oops 2"}, recovered)
+	})
+
+	t.Run("source is stopped after max restarts", func(t *testing.T) {
+		runs, recovered, err := run(t, 10, 2)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "oops 3")
+		require.Equal(t, 3, runs)
+		require.Len(t, recovered, 3)
+	})
+}
+
+func TestManager_StopSource(t *testing.T) {
+	defer resources.NewGoroutinesChecker().Check(t)
+
+	manager := constInput(t, sourceList("a", "b"), &fakeTestInput{
+		OnRun: func(ctx input.Context, source Source, _ Cursor, _ Publisher) error {
+			<-ctx.Cancelation.Done()
+			if source.Name() == "a" {
+				return errors.New("oops")
+			}
+			return nil
+		},
+	})
+
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	stopper := inp.(SourceStopper)
+	require.Error(t, stopper.StopSource("a"), "input is not running")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		err = inp.Run(input.Context{Logger: manager.Logger, Cancelation: ctx}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	}()
+
+	reporter := inp.(SourceReporter)
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"a", "b"}, reporter.ActiveSources())
+	}, time.Second, time.Millisecond)
+
+	require.NoError(t, stopper.StopSource("a"))
+	require.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"b"}, reporter.ActiveSources())
+	}, time.Second, time.Millisecond)
+	require.Error(t, stopper.StopSource("a"))
+	require.Error(t, stopper.StopSource("unknown"))
+
+	// the lock of the stopped source is released
+	res := manager.store.Get("test::a")
+	require.Eventually(t, res.lock.TryLock, time.Second, time.Millisecond)
+	res.lock.Unlock()
+	res.Release()
+
+	cancel()
+	wg.Wait()
+	require.NoError(t, err)
+}
+
+func TestManager_WorkerPool(t *testing.T) {
+	runInput := func(t *testing.T, manager *InputManager) error {
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+		return inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pubtest.ConstClient(&pubtest.FakeClient{}))
+	}
+
+	t.Run("sources yield after each batch", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var collected []string
+		var stopped []string
+		manager := constInput(t, sourceList("a", "b"), &yieldingTestInput{
+			OnCollect: func(_ input.Context, source Source, cursor Cursor, pub Publisher, batchLimit int) (bool, error) {
+				require.Equal(t, 1024, batchLimit)
+
+				var n int
+				require.NoError(t, cursor.Unpack(&n))
+				collected = append(collected, fmt.Sprintf("%v%v", source.Name(), n))
+				mustPublish(pub, publisher.Event{}, n+1)
+				return n == 1, nil
+			},
+		})
+		manager.WorkerPoolSize = 1
+		manager.OnSourceStop = func(source Source, err error) {
+			require.NoError(t, err)
+			stopped = append(stopped, source.Name())
+		}
+
+		require.NoError(t, runInput(t, manager))
+		require.Equal(t, []string{"a0", "b0", "a1", "b1"}, collected)
+		require.Equal(t, []string{"a", "b"}, stopped)
+	})
+
+	t.Run("number of workers is limited", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		var active, maxActive, batches int
+		manager := constInput(t, sourceList("a", "b", "c", "d", "e"), &yieldingTestInput{
+			OnCollect: func(_ input.Context, _ Source, _ Cursor, _ Publisher, batchLimit int) (bool, error) {
+				require.Equal(t, 10, batchLimit)
+
+				mu.Lock()
+				active++
+				batches++
+				if active > maxActive {
+					maxActive = active
+				}
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+				return true, nil
+			},
+		})
+		manager.WorkerPoolSize = 2
+		manager.WorkerBatchLimit = 10
+
+		require.NoError(t, runInput(t, manager))
+		require.Equal(t, 5, batches)
+		require.LessOrEqual(t, maxActive, 2)
+	})
+
+	t.Run("failing source stops the input", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		manager := constInput(t, sourceList("a", "b"), &yieldingTestInput{
+			OnCollect: func(ctx input.Context, source Source, _ Cursor, _ Publisher, _ int) (bool, error) {
+				if source.Name() == "a" {
+					return false, errors.New("oops")
+				}
+				return false, nil
+			},
+		})
+		manager.WorkerPoolSize = 2
+
+		err := runInput(t, manager)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "oops")
+	})
+
+	t.Run("panicking source is restarted", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var batches int
+		var recovered []interface{}
+		manager := constInput(t, sourceList("a"), &yieldingTestInput{
+			OnCollect: func(_ input.Context, _ Source, _ Cursor, _ Publisher, _ int) (bool, error) {
+				batches++
+				if batches == 1 {
+					panic("oops")
+				}
+				return true, nil
+			},
+		})
+		manager.WorkerPoolSize = 1
+		manager.RecoverPanics = true
+		manager.PanicBackoff = time.Millisecond
+		manager.OnPanic = func(_ Source, v interface{}) {
+			recovered = append(recovered, v)
+		}
+
+		require.NoError(t, runInput(t, manager))
+		require.Equal(t, 2, batches)
+		require.Equal(t, []interface{}{"oops"}, recovered)
+	})
+
+	t.Run("sources share slots between batches", func(t *testing.T) {
+		defer resources.NewGoroutinesChecker().Check(t)
+
+		var mu sync.Mutex
+		var active, maxActive int
+		batches := map[string]int{}
+		manager := constInput(t, sourceList("a", "b", "c"), &yieldingTestInput{
+			OnCollect: func(_ input.Context, source Source, _ Cursor, _ Publisher, _ int) (bool, error) {
+				mu.Lock()
+				active++
+				if active > maxActive {
+					maxActive = active
+				}
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond)
+
+				mu.Lock()
+				defer mu.Unlock()
+				active--
+				batches[source.Name()]++
+				return batches[source.Name()] == 3, nil
+			},
+		})
+		manager.WorkerPoolSize = 2
+		manager.MaxConcurrentSources = 1
+
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+		done := make(chan error, 1)
+		go func() {
+			done <- inp.Run(input.Context{
+				Logger:      manager.Logger,
+				Cancelation: context.Background(),
+			}, pubtest.ConstClient(&pubtest.FakeClient{}))
+		}()
+		select {
+		case err := <-done:
+			require.NoError(t, err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("worker pool did not finish")
+		}
+		require.Equal(t, map[string]int{"a": 3, "b": 3, "c": 3}, batches)
+		require.Equal(t, 1, maxActive)
+	})
+
+	t.Run("input must implement YieldingInput", func(t *testing.T) {
+		manager := constInput(t, sourceList("a"), &fakeTestInput{})
+		manager.WorkerPoolSize = 1
+		_, err := manager.Create(conf.NewConfig())
+		require.Error(t, err)
+	})
+}
+
+func TestManager_ExportImportState(t *testing.T) {
+	updated := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+	states := map[string]state{
+		"test::a": {TTL: time.Minute, Updated: updated, Cursor: "cursor-a"},
+		"test::b": {TTL: time.Hour, Updated: updated, Cursor: map[string]interface{}{"offset": "10"}},
+	}
+
+	t.Run("state can be restored", func(t *testing.T) {
+		source := constInput(t, nil, nil)
+		source.StateStore = createSampleStore(t, states)
+
+		var buf bytes.Buffer
+		require.NoError(t, source.ExportState(&buf))
+
+		target := constInput(t, nil, nil)
+		store := createSampleStore(t, nil)
+		target.StateStore = store
+		require.NoError(t, target.ImportState(&buf))
+
+		checkEqualStoreState(t, states, store.snapshot())
+		checkEqualStoreState(t, states, storeInSyncSnapshot(target.store))
+	})
+
+	t.Run("keys of other input types are rejected", func(t *testing.T) {
+		manager := constInput(t, nil, nil)
+		err := manager.ImportState(strings.NewReader(`{"other::a": {}}`))
+		require.Error(t, err)
+	})
+
+	t.Run("locked keys are not overwritten", func(t *testing.T) {
+		store := createSampleStore(t, states)
+		manager := constInput(t, nil, nil)
+		manager.StateStore = store
+
+		require.NoError(t, manager.init())
+		res := manager.store.Get("test::a")
+		require.NoError(t, lockResource(manager.Logger, nopMetrics{}, res, context.TODO(), 0))
+		defer releaseResource(res)
+
+		err := manager.ImportState(strings.NewReader(`{"test::a": {"Cursor": "new"}, "test::b": {"Cursor": "new"}}`))
+		require.Error(t, err)
+		checkEqualStoreState(t, states, store.snapshot())
+	})
+}
+
+func TestManager_StateHooks(t *testing.T) {
+	type access struct {
+		key    string
+		cursor interface{}
+	}
+	var mu sync.Mutex
+	var reads, writes []access
+
+	manager := constInput(t, sourceList("a"), &fakeTestInput{
+		OnRun: func(_ input.Context, _ Source, _ Cursor, pub Publisher) error {
+			mustPublish(pub, publisher.Event{}, "cursor-new")
+			return nil
+		},
+	})
+	manager.StateStore = createSampleStore(t, map[string]state{
+		"test::a": {TTL: time.Hour, Cursor: "cursor-old"},
+	})
+	manager.OnStateRead = func(key string, cursor interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		reads = append(reads, access{key, cursor})
+	}
+	manager.OnStateWrite = func(key string, cursor interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		writes = append(writes, access{key, cursor})
+	}
+
+	pipeline := pubtest.NewTestPipeline()
+	pipeline.AutoACK = true
+	inp, err := manager.Create(conf.NewConfig())
+	require.NoError(t, err)
+	require.NoError(t, inp.Run(input.Context{
+		Logger:      manager.Logger,
+		Cancelation: context.Background(),
+	}, pipeline))
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, []access{{"test::a", "cursor-old"}}, reads)
+	require.Equal(t, []access{{"test::a", "cursor-new"}}, writes)
+}
+
+func TestManager_Compact(t *testing.T) {
+	now := time.Now()
+	store := createSampleStore(t, map[string]state{
+		"test::a":      {TTL: time.Hour, Updated: now, Cursor: "cursor-a"},
+		"test::locked": {TTL: time.Hour, Updated: now, Cursor: "cursor-locked"},
+		"test::old":    {TTL: time.Hour, Updated: now, ExpiresAt: now.Add(-time.Minute), Cursor: "cursor-old"},
+		"other::a":     {TTL: time.Hour, Updated: now, Cursor: "cursor-other"},
+	})
+	manager := constInput(t, nil, nil)
+	manager.StateStore = store
+	require.Equal(t, CompactionStats{}, manager.CompactionStats())
+
+	require.NoError(t, manager.init())
+	res := manager.store.Get("test::locked")
+	require.NoError(t, lockResource(manager.Logger, nopMetrics{}, res, context.TODO(), 0))
+	defer releaseResource(res)
+
+	require.NoError(t, manager.Compact())
+
+	stats := manager.CompactionStats()
+	require.Equal(t, 3, stats.KeysBefore)
+	require.Equal(t, 2, stats.KeysAfter)
+	require.Equal(t, 1, stats.Removed)
+	require.Equal(t, 1, stats.Skipped)
+	require.False(t, stats.Started.IsZero())
+
+	snapshot := store.snapshot()
+	require.NotContains(t, snapshot, "test::old")
+	require.Equal(t, "cursor-a", snapshot["test::a"].Cursor)
+	require.Equal(t, "cursor-locked", snapshot["test::locked"].Cursor)
+	require.Equal(t, "cursor-other", snapshot["other::a"].Cursor)
+}
+
+func mustPublish(p Publisher, e publisher.Event, cursor interface{}) {
+	err := p.Publish(e, cursor)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func TestLockResource(t *testing.T) {
+	t.Run("can lock unused resource", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		res := store.Get("test::key")
+		err := lockResource(logp.NewLogger("test"), nopMetrics{}, res, context.TODO(), 0)
+		require.NoError(t, err)
+	})
+
+	t.Run("fail to lock resource in use when context is cancelled", func(t *testing.T) {
+		log := logp.NewLogger("test")
+
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		resUsed := store.Get("test::key")
+		err := lockResource(log, nopMetrics{}, resUsed, context.TODO(), 0)
+		require.NoError(t, err)
+
+		// fail to lock resource in use
+		ctx, cancel := context.WithCancel(context.TODO())
+		cancel()
+		resFail := store.Get("test::key")
+		err = lockResource(log, nopMetrics{}, resFail, ctx, 0)
+		require.Error(t, err)
+		resFail.Release()
+
+		// unlock and release resource in use -> it should be marked finished now
+		releaseResource(resUsed)
+		require.True(t, resUsed.Finished())
+	})
+
+	t.Run("succeed to lock resource after it has been released", func(t *testing.T) {
+		log := logp.NewLogger("test")
+
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		resUsed := store.Get("test::key")
+		err := lockResource(log, nopMetrics{}, resUsed, context.TODO(), 0)
+		require.NoError(t, err)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resOther := store.Get("test::key")
+			err := lockResource(log, nopMetrics{}, resOther, context.TODO(), 0)
+			if err == nil {
+				releaseResource(resOther)
+			}
+		}()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			releaseResource(resUsed)
+		}()
+
+		wg.Wait() // <- block forever if waiting go-routine can not acquire lock
+	})
+	t.Run("fail with ErrLockTimeout if resource is not released in time", func(t *testing.T) {
+		log := logp.NewLogger("test")
+
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		resUsed := store.Get("test::key")
+		require.NoError(t, lockResource(log, nopMetrics{}, resUsed, context.TODO(), 0))
+		defer releaseResource(resUsed)
+
+		resFail := store.Get("test::key")
+		defer resFail.Release()
+		err := lockResource(log, nopMetrics{}, resFail, context.TODO(), 10*time.Millisecond)
+		require.ErrorIs(t, err, ErrLockTimeout)
+	})
+}
+
+func (s stringSource) Name() string { return string(s) }
+
+func (s timedSource) Name() string                { return s.name }
+func (s timedSource) CleanTimeout() time.Duration { return s.timeout }
+
+func (s statelessSource) Name() string    { return string(s) }
+func (s statelessSource) Stateless() bool { return true }
+
+func (s partitionedSource) Name() string         { return s.name }
+func (s partitionedSource) Partitions() []string { return s.partitions }
+
+func (s clientSource) Name() string                         { return s.name }
+func (s clientSource) ClientConfig() publisher.ClientConfig { return s.cfg }
+
+func (m *testMetrics) SourceActive(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.active += delta
+}
+
+func (m *testMetrics) SourceBlocked(delta int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.blocked += delta
+}
+
+func (m *testMetrics) CleanupRun(keys int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.cleanups = append(m.cleanups, keys)
+}
+
+func (m *testMetrics) Active() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.active
+}
+
+func (m *testMetrics) Blocked() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.blocked
+}
+
+func (m *testMetrics) Cleanups() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]int(nil), m.cleanups...)
+}
+
+func simpleManagerWithConfigure(t *testing.T, configure func(*conf.C) ([]Source, Input, error)) *InputManager {
+	return &InputManager{
+		Logger:     logp.NewLogger("test"),
+		StateStore: createSampleStore(t, nil),
+		Type:       "test",
+		Configure:  configure,
+	}
+}
+
+func constConfigureResult(t *testing.T, sources []Source, inp Input, err error) *InputManager {
+	return simpleManagerWithConfigure(t, func(cfg *conf.C) ([]Source, Input, error) {
+		return sources, inp, err
+	})
+}
+
+func failingManager(t *testing.T, err error) *InputManager {
+	return constConfigureResult(t, nil, nil, err)
+}
+
+func constInput(t *testing.T, sources []Source, inp Input) *InputManager {
+	return constConfigureResult(t, sources, inp, nil)
+}
+
+func (f *fakeTestInput) Name() string { return "test" }
+
+func (f *fakeTestInput) Test(source Source, ctx input.TestContext) error {
+	if f.OnTest != nil {
+		return f.OnTest(source, ctx)
+	}
+	return nil
+}
+
+func (f *fakeTestInput) Run(ctx input.Context, source Source, cursor Cursor, pub Publisher) error {
+	if f.OnRun != nil {
+		return f.OnRun(ctx, source, cursor, pub)
+	}
+	return nil
+}
+
+func (f *yieldingTestInput) Collect(ctx input.Context, source Source, cursor Cursor, pub Publisher, batchLimit int) (bool, error) {
+	if f.OnCollect != nil {
+		return f.OnCollect(ctx, source, cursor, pub, batchLimit)
+	}
+	return true, nil
 }
 
 func sourceList(names ...string) []Source {
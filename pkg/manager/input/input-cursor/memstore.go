@@ -0,0 +1,42 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cursor
+
+import (
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/statestore"
+	"github.com/elastic/elastic-agent-inputs/pkg/statestore/storetest"
+)
+
+// memoryStateStore implements StateStore, keeping all state in memory.
+type memoryStateStore struct {
+	registry *statestore.Registry
+}
+
+// memoryStoreName is the name of the store in the in memory registry.
+const memoryStoreName = "cursor"
+
+// NewInMemoryStateStore creates a StateStore that keeps all state in memory.
+// The state is shared between all InputManagers using the same StateStore
+// instance, and is lost once the StateStore is not used anymore.
+// The in memory StateStore is meant to be used in unit tests for inputs, such
+// that no registry file needs to be created.
+func NewInMemoryStateStore() StateStore {
+	return &memoryStateStore{
+		registry: statestore.NewRegistry(storetest.NewMemoryStoreBackend()),
+	}
+}
+
+func (m *memoryStateStore) Access() (PersistentStore, error) {
+	store, err := m.registry.Get(memoryStoreName)
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// CleanupInterval returns 0, making the InputManager use its default interval.
+func (m *memoryStateStore) CleanupInterval() time.Duration { return 0 }
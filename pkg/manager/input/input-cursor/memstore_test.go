@@ -0,0 +1,70 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cursor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	pubtest "github.com/elastic/elastic-agent-inputs/pkg/publisher/testing"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestInMemoryStateStore(t *testing.T) {
+	stateStore := NewInMemoryStateStore()
+
+	var seen []int
+	newManager := func() *InputManager {
+		return &InputManager{
+			Logger:     logp.NewLogger("test"),
+			StateStore: stateStore,
+			Type:       "test",
+			Configure: func(_ *conf.C) ([]Source, Input, error) {
+				return sourceList("source"), &fakeTestInput{
+					OnRun: func(_ input.Context, _ Source, cursor Cursor, pub Publisher) error {
+						var n int
+						if err := cursor.Unpack(&n); err != nil {
+							return err
+						}
+						seen = append(seen, n)
+						return pub.Publish(publisher.Event{}, n+1)
+					},
+				}, nil
+			},
+		}
+	}
+
+	// pipeline ACKing all events immediately
+	pipeline := &pubtest.FakeConnector{
+		ConnectFunc: func(cfg publisher.ClientConfig) (publisher.Client, error) {
+			return &pubtest.FakeClient{
+				PublishFunc: func(event publisher.Event) {
+					cfg.ACKHandler.AddEvent(event, true)
+					cfg.ACKHandler.ACKEvents(1)
+				},
+			}, nil
+		},
+	}
+
+	for i := 0; i < 3; i++ {
+		manager := newManager()
+		inp, err := manager.Create(conf.NewConfig())
+		require.NoError(t, err)
+
+		err = inp.Run(input.Context{
+			Logger:      manager.Logger,
+			Cancelation: context.Background(),
+		}, pipeline)
+		require.NoError(t, err)
+		manager.shutdown()
+	}
+
+	require.Equal(t, []int{0, 1, 2}, seen)
+}
@@ -0,0 +1,240 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cursor
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
+)
+
+// sourcePool holds the sources that are ready to be collected by the workers
+// of an input run. Sources are collected in FIFO order.
+type sourcePool struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	ready []*poolTask
+
+	// pending is the number of sources that have not been stopped yet. The
+	// workers return once all sources have been stopped.
+	pending int
+}
+
+// poolTask holds the state of a source collected by the worker pool, in
+// between two batches.
+type poolTask struct {
+	source Source
+	ctx    input.Context
+	worker *sourceWorker
+
+	// closeSource is set once the source has been opened.
+	closeSource func()
+	cursor      Cursor
+	pub         *cursorPublisher
+
+	restarts int
+	backoff  time.Duration
+}
+
+func newSourcePool() *sourcePool {
+	p := &sourcePool{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+// add adds a new source to the pool.
+func (p *sourcePool) add(task *poolTask) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending++
+	p.ready = append(p.ready, task)
+	p.cond.Signal()
+}
+
+// push puts a source back into the pool, once it is ready to be collected
+// again.
+func (p *sourcePool) push(task *poolTask) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ready = append(p.ready, task)
+	p.cond.Signal()
+}
+
+// next blocks until a source is ready to be collected. False is returned once
+// all sources have been stopped.
+func (p *sourcePool) next() (*poolTask, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(p.ready) == 0 && p.pending > 0 {
+		p.cond.Wait()
+	}
+	if len(p.ready) == 0 {
+		return nil, false
+	}
+	task := p.ready[0]
+	p.ready[0] = nil
+	p.ready = p.ready[1:]
+	return task, true
+}
+
+// done marks a source as stopped.
+func (p *sourcePool) done() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pending--
+	if p.pending == 0 {
+		p.cond.Broadcast()
+	}
+}
+
+// runPoolWorker collects batches from the sources of run, until all sources
+// have been stopped.
+func (inp *managedInput) runPoolWorker(run *inputRun) {
+	for {
+		task, ok := run.pool.next()
+		if !ok {
+			return
+		}
+		if stopped, err := inp.collectTask(run, task); stopped {
+			inp.stopTask(run, task, err)
+		}
+	}
+}
+
+// collectTask collects the next batch of task. The source is opened when it
+// is collected for the first time. collectTask reports whether the source
+// has been stopped. Otherwise the task has been put back into the pool.
+// If the input is paused, the worker waits for the input to be resumed
+// before collecting the batch.
+func (inp *managedInput) collectTask(run *inputRun, task *poolTask) (stopped bool, err error) {
+	ctx := task.ctx
+	defer func() {
+		if v := recover(); v != nil {
+			stopped = true
+			err = fmt.Errorf("input panic with: %+v\n%s", v, debug.Stack())
+			ctx.Logger.Errorf("Input crashed with: %+v", err)
+		}
+	}()
+
+	if paused, _, resumeCh := inp.pauseState(); paused {
+		select {
+		case <-resumeCh:
+		case <-ctx.Cancelation.Done():
+		}
+	}
+	if ctx.Cancelation.Err() != nil {
+		return true, nil
+	}
+
+	// The source slot is only held while a batch is collected, such that
+	// sources waiting in the pool can be collected once a source yields.
+	if err := inp.acquireBatchSlot(task); err != nil {
+		return true, nil
+	}
+	defer inp.manager.releaseSourceSlot()
+
+	if task.closeSource == nil {
+		if fn := inp.manager.OnSourceStart; fn != nil {
+			fn(task.source)
+		}
+		client, cursor, closeSource, err := inp.openSource(ctx, inp.manager.store, task.source, run.pipeline, false)
+		if err != nil {
+			return true, err
+		}
+		task.closeSource = closeSource
+		task.cursor = cursor
+		task.pub = &cursorPublisher{canceler: ctx.Cancelation, client: client, cursor: &task.cursor}
+	}
+
+	done, err := inp.callCollect(task)
+	var panicErr *sourcePanicError
+	if errors.As(err, &panicErr) {
+		return inp.restartTask(run, task, panicErr)
+	}
+	if done || err != nil {
+		return true, err
+	}
+	run.pool.push(task)
+	return false, nil
+}
+
+// acquireBatchSlot waits for a source slot to collect the next batch of
+// task. Unlike acquireSourceSlot, waiting is not logged, as sources in the
+// pool wait for a slot on every batch.
+func (inp *managedInput) acquireBatchSlot(task *poolTask) error {
+	slots := inp.manager.sourceSlots
+	if slots == nil || slots.tryAcquire() {
+		return nil
+	}
+	return slots.acquire(task.ctx.Cancelation, inp.manager.sourcePriority(task.source))
+}
+
+// callCollect calls YieldingInput.Collect. Panics are returned as
+// sourcePanicError if RecoverPanics is set.
+func (inp *managedInput) callCollect(task *poolTask) (done bool, err error) {
+	if inp.manager.RecoverPanics {
+		defer func() {
+			if v := recover(); v != nil {
+				err = &sourcePanicError{value: v, stack: debug.Stack()}
+			}
+		}()
+	}
+	return inp.input.(YieldingInput).Collect(task.ctx, task.source, task.cursor, task.pub, inp.manager.workerBatchLimit())
+}
+
+// restartTask puts task back into the pool after the panic backoff, unless
+// the source has been restarted MaxPanicRestarts times already.
+func (inp *managedInput) restartTask(run *inputRun, task *poolTask, panicErr *sourcePanicError) (stopped bool, err error) {
+	ctx := task.ctx
+	ctx.Logger.Errorf("Input crashed with: %+v", panicErr)
+	if inp.manager.OnPanic != nil {
+		inp.manager.OnPanic(task.source, panicErr.value)
+	}
+	if task.restarts >= inp.manager.maxPanicRestarts() {
+		return true, fmt.Errorf("source has been restarted %v times after panics: %w", task.restarts, panicErr)
+	}
+	task.restarts++
+
+	backoff := task.backoff
+	task.backoff *= 2
+	ctx.Logger.Infof("Restarting source in %v (restart %v of %v)", backoff, task.restarts, inp.manager.maxPanicRestarts())
+	go func() {
+		timer := time.NewTimer(backoff)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Cancelation.Done():
+		}
+		run.pool.push(task)
+	}()
+	return false, nil
+}
+
+// stopTask closes the source of task, once the source has been stopped
+// with err. The error is reported by Run, unless the source has been removed
+// by Reload or StopSource.
+func (inp *managedInput) stopTask(run *inputRun, task *poolTask, err error) {
+	defer run.pool.done()
+
+	if task.closeSource != nil {
+		task.closeSource()
+	}
+	task.worker.cancel()
+
+	err = inp.sourceStopped(run, task.source.Name(), task.worker, err)
+	if err != nil {
+		inp.runMu.Lock()
+		run.errs = append(run.errs, err)
+		inp.runMu.Unlock()
+	}
+	if fn := inp.manager.OnSourceStop; fn != nil {
+		fn(task.source, err)
+	}
+}
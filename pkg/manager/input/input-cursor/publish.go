@@ -9,7 +9,6 @@ import (
 
 	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
 	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
-	"github.com/elastic/elastic-agent-inputs/pkg/statestore"
 	"github.com/elastic/elastic-agent-libs/transform/typeconv"
 )
 
@@ -20,6 +19,23 @@ type Publisher interface {
 	Publish(event publisher.Event, cursor interface{}) error
 }
 
+// ExpiringUpdate can be passed as cursor update to Publisher.Publish, in
+// order to set an expiry time for the state of the source. Cursor is
+// applied like a plain cursor update. Once the update has been persisted, the
+// store cleaner removes the state after ExpiresAt, independent of the
+// clean_timeout setting and of later updates. Updates that do not set
+// ExpiresAt keep the expiry time of earlier updates.
+//
+// The state is not removed while the source is collected by an input,
+// because the input holds the lock of the source. The cleaner removes the
+// expired state once the input has released the lock and all pending
+// updates have been persisted. Inputs must check the expiry time themselves
+// if the state must not be used after expiry while the input is running.
+type ExpiringUpdate struct {
+	Cursor    interface{}
+	ExpiresAt time.Time
+}
+
 // cursorPublisher implements the Publisher interface and used internally by the managedInput.
 // When publishing an event with cursor state updates, the cursorPublisher
 // updates the in memory state and create an updateOp that is used to schedule
@@ -42,6 +58,7 @@ type updateOp struct {
 
 	// state updates to persist
 	timestamp time.Time
+	expiresAt time.Time
 	delta     interface{}
 }
 
@@ -50,8 +67,9 @@ type updateOp struct {
 // It overwrite event.Private with the update operation, before finally sending the event.
 // The ACK ordering in the publisher pipeline guarantees that update operations
 // will be ACKed and executed in the correct order.
+// The cursor update is ignored if the source is stateless.
 func (c *cursorPublisher) Publish(event publisher.Event, cursorUpdate interface{}) error {
-	if cursorUpdate == nil {
+	if cursorUpdate == nil || c.cursor.resource == nil {
 		return c.forward(event)
 	}
 
@@ -75,6 +93,11 @@ func (c *cursorPublisher) forward(event publisher.Event) error {
 func createUpdateOp(store *store, resource *resource, updates interface{}) (*updateOp, error) {
 	ts := time.Now()
 
+	var expiresAt time.Time
+	if update, ok := updates.(ExpiringUpdate); ok {
+		updates, expiresAt = update.Cursor, update.ExpiresAt
+	}
+
 	resource.stateMutex.Lock()
 	defer resource.stateMutex.Unlock()
 
@@ -83,6 +106,7 @@ func createUpdateOp(store *store, resource *resource, updates interface{}) (*upd
 		var tmp interface{}
 		_ = typeconv.Convert(&tmp, cursor)
 		resource.pendingCursor = tmp
+		resource.pendingExpiresAt = time.Time{}
 		cursor = tmp
 	}
 	if err := typeconv.Convert(&cursor, updates); err != nil {
@@ -90,12 +114,21 @@ func createUpdateOp(store *store, resource *resource, updates interface{}) (*upd
 	}
 	resource.pendingCursor = cursor
 
+	// The ACK handler only executes the last operation of an ACKed batch.
+	// The expiry time of earlier pending operations is carried forward, such
+	// that it is not lost if a later operation does not set an expiry time.
+	if expiresAt.IsZero() {
+		expiresAt = resource.pendingExpiresAt
+	}
+	resource.pendingExpiresAt = expiresAt
+
 	resource.Retain()
 	resource.activeCursorOperations++
 	return &updateOp{
 		resource:  resource,
 		store:     store,
 		timestamp: ts,
+		expiresAt: expiresAt,
 		delta:     updates,
 	}, nil
 }
@@ -108,6 +141,7 @@ func (op *updateOp) done(n uint) {
 }
 
 // Execute updates the persistent store with the scheduled changes and releases the resource.
+// The write to the persistent store is deferred if the store throttles cursor writes.
 func (op *updateOp) Execute(n uint) {
 	resource := op.resource
 	defer op.done(n)
@@ -119,6 +153,7 @@ func (op *updateOp) Execute(n uint) {
 	if resource.activeCursorOperations == 0 {
 		resource.cursor = resource.pendingCursor
 		resource.pendingCursor = nil
+		resource.pendingExpiresAt = time.Time{}
 	} else {
 		_ = typeconv.Convert(&resource.cursor, op.delta)
 	}
@@ -126,14 +161,9 @@ func (op *updateOp) Execute(n uint) {
 	if resource.internalState.Updated.Before(op.timestamp) {
 		resource.internalState.Updated = op.timestamp
 	}
-
-	err := op.store.persistentStore.Set(resource.key, resource.inSyncStateSnapshot())
-	if err != nil {
-		if !statestore.IsClosed(err) {
-			op.store.log.Errorf("Failed to update state in the registry for '%v'", resource.key)
-		}
-	} else {
-		resource.internalInSync = true
-		resource.stored = true
+	if !op.expiresAt.IsZero() {
+		resource.internalState.ExpiresAt = op.expiresAt
 	}
+
+	op.store.writeCursor(resource)
 }
@@ -7,6 +7,7 @@ package cursor
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -47,6 +48,72 @@ func TestPublish(t *testing.T) {
 		require.Nil(t, actual.Private)
 	})
 
+	t.Run("cursor state is ignored for stateless source", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+		cursor := makeCursor(store, nil)
+
+		var actual publisher.Event
+		client := &pubtest.FakeClient{
+			PublishFunc: func(event publisher.Event) { actual = event },
+		}
+		p := cursorPublisher{nil, client, &cursor}
+		err := p.Publish(publisher.Event{}, "test")
+		require.NoError(t, err)
+		require.Nil(t, actual.Private)
+	})
+
+	t.Run("expiry time is persisted with the cursor", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+		res := store.Get("test::key")
+		defer res.Release()
+		cursor := makeCursor(store, res)
+
+		var actual publisher.Event
+		client := &pubtest.FakeClient{
+			PublishFunc: func(event publisher.Event) { actual = event },
+		}
+		expiresAt := time.Now().Add(time.Hour).Round(0)
+		p := cursorPublisher{nil, client, &cursor}
+		err := p.Publish(publisher.Event{}, ExpiringUpdate{Cursor: "test", ExpiresAt: expiresAt})
+		require.NoError(t, err)
+
+		actual.Private.(*updateOp).Execute(1)
+		st := storeInSyncSnapshot(store)["test::key"]
+		require.Equal(t, "test", st.Cursor)
+		require.Equal(t, expiresAt, st.ExpiresAt)
+
+		// updates without expiry time keep the expiry time
+		require.NoError(t, p.Publish(publisher.Event{}, "updated"))
+		actual.Private.(*updateOp).Execute(1)
+		st = storeInSyncSnapshot(store)["test::key"]
+		require.Equal(t, "updated", st.Cursor)
+		require.Equal(t, expiresAt, st.ExpiresAt)
+	})
+
+	t.Run("expiry time is kept if ACKed with later updates", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+		res := store.Get("test::key")
+		defer res.Release()
+		cursor := makeCursor(store, res)
+
+		ackHandler := newInputACKHandler()
+		client := &pubtest.FakeClient{
+			PublishFunc: func(event publisher.Event) { ackHandler.AddEvent(event, true) },
+		}
+		expiresAt := time.Now().Add(time.Hour).Round(0)
+		p := cursorPublisher{nil, client, &cursor}
+		require.NoError(t, p.Publish(publisher.Event{}, ExpiringUpdate{Cursor: "test", ExpiresAt: expiresAt}))
+		require.NoError(t, p.Publish(publisher.Event{}, "updated"))
+		ackHandler.ACKEvents(2)
+
+		st := storeInSyncSnapshot(store)["test::key"]
+		require.Equal(t, "updated", st.Cursor)
+		require.Equal(t, expiresAt, st.ExpiresAt)
+	})
+
 	t.Run("publish returns error if context has been cancelled", func(t *testing.T) {
 		ctx, cancel := context.WithCancel(context.TODO())
 		cancel()
@@ -136,6 +203,53 @@ func TestOp_Execute(t *testing.T) {
 		assert.Equal(t, "test-updated-cursor-state-intermediate", inSyncCursor)
 		assert.Equal(t, "test-updated-cursor-state-final", inMemCursor)
 	})
+
+	t.Run("cursor writes are coalesced within the flush interval", func(t *testing.T) {
+		backend := createSampleStore(t, nil)
+		store := testOpenStore(t, backend)
+		defer store.Release()
+		store.flushInterval = time.Hour
+		res := store.Get("test::key")
+
+		op1 := mustCreateUpdateOp(t, store, res, "test-updated-cursor-state-first")
+		op2 := mustCreateUpdateOp(t, store, res, "test-updated-cursor-state-second")
+		op3 := mustCreateUpdateOp(t, store, res, "test-updated-cursor-state-final")
+		res.Release()
+
+		// first write is not throttled
+		op1.Execute(1)
+		assert.Equal(t, "test-updated-cursor-state-first", backend.snapshot()["test::key"].Cursor)
+
+		// later writes are deferred, while the in memory state is updated
+		op2.Execute(1)
+		op3.Execute(1)
+		assert.Equal(t, "test-updated-cursor-state-first", backend.snapshot()["test::key"].Cursor)
+		assert.Equal(t, "test-updated-cursor-state-final", storeInSyncSnapshot(store)["test::key"].Cursor)
+		require.False(t, res.Finished(), "resource must not be collected while writes are deferred")
+
+		store.flushPending()
+		assert.Equal(t, "test-updated-cursor-state-final", backend.snapshot()["test::key"].Cursor)
+		require.True(t, res.Finished())
+	})
+
+	t.Run("deferred cursor writes are flushed after the interval", func(t *testing.T) {
+		backend := createSampleStore(t, nil)
+		store := testOpenStore(t, backend)
+		defer store.Release()
+		store.flushInterval = 10 * time.Millisecond
+		res := store.Get("test::key")
+
+		op1 := mustCreateUpdateOp(t, store, res, "test-updated-cursor-state-first")
+		op2 := mustCreateUpdateOp(t, store, res, "test-updated-cursor-state-final")
+		res.Release()
+		op1.Execute(1)
+		op2.Execute(1)
+
+		require.Eventually(t, func() bool {
+			return backend.snapshot()["test::key"].Cursor == "test-updated-cursor-state-final"
+		}, time.Second, time.Millisecond)
+		require.Eventually(t, res.Finished, time.Second, time.Millisecond)
+	})
 }
 
 func mustCreateUpdateOp(t *testing.T, store *store, resource *resource, updates interface{}) *updateOp {
@@ -0,0 +1,127 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package cursor
+
+import (
+	"container/heap"
+	"sync"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
+)
+
+// sourceSlots limits the number of sources collected concurrently. Sources
+// waiting for a slot are queued by priority. Sources with the same priority
+// get a slot in the order they started waiting.
+type sourceSlots struct {
+	mu      sync.Mutex
+	free    int
+	seq     uint64
+	waiting slotQueue
+}
+
+type slotWaiter struct {
+	priority int
+	seq      uint64
+	index    int
+	granted  chan struct{}
+}
+
+// slotQueue implements heap.Interface. The waiter with the highest priority,
+// and the lowest sequence number for equal priorities, is at the top.
+type slotQueue []*slotWaiter
+
+func newSourceSlots(n int) *sourceSlots {
+	return &sourceSlots{free: n}
+}
+
+// tryAcquire takes a free slot without waiting. No slot is taken if other
+// sources are waiting already.
+func (s *sourceSlots) tryAcquire() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.free > 0 && len(s.waiting) == 0 {
+		s.free--
+		return true
+	}
+	return false
+}
+
+// acquire blocks until a slot has been assigned, or canceler is done.
+func (s *sourceSlots) acquire(canceler input.Canceler, priority int) error {
+	s.mu.Lock()
+	if s.free > 0 && len(s.waiting) == 0 {
+		s.free--
+		s.mu.Unlock()
+		return nil
+	}
+	s.seq++
+	w := &slotWaiter{priority: priority, seq: s.seq, granted: make(chan struct{})}
+	heap.Push(&s.waiting, w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.granted:
+		return nil
+	case <-canceler.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-w.granted:
+		// the slot has been assigned while cancelling, pass it on
+		s.release()
+	default:
+		heap.Remove(&s.waiting, w.index)
+	}
+	return canceler.Err()
+}
+
+// Release passes the slot to the next waiting source, or marks it as free.
+func (s *sourceSlots) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.release()
+}
+
+// release must be called with s.mu held.
+func (s *sourceSlots) release() {
+	if len(s.waiting) == 0 {
+		s.free++
+		return
+	}
+	w := heap.Pop(&s.waiting).(*slotWaiter)
+	close(w.granted)
+}
+
+func (q slotQueue) Len() int { return len(q) }
+
+func (q slotQueue) Less(i, j int) bool {
+	if q[i].priority != q[j].priority {
+		return q[i].priority > q[j].priority
+	}
+	return q[i].seq < q[j].seq
+}
+
+func (q slotQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+
+func (q *slotQueue) Push(x interface{}) {
+	w := x.(*slotWaiter)
+	w.index = len(*q)
+	*q = append(*q, w)
+}
+
+func (q *slotQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	w := old[n-1]
+	old[n-1] = nil
+	*q = old[:n-1]
+	return w
+}
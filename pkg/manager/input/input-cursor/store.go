@@ -5,6 +5,11 @@
 package cursor
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
 	"strings"
 	"sync"
 	"time"
@@ -27,8 +32,27 @@ import (
 type store struct {
 	log             *logp.Logger
 	refCount        concert.RefCount
-	persistentStore *statestore.Store
+	persistentStore PersistentStore
 	ephemeralStore  *states
+
+	// flushInterval is the minimum interval between two cursor writes of a
+	// resource to the persistent store. Cursor writes are not throttled if
+	// flushInterval is 0.
+	flushInterval time.Duration
+
+	// onRead and onWrite are called with the cursor of a key when the key
+	// is accessed, or its cursor is written to the persistent store.
+	onRead  func(key string, cursor interface{})
+	onWrite func(key string, cursor interface{})
+
+	// cleanupExclude reports keys that must not be removed by the cleaner or
+	// by compaction, even if their state has expired.
+	cleanupExclude func(key string) bool
+
+	// opened is the time the store has been opened. Like the cleaner,
+	// compaction does not remove states whose TTL has expired while the
+	// process was not running.
+	opened time.Time
 }
 
 // states stores resource states in memory. When a cursor for an input is updated,
@@ -39,6 +63,9 @@ type store struct {
 type states struct {
 	mu    sync.Mutex
 	table map[string]*resource
+
+	// version is the state version assigned to new resources.
+	version int
 }
 
 // resource holds the in memory state and keeps track of pending updates and inputs collecting
@@ -87,12 +114,25 @@ type resource struct {
 	// we always write the complete state of the key/value pair.
 	cursor        interface{}
 	pendingCursor interface{}
+
+	// pendingExpiresAt is the expiry time set by the pending update
+	// operations. It is zero if no pending operation sets an expiry time.
+	pendingExpiresAt time.Time
+
+	// lastFlush is the time the cursor has last been written to the
+	// persistent store. If the store throttles cursor writes, dirty is set
+	// while the cursor is ahead of the persistent store, and flushTimer
+	// writes the cursor once the flush interval has passed.
+	lastFlush  time.Time
+	dirty      bool
+	flushTimer *time.Timer
 }
 
 type (
 	// state represents the full document as it is stored in the registry.
 	//
-	// The TTL and Update fields are for internal use only.
+	// The TTL, Updated, and ExpiresAt fields are for internal use only.
+	// ExpiresAt is zero if no cursor update has set an expiry time.
 	//
 	// The `Cursor` namespace is used to store the cursor information that are
 	// required to continue processing from the last known position. Cursor
@@ -101,21 +141,51 @@ type (
 	// information that are require to identify/track the source we are
 	// collecting from.
 	state struct {
-		TTL     time.Duration
-		Updated time.Time
-		Cursor  interface{}
+		TTL       time.Duration
+		Updated   time.Time
+		ExpiresAt time.Time
+		Version   int
+		Cursor    interface{}
 	}
 
 	stateInternal struct {
-		TTL     time.Duration
-		Updated time.Time
+		TTL       time.Duration
+		Updated   time.Time
+		ExpiresAt time.Time
+		Version   int
 	}
 )
 
+// drainCheckInterval configures how often waitPendingUpdates checks for
+// pending updates.
+const drainCheckInterval = 10 * time.Millisecond
+
 // hook into store close for testing purposes
 var closeStore = (*store).close
 
-func openStore(log *logp.Logger, statestore StateStore, prefix string) (*store, error) {
+// checkpointer is implemented by persistent stores that can compact their
+// storage, like statestore.Store.
+type checkpointer interface {
+	Checkpoint() error
+}
+
+// sizer is implemented by persistent stores that can report the size of
+// their storage, like statestore.Store.
+type sizer interface {
+	Size() (logSize, checkpointSize int64, err error)
+}
+
+// batchWriter is implemented by persistent stores that can write multiple
+// keys atomically, like statestore.Store.
+type batchWriter interface {
+	SetAll(values map[string]interface{}) error
+}
+
+// stateMigrator converts a JSON encoded cursor from an older state version to
+// the current version.
+type stateMigrator func(oldVersion int, raw []byte) ([]byte, error)
+
+func openStore(log *logp.Logger, statestore StateStore, prefix string, version int, migrate stateMigrator) (*store, error) {
 	ok := false
 
 	persistentStore, err := statestore.Access()
@@ -124,7 +194,7 @@ func openStore(log *logp.Logger, statestore StateStore, prefix string) (*store,
 	}
 	defer cleanup.IfNot(&ok, func() { persistentStore.Close() })
 
-	states, err := readStates(log, persistentStore, prefix)
+	states, err := readStates(log, persistentStore, prefix, version, migrate)
 	if err != nil {
 		return nil, err
 	}
@@ -134,6 +204,7 @@ func openStore(log *logp.Logger, statestore StateStore, prefix string) (*store,
 		log:             log,
 		persistentStore: persistentStore,
 		ephemeralStore:  states,
+		opened:          time.Now(),
 	}, nil
 }
 
@@ -145,6 +216,7 @@ func (s *store) Release() {
 }
 
 func (s *store) close() {
+	s.flushPending()
 	if err := s.persistentStore.Close(); err != nil {
 		s.log.Errorf("Closing registry store did report an error: %+v", err)
 	}
@@ -154,7 +226,13 @@ func (s *store) close() {
 // A new shared resource is generated if the key is not known. The generated
 // resource is not synced to disk yet.
 func (s *store) Get(key string) *resource {
-	return s.ephemeralStore.Find(key, true)
+	res := s.ephemeralStore.Find(key, true)
+	if s.onRead != nil {
+		res.stateMutex.Lock()
+		s.onRead(key, res.stateSnapshot().Cursor)
+		res.stateMutex.Unlock()
+	}
+	return res
 }
 
 // UpdateTTL updates the time-to-live of a resource. Inactive resources with expired TTL are subject to removal.
@@ -173,11 +251,7 @@ func (s *store) UpdateTTL(resource *resource, ttl time.Duration) {
 		resource.internalState.Updated = time.Now()
 	}
 
-	err := s.persistentStore.Set(resource.key, state{
-		TTL:     resource.internalState.TTL,
-		Updated: resource.internalState.Updated,
-		Cursor:  resource.cursor,
-	})
+	err := s.persistentStore.Set(resource.key, resource.inSyncStateSnapshot())
 	if err != nil {
 		s.log.Errorf("Failed to update resource management fields for '%v'", resource.key)
 		resource.internalInSync = false
@@ -187,6 +261,455 @@ func (s *store) UpdateTTL(resource *resource, ttl time.Duration) {
 	}
 }
 
+// writeCursor writes the state of resource to the persistent store after a
+// cursor update has been ACKed. If the last write of the resource happened
+// less than flushInterval ago, the write is deferred until the interval has
+// passed. Updates ACKed in the meantime are coalesced into a single write.
+// The resource is retained while a write is deferred, such that the cleaner
+// does not remove it. resource.stateMutex must be held.
+func (s *store) writeCursor(resource *resource) {
+	if s.flushInterval > 0 {
+		if wait := s.flushInterval - time.Since(resource.lastFlush); wait > 0 {
+			if !resource.dirty {
+				resource.dirty = true
+				resource.Retain()
+				resource.flushTimer = time.AfterFunc(wait, func() { s.flushResource(resource) })
+			}
+			return
+		}
+	}
+	s.writeState(resource)
+}
+
+// flushResource writes a deferred cursor update of resource to the
+// persistent store.
+func (s *store) flushResource(resource *resource) {
+	resource.stateMutex.Lock()
+	defer resource.stateMutex.Unlock()
+	if !resource.dirty {
+		return
+	}
+
+	resource.flushTimer.Stop()
+	resource.flushTimer = nil
+	resource.dirty = false
+	s.writeState(resource)
+	resource.Release()
+}
+
+// flushPending writes all deferred cursor updates to the persistent store.
+func (s *store) flushPending() {
+	s.ephemeralStore.mu.Lock()
+	defer s.ephemeralStore.mu.Unlock()
+	for _, resource := range s.ephemeralStore.table {
+		s.flushResource(resource)
+	}
+}
+
+// writeState writes the in sync state of resource to the persistent store.
+// resource.stateMutex must be held.
+func (s *store) writeState(resource *resource) {
+	resource.lastFlush = time.Now()
+	st := resource.inSyncStateSnapshot()
+	if s.onWrite != nil {
+		s.onWrite(resource.key, st.Cursor)
+	}
+	err := s.persistentStore.Set(resource.key, st)
+	if err != nil {
+		if !statestore.IsClosed(err) {
+			s.log.Errorf("Failed to update state in the registry for '%v'", resource.key)
+		}
+	} else {
+		resource.internalInSync = true
+		resource.stored = true
+	}
+}
+
+// pendingUpdates returns the number of cursor updates that have not been
+// written to the persistent store yet.
+func (s *store) pendingUpdates() uint {
+	s.ephemeralStore.mu.Lock()
+	defer s.ephemeralStore.mu.Unlock()
+
+	var n uint
+	for _, resource := range s.ephemeralStore.table {
+		resource.stateMutex.Lock()
+		n += resource.activeCursorOperations
+		resource.stateMutex.Unlock()
+	}
+	return n
+}
+
+// waitPendingUpdates blocks until all pending cursor updates have been
+// written to the persistent store, or ctx is cancelled.
+func (s *store) waitPendingUpdates(ctx context.Context) error {
+	ticker := time.NewTicker(drainCheckInterval)
+	defer ticker.Stop()
+
+	for s.pendingUpdates() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
+
+// Export returns the state of all resources written to the persistent store.
+// Pending cursor updates not yet ACKed are not included.
+func (s *store) Export() map[string]state {
+	s.ephemeralStore.mu.Lock()
+	defer s.ephemeralStore.mu.Unlock()
+
+	states := make(map[string]state, len(s.ephemeralStore.table))
+	for key, resource := range s.ephemeralStore.table {
+		resource.stateMutex.Lock()
+		if resource.stored {
+			states[key] = resource.inSyncStateSnapshot()
+		}
+		resource.stateMutex.Unlock()
+	}
+	return states
+}
+
+// Import writes the given states to the in memory and persistent store.
+// Import fails without modifying the store if any of the keys is currently
+// locked by an input, or still has pending updates.
+func (s *store) Import(states map[string]state) error {
+	var resources []*resource
+	defer func() {
+		for _, res := range resources {
+			releaseResource(res)
+		}
+	}()
+
+	for key := range states {
+		res := s.Get(key)
+		if !res.lock.TryLock() {
+			res.Release()
+			return fmt.Errorf("state for '%v' is in use by an active input", key)
+		}
+		resources = append(resources, res)
+
+		res.stateMutex.Lock()
+		pending := res.activeCursorOperations
+		res.stateMutex.Unlock()
+		if pending > 0 {
+			return fmt.Errorf("state for '%v' has pending updates", key)
+		}
+	}
+
+	for _, res := range resources {
+		st := states[res.key]
+
+		res.stateMutex.Lock()
+		res.cursor = st.Cursor
+		res.internalState = stateInternal{TTL: st.TTL, Updated: st.Updated, ExpiresAt: st.ExpiresAt, Version: st.Version}
+		if s.onWrite != nil {
+			s.onWrite(res.key, st.Cursor)
+		}
+		err := s.persistentStore.Set(res.key, st)
+		if err == nil {
+			res.stored = true
+			res.internalInSync = true
+		}
+		res.stateMutex.Unlock()
+
+		if err != nil {
+			return fmt.Errorf("failed to write state for '%v': %w", res.key, err)
+		}
+	}
+	return nil
+}
+
+// Seek overwrites the cursor of key in the in memory and persistent store.
+// The resource TTL is set to ttl. Seek fails if the key is currently locked
+// by an input, or still has pending updates. Deferred cursor writes of the
+// key are discarded. The in memory state is not modified if the write to the
+// persistent store fails.
+func (s *store) Seek(key string, cursor interface{}, ttl time.Duration) error {
+	res := s.Get(key)
+	if !res.lock.TryLock() {
+		res.Release()
+		return fmt.Errorf("state for '%v' is in use by an active input", key)
+	}
+	defer releaseResource(res)
+
+	res.stateMutex.Lock()
+	defer res.stateMutex.Unlock()
+	if res.activeCursorOperations > 0 {
+		return fmt.Errorf("state for '%v' has pending updates", key)
+	}
+	st := res.inSyncStateSnapshot()
+	st.Cursor = cursor
+	st.TTL = ttl
+	st.Updated = time.Now()
+	st.Version = s.ephemeralStore.version
+	if err := s.persistentStore.Set(key, st); err != nil {
+		return fmt.Errorf("failed to write state for '%v': %w", key, err)
+	}
+
+	if res.dirty {
+		res.flushTimer.Stop()
+		res.flushTimer = nil
+		res.dirty = false
+		res.Release()
+	}
+	res.cursor = st.Cursor
+	res.pendingCursor = nil
+	res.internalState.TTL = st.TTL
+	res.internalState.Updated = st.Updated
+	res.internalState.Version = st.Version
+	res.lastFlush = time.Now()
+	res.stored = true
+	res.internalInSync = true
+	if s.onWrite != nil {
+		s.onWrite(key, st.Cursor)
+	}
+	return nil
+}
+
+// SeekAll overwrites the cursors of multiple keys in the in memory and
+// persistent store. All keys are written in a single batch: either all or
+// none of the cursors are updated. The TTL of each resource is set to the
+// TTL given for its key. SeekAll fails without modifying the store if the
+// persistent store does not support batch writes, or if any of the keys is
+// currently locked by an input, or still has pending updates. Deferred cursor
+// writes of the keys are discarded.
+func (s *store) SeekAll(cursors map[string]interface{}, ttls map[string]time.Duration) error {
+	bw, ok := s.persistentStore.(batchWriter)
+	if !ok {
+		return statestore.ErrBatchNotSupported
+	}
+
+	keys := make([]string, 0, len(cursors))
+	for key := range cursors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// All resources are looked up before any of them is locked. Get acquires
+	// ephemeralStore.mu, which must never be acquired while holding a
+	// stateMutex. Resources are locked in key order.
+	resources := make([]*resource, len(keys))
+	for i, key := range keys {
+		resources[i] = s.Get(key)
+	}
+	locked := 0
+	defer func() {
+		for i, res := range resources {
+			if i < locked {
+				res.stateMutex.Unlock()
+				releaseResource(res)
+			} else {
+				res.Release()
+			}
+		}
+	}()
+	for _, res := range resources {
+		if !res.lock.TryLock() {
+			return fmt.Errorf("state for '%v' is in use by an active input", res.key)
+		}
+		res.stateMutex.Lock()
+		locked++
+		if res.activeCursorOperations > 0 {
+			return fmt.Errorf("state for '%v' has pending updates", res.key)
+		}
+	}
+
+	now := time.Now()
+	values := make(map[string]interface{}, len(resources))
+	for _, res := range resources {
+		st := res.inSyncStateSnapshot()
+		st.Cursor = cursors[res.key]
+		st.TTL = ttls[res.key]
+		st.Updated = now
+		st.Version = s.ephemeralStore.version
+		values[res.key] = st
+	}
+	if err := bw.SetAll(values); err != nil {
+		return fmt.Errorf("failed to write states: %w", err)
+	}
+
+	for _, res := range resources {
+		if res.dirty {
+			res.flushTimer.Stop()
+			res.flushTimer = nil
+			res.dirty = false
+			res.Release()
+		}
+
+		st := values[res.key].(state)
+		res.cursor = st.Cursor
+		res.pendingCursor = nil
+		res.internalState.TTL = st.TTL
+		res.internalState.Updated = st.Updated
+		res.internalState.Version = st.Version
+		res.lastFlush = now
+		res.stored = true
+		res.internalInSync = true
+		if s.onWrite != nil {
+			s.onWrite(res.key, st.Cursor)
+		}
+	}
+	return nil
+}
+
+// Compact rewrites the persistent state of all resources that are not in
+// use, and asks the persistent store to write a compact snapshot if it
+// supports checkpoints. Resources locked by an input, or with cursor updates
+// not yet written, are skipped, such that no key is compacted mid-update.
+// Finished resources whose state has expired are removed instead of being
+// rewritten. The number of keys starting with prefix is reported before and
+// after compaction, as well as the size of the persistent store, if
+// supported.
+func (s *store) Compact(prefix string) (CompactionStats, error) {
+	stats := CompactionStats{Started: time.Now()}
+	var err error
+	if stats.KeysBefore, err = s.countKeys(prefix); err != nil {
+		return stats, err
+	}
+	var sizeBefore storeSize
+	if sizeBefore, stats.SizeReported, err = s.size(); err != nil {
+		return stats, err
+	}
+	stats.LogBytesBefore, stats.CheckpointBytesBefore = sizeBefore.log, sizeBefore.checkpoint
+
+	// The table is only locked to collect the resources, such that the
+	// persistent store is not accessed while Get is blocked. The resources
+	// are retained, such that the cleaner does not remove them concurrently.
+	s.ephemeralStore.mu.Lock()
+	resources := make([]*resource, 0, len(s.ephemeralStore.table))
+	for _, res := range s.ephemeralStore.table {
+		res.Retain()
+		resources = append(resources, res)
+	}
+	s.ephemeralStore.mu.Unlock()
+
+	for _, res := range resources {
+		if err != nil {
+			// compaction failed, release the remaining resources
+			res.Release()
+			continue
+		}
+
+		var removed, skipped bool
+		removed, skipped, err = s.compactResource(res, stats.Started)
+		switch {
+		case removed:
+			stats.Removed++
+		case skipped:
+			stats.Skipped++
+		}
+	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to compact state: %w", err)
+	}
+
+	if cp, ok := s.persistentStore.(checkpointer); ok {
+		if err := cp.Checkpoint(); err != nil {
+			return stats, fmt.Errorf("failed to checkpoint persistent store: %w", err)
+		}
+	}
+
+	if stats.KeysAfter, err = s.countKeys(prefix); err != nil {
+		return stats, err
+	}
+	if stats.SizeReported {
+		var sizeAfter storeSize
+		if sizeAfter, _, err = s.size(); err != nil {
+			return stats, err
+		}
+		stats.LogBytesAfter, stats.CheckpointBytesAfter = sizeAfter.log, sizeAfter.checkpoint
+	}
+	stats.Duration = time.Since(stats.Started)
+	return stats, nil
+}
+
+// storeSize is the size in bytes of the update log and of the last
+// checkpoint of the persistent store.
+type storeSize struct {
+	log, checkpoint int64
+}
+
+// size returns the size of the persistent store. False is returned if the
+// persistent store can not report its size.
+func (s *store) size() (storeSize, bool, error) {
+	sz, ok := s.persistentStore.(sizer)
+	if !ok {
+		return storeSize{}, false, nil
+	}
+	logSize, checkpointSize, err := sz.Size()
+	if errors.Is(err, statestore.ErrSizeNotSupported) {
+		return storeSize{}, false, nil
+	}
+	if err != nil {
+		return storeSize{}, false, fmt.Errorf("failed to read persistent store size: %w", err)
+	}
+	return storeSize{log: logSize, checkpoint: checkpointSize}, true, nil
+}
+
+// compactResource rewrites the persistent state of res, or removes res if
+// its state has expired. Resources locked by an input, or with cursor updates
+// not yet written, are skipped. res must be retained by the caller, and is
+// released by compactResource.
+func (s *store) compactResource(res *resource, now time.Time) (removed, skipped bool, err error) {
+	if !res.lock.TryLock() {
+		res.Release()
+		return false, true, nil
+	}
+	defer res.lock.Unlock()
+
+	if s.cleanupExclude == nil || !s.cleanupExclude(res.key) {
+		// Like the cleaner, expired states are removed while the table is
+		// locked, such that the resource can not be accessed concurrently.
+		s.ephemeralStore.mu.Lock()
+		res.Release()
+		if s.ephemeralStore.table[res.key] == res && checkCleanResource(s.opened, now, res) {
+			err = s.persistentStore.Remove(res.key)
+			if err == nil {
+				delete(s.ephemeralStore.table, res.key)
+				removed = true
+			}
+		}
+		if !removed {
+			res.Retain()
+		}
+		s.ephemeralStore.mu.Unlock()
+		if removed {
+			return true, false, nil
+		}
+	}
+	defer res.Release()
+	if err != nil {
+		return false, false, err
+	}
+
+	res.stateMutex.Lock()
+	defer res.stateMutex.Unlock()
+	switch {
+	case res.activeCursorOperations > 0 || res.dirty:
+		return false, true, nil
+	case res.stored:
+		err = s.persistentStore.Set(res.key, res.inSyncStateSnapshot())
+	}
+	return false, false, err
+}
+
+// countKeys returns the number of keys starting with prefix in the
+// persistent store.
+func (s *store) countKeys(prefix string) (int, error) {
+	n := 0
+	err := s.persistentStore.Each(func(key string, _ statestore.ValueDecoder) (bool, error) {
+		if strings.HasPrefix(key, prefix) {
+			n++
+		}
+		return true, nil
+	})
+	return n, err
+}
+
 // Find returns the resource for a given key. If the key is unknown and create is set to false nil will be returned.
 // The resource returned by Find is marked as active. (*resource).Release must be called to mark the resource as inactive again.
 func (s *states) Find(key string, create bool) *resource {
@@ -204,9 +727,10 @@ func (s *states) Find(key string, create bool) *resource {
 
 	// resource is owned by table(session) and input that uses the resource.
 	resource := &resource{
-		stored: false,
-		key:    key,
-		lock:   unison.MakeMutex(),
+		stored:        false,
+		key:           key,
+		lock:          unison.MakeMutex(),
+		internalState: stateInternal{Version: s.version},
 	}
 	s.table[key] = resource
 	resource.Retain()
@@ -250,9 +774,11 @@ func (r *resource) UnpackCursor(to interface{}) error {
 // syncStateSnapshot returns the current insync state based on already ACKed update operations.
 func (r *resource) inSyncStateSnapshot() state {
 	return state{
-		TTL:     r.internalState.TTL,
-		Updated: r.internalState.Updated,
-		Cursor:  r.cursor,
+		TTL:       r.internalState.TTL,
+		Updated:   r.internalState.Updated,
+		ExpiresAt: r.internalState.ExpiresAt,
+		Version:   r.internalState.Version,
+		Cursor:    r.cursor,
 	}
 }
 
@@ -265,16 +791,24 @@ func (r *resource) stateSnapshot() state {
 	}
 
 	return state{
-		TTL:     r.internalState.TTL,
-		Updated: r.internalState.Updated,
-		Cursor:  cursor,
+		TTL:       r.internalState.TTL,
+		Updated:   r.internalState.Updated,
+		ExpiresAt: r.internalState.ExpiresAt,
+		Version:   r.internalState.Version,
+		Cursor:    cursor,
 	}
 }
 
-func readStates(log *logp.Logger, store *statestore.Store, prefix string) (*states, error) {
+// readStates loads all states for the given prefix from the persistent store.
+// If migrate is set, cursors stored with a version other than the current
+// version are migrated. Keys failing to migrate are ignored, such that the
+// input starts collecting the source from the beginning. The persistent state
+// of ignored keys is overwritten, once the key is used by an input.
+func readStates(log *logp.Logger, store PersistentStore, prefix string, version int, migrate stateMigrator) (*states, error) {
 	keyPrefix := prefix + "::"
 	states := &states{
-		table: map[string]*resource{},
+		table:   map[string]*resource{},
+		version: version,
 	}
 
 	err := store.Each(func(key string, dec statestore.ValueDecoder) (bool, error) {
@@ -289,14 +823,28 @@ func readStates(log *logp.Logger, store *statestore.Store, prefix string) (*stat
 			return true, nil
 		}
 
+		if migrate != nil && st.Version != version {
+			cursor, err := migrateCursor(migrate, st.Version, st.Cursor)
+			if err != nil {
+				// The key is kept without cursor, such that the cleaner
+				// removes it once its TTL has expired.
+				log.Errorf("Failed to migrate registry state for '%v' from version %v to %v, cursor state will be ignored. Error was: %+v",
+					key, st.Version, version, err)
+				cursor = nil
+			}
+			st.Cursor = cursor
+		}
+
 		resource := &resource{
 			key:            key,
 			stored:         true,
 			lock:           unison.MakeMutex(),
 			internalInSync: true,
 			internalState: stateInternal{
-				TTL:     st.TTL,
-				Updated: st.Updated,
+				TTL:       st.TTL,
+				Updated:   st.Updated,
+				ExpiresAt: st.ExpiresAt,
+				Version:   version,
 			},
 			cursor: st.Cursor,
 		}
@@ -309,3 +857,21 @@ func readStates(log *logp.Logger, store *statestore.Store, prefix string) (*stat
 	}
 	return states, nil
 }
+
+func migrateCursor(migrate stateMigrator, oldVersion int, cursor interface{}) (interface{}, error) {
+	raw, err := json.Marshal(cursor)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err = migrate(oldVersion, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var migrated interface{}
+	if err := json.Unmarshal(raw, &migrated); err != nil {
+		return nil, err
+	}
+	return migrated, nil
+}
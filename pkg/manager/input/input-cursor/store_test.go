@@ -5,7 +5,11 @@
 package cursor
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 
@@ -39,7 +43,7 @@ func TestStore_OpenClose(t *testing.T) {
 	})
 
 	t.Run("fail if persistent store can not be accessed", func(t *testing.T) {
-		_, err := openStore(logp.NewLogger("test"), testStateStore{}, "test")
+		_, err := openStore(logp.NewLogger("test"), testStateStore{}, "test", 0, nil)
 		require.Error(t, err)
 	})
 
@@ -80,6 +84,52 @@ func TestStore_OpenClose(t *testing.T) {
 	})
 }
 
+func TestStore_Migrate(t *testing.T) {
+	log := logp.NewLogger("test")
+	now := time.Now()
+	states := map[string]state{
+		"test::old":     {Version: 1, TTL: time.Hour, Updated: now, Cursor: map[string]interface{}{"offset": 10}},
+		"test::current": {Version: 2, TTL: time.Hour, Updated: now, Cursor: map[string]interface{}{"position": 20}},
+		"test::broken":  {Version: 0, TTL: time.Minute, Updated: now.Add(-time.Hour), Cursor: "broken"},
+	}
+
+	var migrated []int
+	migrate := func(oldVersion int, raw []byte) ([]byte, error) {
+		migrated = append(migrated, oldVersion)
+		if oldVersion == 0 {
+			return nil, errors.New("unsupported version")
+		}
+		var old struct{ Offset int }
+		if err := json.Unmarshal(raw, &old); err != nil {
+			return nil, err
+		}
+		return json.Marshal(map[string]int{"position": old.Offset})
+	}
+
+	store, err := openStore(log, createSampleStore(t, states), "test", 2, migrate)
+	require.NoError(t, err)
+	defer store.Release()
+
+	sort.Ints(migrated)
+	require.Equal(t, []int{0, 1}, migrated)
+
+	want := map[string]state{
+		"test::old":     {Version: 2, TTL: time.Hour, Updated: now, Cursor: map[string]interface{}{"position": float64(10)}},
+		"test::current": {Version: 2, TTL: time.Hour, Updated: now, Cursor: map[string]interface{}{"position": int64(20)}},
+		"test::broken":  {Version: 2, TTL: time.Minute, Updated: now.Add(-time.Hour), Cursor: nil},
+	}
+	checkEqualStoreState(t, want, storeMemorySnapshot(store))
+
+	// keys that failed to migrate are removed once their TTL has expired
+	require.Equal(t, 1, gcStore(log, now.Add(-time.Hour), store))
+	delete(want, "test::broken")
+	checkEqualStoreState(t, want, storeMemorySnapshot(store))
+
+	res := store.Get("test::new")
+	defer res.Release()
+	require.Equal(t, 2, res.stateSnapshot().Version)
+}
+
 func TestStore_Get(t *testing.T) {
 	t.Run("find existing resource", func(t *testing.T) {
 		cursorState := state{Cursor: "1"}
@@ -214,6 +264,203 @@ func TestStore_UpdateTTL(t *testing.T) {
 	})
 }
 
+// failingSetStore wraps a PersistentStore, failing all Set operations.
+type failingSetStore struct {
+	PersistentStore
+}
+
+func (failingSetStore) Set(string, interface{}) error { return errors.New("oops") }
+
+func TestStore_Seek(t *testing.T) {
+	t.Run("overwrites cursor", func(t *testing.T) {
+		backend := createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Second, Cursor: "old"},
+		})
+		store := testOpenStore(t, backend)
+		defer store.Release()
+
+		require.NoError(t, store.Seek("test::key", "new", time.Minute))
+		snapshot := storeInSyncSnapshot(store)
+		require.Equal(t, "new", snapshot["test::key"].Cursor)
+		require.Equal(t, time.Minute, snapshot["test::key"].TTL)
+		checkEqualStoreState(t, snapshot, backend.snapshot())
+	})
+
+	t.Run("failed write keeps in memory state", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Second, Cursor: "old"},
+		}))
+		defer store.Release()
+		var written []interface{}
+		store.onWrite = func(_ string, cursor interface{}) { written = append(written, cursor) }
+
+		want := storeInSyncSnapshot(store)
+		persistentStore := store.persistentStore
+		store.persistentStore = failingSetStore{persistentStore}
+		defer func() { store.persistentStore = persistentStore }()
+
+		require.Error(t, store.Seek("test::key", "new", time.Minute))
+		checkEqualStoreState(t, want, storeInSyncSnapshot(store))
+		require.Empty(t, written)
+	})
+}
+
+// blockingSetStore wraps a PersistentStore. Set blocks until unblock is
+// closed, after reporting the call on blocked.
+type blockingSetStore struct {
+	PersistentStore
+	blocked chan struct{}
+	unblock chan struct{}
+}
+
+func (s blockingSetStore) Set(key string, from interface{}) error {
+	s.blocked <- struct{}{}
+	<-s.unblock
+	return s.PersistentStore.Set(key, from)
+}
+
+func TestStore_Compact(t *testing.T) {
+	t.Run("table is not locked while writing", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Hour, Updated: time.Now(), Cursor: "cursor"},
+		}))
+		defer store.Release()
+
+		persistentStore := store.persistentStore
+		blocking := blockingSetStore{persistentStore, make(chan struct{}), make(chan struct{})}
+		store.persistentStore = blocking
+		defer func() { store.persistentStore = persistentStore }()
+
+		var stats CompactionStats
+		var err error
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			stats, err = store.Compact("test::")
+		}()
+
+		<-blocking.blocked
+		res := store.Get("test::other")
+		res.Release()
+		close(blocking.unblock)
+		<-done
+		require.NoError(t, err)
+		require.Equal(t, 1, stats.KeysAfter)
+	})
+
+	t.Run("store size is reported", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, map[string]state{
+			"test::key": {TTL: time.Hour, Updated: time.Now(), Cursor: "cursor"},
+		}))
+		defer store.Release()
+
+		persistentStore := store.persistentStore
+		store.persistentStore = &sizedStore{persistentStore, []storeSize{{100, 50}, {0, 80}}}
+		defer func() { store.persistentStore = persistentStore }()
+
+		stats, err := store.Compact("test::")
+		require.NoError(t, err)
+		require.True(t, stats.SizeReported)
+		require.Equal(t, int64(100), stats.LogBytesBefore)
+		require.Equal(t, int64(50), stats.CheckpointBytesBefore)
+		require.Equal(t, int64(0), stats.LogBytesAfter)
+		require.Equal(t, int64(80), stats.CheckpointBytesAfter)
+	})
+
+	t.Run("store size is not reported if unsupported", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		stats, err := store.Compact("test::")
+		require.NoError(t, err)
+		require.False(t, stats.SizeReported)
+	})
+}
+
+// sizedStore reports the given sizes, one per call to Size.
+type sizedStore struct {
+	PersistentStore
+	sizes []storeSize
+}
+
+func (s *sizedStore) Size() (int64, int64, error) {
+	size := s.sizes[0]
+	s.sizes = s.sizes[1:]
+	return size.log, size.checkpoint, nil
+}
+
+func TestStore_SeekAll(t *testing.T) {
+	t.Run("writes all cursors", func(t *testing.T) {
+		backend := createSampleStore(t, map[string]state{
+			"test::a": {TTL: time.Second, Cursor: "a"},
+		})
+		store := testOpenStore(t, backend)
+		defer store.Release()
+
+		err := store.SeekAll(
+			map[string]interface{}{"test::a": "checkpoint-a", "test::b": "checkpoint-b"},
+			map[string]time.Duration{"test::a": time.Minute, "test::b": time.Hour},
+		)
+		require.NoError(t, err)
+
+		snapshot := storeInSyncSnapshot(store)
+		require.Equal(t, "checkpoint-a", snapshot["test::a"].Cursor)
+		require.Equal(t, time.Minute, snapshot["test::a"].TTL)
+		require.Equal(t, "checkpoint-b", snapshot["test::b"].Cursor)
+		require.Equal(t, time.Hour, snapshot["test::b"].TTL)
+		checkEqualStoreState(t, snapshot, backend.snapshot())
+	})
+
+	t.Run("locked resource fails without writes", func(t *testing.T) {
+		backend := createSampleStore(t, nil)
+		store := testOpenStore(t, backend)
+		defer store.Release()
+
+		res := store.Get("test::b")
+		res.lock.Lock()
+		defer releaseResource(res)
+
+		err := store.SeekAll(
+			map[string]interface{}{"test::a": "checkpoint-a", "test::b": "checkpoint-b"},
+			map[string]time.Duration{"test::a": time.Minute, "test::b": time.Minute},
+		)
+		require.Error(t, err)
+		require.Empty(t, backend.snapshot())
+	})
+
+	t.Run("concurrent export", func(t *testing.T) {
+		store := testOpenStore(t, createSampleStore(t, nil))
+		defer store.Release()
+
+		cursors := map[string]interface{}{}
+		ttls := map[string]time.Duration{}
+		for i := 0; i < 20; i++ {
+			key := fmt.Sprintf("test::%v", i)
+			cursors[key] = i
+			ttls[key] = time.Minute
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					_ = store.SeekAll(cursors, ttls)
+				}
+			}()
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					store.Export()
+				}
+			}()
+		}
+		wg.Wait()
+		require.Len(t, store.Export(), len(cursors))
+	})
+}
+
 func closeStoreWith(fn func(s *store)) func() {
 	old := closeStore
 	closeStore = fn
@@ -227,7 +474,7 @@ func testOpenStore(t *testing.T, persistentStore StateStore) *store {
 		persistentStore = createSampleStore(t, nil)
 	}
 
-	store, err := openStore(logp.NewLogger("test"), persistentStore, "test")
+	store, err := openStore(logp.NewLogger("test"), persistentStore, "test", 0, nil)
 	if err != nil {
 		t.Fatalf("failed to open the store")
 	}
@@ -254,7 +501,7 @@ func createSampleStore(t *testing.T, data map[string]state) testStateStore {
 
 func (ts testStateStore) WithGCPeriod(d time.Duration) testStateStore { ts.GCPeriod = d; return ts }
 func (ts testStateStore) CleanupInterval() time.Duration              { return ts.GCPeriod }
-func (ts testStateStore) Access() (*statestore.Store, error) {
+func (ts testStateStore) Access() (PersistentStore, error) {
 	if ts.Store == nil {
 		return nil, errors.New("no store configured")
 	}
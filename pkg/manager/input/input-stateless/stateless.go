@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"runtime/debug"
 
+	"github.com/elastic/go-concert/ctxtool"
 	"github.com/elastic/go-concert/unison"
 
 	"github.com/elastic/elastic-agent-inputs/pkg/manager/input"
@@ -74,7 +75,7 @@ func (si configuredInput) Run(ctx input.Context, pipeline publisher.PipelineConn
 		PublishMode: publisher.DefaultGuarantees,
 
 		// configure pipeline to disconnect input on stop signal.
-		CloseRef: ctx.Cancelation,
+		Context: ctxtool.FromCanceller(ctx.Cancelation),
 	})
 	if err != nil {
 		return err
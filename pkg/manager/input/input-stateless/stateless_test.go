@@ -101,7 +101,7 @@ func TestStateless_Run(t *testing.T) {
 				return &pubtest.FakeClient{
 					PublishFunc: func(event publisher.Event) {
 						publishCalls.Inc()
-						<-config.CloseRef.Done()
+						<-config.CloseSignal().Done()
 					},
 				}, nil
 			},
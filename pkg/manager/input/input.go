@@ -5,6 +5,7 @@
 package input
 
 import (
+	"context"
 	"time"
 
 	"github.com/gofrs/uuid"
@@ -12,6 +13,7 @@ import (
 	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/go-concert/ctxtool"
 	"github.com/elastic/go-concert/unison"
 )
 
@@ -97,9 +99,18 @@ type Context struct {
 	Agent Info
 
 	// Cancelation is used by Beats to signal the input to shutdown.
+	// Input managers can pass a context.Context carrying the attributes of
+	// the input, see WithAttributes and GoContext.
 	Cancelation Canceler
 }
 
+// GoContext returns a context.Context that is cancelled once Cancelation
+// signals shutdown. The attributes added by WithAttributes are available via
+// InputIDFromContext and SourceFromContext, if Cancelation carries them.
+func (c Context) GoContext() context.Context {
+	return ctxtool.FromCanceller(c.Cancelation)
+}
+
 // TestContext provides the Input Test function with common environmental
 // information and services.
 type TestContext struct {
@@ -119,3 +130,29 @@ type Canceler interface {
 	Done() <-chan struct{}
 	Err() error
 }
+
+type attributeKey int
+
+const (
+	inputIDKey attributeKey = iota
+	sourceKey
+)
+
+// WithAttributes returns a copy of parent carrying the input ID and the name
+// of the source an input collects from.
+func WithAttributes(parent context.Context, inputID, source string) context.Context {
+	ctx := context.WithValue(parent, inputIDKey, inputID)
+	return context.WithValue(ctx, sourceKey, source)
+}
+
+// InputIDFromContext returns the input ID added to ctx by WithAttributes.
+func InputIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(inputIDKey).(string)
+	return id, ok
+}
+
+// SourceFromContext returns the source name added to ctx by WithAttributes.
+func SourceFromContext(ctx context.Context) (string, bool) {
+	source, ok := ctx.Value(sourceKey).(string)
+	return source, ok
+}
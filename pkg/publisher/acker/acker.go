@@ -6,6 +6,7 @@ package acker
 
 import (
 	"sync"
+	"time"
 
 	"go.uber.org/atomic"
 
@@ -68,6 +69,24 @@ func Counting(fn func(n int)) publisher.ACKer {
 	})
 }
 
+// RunningCount reports the total number of events ACKed by the outputs since the
+// ACKer has been created. Events dropped by the processors are not included
+// in the total. fn is only called if the total has changed.
+func RunningCount(fn func(total int)) publisher.ACKer {
+	var mu sync.Mutex
+	var total int
+	return TrackingCounter(func(acked, _ int) {
+		if acked == 0 {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		total += acked
+		fn(total)
+	})
+}
+
 type trackingACKer struct {
 	fn     func(acked, total int)
 	events atomic.Uint32
@@ -265,8 +284,23 @@ func LastEventPrivateReporter(fn func(acked int, data interface{})) publisher.AC
 }
 
 // Combine forwards events to a list of ackers.
+// AddEvent, ACKEvents, and Close are forwarded to the ACKers in the order they
+// have been passed to Combine. Each ACKer has returned before the next one is
+// called, such that all ACKers observe the same sequence of operations. Nil
+// ACKers are ignored.
+// The combined ACKer implements publisher.LatencyACKer and
+// publisher.PartialACKer. ACK timestamps and event indices are forwarded to
+// all ACKers implementing the respective interface.
+// The list of ACKers is not modified after Combine returns. The combined
+// ACKer is safe to be used from multiple go-routines as long as all its ACKers are.
 func Combine(as ...publisher.ACKer) publisher.ACKer {
-	return ackerList(as)
+	l := make(ackerList, 0, len(as))
+	for _, a := range as {
+		if a != nil {
+			l = append(l, a)
+		}
+	}
+	return l
 }
 
 type ackerList []publisher.ACKer
@@ -283,6 +317,22 @@ func (l ackerList) ACKEvents(n int) {
 	}
 }
 
+func (l ackerList) ACKEventsWithTime(n int, t time.Time) {
+	for _, a := range l {
+		if la, ok := a.(publisher.LatencyACKer); ok {
+			la.ACKEventsWithTime(n, t)
+		} else {
+			a.ACKEvents(n)
+		}
+	}
+}
+
+func (l ackerList) ACKEventsIndexed(acked, failed []int) {
+	for _, a := range l {
+		ACKIndexed(a, acked, failed)
+	}
+}
+
 func (l ackerList) Close() {
 	for _, a := range l {
 		a.Close()
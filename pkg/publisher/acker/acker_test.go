@@ -102,6 +102,30 @@ func TestTracking(t *testing.T) {
 	})
 }
 
+func TestRunningCount(t *testing.T) {
+	t.Run("dropped events are not reported", func(t *testing.T) {
+		var called bool
+		acker := RunningCount(func(_ int) { called = true })
+		acker.AddEvent(publisher.Event{}, false)
+		require.False(t, called)
+	})
+
+	t.Run("total is accumulated", func(t *testing.T) {
+		var total int
+		acker := RunningCount(func(n int) { total = n })
+		acker.AddEvent(publisher.Event{}, true)
+		acker.AddEvent(publisher.Event{}, false)
+		acker.AddEvent(publisher.Event{}, true)
+		acker.AddEvent(publisher.Event{}, true)
+
+		acker.ACKEvents(2)
+		require.Equal(t, 2, total)
+
+		acker.ACKEvents(1)
+		require.Equal(t, 3, total)
+	})
+}
+
 //nolint:dupl // tests are similar, not duplicated
 func TestEventPrivateReporter(t *testing.T) {
 	t.Run("dropped event is acked immediately if empty", func(t *testing.T) {
@@ -192,6 +216,34 @@ func TestCombine(t *testing.T) {
 		require.Equal(t, 1, c1)
 		require.Equal(t, 1, c2)
 	})
+
+	t.Run("nil ACKers are ignored", func(t *testing.T) {
+		var a1, a2, c1 int
+		acker := Combine(nil, countACKerOps(&a1, &a2, &c1), nil)
+		acker.AddEvent(publisher.Event{}, true)
+		acker.ACKEvents(1)
+		acker.Close()
+		require.Equal(t, 1, a1)
+		require.Equal(t, 1, a2)
+		require.Equal(t, 1, c1)
+	})
+
+	t.Run("all ACKers observe the same counts in order", func(t *testing.T) {
+		var order []int
+		var total1, total2 int
+		acker := Combine(
+			RunningCount(func(n int) { total1 = n; order = append(order, 1) }),
+			RunningCount(func(n int) { total2 = n; order = append(order, 2) }),
+		)
+		for i := 0; i < 5; i++ {
+			acker.AddEvent(publisher.Event{}, i != 2)
+		}
+		acker.ACKEvents(3)
+		acker.ACKEvents(1)
+		require.Equal(t, 4, total1)
+		require.Equal(t, 4, total2)
+		require.Equal(t, []int{1, 2, 1, 2}, order)
+	})
 }
 
 func TestConnectionOnly(t *testing.T) {
@@ -0,0 +1,111 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+// Batching coalesces the ACKEvents calls received within window into a single
+// ACKEvents call to a, with the sum of all counts. The window starts with the
+// first ACKEvents call after a flush. AddEvent is forwarded immediately.
+// On Close pending ACKs are flushed before a is closed. ACKs received after
+// Close are forwarded immediately. a is returned unchanged if window is not
+// positive.
+// The batching ACKer implements publisher.PartialACKer. Batches without
+// failed events are coalesced like ACKEvents. Batches with failed events
+// flush the pending ACKs, and are forwarded immediately, such that the
+// indices passed to a stay exact.
+// The batching ACKer does not implement publisher.LatencyACKer, as coalesced
+// ACKs have no single ACK timestamp. ACKers measuring latency, like Latency,
+// observe the time of the flush, which is up to window after the ACK.
+// Combine them with Batching only if the delay is acceptable.
+func Batching(window time.Duration, a publisher.ACKer) publisher.ACKer {
+	if window <= 0 {
+		return a
+	}
+	return &batchingACKer{window: window, acker: a}
+}
+
+var _ publisher.PartialACKer = (*batchingACKer)(nil)
+
+type batchingACKer struct {
+	window time.Duration
+	acker  publisher.ACKer
+
+	// flushMu serializes the calls to acker, such that coalesced ACKs are
+	// forwarded in order.
+	flushMu sync.Mutex
+
+	mu      sync.Mutex
+	pending int
+	timer   *time.Timer
+	closed  bool
+}
+
+func (a *batchingACKer) AddEvent(event publisher.Event, published bool) {
+	a.acker.AddEvent(event, published)
+}
+
+func (a *batchingACKer) ACKEvents(n int) {
+	a.mu.Lock()
+	a.pending += n
+	if a.closed {
+		a.mu.Unlock()
+		a.flush()
+		return
+	}
+	if a.timer == nil {
+		a.timer = time.AfterFunc(a.window, a.flush)
+	}
+	a.mu.Unlock()
+}
+
+func (a *batchingACKer) ACKEventsIndexed(acked, failed []int) {
+	if len(failed) == 0 {
+		a.ACKEvents(len(acked))
+		return
+	}
+
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+	a.flushPending()
+	ACKIndexed(a.acker, acked, failed)
+}
+
+func (a *batchingACKer) Close() {
+	a.mu.Lock()
+	a.closed = true
+	if a.timer != nil {
+		a.timer.Stop()
+	}
+	a.mu.Unlock()
+
+	a.flush()
+	a.acker.Close()
+}
+
+// flush forwards the pending ACKs, and ends the current window.
+func (a *batchingACKer) flush() {
+	a.flushMu.Lock()
+	defer a.flushMu.Unlock()
+	a.flushPending()
+}
+
+// flushPending forwards the pending ACKs. a.flushMu must be held.
+func (a *batchingACKer) flushPending() {
+	a.mu.Lock()
+	n := a.pending
+	a.pending = 0
+	a.timer = nil
+	a.mu.Unlock()
+
+	if n > 0 {
+		a.acker.ACKEvents(n)
+	}
+}
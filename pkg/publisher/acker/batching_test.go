@@ -0,0 +1,134 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+type recordingACKer struct {
+	mu     sync.Mutex
+	acks   []int
+	closed bool
+}
+
+func (r *recordingACKer) AddEvent(publisher.Event, bool) {}
+
+func (r *recordingACKer) ACKEvents(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.acks = append(r.acks, n)
+}
+
+func (r *recordingACKer) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+func (r *recordingACKer) ACKs() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int(nil), r.acks...)
+}
+
+func TestBatching(t *testing.T) {
+	t.Run("ACKs within the window are coalesced", func(t *testing.T) {
+		rec := &recordingACKer{}
+		acker := Batching(20*time.Millisecond, rec)
+
+		acker.ACKEvents(1)
+		acker.ACKEvents(2)
+		acker.ACKEvents(3)
+		require.Empty(t, rec.ACKs())
+
+		require.Eventually(t, func() bool { return len(rec.ACKs()) == 1 }, time.Second, time.Millisecond)
+		require.Equal(t, []int{6}, rec.ACKs())
+
+		acker.ACKEvents(4)
+		require.Eventually(t, func() bool { return len(rec.ACKs()) == 2 }, time.Second, time.Millisecond)
+		require.Equal(t, []int{6, 4}, rec.ACKs())
+	})
+
+	t.Run("close flushes pending ACKs", func(t *testing.T) {
+		rec := &recordingACKer{}
+		acker := Batching(time.Hour, rec)
+
+		acker.ACKEvents(1)
+		acker.ACKEvents(2)
+		acker.Close()
+		require.Equal(t, []int{3}, rec.ACKs())
+		require.True(t, rec.closed)
+
+		// ACKs after close are forwarded immediately
+		acker.ACKEvents(4)
+		require.Equal(t, []int{3, 4}, rec.ACKs())
+	})
+
+	t.Run("counts are exact", func(t *testing.T) {
+		var mu sync.Mutex
+		total := 0
+		acker := Batching(time.Millisecond, RawCounting(func(n int) {
+			mu.Lock()
+			defer mu.Unlock()
+			total += n
+		}))
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					acker.ACKEvents(1)
+				}
+			}()
+		}
+		wg.Wait()
+		acker.Close()
+		require.Equal(t, 400, total)
+	})
+
+	t.Run("failed events flush pending ACKs", func(t *testing.T) {
+		var calls [][2][]int
+		acker := Batching(time.Hour, Partial(func(acked, failed []int) {
+			calls = append(calls, [2][]int{acked, failed})
+		}))
+
+		acker.ACKEvents(2)
+		ACKIndexed(acker, []int{0, 1}, nil)
+		require.Empty(t, calls)
+
+		ACKIndexed(acker, []int{1}, []int{0})
+		require.Equal(t, [][2][]int{
+			{{0, 1, 2, 3}, nil},
+			{{1}, {0}},
+		}, calls)
+	})
+
+	t.Run("ACK timestamps are not forwarded", func(t *testing.T) {
+		const window = 20 * time.Millisecond
+		latency := make(chan time.Duration, 1)
+		acker := Batching(window, Latency(1, func(d time.Duration) { latency <- d }))
+		_, ok := acker.(publisher.LatencyACKer)
+		require.False(t, ok)
+
+		// latency is measured at flush time, after the window has elapsed
+		acker.AddEvent(publisher.Event{}, true)
+		acker.ACKEvents(1)
+		require.GreaterOrEqual(t, <-latency, window)
+	})
+
+	t.Run("disabled without window", func(t *testing.T) {
+		rec := &recordingACKer{}
+		require.Same(t, rec, Batching(0, rec))
+	})
+}
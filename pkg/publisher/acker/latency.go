@@ -0,0 +1,78 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+const defaultLatencyAlpha = 0.1
+
+// Latency measures the time between an event being published and the event
+// being ACKed. After each ACK, fn is called with the exponential moving average
+// of the latency of all ACKed events. Alpha is the weight of a new sample, and
+// must be in the range (0, 1]. Alpha defaults to 0.1 if the value is out of
+// range.
+// Events dropped by the processors are not included in the average.
+// If the pipeline does not report ACK timestamps, the time ACKEvents is called
+// is used instead.
+func Latency(alpha float64, fn func(avg time.Duration)) publisher.LatencyACKer {
+	if alpha <= 0 || alpha > 1 {
+		alpha = defaultLatencyAlpha
+	}
+	return &latencyACKer{alpha: alpha, fn: fn}
+}
+
+type latencyACKer struct {
+	alpha float64
+	fn    func(time.Duration)
+
+	mu        sync.Mutex
+	published []time.Time
+	avg       float64
+	hasAvg    bool
+}
+
+func (a *latencyACKer) AddEvent(_ publisher.Event, published bool) {
+	if !published {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.published = append(a.published, time.Now())
+}
+
+func (a *latencyACKer) ACKEvents(n int) { a.ACKEventsWithTime(n, time.Now()) }
+
+func (a *latencyACKer) ACKEventsWithTime(n int, t time.Time) {
+	a.mu.Lock()
+	if n > len(a.published) {
+		n = len(a.published)
+	}
+	if n == 0 {
+		a.mu.Unlock()
+		return
+	}
+
+	for _, ts := range a.published[:n] {
+		sample := float64(t.Sub(ts))
+		if !a.hasAvg {
+			a.avg, a.hasAvg = sample, true
+		} else {
+			a.avg += a.alpha * (sample - a.avg)
+		}
+	}
+	a.published = a.published[n:]
+	avg := time.Duration(a.avg)
+	a.mu.Unlock()
+
+	a.fn(avg)
+}
+
+func (a *latencyACKer) Close() {}
@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+func TestLatency(t *testing.T) {
+	t.Run("first sample initializes average", func(t *testing.T) {
+		var avg time.Duration
+		acker := Latency(0.5, func(d time.Duration) { avg = d })
+
+		acker.AddEvent(publisher.Event{}, true)
+		acker.ACKEventsWithTime(1, time.Now().Add(time.Second))
+		require.InDelta(t, time.Second, avg, float64(100*time.Millisecond))
+	})
+
+	t.Run("new samples are weighted by alpha", func(t *testing.T) {
+		var avg time.Duration
+		acker := Latency(0.5, func(d time.Duration) { avg = d })
+
+		acker.AddEvent(publisher.Event{}, true)
+		acker.AddEvent(publisher.Event{}, true)
+		now := time.Now()
+		acker.ACKEventsWithTime(1, now.Add(2*time.Second))
+		acker.ACKEventsWithTime(1, now.Add(4*time.Second))
+		require.InDelta(t, 3*time.Second, avg, float64(100*time.Millisecond))
+	})
+
+	t.Run("dropped events are ignored", func(t *testing.T) {
+		calls := 0
+		acker := Latency(0.5, func(time.Duration) { calls++ })
+
+		acker.AddEvent(publisher.Event{}, false)
+		acker.ACKEvents(1)
+		require.Equal(t, 0, calls)
+	})
+
+	t.Run("combined ACKer forwards ACK timestamp", func(t *testing.T) {
+		var avg time.Duration
+		var counted int
+		acker := Combine(
+			Latency(1, func(d time.Duration) { avg = d }),
+			RawCounting(func(n int) { counted += n }),
+		).(publisher.LatencyACKer)
+
+		acker.AddEvent(publisher.Event{}, true)
+		acker.ACKEventsWithTime(1, time.Now().Add(time.Second))
+		require.InDelta(t, time.Second, avg, float64(100*time.Millisecond))
+		require.Equal(t, 1, counted)
+	})
+}
@@ -0,0 +1,58 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// Monitoring creates an ACKer that reports event counters in the sub-registry
+// name of reg:
+//
+//   - `added`: events published to the pipeline
+//   - `dropped`: events dropped by the processors
+//   - `acked`: events ACKed by the outputs
+//
+// Counters already registered under name are reused, such that the counters
+// keep accumulating if a client is replaced, e.g. when an input is
+// restarted. Counters are updated atomically. Close does not unregister the
+// counters, so their final values stay observable.
+// Monitoring panics if name is in use by a variable that is not a registry.
+func Monitoring(reg *monitoring.Registry, name string) publisher.ACKer {
+	sub := reg.GetRegistry(name)
+	if sub == nil {
+		sub = reg.NewRegistry(name)
+	}
+	return &monitoringACKer{
+		added:   monitoringCounter(sub, "added"),
+		dropped: monitoringCounter(sub, "dropped"),
+		acked:   monitoringCounter(sub, "acked"),
+	}
+}
+
+type monitoringACKer struct {
+	added, dropped, acked *monitoring.Uint
+}
+
+// monitoringCounter returns the counter name of reg, registering the counter
+// if required.
+func monitoringCounter(reg *monitoring.Registry, name string) *monitoring.Uint {
+	if v, ok := reg.Get(name).(*monitoring.Uint); ok {
+		return v
+	}
+	return monitoring.NewUint(reg, name)
+}
+
+func (a *monitoringACKer) AddEvent(_ publisher.Event, published bool) {
+	if published {
+		a.added.Inc()
+	} else {
+		a.dropped.Inc()
+	}
+}
+
+func (a *monitoringACKer) ACKEvents(n int) { a.acked.Add(uint64(n)) }
+func (a *monitoringACKer) Close()          {}
@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestMonitoring(t *testing.T) {
+	snapshot := func(reg *monitoring.Registry) map[string]int64 {
+		return monitoring.CollectFlatSnapshot(reg, monitoring.Full, false).Ints
+	}
+
+	t.Run("counters are updated", func(t *testing.T) {
+		reg := monitoring.NewRegistry()
+		acker := Monitoring(reg, "test")
+
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				acker.AddEvent(publisher.Event{}, true)
+				acker.AddEvent(publisher.Event{}, true)
+				acker.AddEvent(publisher.Event{}, false)
+				acker.ACKEvents(2)
+			}()
+		}
+		wg.Wait()
+		acker.Close()
+
+		require.Equal(t, map[string]int64{
+			"test.added":   int64(20),
+			"test.dropped": int64(10),
+			"test.acked":   int64(20),
+		}, snapshot(reg))
+	})
+
+	t.Run("counters are reused", func(t *testing.T) {
+		reg := monitoring.NewRegistry()
+		first := Monitoring(reg, "test")
+		first.AddEvent(publisher.Event{}, true)
+		first.Close()
+
+		second := Monitoring(reg, "test")
+		second.AddEvent(publisher.Event{}, true)
+		second.ACKEvents(1)
+
+		require.Equal(t, map[string]int64{
+			"test.added":   int64(2),
+			"test.dropped": int64(0),
+			"test.acked":   int64(1),
+		}, snapshot(reg))
+	})
+}
@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"sync"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+// OrderedACKer tracks the completion of events by position, and reports the
+// position of the last event of the contiguous prefix of completed events.
+// Events are assigned positions in the order they are passed to AddEvent,
+// starting at 1.
+//
+// Events published to the pipeline are completed by ACKEvents, in the order
+// they have been added. Complete can be used to complete events out of order,
+// e.g. if events are processed by multiple clients. Completions beyond the
+// contiguous prefix are buffered until all events before them have been
+// completed. Events dropped by the processors are completed immediately.
+//
+// The committed position increases monotonically. Inputs can use it as the
+// position up to which all events have been processed, in order to provide
+// at-least-once delivery.
+type OrderedACKer struct {
+	fn func(position uint64)
+
+	mu        sync.Mutex
+	added     uint64              // position of the last added event
+	committed uint64              // position of the last event of the contiguous prefix
+	published []uint64            // positions of published events not yet ACKed via ACKEvents
+	completed map[uint64]struct{} // completed positions beyond committed
+}
+
+var _ publisher.ACKer = (*OrderedACKer)(nil)
+
+// Ordered creates an OrderedACKer. fn is called with the committed position
+// each time the contiguous prefix of completed events grows. Calls to fn are
+// serialized, and fn must not call into the OrderedACKer.
+func Ordered(fn func(position uint64)) *OrderedACKer {
+	return &OrderedACKer{fn: fn, completed: map[uint64]struct{}{}}
+}
+
+// AddEvent assigns the next position to event.
+func (a *OrderedACKer) AddEvent(_ publisher.Event, published bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.added++
+	if published {
+		a.published = append(a.published, a.added)
+	} else {
+		a.complete(a.added)
+		a.advance()
+	}
+}
+
+// ACKEvents completes the n oldest published events not yet ACKed.
+func (a *OrderedACKer) ACKEvents(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if n > len(a.published) {
+		n = len(a.published)
+	}
+	for _, position := range a.published[:n] {
+		a.complete(position)
+	}
+	a.published = a.published[n:]
+	a.advance()
+}
+
+// Complete marks the event at position as completed. Positions that have not
+// been added yet, or that have been completed already, are ignored.
+func (a *OrderedACKer) Complete(position uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if position > a.added {
+		return
+	}
+	a.complete(position)
+	a.advance()
+}
+
+// Position returns the committed position. All events up to and including
+// the committed position have been completed.
+func (a *OrderedACKer) Position() uint64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.committed
+}
+
+func (a *OrderedACKer) Close() {}
+
+// complete records position as completed. a.mu must be held.
+func (a *OrderedACKer) complete(position uint64) {
+	if position > a.committed {
+		a.completed[position] = struct{}{}
+	}
+}
+
+// advance moves the committed position over the contiguous prefix of
+// completed events, and reports the new position. a.mu must be held.
+func (a *OrderedACKer) advance() {
+	old := a.committed
+	for {
+		if _, ok := a.completed[a.committed+1]; !ok {
+			break
+		}
+		delete(a.completed, a.committed+1)
+		a.committed++
+	}
+	if a.committed != old && a.fn != nil {
+		a.fn(a.committed)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+func TestOrdered(t *testing.T) {
+	t.Run("acked events advance the position", func(t *testing.T) {
+		var positions []uint64
+		acker := Ordered(func(p uint64) { positions = append(positions, p) })
+		for i := 0; i < 3; i++ {
+			acker.AddEvent(publisher.Event{}, true)
+		}
+		acker.ACKEvents(2)
+		acker.ACKEvents(1)
+		require.Equal(t, []uint64{2, 3}, positions)
+		require.Equal(t, uint64(3), acker.Position())
+	})
+
+	t.Run("out of order completions are buffered", func(t *testing.T) {
+		var positions []uint64
+		acker := Ordered(func(p uint64) { positions = append(positions, p) })
+		for i := 0; i < 4; i++ {
+			acker.AddEvent(publisher.Event{}, true)
+		}
+
+		acker.Complete(3)
+		acker.Complete(2)
+		require.Empty(t, positions)
+		require.Equal(t, uint64(0), acker.Position())
+
+		acker.Complete(1)
+		require.Equal(t, []uint64{3}, positions)
+
+		acker.Complete(4)
+		require.Equal(t, []uint64{3, 4}, positions)
+	})
+
+	t.Run("dropped events are completed immediately", func(t *testing.T) {
+		var positions []uint64
+		acker := Ordered(func(p uint64) { positions = append(positions, p) })
+		acker.AddEvent(publisher.Event{}, true)
+		acker.AddEvent(publisher.Event{}, false)
+		acker.AddEvent(publisher.Event{}, true)
+		require.Empty(t, positions)
+
+		acker.ACKEvents(1)
+		require.Equal(t, []uint64{2}, positions)
+		acker.ACKEvents(1)
+		require.Equal(t, []uint64{2, 3}, positions)
+	})
+
+	t.Run("unknown and repeated completions are ignored", func(t *testing.T) {
+		var positions []uint64
+		acker := Ordered(func(p uint64) { positions = append(positions, p) })
+		acker.AddEvent(publisher.Event{}, true)
+
+		acker.Complete(5)
+		acker.Complete(1)
+		acker.Complete(1)
+		acker.ACKEvents(1)
+		require.Equal(t, []uint64{1}, positions)
+	})
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import "github.com/elastic/elastic-agent-inputs/pkg/publisher"
+
+// Partial creates a publisher.PartialACKer calling fn with the indices of
+// the accepted and failed events of each ACKed batch. If the pipeline can
+// not report indices and calls ACKEvents, all n events are reported as
+// accepted.
+func Partial(fn func(acked, failed []int)) publisher.PartialACKer {
+	return partialACKer(fn)
+}
+
+type partialACKer func(acked, failed []int)
+
+func (partialACKer) AddEvent(_ publisher.Event, _ bool) {}
+
+func (fn partialACKer) ACKEvents(n int) {
+	if n <= 0 {
+		return
+	}
+	acked := make([]int, n)
+	for i := range acked {
+		acked[i] = i
+	}
+	fn(acked, nil)
+}
+
+func (fn partialACKer) ACKEventsIndexed(acked, failed []int) { fn(acked, failed) }
+
+func (partialACKer) Close() {}
+
+// ACKIndexed reports ACKed events with indices to a. If a does not implement
+// publisher.PartialACKer, ACKEvents is called with the total number of
+// events instead.
+func ACKIndexed(a publisher.ACKer, acked, failed []int) {
+	if pa, ok := a.(publisher.PartialACKer); ok {
+		pa.ACKEventsIndexed(acked, failed)
+		return
+	}
+	if n := len(acked) + len(failed); n > 0 {
+		a.ACKEvents(n)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package acker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+func TestPartial(t *testing.T) {
+	t.Run("indices are passed through", func(t *testing.T) {
+		var acked, failed []int
+		a := Partial(func(a, f []int) { acked, failed = a, f })
+		ACKIndexed(a, []int{0, 2}, []int{1})
+		require.Equal(t, []int{0, 2}, acked)
+		require.Equal(t, []int{1}, failed)
+	})
+
+	t.Run("ACKEvents reports all events as accepted", func(t *testing.T) {
+		var acked, failed []int
+		a := Partial(func(a, f []int) { acked, failed = a, f })
+		a.ACKEvents(3)
+		require.Equal(t, []int{0, 1, 2}, acked)
+		require.Nil(t, failed)
+	})
+
+	t.Run("ACKers without index support get the total count", func(t *testing.T) {
+		var n int
+		ACKIndexed(RawCounting(func(acked int) { n = acked }), []int{0, 2}, []int{1})
+		require.Equal(t, 3, n)
+	})
+
+	t.Run("combine forwards indices", func(t *testing.T) {
+		var acked, failed []int
+		var n int
+		a := Combine(
+			Partial(func(a, f []int) { acked, failed = a, f }),
+			RawCounting(func(acked int) { n = acked }),
+		)
+		a.(publisher.PartialACKer).ACKEventsIndexed([]int{1}, []int{0})
+		require.Equal(t, []int{1}, acked)
+		require.Equal(t, []int{0}, failed)
+		require.Equal(t, 2, n)
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"math"
+	"sync"
+)
+
+// BackpressureConfig configures the hysteresis of Client.Backpressure. The
+// thresholds are fractions of the queue capacity. Backpressure is signaled
+// once the number of queued events reaches HighWater, and is released once
+// the number of queued events has dropped below LowWater. The gap between
+// both thresholds prevents sources from toggling between pausing and
+// fetching on every event.
+type BackpressureConfig struct {
+	// HighWater is the fraction of the queue capacity at which backpressure
+	// is signaled. Must be in the range (0, 1].
+	HighWater float64
+
+	// LowWater is the fraction of the queue capacity below which
+	// backpressure is released. Must be smaller than HighWater. Half of
+	// HighWater is used if LowWater is not smaller than HighWater.
+	LowWater float64
+}
+
+// DefaultBackpressureConfig is used for unset fields of the
+// BackpressureConfig.
+var DefaultBackpressureConfig = BackpressureConfig{
+	HighWater: 0.8,
+	LowWater:  0.5,
+}
+
+// Thresholds returns the number of queued events at which backpressure is
+// signaled (high), and below which backpressure is released (low), for a
+// queue with the given capacity. High is at least 1.
+func (c BackpressureConfig) Thresholds(capacity int) (high, low int) {
+	if c.HighWater <= 0 || c.HighWater > 1 {
+		c.HighWater = DefaultBackpressureConfig.HighWater
+	}
+	if c.LowWater <= 0 {
+		c.LowWater = DefaultBackpressureConfig.LowWater
+	}
+	if c.LowWater >= c.HighWater {
+		c.LowWater = c.HighWater / 2
+	}
+
+	high = int(math.Ceil(c.HighWater * float64(capacity)))
+	if high < 1 {
+		high = 1
+	}
+	low = int(math.Ceil(c.LowWater * float64(capacity)))
+	if low >= high {
+		low = high - 1
+	}
+	return high, low
+}
+
+// BackpressureSignal implements the channel returned by Client.Backpressure
+// for a queue. Clients call Update with the current number of queued events,
+// whenever events are added to the queue and when Backpressure is called.
+type BackpressureSignal struct {
+	high, low int
+
+	mu     sync.Mutex
+	active bool
+	ch     chan struct{}
+}
+
+// NewBackpressureSignal creates a BackpressureSignal for a queue with the
+// given capacity, using the thresholds of cfg.
+func NewBackpressureSignal(cfg BackpressureConfig, capacity int) *BackpressureSignal {
+	high, low := cfg.Thresholds(capacity)
+	return &BackpressureSignal{high: high, low: low, ch: make(chan struct{})}
+}
+
+// Update updates the signal with the number of queued events, and returns
+// the current channel. The channel is closed once queued reaches the high
+// water mark. Once queued drops below the low water mark, a new open channel
+// is created.
+func (s *BackpressureSignal) Update(queued int) <-chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case !s.active && queued >= s.high:
+		s.active = true
+		close(s.ch)
+	case s.active && queued < s.low:
+		s.active = false
+		s.ch = make(chan struct{})
+	}
+	return s.ch
+}
@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackpressureConfig(t *testing.T) {
+	cases := map[string]struct {
+		cfg       BackpressureConfig
+		capacity  int
+		high, low int
+	}{
+		"defaults":                 {BackpressureConfig{}, 100, 80, 50},
+		"custom":                   {BackpressureConfig{HighWater: 0.9, LowWater: 0.1}, 100, 90, 10},
+		"low above high":           {BackpressureConfig{HighWater: 0.6, LowWater: 0.7}, 100, 60, 30},
+		"invalid high":             {BackpressureConfig{HighWater: 2, LowWater: 0.2}, 10, 8, 2},
+		"small queue":              {BackpressureConfig{}, 1, 1, 0},
+		"high is at least one":     {BackpressureConfig{}, 0, 1, 0},
+		"low is smaller than high": {BackpressureConfig{HighWater: 0.5, LowWater: 0.4}, 2, 1, 0},
+	}
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			high, low := test.cfg.Thresholds(test.capacity)
+			require.Equal(t, test.high, high, "high")
+			require.Equal(t, test.low, low, "low")
+		})
+	}
+}
+
+func TestBackpressureSignal(t *testing.T) {
+	isClosed := func(ch <-chan struct{}) bool {
+		select {
+		case <-ch:
+			return true
+		default:
+			return false
+		}
+	}
+
+	signal := NewBackpressureSignal(BackpressureConfig{HighWater: 0.8, LowWater: 0.5}, 10)
+	ch := signal.Update(0)
+	require.False(t, isClosed(ch))
+	require.False(t, isClosed(signal.Update(7)))
+
+	// backpressure is signaled at the high water mark, and kept until the
+	// queue drops below the low water mark
+	require.Equal(t, ch, signal.Update(8))
+	require.True(t, isClosed(ch))
+	require.True(t, isClosed(signal.Update(9)))
+	require.True(t, isClosed(signal.Update(5)))
+
+	released := signal.Update(4)
+	require.False(t, isClosed(released))
+	require.True(t, isClosed(ch), "old channels stay closed")
+	require.False(t, isClosed(signal.Update(7)))
+	require.True(t, isClosed(signal.Update(10)))
+	require.True(t, isClosed(released))
+}
@@ -0,0 +1,354 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// OverflowPolicy configures how a buffered client handles new events if its
+// buffer is full.
+type OverflowPolicy uint8
+
+const (
+	// Block waits for space to become available in the buffer.
+	Block OverflowPolicy = iota
+
+	// DropOldest removes the oldest events from the buffer to make space for
+	// new events.
+	DropOldest
+
+	// DropNewest drops new events if the buffer is full.
+	DropNewest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop_oldest"
+	case DropNewest:
+		return "drop_newest"
+	default:
+		return "unknown"
+	}
+}
+
+// bufferedClient implements Client by buffering events in memory. A
+// go-routine forwards buffered events to the inner client.
+type bufferedClient struct {
+	inner     Client
+	capacity  int
+	overflow  OverflowPolicy
+	waitClose time.Duration
+
+	mu       sync.Mutex
+	buf      []Event
+	inflight bool // the worker is forwarding an event to inner
+	closed   bool // no new events are accepted
+	stopped  bool // the worker must return
+	dropped  uint64
+	changed  chan struct{} // closed and replaced on state changes
+
+	backpressure *BackpressureSignal
+
+	done chan struct{} // closed once the worker has returned
+}
+
+var _ Client = (*bufferedClient)(nil)
+
+// NewBufferedClient creates a Client that buffers up to capacity events in
+// memory, and forwards them to inner from a separate go-routine. The
+// overflow policy is applied if the buffer is full. A capacity < 1 is
+// treated as 1.
+//
+// Events are passed to inner asynchronously, such that PublishChecked can not
+// report events filtered by the processors of inner. Events dropped by the
+// buffer are included in the Dropped metric, and Metrics reports the number
+// of buffered events as Buffered. Backpressure is signaled while the buffer
+// is filled above the thresholds of DefaultBackpressureConfig.
+//
+// On Close, new events are rejected and the buffered events are forwarded to
+// inner for up to waitClose. Events still buffered after waitClose are
+// dropped, and ErrCloseTimeout is returned. The buffer is dropped immediately
+// if waitClose is <= 0. Finally inner is closed.
+func NewBufferedClient(inner Client, capacity int, overflow OverflowPolicy, waitClose time.Duration) Client {
+	if capacity < 1 {
+		capacity = 1
+	}
+	c := &bufferedClient{
+		inner:     inner,
+		capacity:  capacity,
+		overflow:  overflow,
+		waitClose: waitClose,
+		changed:   make(chan struct{}),
+		done:      make(chan struct{}),
+
+		backpressure: NewBackpressureSignal(DefaultBackpressureConfig, capacity),
+	}
+	go c.run()
+	return c
+}
+
+func (c *bufferedClient) Publish(event Event) {
+	_ = c.enqueue(context.Background(), []Event{event}, true)
+}
+
+func (c *bufferedClient) PublishAll(events []Event) {
+	for _, event := range events {
+		c.Publish(event)
+	}
+}
+
+func (c *bufferedClient) PublishAllContext(ctx context.Context, events []Event) (int, error) {
+	published := 0
+	for _, event := range events {
+		if err := ctx.Err(); err != nil {
+			return published, err
+		}
+		err := c.enqueue(ctx, []Event{event}, true)
+		switch {
+		case err == nil:
+			published++
+		case !errors.Is(err, ErrQueueFull):
+			return published, err
+		}
+	}
+	return published, nil
+}
+
+// TryPublish adds the event to the buffer without blocking. False is
+// returned if the event has been dropped, because the buffer is full and
+// the overflow policy is Block or DropNewest.
+func (c *bufferedClient) TryPublish(event Event) bool {
+	return c.enqueue(context.Background(), []Event{event}, false) == nil
+}
+
+func (c *bufferedClient) PublishWait(ctx context.Context, event Event) error {
+	if err := c.enqueue(ctx, []Event{event}, true); err != nil {
+		return err
+	}
+	return c.Flush(ctx)
+}
+
+// PublishDeadline adds the event to the buffer. If the buffer is full and the
+// overflow policy is Block, PublishDeadline waits for space until deadline.
+func (c *bufferedClient) PublishDeadline(event Event, deadline time.Time) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	err := c.enqueue(ctx, []Event{event}, true)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrPublishTimeout
+	}
+	return err
+}
+
+// PublishBatch adds all events to the buffer. ErrQueueFull is returned if
+// the batch is larger than the buffer, or if the buffer is full and the
+// overflow policy is DropNewest.
+func (c *bufferedClient) PublishBatch(events []Event) error {
+	return c.enqueue(context.Background(), events, true)
+}
+
+// PublishChecked adds the event to the buffer. Buffered events are reported
+// as Accepted, even if they are filtered by the processors of the inner
+// client later.
+func (c *bufferedClient) PublishChecked(event Event) (PublishResult, error) {
+	err := c.enqueue(context.Background(), []Event{event}, true)
+	switch {
+	case err == nil:
+		return Accepted, nil
+	case errors.Is(err, ErrQueueFull):
+		return Dropped, nil
+	default:
+		return Dropped, err
+	}
+}
+
+// Flush waits for the buffer to be forwarded to the inner client, and
+// flushes the inner client.
+func (c *bufferedClient) Flush(ctx context.Context) error {
+	if err := c.waitEmpty(ctx); err != nil {
+		return err
+	}
+	return c.inner.Flush(ctx)
+}
+
+func (c *bufferedClient) Metrics() ClientMetrics {
+	m := c.inner.Metrics()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.Dropped += c.dropped
+	m.Buffered = len(c.buf)
+	return m
+}
+
+// Backpressure signals backpressure while the buffer is filled above the
+// thresholds of DefaultBackpressureConfig. The buffer fills up once the inner
+// client is under backpressure.
+func (c *bufferedClient) Backpressure() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.backpressure.Update(len(c.buf))
+}
+
+func (c *bufferedClient) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), c.waitClose)
+	defer cancel()
+	return c.close(ctx, c.inner.Close)
+}
+
+// CloseWithTimeout forwards buffered events to the inner client until ctx
+// is done, and closes the inner client using CloseWithTimeout.
+func (c *bufferedClient) CloseWithTimeout(ctx context.Context) error {
+	return c.close(ctx, func() error { return c.inner.CloseWithTimeout(ctx) })
+}
+
+func (c *bufferedClient) close(ctx context.Context, closeInner func() error) error {
+	c.mu.Lock()
+	c.closed = true
+	c.notify()
+	c.mu.Unlock()
+
+	// the buffer is empty once waitEmpty returns without error
+	_ = c.waitEmpty(ctx)
+
+	c.mu.Lock()
+	c.stopped = true
+	pending := len(c.buf)
+	c.dropped += uint64(pending)
+	c.buf = nil
+	c.notify()
+	c.mu.Unlock()
+
+	err := closeInner()
+	<-c.done
+	if err == nil && pending > 0 {
+		err = ErrCloseTimeout{Pending: pending}
+	}
+	return err
+}
+
+// enqueue adds events to the buffer. If the buffer is full and the overflow
+// policy is Block, enqueue waits for space to become available, unless wait
+// is false. Events are not added if an error is returned.
+func (c *bufferedClient) enqueue(ctx context.Context, events []Event, wait bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		if c.closed {
+			c.dropped += uint64(len(events))
+			return ErrClientClosed
+		}
+		if len(events) > c.capacity {
+			c.dropped += uint64(len(events))
+			return ErrQueueFull
+		}
+
+		free := c.capacity - len(c.buf)
+		if free >= len(events) {
+			c.buf = append(c.buf, events...)
+			c.notify()
+			return nil
+		}
+
+		switch {
+		case c.overflow == DropOldest:
+			n := len(events) - free
+			for i := 0; i < n; i++ {
+				c.buf[i] = Event{}
+			}
+			c.buf = append(c.buf[n:], events...)
+			c.dropped += uint64(n)
+			c.notify()
+			return nil
+		case c.overflow == DropNewest || !wait:
+			c.dropped += uint64(len(events))
+			return ErrQueueFull
+		}
+
+		changed := c.changed
+		c.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			c.mu.Lock()
+			return ctx.Err()
+		case <-changed:
+		}
+		c.mu.Lock()
+	}
+}
+
+// waitEmpty blocks until all buffered events have been forwarded to the
+// inner client, or ctx is done.
+func (c *bufferedClient) waitEmpty(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		empty := len(c.buf) == 0 && !c.inflight
+		changed := c.changed
+		c.mu.Unlock()
+
+		if empty {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// run forwards buffered events to the inner client until the client is
+// stopped.
+func (c *bufferedClient) run() {
+	defer close(c.done)
+
+	for {
+		c.mu.Lock()
+		for len(c.buf) == 0 && !c.stopped {
+			changed := c.changed
+			c.mu.Unlock()
+			<-changed
+			c.mu.Lock()
+		}
+		if c.stopped {
+			c.mu.Unlock()
+			return
+		}
+
+		event := c.buf[0]
+		c.buf[0] = Event{}
+		c.buf = c.buf[1:]
+		c.inflight = true
+		c.notify()
+		c.mu.Unlock()
+
+		c.inner.Publish(event)
+
+		c.mu.Lock()
+		c.inflight = false
+		c.notify()
+		c.mu.Unlock()
+	}
+}
+
+// notify wakes up go-routines waiting for state changes, and updates the
+// backpressure signal. c.mu must be held.
+func (c *bufferedClient) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.backpressure.Update(len(c.buf))
+}
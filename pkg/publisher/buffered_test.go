@@ -0,0 +1,245 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// bufferTestClient records published events. Publish blocks while the
+// client is paused.
+type bufferTestClient struct {
+	Client // not implemented methods panic
+
+	mu        sync.Mutex
+	published []Event
+	closed    bool
+	resume    chan struct{}
+}
+
+func newBufferTestClient(paused bool) *bufferTestClient {
+	c := &bufferTestClient{resume: make(chan struct{})}
+	if !paused {
+		close(c.resume)
+	}
+	return c
+}
+
+func (c *bufferTestClient) Publish(event Event) {
+	c.mu.Lock()
+	resume := c.resume
+	c.mu.Unlock()
+	<-resume
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.published = append(c.published, event)
+}
+
+func (c *bufferTestClient) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.resume)
+}
+
+func (c *bufferTestClient) Events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.published...)
+}
+
+func (c *bufferTestClient) Flush(context.Context) error { return nil }
+
+func (c *bufferTestClient) Metrics() ClientMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientMetrics{Published: uint64(len(c.published))}
+}
+
+func (c *bufferTestClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.closed {
+		c.closed = true
+		select {
+		case <-c.resume:
+		default:
+			close(c.resume) // unblock the publishing go-routine
+		}
+	}
+	return nil
+}
+
+func TestBufferedClient(t *testing.T) {
+	event := func(i int) Event { return Event{Fields: mapstr.M{"i": i}} }
+	ids := func(events []Event) []int {
+		var ids []int
+		for _, e := range events {
+			ids = append(ids, e.Fields["i"].(int))
+		}
+		return ids
+	}
+
+	t.Run("events are forwarded in order", func(t *testing.T) {
+		inner := newBufferTestClient(false)
+		client := NewBufferedClient(inner, 2, Block, time.Second)
+		for i := 0; i < 10; i++ {
+			client.Publish(event(i))
+		}
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, ids(inner.Events()))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("metrics report buffer occupancy", func(t *testing.T) {
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 10, Block, time.Second)
+		for i := 0; i < 4; i++ {
+			client.Publish(event(i))
+		}
+
+		// one event is being forwarded to the blocked inner client
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 3 }, time.Second, time.Millisecond)
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, ClientMetrics{Published: 4}, client.Metrics())
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 2, DropOldest, time.Second)
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+
+		for i := 1; i < 5; i++ {
+			require.True(t, client.TryPublish(event(i)))
+		}
+		require.Equal(t, uint64(2), client.Metrics().Dropped)
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []int{0, 3, 4}, ids(inner.Events()))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("drop newest", func(t *testing.T) {
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 2, DropNewest, time.Second)
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+
+		for i := 1; i < 5; i++ {
+			result, err := client.PublishChecked(event(i))
+			require.NoError(t, err)
+			require.Equal(t, i <= 2, result == Accepted)
+		}
+		require.ErrorIs(t, client.PublishBatch([]Event{event(5)}), ErrQueueFull)
+		require.Equal(t, uint64(3), client.Metrics().Dropped)
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []int{0, 1, 2}, ids(inner.Events()))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("block waits for space", func(t *testing.T) {
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 1, Block, time.Second)
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+		client.Publish(event(1))
+		require.False(t, client.TryPublish(event(2)))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		n, err := client.PublishAllContext(ctx, []Event{event(3)})
+		require.Equal(t, 0, n)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, client.PublishDeadline(event(5), time.Now().Add(10*time.Millisecond)), ErrPublishTimeout)
+		require.Equal(t, 1, client.Metrics().Buffered)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			client.Publish(event(4))
+		}()
+		inner.Resume()
+		<-done
+
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []int{0, 1, 4}, ids(inner.Events()))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("backpressure is signaled while the buffer is filled", func(t *testing.T) {
+		isClosed := func(ch <-chan struct{}) bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		}
+
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 10, Block, time.Second)
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+
+		ch := client.Backpressure()
+		for i := 1; i < 8; i++ {
+			client.Publish(event(i))
+		}
+		require.False(t, isClosed(ch), "buffer is below the high water mark")
+		client.Publish(event(8))
+		require.True(t, isClosed(ch), "buffer has reached the high water mark")
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		require.False(t, isClosed(client.Backpressure()), "buffer has been drained")
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("close forwards buffered events", func(t *testing.T) {
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 10, Block, time.Second)
+		for i := 0; i < 3; i++ {
+			client.Publish(event(i))
+		}
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			inner.Resume()
+		}()
+		require.NoError(t, client.Close())
+		require.Equal(t, []int{0, 1, 2}, ids(inner.Events()))
+		require.ErrorIs(t, client.PublishBatch([]Event{event(3)}), ErrClientClosed)
+	})
+
+	t.Run("close drops buffered events after timeout", func(t *testing.T) {
+		inner := newBufferTestClient(true)
+		client := NewBufferedClient(inner, 10, Block, 10*time.Millisecond)
+		for i := 0; i < 3; i++ {
+			client.Publish(event(i))
+		}
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 2 }, time.Second, time.Millisecond)
+
+		err := client.Close()
+		var timeoutErr ErrCloseTimeout
+		require.True(t, errors.As(err, &timeoutErr))
+		require.Equal(t, 2, timeoutErr.Pending)
+		require.Equal(t, uint64(2), client.Metrics().Dropped)
+	})
+}
@@ -0,0 +1,284 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned by the CircuitBreakerClient if events are
+// rejected, because the outputs have been failing.
+var ErrCircuitOpen = errors.New("publisher circuit breaker is open")
+
+// CircuitState is the state of a CircuitBreakerClient.
+type CircuitState uint8
+
+const (
+	// CircuitClosed is the normal state. Events are published.
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects all events, until the cooldown has elapsed.
+	CircuitOpen
+
+	// CircuitHalfOpen publishes events again after the cooldown. The next
+	// ACK decides if the circuit is closed or opened again.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerClient is a Client that stops publishing events if the
+// outputs are failing persistently. Failures are observed via an ACKer
+// installed by the CircuitBreakerClient. Events reported as failed via
+// PartialACKer.ACKEventsIndexed count as failures, while all other ACKed
+// events count as successes.
+//
+// The circuit trips open after threshold consecutive failed events. While
+// open, all events are rejected: Publish and TryPublish drop the event, and
+// the other publish methods return ErrCircuitOpen. Rejected events are
+// included in the Dropped metric. Once the cooldown has elapsed, the circuit
+// is half-open and events are published again. The next successful event
+// closes the circuit, while the next failed event opens it again.
+type CircuitBreakerClient struct {
+	client    Client
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    CircuitState
+	failures int // number of consecutive failed events
+	openedAt time.Time
+	rejected uint64
+}
+
+var _ Client = (*CircuitBreakerClient)(nil)
+var _ PartialACKer = (*circuitACKer)(nil)
+var _ LatencyACKer = (*circuitACKer)(nil)
+
+// circuitACKer reports ACK results to the CircuitBreakerClient, and forwards
+// them to the ACKer of the ClientConfig.
+type circuitACKer struct {
+	breaker *CircuitBreakerClient
+	next    ACKer
+}
+
+// NewCircuitBreakerClient connects to pipeline using cfg. The ACKHandler of
+// cfg is wrapped, such that the CircuitBreakerClient can observe failed
+// events. A threshold < 1 is treated as 1.
+// The CircuitBreakerClient connects to the pipeline itself, instead of
+// wrapping an existing Client, as the ACKer observing the outputs can only be
+// installed via the ClientConfig when connecting.
+func NewCircuitBreakerClient(pipeline Pipeline, cfg ClientConfig, threshold int, cooldown time.Duration) (*CircuitBreakerClient, error) {
+	if threshold < 1 {
+		threshold = 1
+	}
+	c := &CircuitBreakerClient{threshold: threshold, cooldown: cooldown}
+
+	cfg.ACKHandler = &circuitACKer{breaker: c, next: cfg.ACKHandler}
+	client, err := pipeline.ConnectWith(cfg)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return c, nil
+}
+
+// State returns the current state of the circuit breaker.
+func (c *CircuitBreakerClient) State() CircuitState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.currentState()
+}
+
+func (c *CircuitBreakerClient) Publish(event Event) {
+	if c.allow(1) == nil {
+		c.client.Publish(event)
+	}
+}
+
+func (c *CircuitBreakerClient) PublishAll(events []Event) {
+	for _, event := range events {
+		c.Publish(event)
+	}
+}
+
+func (c *CircuitBreakerClient) PublishAllContext(ctx context.Context, events []Event) (int, error) {
+	if err := c.allow(len(events)); err != nil {
+		return 0, err
+	}
+	return c.client.PublishAllContext(ctx, events)
+}
+
+func (c *CircuitBreakerClient) TryPublish(event Event) bool {
+	return c.allow(1) == nil && c.client.TryPublish(event)
+}
+
+func (c *CircuitBreakerClient) PublishWait(ctx context.Context, event Event) error {
+	if err := c.allow(1); err != nil {
+		return err
+	}
+	return c.client.PublishWait(ctx, event)
+}
+
+func (c *CircuitBreakerClient) PublishDeadline(event Event, deadline time.Time) error {
+	if err := c.allow(1); err != nil {
+		return err
+	}
+	return c.client.PublishDeadline(event, deadline)
+}
+
+func (c *CircuitBreakerClient) PublishBatch(events []Event) error {
+	if err := c.allow(len(events)); err != nil {
+		return err
+	}
+	return c.client.PublishBatch(events)
+}
+
+func (c *CircuitBreakerClient) PublishChecked(event Event) (PublishResult, error) {
+	if err := c.allow(1); err != nil {
+		return Dropped, err
+	}
+	return c.client.PublishChecked(event)
+}
+
+func (c *CircuitBreakerClient) Flush(ctx context.Context) error {
+	return c.client.Flush(ctx)
+}
+
+func (c *CircuitBreakerClient) Metrics() ClientMetrics {
+	m := c.client.Metrics()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.Dropped += c.rejected
+	return m
+}
+
+func (c *CircuitBreakerClient) Backpressure() <-chan struct{} {
+	return c.client.Backpressure()
+}
+
+func (c *CircuitBreakerClient) Close() error {
+	return c.client.Close()
+}
+
+func (c *CircuitBreakerClient) CloseWithTimeout(ctx context.Context) error {
+	return c.client.CloseWithTimeout(ctx)
+}
+
+// allow returns ErrCircuitOpen if n events must be rejected.
+func (c *CircuitBreakerClient) allow(n int) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.currentState() == CircuitOpen {
+		c.rejected += uint64(n)
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// currentState moves an open circuit to half-open once the cooldown has
+// elapsed. c.mu must be held.
+func (c *CircuitBreakerClient) currentState() CircuitState {
+	if c.state == CircuitOpen && time.Since(c.openedAt) >= c.cooldown {
+		c.state = CircuitHalfOpen
+	}
+	return c.state
+}
+
+// record updates the circuit state with the results of ACKed events, in
+// the order the events have been published.
+func (c *CircuitBreakerClient) record(acked, failed []int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(acked) > 0 || len(failed) > 0 {
+		if len(failed) == 0 || (len(acked) > 0 && acked[0] < failed[0]) {
+			acked = acked[1:]
+			c.failures = 0
+			if c.currentState() == CircuitHalfOpen {
+				c.state = CircuitClosed
+			}
+			continue
+		}
+
+		failed = failed[1:]
+		c.failures++
+		if state := c.currentState(); state == CircuitHalfOpen || (state == CircuitClosed && c.failures >= c.threshold) {
+			c.state = CircuitOpen
+			c.openedAt = time.Now()
+			c.failures = 0
+		}
+	}
+}
+
+func (a *circuitACKer) AddEvent(event Event, published bool) {
+	if a.next != nil {
+		a.next.AddEvent(event, published)
+	}
+}
+
+func (a *circuitACKer) ACKEvents(n int) {
+	if a.recordACKed(n) && a.next != nil {
+		a.next.ACKEvents(n)
+	}
+}
+
+func (a *circuitACKer) ACKEventsWithTime(n int, t time.Time) {
+	if !a.recordACKed(n) || a.next == nil {
+		return
+	}
+	if la, ok := a.next.(LatencyACKer); ok {
+		la.ACKEventsWithTime(n, t)
+	} else {
+		a.next.ACKEvents(n)
+	}
+}
+
+// recordACKed records n successful events. False is returned if n is not
+// positive.
+func (a *circuitACKer) recordACKed(n int) bool {
+	if n <= 0 {
+		return false
+	}
+	acked := make([]int, n)
+	for i := range acked {
+		acked[i] = i
+	}
+	a.breaker.record(acked, nil)
+	return true
+}
+
+func (a *circuitACKer) ACKEventsIndexed(acked, failed []int) {
+	a.breaker.record(acked, failed)
+	if a.next == nil {
+		return
+	}
+	if pa, ok := a.next.(PartialACKer); ok {
+		pa.ACKEventsIndexed(acked, failed)
+	} else if n := len(acked) + len(failed); n > 0 {
+		a.next.ACKEvents(n)
+	}
+}
+
+func (a *circuitACKer) Close() {
+	if a.next != nil {
+		a.next.Close()
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerClient(t *testing.T) {
+	connect := func(t *testing.T, acker ACKer, cooldown time.Duration) (*CircuitBreakerClient, PartialACKer) {
+		pipeline := &poolTestPipeline{}
+		client, err := NewCircuitBreakerClient(pipeline, ClientConfig{ACKHandler: acker}, 2, cooldown)
+		require.NoError(t, err)
+		return client, pipeline.clients[0].acker.(PartialACKer)
+	}
+
+	t.Run("circuit opens after consecutive failures", func(t *testing.T) {
+		client, acker := connect(t, nil, time.Hour)
+
+		acker.ACKEventsIndexed([]int{1}, []int{0, 2})
+		require.Equal(t, CircuitClosed, client.State())
+
+		acker.ACKEventsIndexed(nil, []int{0})
+		require.Equal(t, CircuitOpen, client.State())
+
+		client.Publish(Event{})
+		_, err := client.PublishChecked(Event{})
+		require.ErrorIs(t, err, ErrCircuitOpen)
+		require.ErrorIs(t, client.PublishBatch([]Event{{}, {}}), ErrCircuitOpen)
+		require.Equal(t, uint64(4), client.Metrics().Dropped)
+	})
+
+	t.Run("half-open circuit is closed on success", func(t *testing.T) {
+		client, acker := connect(t, nil, 10*time.Millisecond)
+
+		acker.ACKEventsIndexed(nil, []int{0, 1})
+		require.Equal(t, CircuitOpen, client.State())
+		require.Eventually(t, func() bool { return client.State() == CircuitHalfOpen }, time.Second, time.Millisecond)
+
+		client.Publish(Event{})
+		acker.ACKEvents(1)
+		require.Equal(t, CircuitClosed, client.State())
+	})
+
+	t.Run("half-open circuit is opened again on failure", func(t *testing.T) {
+		client, acker := connect(t, nil, 10*time.Millisecond)
+
+		acker.ACKEventsIndexed(nil, []int{0, 1})
+		require.Eventually(t, func() bool { return client.State() == CircuitHalfOpen }, time.Second, time.Millisecond)
+
+		acker.ACKEventsIndexed(nil, []int{0})
+		require.Equal(t, CircuitOpen, client.State())
+	})
+
+	t.Run("ACKs are forwarded", func(t *testing.T) {
+		var gotACKed, gotFailed []int
+		next := &poolTestACKer{}
+		client, acker := connect(t, struct {
+			*poolTestACKer
+			partialACKFunc
+		}{next, func(acked, failed []int) { gotACKed, gotFailed = acked, failed }}, time.Hour)
+
+		client.Publish(Event{})
+		acker.ACKEventsIndexed([]int{0}, []int{1})
+		require.Equal(t, 1, next.added)
+		require.Equal(t, []int{0}, gotACKed)
+		require.Equal(t, []int{1}, gotFailed)
+	})
+
+	t.Run("ACK timestamps are forwarded", func(t *testing.T) {
+		var gotN int
+		var gotTime time.Time
+		next := &poolTestACKer{}
+		client, acker := connect(t, struct {
+			*poolTestACKer
+			latencyACKFunc
+		}{next, func(n int, t time.Time) { gotN, gotTime = n, t }}, time.Hour)
+
+		ts := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+		acker.(LatencyACKer).ACKEventsWithTime(2, ts)
+		require.Equal(t, 2, gotN)
+		require.Equal(t, ts, gotTime)
+		require.Equal(t, 0, next.acked)
+		require.Equal(t, CircuitClosed, client.State())
+	})
+}
+
+type partialACKFunc func(acked, failed []int)
+
+func (fn partialACKFunc) ACKEventsIndexed(acked, failed []int) { fn(acked, failed) }
+
+type latencyACKFunc func(n int, t time.Time)
+
+func (fn latencyACKFunc) ACKEventsWithTime(n int, t time.Time) { fn(n, t) }
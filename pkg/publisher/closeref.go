@@ -0,0 +1,53 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// closeRef is a CloseRef that is closed once with a fixed error.
+type closeRef struct {
+	once sync.Once
+	done chan struct{}
+	err  error
+}
+
+// NewTimeoutCloseRef returns a CloseRef that is closed after d. Err returns
+// context.DeadlineExceeded once the CloseRef has been closed.
+func NewTimeoutCloseRef(d time.Duration) CloseRef {
+	ref := newCloseRef(context.DeadlineExceeded)
+	time.AfterFunc(d, ref.close)
+	return ref
+}
+
+// NewCancelCloseRef returns a CloseRef and a function to close it. Err
+// returns context.Canceled once the CloseRef has been closed. The function
+// can be called multiple times.
+func NewCancelCloseRef() (CloseRef, func()) {
+	ref := newCloseRef(context.Canceled)
+	return ref, ref.close
+}
+
+func newCloseRef(err error) *closeRef {
+	return &closeRef{done: make(chan struct{}), err: err}
+}
+
+func (r *closeRef) close() {
+	r.once.Do(func() { close(r.done) })
+}
+
+func (r *closeRef) Done() <-chan struct{} { return r.done }
+
+func (r *closeRef) Err() error {
+	select {
+	case <-r.done:
+		return r.err
+	default:
+		return nil
+	}
+}
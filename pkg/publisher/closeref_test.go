@@ -0,0 +1,41 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTimeoutCloseRef(t *testing.T) {
+	ref := NewTimeoutCloseRef(10 * time.Millisecond)
+	require.NoError(t, ref.Err())
+
+	select {
+	case <-ref.Done():
+	case <-time.After(time.Second):
+		t.Fatal("close ref has not been closed after timeout")
+	}
+	require.ErrorIs(t, ref.Err(), context.DeadlineExceeded)
+}
+
+func TestNewCancelCloseRef(t *testing.T) {
+	ref, cancel := NewCancelCloseRef()
+	require.NoError(t, ref.Err())
+
+	select {
+	case <-ref.Done():
+		t.Fatal("close ref closed before cancel")
+	default:
+	}
+
+	cancel()
+	cancel()
+	<-ref.Done()
+	require.ErrorIs(t, ref.Err(), context.Canceled)
+}
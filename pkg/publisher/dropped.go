@@ -0,0 +1,170 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// DefaultDroppedLogMaxSize is the file size at which a FileDroppedLogger
+// rotates its file, if no size has been configured.
+const DefaultDroppedLogMaxSize = 10 * 1024 * 1024
+
+// droppedLogBackups is the number of rotated files kept by the
+// FileDroppedLogger.
+const droppedLogBackups = 3
+
+// FileDroppedLogger is a ClientEventer writing events that have been filtered
+// out by the processors or dropped on publish to a file. Each event is
+// written as a JSON line holding the time, the reason ("filtered" or
+// "dropped"), and the event fields. The FileDroppedLogger implements
+// ReasonedEventer, such that the detailed reason reported by the pipeline is
+// written as detail.
+//
+// Before a line is written that would exceed the maximum file size, the file
+// is rotated: <path> is renamed to <path>.1, <path>.1 to <path>.2, and so on.
+// Up to 3 rotated files are kept.
+//
+// The FileDroppedLogger can be shared by multiple clients. The file is not
+// closed on ClientEventer.Closed, but must be closed via Close. Write errors
+// are logged.
+type FileDroppedLogger struct {
+	path    string
+	maxSize int64
+	log     *logp.Logger
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+}
+
+var _ ReasonedEventer = (*FileDroppedLogger)(nil)
+
+type droppedLogEntry struct {
+	Timestamp time.Time `json:"@timestamp"`
+	Reason    string    `json:"reason"`
+	Detail    string    `json:"detail,omitempty"`
+	Event     mapstr.M  `json:"event"`
+}
+
+// NewFileDroppedLogger opens or creates the file at path, appending new
+// entries to the file. DefaultDroppedLogMaxSize is used if maxSize is <= 0.
+func NewFileDroppedLogger(path string, maxSize int64) (*FileDroppedLogger, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultDroppedLogMaxSize
+	}
+	l := &FileDroppedLogger{
+		path:    path,
+		maxSize: maxSize,
+		log:     logp.NewLogger("dropped-events"),
+	}
+	if err := l.open(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *FileDroppedLogger) Closing()   {}
+func (l *FileDroppedLogger) Closed()    {}
+func (l *FileDroppedLogger) Published() {}
+
+func (l *FileDroppedLogger) FilteredOut(event Event) { l.write("filtered", "", event) }
+
+func (l *FileDroppedLogger) DroppedOnPublish(event Event) { l.write("dropped", "", event) }
+
+func (l *FileDroppedLogger) FilteredOutReason(event Event, reason string) {
+	l.write("filtered", reason, event)
+}
+
+func (l *FileDroppedLogger) DroppedReason(event Event, reason string) {
+	l.write("dropped", reason, event)
+}
+
+// Close closes the file. Events reported after Close are not written.
+func (l *FileDroppedLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+func (l *FileDroppedLogger) write(reason, detail string, event Event) {
+	line, err := json.Marshal(droppedLogEntry{Timestamp: time.Now().UTC(), Reason: reason, Detail: detail, Event: event.Fields})
+	if err != nil {
+		l.log.Warnf("Failed to encode dropped event: %v", err)
+		return
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return
+	}
+
+	if l.size > 0 && l.size+int64(len(line)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			l.log.Warnf("Failed to rotate dropped events file: %v", err)
+			if l.file == nil {
+				return
+			}
+		}
+	}
+
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		l.log.Warnf("Failed to write dropped event: %v", err)
+	}
+}
+
+// rotate renames the current file and opens a new file. The current file is
+// opened again if renaming fails. l.mu must be held.
+func (l *FileDroppedLogger) rotate() error {
+	err := l.file.Close()
+	l.file = nil
+
+	for i := droppedLogBackups; i > 0 && err == nil; i-- {
+		from, to := fmt.Sprintf("%v.%d", l.path, i-1), fmt.Sprintf("%v.%d", l.path, i)
+		if i == 1 {
+			from = l.path
+		}
+		if renameErr := os.Rename(from, to); renameErr != nil && !os.IsNotExist(renameErr) {
+			err = renameErr
+		}
+	}
+
+	if openErr := l.open(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+// open opens the file at l.path for appending. l.mu must be held, if the
+// logger is in use.
+func (l *FileDroppedLogger) open() error {
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open dropped events file: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to open dropped events file: %w", err)
+	}
+	l.file, l.size = f, info.Size()
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFileDroppedLogger(t *testing.T) {
+	readEntries := func(t *testing.T, path string) []map[string]interface{} {
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+
+		var entries []map[string]interface{}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var entry map[string]interface{}
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+			entries = append(entries, entry)
+		}
+		require.NoError(t, scanner.Err())
+		return entries
+	}
+
+	t.Run("dropped and filtered events are written", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dropped.ndjson")
+		l, err := NewFileDroppedLogger(path, 0)
+		require.NoError(t, err)
+
+		l.Published()
+		l.FilteredOut(Event{Fields: mapstr.M{"message": "a"}})
+		l.DroppedOnPublish(Event{Fields: mapstr.M{"message": "b"}, Private: "ignored"})
+		require.NoError(t, l.Close())
+		l.DroppedOnPublish(Event{Fields: mapstr.M{"message": "after close"}})
+
+		entries := readEntries(t, path)
+		require.Len(t, entries, 2)
+		require.Equal(t, "filtered", entries[0]["reason"])
+		require.Equal(t, map[string]interface{}{"message": "a"}, entries[0]["event"])
+		require.Equal(t, "dropped", entries[1]["reason"])
+		require.Equal(t, map[string]interface{}{"message": "b"}, entries[1]["event"])
+		require.Contains(t, entries[1], "@timestamp")
+	})
+
+	t.Run("reasons are written as detail", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dropped.ndjson")
+		l, err := NewFileDroppedLogger(path, 0)
+		require.NoError(t, err)
+
+		ReportFilteredOut(l, Event{Fields: mapstr.M{"message": "a"}}, "drop_fields")
+		ReportDropped(l, Event{Fields: mapstr.M{"message": "b"}}, DropReasonQueueFull)
+		require.NoError(t, l.Close())
+
+		entries := readEntries(t, path)
+		require.Len(t, entries, 2)
+		require.Equal(t, "filtered", entries[0]["reason"])
+		require.Equal(t, "drop_fields", entries[0]["detail"])
+		require.Equal(t, "dropped", entries[1]["reason"])
+		require.Equal(t, DropReasonQueueFull, entries[1]["detail"])
+	})
+
+	t.Run("file is rotated", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "dropped.ndjson")
+		l, err := NewFileDroppedLogger(path, 100)
+		require.NoError(t, err)
+		defer l.Close()
+
+		// each entry is ~90 bytes, such that each entry is written to a new file
+		for i := 0; i < 6; i++ {
+			l.DroppedOnPublish(Event{Fields: mapstr.M{"i": i}})
+		}
+
+		require.Equal(t, float64(5), readEntries(t, path)[0]["event"].(map[string]interface{})["i"])
+		for i := 1; i <= droppedLogBackups; i++ {
+			entries := readEntries(t, fmt.Sprintf("%v.%d", path, i))
+			require.Len(t, entries, 1)
+			require.Equal(t, float64(5-i), entries[0]["event"].(map[string]interface{})["i"])
+		}
+		require.NoFileExists(t, path+".4")
+	})
+
+	t.Run("fail if file can not be created", func(t *testing.T) {
+		_, err := NewFileDroppedLogger(filepath.Join(t.TempDir(), "missing", "dropped.ndjson"), 0)
+		require.Error(t, err)
+	})
+}
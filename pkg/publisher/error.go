@@ -0,0 +1,44 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrClientClosed is returned if the client has been closed while an
+// operation was still waiting for the pipeline.
+var ErrClientClosed = errors.New("publisher client has been closed")
+
+// ErrQueueFull is returned by Client.PublishBatch if the queue has no space
+// for all events of the batch.
+var ErrQueueFull = errors.New("publisher queue is full")
+
+// ErrPublishTimeout is returned by Client.PublishDeadline if the event could
+// not be enqueued before the deadline.
+var ErrPublishTimeout = errors.New("timeout while publishing event")
+
+// ErrInvalidEvent is returned when publishing a single event that has been
+// rejected by the client, because it is a zero event and the client has been
+// configured with ClientConfig.ValidateEvents.
+var ErrInvalidEvent = errors.New("invalid event")
+
+// ErrPipelineClosed is returned by Client.Close if the pipeline has been
+// closed before the client, so the client could not wait for its pending
+// events to be ACKed.
+var ErrPipelineClosed = errors.New("publisher pipeline has been closed")
+
+// ErrCloseTimeout is returned by Client.Close and Client.CloseWithTimeout if
+// events are still waiting to be ACKed when the client is closed. Pending is
+// the number of events that have not been ACKed yet, and might have been
+// lost. Use errors.As to check for ErrCloseTimeout.
+type ErrCloseTimeout struct {
+	Pending int
+}
+
+func (e ErrCloseTimeout) Error() string {
+	return fmt.Sprintf("timeout while waiting for %d pending events to be ACKed on close", e.Pending)
+}
@@ -0,0 +1,23 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestErrCloseTimeout(t *testing.T) {
+	err := fmt.Errorf("failed to close client: %w", ErrCloseTimeout{Pending: 3})
+
+	var timeoutErr ErrCloseTimeout
+	require.True(t, errors.As(err, &timeoutErr))
+	require.Equal(t, 3, timeoutErr.Pending)
+	require.Contains(t, err.Error(), "3 pending events")
+	require.False(t, errors.Is(err, ErrPipelineClosed))
+}
@@ -4,9 +4,156 @@
 
 package publisher
 
-import "github.com/elastic/elastic-agent-libs/mapstr"
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Event is the event type published to the pipeline.
+//
+// Fields is a Go map, such that the order of keys is not retained. Encoders
+// are responsible for the order of keys in the serialized event. The
+// encoding/json package, as well as mapstr.M.String and
+// mapstr.M.StringToPrint, write map keys in sorted order on all nesting
+// levels, including maps in arrays. Serialized events can be compared in
+// tests without additional sorting.
 type Event struct {
 	Fields  mapstr.M
 	Private interface{}
 }
+
+// IsZero reports whether the event holds no data: it has no fields, except
+// for an `@timestamp` field holding the zero time. Zero events are skipped by
+// clients configured with ClientConfig.ValidateEvents.
+func (e Event) IsZero() bool {
+	for key, value := range e.Fields {
+		if ts, ok := value.(time.Time); key != "@timestamp" || !ok || !ts.IsZero() {
+			return false
+		}
+	}
+	return true
+}
+
+// FlattenFields returns a copy of fields with all nested objects converted
+// into dotted keys, e.g. {"a": {"b": 1}} becomes {"a.b": 1}. Arrays are not
+// flattened. Null values are removed, unless keepNull is set. Nested objects
+// without any remaining value are removed as well.
+// FlattenFields is used for ProcessingConfig.FlattenFields.
+func FlattenFields(fields mapstr.M, keepNull bool) mapstr.M {
+	flat := mapstr.M{}
+	flattenInto(flat, "", fields, keepNull)
+	return flat
+}
+
+func flattenInto(flat mapstr.M, prefix string, fields map[string]interface{}, keepNull bool) {
+	for key, value := range fields {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case mapstr.M:
+			flattenInto(flat, key, v, keepNull)
+		case map[string]interface{}:
+			flattenInto(flat, key, v, keepNull)
+		case nil:
+			if keepNull {
+				flat[key] = nil
+			}
+		default:
+			flat[key] = value
+		}
+	}
+}
+
+// ErrFieldCollision is returned by EventBuilder.Build if a field has been
+// added to a path that is already in use by another field.
+var ErrFieldCollision = errors.New("field collides with existing field")
+
+// EventBuilder creates an Event using chainable methods. Dotted paths are
+// stored as nested objects, e.g. Field("a.b", 1) creates {"a": {"b": 1}}.
+//
+// Adding a field to a path whose parent holds a value, or adding a field to a
+// path holding an object, is a collision. Build reports the first collision
+// or invalid path. Adding a value to a path that already holds a value
+// replaces the value.
+type EventBuilder struct {
+	fields  mapstr.M
+	private interface{}
+	err     error
+}
+
+// NewEventBuilder creates an EventBuilder for an empty event.
+func NewEventBuilder() *EventBuilder {
+	return &EventBuilder{fields: mapstr.M{}}
+}
+
+// Field adds value under path.
+func (b *EventBuilder) Field(path string, value interface{}) *EventBuilder {
+	if b.err != nil {
+		return b
+	}
+	b.err = putField(b.fields, path, value)
+	return b
+}
+
+// Timestamp sets the `@timestamp` field.
+func (b *EventBuilder) Timestamp(ts time.Time) *EventBuilder {
+	return b.Field("@timestamp", ts)
+}
+
+// Meta adds value under key to the `@metadata` field. The key can be a
+// dotted path.
+func (b *EventBuilder) Meta(key string, value interface{}) *EventBuilder {
+	return b.Field("@metadata."+key, value)
+}
+
+// Private sets Event.Private.
+func (b *EventBuilder) Private(private interface{}) *EventBuilder {
+	b.private = private
+	return b
+}
+
+// Build returns the event, or the first error reported while adding fields.
+// Each call returns a copy of the fields, such that the builder can be used
+// to create further events.
+func (b *EventBuilder) Build() (Event, error) {
+	if b.err != nil {
+		return Event{}, b.err
+	}
+	return Event{Fields: b.fields.Clone(), Private: b.private}, nil
+}
+
+func putField(fields mapstr.M, path string, value interface{}) error {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return fmt.Errorf("invalid field path '%v'", path)
+		}
+	}
+
+	current := fields
+	for i, key := range keys[:len(keys)-1] {
+		switch next := current[key].(type) {
+		case nil:
+			m := mapstr.M{}
+			current[key] = m
+			current = m
+		case mapstr.M:
+			current = next
+		default:
+			return fmt.Errorf("%w: '%v' is a parent of '%v'", ErrFieldCollision, strings.Join(keys[:i+1], "."), path)
+		}
+	}
+
+	last := keys[len(keys)-1]
+	if _, isObject := current[last].(mapstr.M); isObject {
+		return fmt.Errorf("%w: '%v' holds an object", ErrFieldCollision, path)
+	}
+	current[last] = value
+	return nil
+}
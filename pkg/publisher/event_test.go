@@ -0,0 +1,133 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFlattenFields(t *testing.T) {
+	fields := mapstr.M{
+		"a": mapstr.M{
+			"b": 1,
+			"c": map[string]interface{}{"d": "x", "null": nil},
+		},
+		"list":  []interface{}{mapstr.M{"e": 1}},
+		"null":  nil,
+		"empty": mapstr.M{},
+	}
+
+	t.Run("null values are removed", func(t *testing.T) {
+		require.Equal(t, mapstr.M{
+			"a.b":   1,
+			"a.c.d": "x",
+			"list":  []interface{}{mapstr.M{"e": 1}},
+		}, FlattenFields(fields, false))
+	})
+
+	t.Run("null values are kept", func(t *testing.T) {
+		require.Equal(t, mapstr.M{
+			"a.b":      1,
+			"a.c.d":    "x",
+			"a.c.null": nil,
+			"list":     []interface{}{mapstr.M{"e": 1}},
+			"null":     nil,
+		}, FlattenFields(fields, true))
+	})
+}
+
+func TestEventIsZero(t *testing.T) {
+	require.True(t, Event{}.IsZero())
+	require.True(t, Event{Fields: mapstr.M{}, Private: 1}.IsZero())
+	require.True(t, Event{Fields: mapstr.M{"@timestamp": time.Time{}}}.IsZero())
+	require.False(t, Event{Fields: mapstr.M{"@timestamp": time.Now()}}.IsZero())
+	require.False(t, Event{Fields: mapstr.M{"@timestamp": time.Time{}, "message": ""}}.IsZero())
+	require.False(t, Event{Fields: mapstr.M{"@timestamp": nil}}.IsZero())
+}
+
+func TestEventFieldsEncoding(t *testing.T) {
+	fields := func() mapstr.M {
+		return mapstr.M{
+			"z": 1,
+			"a": mapstr.M{"y": true, "b": map[string]interface{}{"x": "1", "c": "2"}},
+			"list": []interface{}{
+				mapstr.M{"w": 1, "d": 2},
+				map[string]interface{}{"v": 1, "e": 2},
+			},
+			"maps": []mapstr.M{{"u": 1, "f": 2}},
+		}
+	}
+
+	expected := `{"a":{"b":{"c":"2","x":"1"},"y":true},` +
+		`"list":[{"d":2,"w":1},{"e":2,"v":1}],"maps":[{"f":2,"u":1}],"z":1}`
+	for i := 0; i < 10; i++ {
+		raw, err := json.Marshal(fields())
+		require.NoError(t, err)
+		require.Equal(t, expected, string(raw))
+		require.Equal(t, expected, fields().String())
+	}
+}
+
+func TestEventBuilder(t *testing.T) {
+	ts := time.Date(2022, 8, 15, 10, 30, 0, 0, time.UTC)
+
+	t.Run("dotted paths create nested objects", func(t *testing.T) {
+		event, err := NewEventBuilder().
+			Field("message", "hello").
+			Field("host.name", "localhost").
+			Field("host.os.family", "linux").
+			Timestamp(ts).
+			Meta("pipeline", "logs").
+			Private(42).
+			Build()
+		require.NoError(t, err)
+		require.Equal(t, Event{
+			Fields: mapstr.M{
+				"@timestamp": ts,
+				"@metadata":  mapstr.M{"pipeline": "logs"},
+				"message":    "hello",
+				"host":       mapstr.M{"name": "localhost", "os": mapstr.M{"family": "linux"}},
+			},
+			Private: 42,
+		}, event)
+	})
+
+	t.Run("values are replaced", func(t *testing.T) {
+		event, err := NewEventBuilder().Field("a.b", 1).Field("a.b", 2).Build()
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"a": mapstr.M{"b": 2}}, event.Fields)
+	})
+
+	t.Run("builder can be reused", func(t *testing.T) {
+		b := NewEventBuilder().Field("a.b", 1)
+		first, err := b.Build()
+		require.NoError(t, err)
+		second, err := b.Field("a.c", 2).Build()
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"a": mapstr.M{"b": 1}}, first.Fields)
+		require.Equal(t, mapstr.M{"a": mapstr.M{"b": 1, "c": 2}}, second.Fields)
+	})
+
+	t.Run("collisions are reported", func(t *testing.T) {
+		_, err := NewEventBuilder().Field("a", 1).Field("a.b", 2).Build()
+		require.ErrorIs(t, err, ErrFieldCollision)
+
+		_, err = NewEventBuilder().Field("a.b", 1).Field("a", 2).Build()
+		require.ErrorIs(t, err, ErrFieldCollision)
+	})
+
+	t.Run("invalid paths are reported", func(t *testing.T) {
+		for _, path := range []string{"", "a..b", ".a", "a."} {
+			_, err := NewEventBuilder().Field(path, 1).Build()
+			require.Error(t, err, "path '%v'", path)
+		}
+	})
+}
@@ -5,6 +5,7 @@
 package publisher
 
 import (
+	"context"
 	"time"
 
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -23,7 +24,134 @@ type PipelineConnector = Pipeline
 type Client interface {
 	Publish(Event)
 	PublishAll([]Event)
+
+	// PublishAllContext publishes events one by one until all events have
+	// been published or ctx is cancelled. It returns the number of events that
+	// have been accepted by the pipeline. If ctx is cancelled before all
+	// events have been published the context error is returned.
+	// With GuaranteedSend PublishAllContext blocks per event, but
+	// cancellation is checked in between events.
+	PublishAllContext(ctx context.Context, events []Event) (published int, err error)
+
+	// TryPublish publishes an event and reports if the event has been accepted
+	// by the pipeline. If the client is configured with DropIfFull, the event
+	// is only enqueued if the pipeline has space available, otherwise the event
+	// is dropped (ClientEventer.DroppedOnPublish is called) and false is
+	// returned. AtMostOnce behaves like DropIfFull. With GuaranteedSend
+	// TryPublish blocks like Publish does.
+	// Events filtered out by the processors are reported as accepted, as
+	// there is no need to retry them.
+	TryPublish(Event) bool
+
+	// PublishWait publishes a single event and blocks until the event has been
+	// ACKed by the outputs, or ctx is cancelled. If the client is closed while
+	// waiting ErrClientClosed is returned.
+	PublishWait(ctx context.Context, event Event) error
+
+	// PublishDeadline publishes a single event like Publish, but gives up
+	// once deadline has passed. With GuaranteedSend Publish blocks until the
+	// queue has space available, PublishDeadline returns ErrPublishTimeout
+	// instead if the event could not be enqueued before deadline. Events
+	// that have timed out are not enqueued, and are not accounted for as
+	// active events. ErrClientClosed is returned if the client has been
+	// closed.
+	PublishDeadline(event Event, deadline time.Time) error
+
+	// PublishBatch publishes all events as a single unit. With DropIfFull
+	// the events are only enqueued if the queue has space for all events,
+	// otherwise no event is enqueued and ErrQueueFull is returned. With
+	// GuaranteedSend PublishBatch behaves like PublishAll. ErrClientClosed is
+	// returned if the client has been closed.
+	PublishBatch(events []Event) error
+
+	// PublishChecked publishes an event like Publish, and reports if the
+	// event has been accepted by the pipeline. The processors configured via
+	// ProcessingConfig run synchronously, such that events removed by the
+	// processors are reported as Filtered. Events dropped on publish, e.g. due
+	// to DropIfFull or the client being closed, are reported as Dropped.
+	// If a processor fails, the event is dropped and the error is returned.
+	// Events dropped by the outputs after being accepted are only reported via
+	// the ACKer.
+	PublishChecked(Event) (PublishResult, error)
+
+	// Flush blocks until all events published before Flush has been called
+	// have been ACKed, or ctx is cancelled. Unlike Close, the client can still
+	// be used after Flush returns. The context error is returned if ctx is
+	// cancelled before all events have been ACKed. ErrClientClosed is
+	// returned if the client is closed while waiting.
+	Flush(ctx context.Context) error
+
+	// Metrics returns a snapshot of the clients publishing metrics.
+	Metrics() ClientMetrics
+
+	// Backpressure returns a channel that is closed while the queue is
+	// filled above the high water mark configured via
+	// ClientConfig.Backpressure, e.g. to pause fetching from upstream
+	// instead of blocking in Publish. The channel stays closed until the
+	// queue has drained below the low water mark. Afterwards Backpressure
+	// returns a new open channel, which is closed once the high water mark
+	// is reached again. Sources should call Backpressure on each iteration
+	// of their read loop, and select on the returned channel:
+	//
+	//	select {
+	//	case <-client.Backpressure():
+	//		// wait before fetching more data
+	//	default:
+	//		// fetch
+	//	}
+	//
+	// Clients without a queue return a nil channel, which never signals
+	// backpressure.
+	Backpressure() <-chan struct{}
+
+	// Close closes the client. If WaitClose is configured, Close waits for
+	// pending events to be ACKed. Pending events include events passed to the
+	// client before Close, that are still being processed and have not
+	// reached the queue yet, e.g. the remainder of a PublishAll batch.
+	// ErrCloseTimeout is returned if events are still pending after
+	// WaitClose. ErrPipelineClosed is returned if the pipeline has been closed
+	// while waiting.
 	Close() error
+
+	// CloseWithTimeout closes the client like Close, but waits for pending
+	// events to be ACKed until ctx is cancelled instead of waiting for the
+	// configured WaitClose duration. ErrCloseTimeout is returned if events are
+	// still unacknowledged once ctx is done, indicating that data might be
+	// lost.
+	CloseWithTimeout(ctx context.Context) error
+}
+
+// ClientMetrics reports event counters for a Client. The counters are
+// updated alongside the ClientEventer callbacks.
+type ClientMetrics struct {
+	// Published is the number of events forwarded to the publisher pipeline.
+	Published uint64
+
+	// Dropped is the number of events dropped on publish, e.g. while waiting
+	// for the queue, after the client has been closed, or because a processor
+	// has failed.
+	Dropped uint64
+
+	// Filtered is the number of events filtered out by the processors.
+	Filtered uint64
+
+	// ActiveEvents is the number of events not yet ACKed. This includes
+	// events passed to the client, that are still being processed and have
+	// not been published to the pipeline yet.
+	ActiveEvents int
+
+	// QueueLen is the number of events in the queue. Depending on the
+	// pipeline implementation the queue is shared between clients and the
+	// value might be approximate.
+	QueueLen int
+
+	// Buffered is the number of events buffered by the client itself, that
+	// have not been forwarded to the pipeline yet. See NewBufferedClient.
+	Buffered int
+
+	// Invalid is the number of zero events skipped by the client. See
+	// ClientConfig.ValidateEvents.
+	Invalid uint64
 }
 
 // ClientConfig defines common configuration options one can pass to
@@ -33,6 +161,14 @@ type ClientConfig struct {
 
 	Processing ProcessingConfig
 
+	// Context is used to close the client asynchronously. The client is
+	// closed once the context is cancelled. If both Context and CloseRef are
+	// set, Context takes precedence.
+	Context context.Context
+
+	// CloseRef allows users to close the client asynchronously.
+	//
+	// Deprecated: Use Context instead.
 	CloseRef CloseRef
 
 	// WaitClose sets the maximum duration to wait on ACK, if client still has events
@@ -46,6 +182,57 @@ type ClientConfig struct {
 
 	// Events configures callbacks for common client callbacks
 	Events ClientEventer
+
+	// DeadLetterHandler is called for events the output has permanently
+	// rejected, if the client uses the DeadLetter publish mode. The error
+	// reports the reason the event has been rejected.
+	DeadLetterHandler func(Event, error)
+
+	// ValidateEvents configures the client to skip zero events (see
+	// Event.IsZero), e.g. events accidentally left empty in a batch passed to
+	// PublishAll. Skipped events are not passed to the processors, the ACKer,
+	// or the ClientEventer, and are not accounted for as active events. They
+	// are only counted in ClientMetrics.Invalid.
+	// Batches are published without their zero events, and PublishAllContext
+	// does not count skipped events as published. Single zero events passed to
+	// PublishChecked, PublishWait, or PublishDeadline are rejected with
+	// ErrInvalidEvent, and TryPublish returns false.
+	// If not set, zero events are published like any other event.
+	ValidateEvents bool
+
+	// IdleTimeout configures the client to close its pipeline connection
+	// once no event has been published for the given duration, freeing
+	// pipeline resources held by quiet sources. The idle close waits for
+	// all events published before to be ACKed, such that in-flight ACKs are
+	// still delivered. ClientEventer.Closing and ClientEventer.Closed are
+	// called on idle close, but the ACKer is not closed. The client
+	// reconnects transparently on the next publish, and can still be closed
+	// via Close. IdleTimeout is disabled if not positive.
+	IdleTimeout time.Duration
+
+	// ACKBatchWindow configures the client to coalesce the ACKs received
+	// within the window into a single call to ACKHandler.ACKEvents, reducing
+	// the number of calls for high-throughput inputs. The number of ACKed
+	// events stays exact, only ACKs are delayed by up to the window. Pending
+	// ACKs are flushed before the ACKHandler is closed. ACKs are not
+	// coalesced if ACKBatchWindow is not positive. Event indices are still
+	// forwarded to a PartialACKer, but ACK timestamps are not forwarded to a
+	// LatencyACKer. See acker.Batching.
+	ACKBatchWindow time.Duration
+
+	// Backpressure configures the thresholds of Client.Backpressure.
+	// DefaultBackpressureConfig is used for unset fields.
+	Backpressure BackpressureConfig
+}
+
+// CloseSignal returns the CloseRef the pipeline should watch in order to close
+// the client. The configured Context takes precedence over CloseRef. Nil is
+// returned if neither Context nor CloseRef have been configured.
+func (c ClientConfig) CloseSignal() CloseRef {
+	if c.Context != nil {
+		return c.Context
+	}
+	return c.CloseRef
 }
 
 // ACKer can be registered with a Client when connecting to the pipeline.
@@ -65,6 +252,10 @@ type ACKer interface {
 	// ACK Events from the output and pipeline queue are forwarded to ACKEvents.
 	// The number of reported events only matches the known number of events downstream.
 	// ACKers might need to keep track of dropped events by themselves.
+	// Events are ACKed in the order they have been passed to AddEvent with
+	// published set to true, such that ACKEvents(n) always refers to the n
+	// oldest published events that have not been ACKed yet. No ordering is
+	// guaranteed between events published by different clients.
 	ACKEvents(n int)
 
 	// Close informs the ACKer that the Client used to publish to the pipeline has been closed.
@@ -75,6 +266,36 @@ type ACKer interface {
 	Close()
 }
 
+// LatencyACKer can be implemented by an ACKer that wants to know when events
+// have been ACKed, e.g. to measure the latency between publishing an event and
+// its ACK. If the ACKer implements LatencyACKer, the pipeline calls
+// ACKEventsWithTime instead of ACKEvents, passing the time the events have
+// been ACKed.
+type LatencyACKer interface {
+	ACKer
+
+	// ACKEventsWithTime reports n ACKed events, like ACKEvents. The events
+	// have been ACKed at t.
+	ACKEventsWithTime(n int, t time.Time)
+}
+
+// PartialACKer can be implemented by an ACKer that wants to know which
+// events of a batch have been processed successfully, if an output only
+// accepts a part of the batch. If the ACKer implements PartialACKer, and the
+// pipeline can report the outcome per event, the pipeline calls
+// ACKEventsIndexed instead of ACKEvents.
+type PartialACKer interface {
+	ACKer
+
+	// ACKEventsIndexed reports len(acked)+len(failed) processed events, like
+	// ACKEvents. The indices are relative to the oldest published event that
+	// has not been ACKed yet, such that index 0 is the first event of the
+	// batch. Acked holds the indices of the events accepted by the output,
+	// and failed holds the indices of the events the output has failed to
+	// process. Both lists are sorted.
+	ACKEventsIndexed(acked []int, failed []int)
+}
+
 // CloseRef allows users to close the client asynchronously.
 // A CloseReg implements a subset of function required for context.Context.
 type CloseRef interface {
@@ -105,6 +326,11 @@ type ProcessingConfig struct {
 	// KeepNull determines whether published events will keep null values or omit them.
 	KeepNull bool
 
+	// FlattenFields converts nested objects in the event fields into flat
+	// dotted keys, after the processors have been run. Null values are
+	// handled according to KeepNull. See FlattenFields for details.
+	FlattenFields bool
+
 	// Disables the addition of host.name if it was enabled for the publisher.
 	DisableHost bool
 
@@ -123,6 +349,60 @@ type ClientEventer interface {
 	DroppedOnPublish(Event) // event has been dropped, while waiting for the queue
 }
 
+// ReasonedEventer can be implemented by a ClientEventer that wants to know
+// why an event has been dropped, e.g. for root-cause analysis of data loss.
+// If implemented, the pipeline calls FilteredOutReason instead of
+// FilteredOut, and DroppedReason instead of DroppedOnPublish. Use
+// ReportFilteredOut and ReportDropped to call the right method.
+type ReasonedEventer interface {
+	ClientEventer
+
+	// FilteredOutReason is called for events filtered out by the processors.
+	// The reason is the description (see Processor.String) of the processor
+	// that has dropped the event, or that has failed.
+	FilteredOutReason(event Event, reason string)
+
+	// DroppedReason is called for events dropped on publish. The reason is
+	// one of the DropReason constants, or a pipeline specific description.
+	DroppedReason(event Event, reason string)
+}
+
+// Reasons passed to ReasonedEventer.DroppedReason.
+const (
+	// DropReasonQueueFull is used for events dropped because the queue is
+	// full, e.g. in the DropIfFull publish mode.
+	DropReasonQueueFull = "queue full"
+
+	// DropReasonClientClosed is used for events published after the client
+	// has been closed.
+	DropReasonClientClosed = "client closed"
+)
+
+// ReportFilteredOut informs e that event has been filtered out by the
+// processors, passing reason if e implements ReasonedEventer. Nothing is
+// reported if e is nil.
+func ReportFilteredOut(e ClientEventer, event Event, reason string) {
+	switch e := e.(type) {
+	case nil:
+	case ReasonedEventer:
+		e.FilteredOutReason(event, reason)
+	default:
+		e.FilteredOut(event)
+	}
+}
+
+// ReportDropped informs e that event has been dropped on publish, passing
+// reason if e implements ReasonedEventer. Nothing is reported if e is nil.
+func ReportDropped(e ClientEventer, event Event, reason string) {
+	switch e := e.(type) {
+	case nil:
+	case ReasonedEventer:
+		e.DroppedReason(event, reason)
+	default:
+		e.DroppedOnPublish(event)
+	}
+}
+
 type ProcessorList interface {
 	Processor
 	Close() error
@@ -161,4 +441,50 @@ const (
 	// filled up. Useful if an event stream must be processed to keep internal
 	// state up-to-date.
 	DropIfFull
+
+	// DeadLetter retries events until they are acknowledged by the output, like
+	// GuaranteedSend. Events the output rejects permanently are not retried, but
+	// passed to the ClientConfig.DeadLetterHandler instead. This ensures a
+	// single unrecoverable event can not block the client forever.
+	DeadLetter
+
+	// AtMostOnce sends events without retrying them. The pipeline makes a
+	// single delivery attempt per event, and discards the event if the
+	// attempt fails for any reason. Publishing never blocks: events are
+	// dropped if the pipeline is full, like with DropIfFull. Unlike
+	// DropIfFull, which only drops events on publish and leaves retries to
+	// the output, AtMostOnce also drops events the output has failed to
+	// send. Events are ACKed once the delivery attempt has finished, whether
+	// it has succeeded or not. Useful for data that is worthless if delayed,
+	// like metrics.
+	AtMostOnce
 )
+
+// PublishResult reports the outcome of publishing a single event via
+// Client.PublishChecked.
+type PublishResult uint8
+
+const (
+	// Accepted indicates that the event has been forwarded to the queue.
+	Accepted PublishResult = iota
+
+	// Filtered indicates that the event has been removed by the processors.
+	Filtered
+
+	// Dropped indicates that the event has been dropped before it could be
+	// forwarded to the queue.
+	Dropped
+)
+
+func (r PublishResult) String() string {
+	switch r {
+	case Accepted:
+		return "accepted"
+	case Filtered:
+		return "filtered"
+	case Dropped:
+		return "dropped"
+	default:
+		return "unknown"
+	}
+}
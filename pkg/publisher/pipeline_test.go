@@ -0,0 +1,83 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientConfig_CloseSignal(t *testing.T) {
+	t.Run("nil if nothing is configured", func(t *testing.T) {
+		require.Nil(t, ClientConfig{}.CloseSignal())
+	})
+
+	t.Run("CloseRef is used if no context is configured", func(t *testing.T) {
+		ref, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		cfg := ClientConfig{CloseRef: ref}
+		require.Equal(t, CloseRef(ref), cfg.CloseSignal())
+	})
+
+	t.Run("context takes precedence", func(t *testing.T) {
+		ref, cancelRef := context.WithCancel(context.Background())
+		defer cancelRef()
+		ctx, cancel := context.WithCancel(context.Background())
+
+		cfg := ClientConfig{CloseRef: ref, Context: ctx}
+		sig := cfg.CloseSignal()
+		require.Equal(t, CloseRef(ctx), sig)
+
+		cancel()
+		<-sig.Done()
+		require.ErrorIs(t, sig.Err(), context.Canceled)
+	})
+}
+
+type reportingEventer struct {
+	calls []string
+}
+
+func (e *reportingEventer) Closing()               {}
+func (e *reportingEventer) Closed()                {}
+func (e *reportingEventer) Published()             {}
+func (e *reportingEventer) FilteredOut(Event)      { e.calls = append(e.calls, "filtered") }
+func (e *reportingEventer) DroppedOnPublish(Event) { e.calls = append(e.calls, "dropped") }
+
+type reasonReportingEventer struct {
+	reportingEventer
+}
+
+func (e *reasonReportingEventer) FilteredOutReason(_ Event, reason string) {
+	e.calls = append(e.calls, "filtered: "+reason)
+}
+
+func (e *reasonReportingEventer) DroppedReason(_ Event, reason string) {
+	e.calls = append(e.calls, "dropped: "+reason)
+}
+
+func TestReportDropReasons(t *testing.T) {
+	t.Run("reasons are passed to ReasonedEventer", func(t *testing.T) {
+		e := &reasonReportingEventer{}
+		ReportFilteredOut(e, Event{}, "drop_fields")
+		ReportDropped(e, Event{}, DropReasonQueueFull)
+		require.Equal(t, []string{"filtered: drop_fields", "dropped: queue full"}, e.calls)
+	})
+
+	t.Run("fall back to ClientEventer", func(t *testing.T) {
+		e := &reportingEventer{}
+		ReportFilteredOut(e, Event{}, "drop_fields")
+		ReportDropped(e, Event{}, DropReasonQueueFull)
+		require.Equal(t, []string{"filtered", "dropped"}, e.calls)
+	})
+
+	t.Run("nil eventer is ignored", func(t *testing.T) {
+		ReportFilteredOut(nil, Event{}, "drop_fields")
+		ReportDropped(nil, Event{}, DropReasonQueueFull)
+	})
+}
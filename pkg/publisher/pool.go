@@ -0,0 +1,244 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrPoolExhausted is returned by ClientPool.Acquire if the maximum number of
+// clients is in use.
+var ErrPoolExhausted = errors.New("publisher client pool is exhausted")
+
+// ErrPoolClosed is returned by ClientPool.Acquire after the pool has been
+// closed.
+var ErrPoolClosed = errors.New("publisher client pool has been closed")
+
+// ClientPool hands out reusable clients, connected to the pipeline using a
+// common ClientConfig. Inputs that run many short-lived sources can use the
+// pool instead of connecting a new client per source.
+//
+// Each client is connected with an ACKer owned by the pool, which forwards
+// ACKs to the ACKer of the user that published the events. If a client is
+// released, its ACKer is cleared: events published by the next user are not
+// reported to the previous ACKer, while ACKs for events still pending are
+// forwarded to the ACKer they have been published with. The ACKHandler of the
+// ClientConfig is used by Acquire, and is shared by all clients.
+//
+// The ClientPool is safe for concurrent use. A client must be used by one
+// user at a time, and must not be used after it has been released.
+type ClientPool struct {
+	pipeline Pipeline
+	cfg      ClientConfig
+	max      int
+
+	mu     sync.Mutex
+	idle   []*pooledClient
+	open   int // number of connected clients, idle or in use
+	closed bool
+}
+
+// pooledClient is a Client handed out by the ClientPool.
+type pooledClient struct {
+	Client
+	pool  *ClientPool
+	acker *poolACKer
+
+	mu       sync.Mutex
+	released bool
+	closed   bool
+}
+
+// poolACKer forwards ACKs to the ACKers the events have been published with.
+type poolACKer struct {
+	mu      sync.Mutex
+	current *poolACKOwner
+	pending []*poolACKOwner // owner per published event that has not been ACKed yet
+}
+
+// poolACKOwner identifies the ACKer of a single acquisition of a client.
+type poolACKOwner struct {
+	acker ACKer
+}
+
+// NewClientPool creates a ClientPool connecting clients to pipeline using
+// cfg. At most maxSize clients are connected at a time. The number of clients
+// is not limited if maxSize is <= 0.
+func NewClientPool(pipeline Pipeline, cfg ClientConfig, maxSize int) *ClientPool {
+	return &ClientPool{pipeline: pipeline, cfg: cfg, max: maxSize}
+}
+
+// Acquire returns an idle client, or connects a new client. The client
+// reports ACKs to the ACKHandler of the pool's ClientConfig.
+// ErrPoolExhausted is returned without waiting if maxSize clients are in use.
+func (p *ClientPool) Acquire() (Client, error) {
+	return p.AcquireWith(p.cfg.ACKHandler)
+}
+
+// AcquireWith returns a client like Acquire, but reports ACKs for the events
+// published on the client to acker. Acker can be nil.
+func (p *ClientPool) AcquireWith(acker ACKer) (Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrPoolClosed
+	}
+
+	var c *pooledClient
+	if n := len(p.idle); n > 0 {
+		c = p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+	} else {
+		if p.max > 0 && p.open >= p.max {
+			return nil, ErrPoolExhausted
+		}
+
+		ackerFwd := &poolACKer{}
+		cfg := p.cfg
+		cfg.ACKHandler = ackerFwd
+		client, err := p.pipeline.ConnectWith(cfg)
+		if err != nil {
+			return nil, err
+		}
+		p.open++
+		c = &pooledClient{Client: client, pool: p, acker: ackerFwd}
+	}
+
+	c.mu.Lock()
+	c.released = false
+	c.mu.Unlock()
+	c.acker.setCurrent(acker)
+	return c, nil
+}
+
+// Release returns a client to the pool. The ACKer of the client is cleared,
+// and the client is handed out by the next call to Acquire. The client is
+// closed if the pool has been closed. Clients that have been closed by the
+// user, and clients not acquired from the pool are ignored.
+func (p *ClientPool) Release(client Client) {
+	c, ok := client.(*pooledClient)
+	if !ok || c.pool != p {
+		return
+	}
+
+	c.mu.Lock()
+	if c.released || c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.released = true
+	c.mu.Unlock()
+	c.acker.setCurrent(nil)
+
+	p.mu.Lock()
+	if !p.closed {
+		p.idle = append(p.idle, c)
+		p.mu.Unlock()
+		return
+	}
+	p.open--
+	p.mu.Unlock()
+
+	_ = c.Client.Close()
+}
+
+// Close closes all idle clients. Clients in use are closed once they are
+// released. Acquire fails with ErrPoolClosed after Close has been called.
+func (p *ClientPool) Close() error {
+	p.mu.Lock()
+	idle := p.idle
+	p.idle = nil
+	p.open -= len(idle)
+	p.closed = true
+	p.mu.Unlock()
+
+	var err error
+	for _, c := range idle {
+		if closeErr := c.Client.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// Close closes the underlying client. The client is removed from the pool.
+func (c *pooledClient) Close() error {
+	return c.close(c.Client.Close)
+}
+
+// CloseWithTimeout closes the underlying client using CloseWithTimeout. The
+// client is removed from the pool.
+func (c *pooledClient) CloseWithTimeout(ctx context.Context) error {
+	return c.close(func() error { return c.Client.CloseWithTimeout(ctx) })
+}
+
+func (c *pooledClient) close(fn func() error) error {
+	c.mu.Lock()
+	if c.closed || c.released {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.mu.Unlock()
+
+	c.pool.mu.Lock()
+	c.pool.open--
+	c.pool.mu.Unlock()
+	return fn()
+}
+
+func (a *poolACKer) setCurrent(acker ACKer) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.current = nil
+	if acker != nil {
+		a.current = &poolACKOwner{acker: acker}
+	}
+}
+
+func (a *poolACKer) AddEvent(event Event, published bool) {
+	a.mu.Lock()
+	current := a.current
+	if published {
+		a.pending = append(a.pending, current)
+	}
+	a.mu.Unlock()
+
+	if current != nil {
+		current.acker.AddEvent(event, published)
+	}
+}
+
+func (a *poolACKer) ACKEvents(n int) {
+	a.mu.Lock()
+	if n > len(a.pending) {
+		n = len(a.pending)
+	}
+	owners := make([]*poolACKOwner, n)
+	copy(owners, a.pending)
+	for i := 0; i < n; i++ {
+		a.pending[i] = nil
+	}
+	a.pending = a.pending[n:]
+	a.mu.Unlock()
+
+	// forward ACKs in batches of consecutive events with the same owner
+	for start := 0; start < len(owners); {
+		end := start + 1
+		for end < len(owners) && owners[end] == owners[start] {
+			end++
+		}
+		if owners[start] != nil {
+			owners[start].acker.ACKEvents(end - start)
+		}
+		start = end
+	}
+}
+
+func (a *poolACKer) Close() {}
@@ -0,0 +1,172 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// poolTestPipeline creates clients passing published events to the ACKer of
+// the client config.
+type poolTestPipeline struct {
+	mu      sync.Mutex
+	clients []*poolTestClient
+	fail    bool
+}
+
+type poolTestClient struct {
+	Client // not implemented methods panic
+
+	acker  ACKer
+	closed bool
+}
+
+// poolTestACKer counts events and ACKs.
+type poolTestACKer struct {
+	mu    sync.Mutex
+	added int
+	acked int
+}
+
+func (p *poolTestPipeline) Connect() (Client, error) { return p.ConnectWith(ClientConfig{}) }
+
+func (p *poolTestPipeline) ConnectWith(cfg ClientConfig) (Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail {
+		return nil, errors.New("connection failed")
+	}
+	client := &poolTestClient{acker: cfg.ACKHandler}
+	p.clients = append(p.clients, client)
+	return client, nil
+}
+
+func (c *poolTestClient) Publish(event Event) { c.acker.AddEvent(event, true) }
+
+func (c *poolTestClient) Metrics() ClientMetrics { return ClientMetrics{} }
+
+func (c *poolTestClient) Close() error {
+	c.closed = true
+	return nil
+}
+
+func (a *poolTestACKer) AddEvent(Event, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.added++
+}
+
+func (a *poolTestACKer) ACKEvents(n int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acked += n
+}
+
+func (a *poolTestACKer) Close() {}
+
+func TestClientPool(t *testing.T) {
+	t.Run("released clients are reused", func(t *testing.T) {
+		pipeline := &poolTestPipeline{}
+		pool := NewClientPool(pipeline, ClientConfig{}, 0)
+
+		c1, err := pool.Acquire()
+		require.NoError(t, err)
+		pool.Release(c1)
+
+		c2, err := pool.Acquire()
+		require.NoError(t, err)
+		require.Same(t, c1, c2)
+		require.Len(t, pipeline.clients, 1)
+
+		c3, err := pool.Acquire()
+		require.NoError(t, err)
+		require.NotSame(t, c2, c3)
+		require.Len(t, pipeline.clients, 2)
+	})
+
+	t.Run("acquire fails if pool is exhausted", func(t *testing.T) {
+		pool := NewClientPool(&poolTestPipeline{}, ClientConfig{}, 1)
+
+		c, err := pool.Acquire()
+		require.NoError(t, err)
+		_, err = pool.Acquire()
+		require.ErrorIs(t, err, ErrPoolExhausted)
+
+		pool.Release(c)
+		_, err = pool.Acquire()
+		require.NoError(t, err)
+	})
+
+	t.Run("closed clients are removed from the pool", func(t *testing.T) {
+		pipeline := &poolTestPipeline{}
+		pool := NewClientPool(pipeline, ClientConfig{}, 1)
+
+		c, err := pool.Acquire()
+		require.NoError(t, err)
+		require.NoError(t, c.Close())
+		require.True(t, pipeline.clients[0].closed)
+		pool.Release(c)
+
+		c2, err := pool.Acquire()
+		require.NoError(t, err)
+		require.NotSame(t, c, c2)
+	})
+
+	t.Run("connection errors are returned", func(t *testing.T) {
+		pool := NewClientPool(&poolTestPipeline{fail: true}, ClientConfig{}, 1)
+		_, err := pool.Acquire()
+		require.Error(t, err)
+	})
+
+	t.Run("ACKs are forwarded to the ACKer events have been published with", func(t *testing.T) {
+		pipeline := &poolTestPipeline{}
+		pool := NewClientPool(pipeline, ClientConfig{}, 0)
+
+		first, second := &poolTestACKer{}, &poolTestACKer{}
+		c, err := pool.AcquireWith(first)
+		require.NoError(t, err)
+		c.Publish(Event{})
+		c.Publish(Event{})
+		pool.Release(c)
+
+		// events published after release are not reported
+		c.Publish(Event{})
+
+		c, err = pool.AcquireWith(second)
+		require.NoError(t, err)
+		c.Publish(Event{})
+
+		pipeline.clients[0].acker.ACKEvents(4)
+		require.Equal(t, 2, first.added)
+		require.Equal(t, 2, first.acked)
+		require.Equal(t, 1, second.added)
+		require.Equal(t, 1, second.acked)
+	})
+
+	t.Run("close closes idle clients and clients on release", func(t *testing.T) {
+		pipeline := &poolTestPipeline{}
+		pool := NewClientPool(pipeline, ClientConfig{}, 0)
+
+		c1, err := pool.Acquire()
+		require.NoError(t, err)
+		c2, err := pool.Acquire()
+		require.NoError(t, err)
+		pool.Release(c1)
+
+		require.NoError(t, pool.Close())
+		require.True(t, pipeline.clients[0].closed)
+		require.False(t, pipeline.clients[1].closed)
+
+		pool.Release(c2)
+		require.True(t, pipeline.clients[1].closed)
+
+		_, err = pool.Acquire()
+		require.ErrorIs(t, err, ErrPoolClosed)
+	})
+}
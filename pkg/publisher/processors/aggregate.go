@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Aggregate is a processor combining multiple events into a single event.
+// The fields of the buffered events are stored as an array in the target
+// field of the combined event. The Private field of the combined event is set
+// to the Private field of the last event in the batch.
+//
+// Run returns nil for events that have been buffered, and returns the
+// combined event once batchSize events have been buffered, or if flushInterval
+// has passed since the first event of the batch has been buffered. As Run
+// is only called for new events, Flush must be called on shutdown, or
+// periodically if events are published rarely, in order to not lose the
+// partial batch.
+type Aggregate struct {
+	batchSize     int
+	flushInterval time.Duration
+	target        string
+	now           func() time.Time
+
+	mu      sync.Mutex
+	fields  []mapstr.M
+	private interface{}
+	started time.Time
+}
+
+// NewAggregate creates an Aggregate processor. The time based flush is
+// disabled if flushInterval is <= 0. A batchSize < 1 is treated as 1.
+func NewAggregate(batchSize int, flushInterval time.Duration, targetField string) *Aggregate {
+	if batchSize < 1 {
+		batchSize = 1
+	}
+	return &Aggregate{
+		batchSize:     batchSize,
+		flushInterval: flushInterval,
+		target:        targetField,
+		now:           time.Now,
+	}
+}
+
+func (p *Aggregate) String() string {
+	return fmt.Sprintf("aggregate=[batch_size=%v, flush_interval=%v, target=%v]",
+		p.batchSize, p.flushInterval, p.target)
+}
+
+func (p *Aggregate) Run(event *publisher.Event) (*publisher.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	if len(p.fields) == 0 {
+		p.started = now
+	}
+	p.fields = append(p.fields, event.Fields)
+	p.private = event.Private
+
+	if len(p.fields) >= p.batchSize || (p.flushInterval > 0 && now.Sub(p.started) >= p.flushInterval) {
+		return p.flush(), nil
+	}
+	return nil, nil
+}
+
+// Flush returns the combined event for all events buffered so far. Nil is
+// returned if no event is buffered.
+func (p *Aggregate) Flush() *publisher.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.flush()
+}
+
+func (p *Aggregate) flush() *publisher.Event {
+	if len(p.fields) == 0 {
+		return nil
+	}
+
+	event := &publisher.Event{
+		Fields:  mapstr.M{},
+		Private: p.private,
+	}
+	_, _ = event.Fields.Put(p.target, p.fields)
+
+	p.fields = nil
+	p.private = nil
+	return event
+}
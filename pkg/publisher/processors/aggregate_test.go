@@ -0,0 +1,63 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestAggregate(t *testing.T) {
+	event := func(i int) *publisher.Event {
+		return &publisher.Event{Fields: mapstr.M{"i": i}, Private: i}
+	}
+
+	t.Run("events are combined once batch is full", func(t *testing.T) {
+		p := NewAggregate(3, 0, "events")
+		for i := 1; i <= 2; i++ {
+			out, err := p.Run(event(i))
+			require.NoError(t, err)
+			require.Nil(t, out)
+		}
+
+		out, err := p.Run(event(3))
+		require.NoError(t, err)
+		require.Equal(t, &publisher.Event{
+			Fields:  mapstr.M{"events": []mapstr.M{{"i": 1}, {"i": 2}, {"i": 3}}},
+			Private: 3,
+		}, out)
+		require.Nil(t, p.Flush())
+	})
+
+	t.Run("batch is flushed after interval", func(t *testing.T) {
+		now := time.Now()
+		p := NewAggregate(10, time.Second, "events")
+		p.now = func() time.Time { return now }
+
+		out, _ := p.Run(event(1))
+		require.Nil(t, out)
+
+		now = now.Add(time.Second)
+		out, _ = p.Run(event(2))
+		require.Equal(t, []mapstr.M{{"i": 1}, {"i": 2}}, out.Fields["events"])
+	})
+
+	t.Run("flush returns partial batch", func(t *testing.T) {
+		p := NewAggregate(10, 0, "batch.events")
+		require.Nil(t, p.Flush())
+
+		out, _ := p.Run(event(1))
+		require.Nil(t, out)
+
+		out = p.Flush()
+		require.Equal(t, mapstr.M{"batch": mapstr.M{"events": []mapstr.M{{"i": 1}}}}, out.Fields)
+		require.Nil(t, p.Flush())
+	})
+}
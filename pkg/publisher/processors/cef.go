@@ -0,0 +1,200 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// CEFParseFailureTag is added to the tags of events the CEF processor has
+// failed to parse.
+const CEFParseFailureTag = "_cef_parse_failure"
+
+var errCEFMalformed = errors.New("malformed CEF message")
+
+// cefHeaderFields are the fields of the CEF header following the version, in
+// order.
+var cefHeaderFields = []string{
+	"device.vendor",
+	"device.product",
+	"device.version",
+	"device.event_class_id",
+	"name",
+	"severity",
+}
+
+type cef struct {
+	field  string
+	prefix string
+}
+
+// NewCEF creates a processor that parses the Common Event Format (CEF)
+// message in sourceField, like
+// `CEF:0|Vendor|Product|1.0|100|Name|10|src=10.0.0.1 msg=text`.
+// The message can be preceded by a syslog header. The header is added as
+// version, device.vendor, device.product, device.version,
+// device.event_class_id, name, and severity, and the extensions are added
+// as extensions.<key>. All values are added as strings, under targetPrefix,
+// or to the event root if targetPrefix is empty.
+//
+// In header fields, `\|` and `\\` are unescaped. In extension values, `\=`,
+// `\\`, `\n`, and `\r` are unescaped. Extension values can contain spaces.
+// An unescaped `=` is only treated as the start of a new extension, if it
+// is preceded by a valid key.
+//
+// Events without sourceField are returned unchanged. If the message is
+// malformed, no fields are added and CEFParseFailureTag is added to the tags
+// of the event.
+func NewCEF(sourceField, targetPrefix string) publisher.Processor {
+	return &cef{field: sourceField, prefix: targetPrefix}
+}
+
+func (p *cef) String() string {
+	return fmt.Sprintf("cef=[field=%v, target_prefix=%v]", p.field, p.prefix)
+}
+
+func (p *cef) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.field)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+	}
+
+	str, ok := value.(string)
+	var parsed mapstr.M
+	if ok {
+		parsed, err = parseCEF(str)
+	}
+	if !ok || err != nil {
+		if err := mapstr.AddTags(event.Fields, []string{CEFParseFailureTag}); err != nil {
+			return nil, fmt.Errorf("failed to tag event: %w", err)
+		}
+		return event, nil
+	}
+
+	fields := parsed
+	if p.prefix != "" {
+		fields = mapstr.M{}
+		if _, err := fields.Put(p.prefix, parsed); err != nil {
+			return nil, fmt.Errorf("failed to store field '%v': %w", p.prefix, err)
+		}
+	}
+	event.Fields.DeepUpdate(fields)
+	return event, nil
+}
+
+// parseCEF parses the CEF message in str into header fields and extensions.
+func parseCEF(str string) (mapstr.M, error) {
+	start := strings.Index(str, "CEF:")
+	if start < 0 {
+		return nil, errCEFMalformed
+	}
+	str = str[start+len("CEF:"):]
+
+	// split the version and the header fields at unescaped pipes
+	header := make([]string, 0, len(cefHeaderFields)+1)
+	var current strings.Builder
+	i := 0
+	for ; i < len(str) && len(header) <= len(cefHeaderFields); i++ {
+		switch c := str[i]; {
+		case c == '\\' && i+1 < len(str) && (str[i+1] == '|' || str[i+1] == '\\'):
+			i++
+			current.WriteByte(str[i])
+		case c == '|':
+			header = append(header, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if len(header) <= len(cefHeaderFields) {
+		return nil, errCEFMalformed
+	}
+
+	fields := mapstr.M{}
+	_, _ = fields.Put("version", header[0])
+	for j, name := range cefHeaderFields {
+		_, _ = fields.Put(name, header[j+1])
+	}
+
+	extensions, err := parseCEFExtensions(str[i:])
+	if err != nil {
+		return nil, err
+	}
+	if len(extensions) > 0 {
+		fields["extensions"] = extensions
+	}
+	return fields, nil
+}
+
+// parseCEFExtensions parses space separated key=value pairs. Values extend
+// until the next key, such that they can contain spaces.
+func parseCEFExtensions(str string) (mapstr.M, error) {
+	str = strings.TrimSpace(str)
+	if str == "" {
+		return nil, nil
+	}
+
+	// find the keys: tokens preceding an unescaped '='
+	type keyPos struct {
+		key        string
+		start, end int // start of the key, and position of '='
+	}
+	var keys []keyPos
+	tokenStart := 0
+	for i := 0; i < len(str); i++ {
+		switch str[i] {
+		case '\\':
+			i++
+		case ' ':
+			tokenStart = i + 1
+		case '=':
+			key := str[tokenStart:i]
+			if isCEFKey(key) {
+				keys = append(keys, keyPos{key: key, start: tokenStart, end: i})
+			}
+			tokenStart = i + 1
+		}
+	}
+	if len(keys) == 0 || keys[0].start != 0 {
+		return nil, errCEFMalformed
+	}
+
+	extensions := mapstr.M{}
+	for j, k := range keys {
+		valueEnd := len(str)
+		if j+1 < len(keys) {
+			valueEnd = keys[j+1].start
+		}
+		extensions[k.key] = unescapeCEFValue(strings.TrimSpace(str[k.end+1 : valueEnd]))
+	}
+	return extensions, nil
+}
+
+func isCEFKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, c := range key {
+		isAlnum := (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+		if !isAlnum && !strings.ContainsRune("_.-[]", c) {
+			return false
+		}
+	}
+	return true
+}
+
+var cefValueUnescaper = strings.NewReplacer(`\=`, `=`, `\\`, `\`, `\n`, "\n", `\r`, "\r")
+
+func unescapeCEFValue(value string) string {
+	return cefValueUnescaper.Replace(value)
+}
@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestCEF(t *testing.T) {
+	run := func(t *testing.T, prefix, message string) mapstr.M {
+		out, err := NewCEF("message", prefix).Run(&publisher.Event{Fields: mapstr.M{"message": message}})
+		require.NoError(t, err)
+		return out.Fields
+	}
+
+	t.Run("header and extensions are parsed", func(t *testing.T) {
+		fields := run(t, "cef", `<134>Jan 1 00:00:00 host CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 msg=Detected a threat. No action needed.`)
+		require.Equal(t, mapstr.M{
+			"version": "0",
+			"device": mapstr.M{
+				"vendor":         "Security",
+				"product":        "threatmanager",
+				"version":        "1.0",
+				"event_class_id": "100",
+			},
+			"name":     "worm successfully stopped",
+			"severity": "10",
+			"extensions": mapstr.M{
+				"src": "10.0.0.1",
+				"dst": "2.1.2.2",
+				"msg": "Detected a threat. No action needed.",
+			},
+		}, fields["cef"])
+	})
+
+	t.Run("escaped characters", func(t *testing.T) {
+		fields := run(t, "", `CEF:0|Vendor\|Inc|Product\\X|1.0|100|Name|Low|msg=a\=b c\\d\nnext request=https://example.com/?a=b cs1Label=x`)
+		require.Equal(t, "Vendor|Inc", fields["device"].(mapstr.M)["vendor"])
+		require.Equal(t, `Product\X`, fields["device"].(mapstr.M)["product"])
+		require.Equal(t, "Low", fields["severity"])
+		require.Equal(t, mapstr.M{
+			"msg":      "a=b c\\d\nnext",
+			"request":  "https://example.com/?a=b",
+			"cs1Label": "x",
+		}, fields["extensions"])
+	})
+
+	t.Run("no extensions", func(t *testing.T) {
+		fields := run(t, "event.cef", `CEF:1|Vendor|Product|1.0|100|Name|5|`)
+		fields = fields["event"].(mapstr.M)
+		require.NotContains(t, fields["cef"], "extensions")
+		require.Equal(t, "1", fields["cef"].(mapstr.M)["version"])
+	})
+
+	t.Run("malformed messages are tagged", func(t *testing.T) {
+		for _, message := range []string{
+			"not cef",
+			"CEF:0|Vendor|Product|1.0|100|Name",
+			"CEF:0|Vendor|Product|1.0|100|Name|5|no extension",
+		} {
+			fields := run(t, "cef", message)
+			require.Equal(t, mapstr.M{"message": message, "tags": []string{CEFParseFailureTag}}, fields, message)
+		}
+	})
+
+	t.Run("missing field is ignored", func(t *testing.T) {
+		out, err := NewCEF("message", "cef").Run(&publisher.Event{Fields: mapstr.M{"other": 1}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"other": 1}, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "cef=[field=message, target_prefix=cef]", NewCEF("message", "cef").String())
+	})
+}
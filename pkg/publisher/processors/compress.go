@@ -0,0 +1,116 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// compressedSuffix is appended to the field name to create the key of the
+// marker field. The marker can not be nested below the field, as the field
+// holds a string.
+const compressedSuffix = "_compressed"
+
+type compress struct {
+	field   string
+	minSize int
+}
+
+type decompress struct {
+	field string
+}
+
+// NewCompress creates a processor that gzip compresses the string value of
+// field if it is longer than minSize bytes. The compressed value is stored
+// base64 encoded in field, and the marker field `<field>_compressed` is set to
+// true. Events without field, or with a value that is not a string, are
+// returned unchanged.
+func NewCompress(field string, minSize int) publisher.Processor {
+	return &compress{field: field, minSize: minSize}
+}
+
+// NewDecompress creates a processor that reverts NewCompress. Fields without
+// the `<field>_compressed` marker are returned unchanged.
+func NewDecompress(field string) publisher.Processor {
+	return &decompress{field: field}
+}
+
+func (p *compress) String() string {
+	return fmt.Sprintf("compress=[field=%v, min_size=%v]", p.field, p.minSize)
+}
+
+func (p *compress) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.field)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+	}
+
+	str, ok := value.(string)
+	if !ok || len(str) <= p.minSize {
+		return event, nil
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := io.WriteString(w, str); err != nil {
+		return nil, fmt.Errorf("failed to compress field '%v': %w", p.field, err)
+	}
+	if err := w.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress field '%v': %w", p.field, err)
+	}
+
+	_, _ = event.Fields.Put(p.field, base64.StdEncoding.EncodeToString(buf.Bytes()))
+	_, _ = event.Fields.Put(p.field+compressedSuffix, true)
+	return event, nil
+}
+
+func (p *decompress) String() string {
+	return fmt.Sprintf("decompress=[field=%v]", p.field)
+}
+
+func (p *decompress) Run(event *publisher.Event) (*publisher.Event, error) {
+	marker, err := event.Fields.GetValue(p.field + compressedSuffix)
+	if err != nil || marker != true {
+		return event, nil //nolint:nilerr // fields without marker are not compressed
+	}
+
+	value, err := event.Fields.GetValue(p.field)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read compressed field '%v': %w", p.field, err)
+	}
+	str, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("compressed field '%v' is not a string", p.field)
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(str)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode field '%v': %w", p.field, err)
+	}
+	r, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress field '%v': %w", p.field, err)
+	}
+	defer r.Close()
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress field '%v': %w", p.field, err)
+	}
+
+	_, _ = event.Fields.Put(p.field, string(decompressed))
+	_ = event.Fields.Delete(p.field + compressedSuffix)
+	return event, nil
+}
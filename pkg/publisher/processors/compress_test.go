@@ -0,0 +1,64 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat("message ", 100)
+
+	t.Run("large value is compressed and restored", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{"log": mapstr.M{"message": large}}}
+
+		out, err := NewCompress("log.message", 64).Run(event)
+		require.NoError(t, err)
+		compressed, _ := out.Fields.GetValue("log.message")
+		require.Less(t, len(compressed.(string)), len(large))
+		marker, _ := out.Fields.GetValue("log.message_compressed")
+		require.Equal(t, true, marker)
+
+		out, err = NewDecompress("log.message").Run(out)
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"log": mapstr.M{"message": large}}, out.Fields)
+	})
+
+	t.Run("small value is unchanged", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{"message": "short"}}
+		out, err := NewCompress("message", 64).Run(event)
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"message": "short"}, out.Fields)
+	})
+
+	t.Run("missing and non-string fields are unchanged", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{"count": 1}}
+		for _, field := range []string{"count", "missing"} {
+			out, err := NewCompress(field, 0).Run(event)
+			require.NoError(t, err)
+			require.Equal(t, mapstr.M{"count": 1}, out.Fields)
+		}
+	})
+
+	t.Run("decompress ignores fields without marker", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{"message": "plain"}}
+		out, err := NewDecompress("message").Run(event)
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"message": "plain"}, out.Fields)
+	})
+
+	t.Run("decompress fails on invalid data", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{"message": "not base64!", "message_compressed": true}}
+		out, err := NewDecompress("message").Run(event)
+		require.Error(t, err)
+		require.Nil(t, out)
+	})
+}
@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/urso/sderr"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+type conditional struct {
+	cond      func(*publisher.Event) bool
+	then      publisher.Processor
+	otherwise publisher.Processor
+}
+
+// NewConditional creates a processor that runs then for events matching
+// cond, and otherwise for all other events. A nil branch passes the event
+// through unchanged. The result of the branch, including dropped events and
+// errors, is returned as is.
+// Close closes both branches if they implement io.Closer.
+func NewConditional(cond func(*publisher.Event) bool, then, otherwise publisher.Processor) publisher.Processor {
+	return &conditional{cond: cond, then: then, otherwise: otherwise}
+}
+
+func (p *conditional) String() string {
+	return fmt.Sprintf("if=[then=%v, else=%v]", processorName(p.then), processorName(p.otherwise))
+}
+
+func (p *conditional) Run(event *publisher.Event) (*publisher.Event, error) {
+	branch := p.otherwise
+	if p.cond(event) {
+		branch = p.then
+	}
+	if branch == nil {
+		return event, nil
+	}
+	return branch.Run(event)
+}
+
+func (p *conditional) Close() error {
+	var errs []error
+	for _, branch := range []publisher.Processor{p.then, p.otherwise} {
+		if c, ok := branch.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return sderr.WrapAll(errs, "failed to close processors")
+	}
+	return nil
+}
+
+func processorName(p publisher.Processor) string {
+	if p == nil {
+		return "none"
+	}
+	return p.String()
+}
@@ -0,0 +1,67 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConditional(t *testing.T) {
+	isError := func(event *publisher.Event) bool { return event.Fields["level"] == "error" }
+	tag := func(value string) publisher.Processor {
+		return NewMetadata(mapstr.M{"tag": value}, true)
+	}
+
+	t.Run("branch is selected by condition", func(t *testing.T) {
+		p := NewConditional(isError, tag("then"), tag("else"))
+
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"level": "error"}})
+		require.NoError(t, err)
+		require.Equal(t, "then", out.Fields["tag"])
+
+		out, err = p.Run(&publisher.Event{Fields: mapstr.M{"level": "info"}})
+		require.NoError(t, err)
+		require.Equal(t, "else", out.Fields["tag"])
+	})
+
+	t.Run("nil branch passes event through", func(t *testing.T) {
+		p := NewConditional(isError, nil, nil)
+		in := &publisher.Event{Fields: mapstr.M{"level": "error"}}
+		out, err := p.Run(in)
+		require.NoError(t, err)
+		require.Equal(t, in, out)
+		require.Equal(t, "if=[then=none, else=none]", p.String())
+	})
+
+	t.Run("drop and error are returned", func(t *testing.T) {
+		drop := NewFilter("drop", func(*publisher.Event) bool { return false })
+		fail := &fakeProcessor{name: "fail", run: func(*publisher.Event) (*publisher.Event, error) {
+			return nil, errors.New("oops")
+		}}
+		p := NewConditional(isError, drop, fail)
+
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"level": "error"}})
+		require.NoError(t, err)
+		require.Nil(t, out)
+
+		_, err = p.Run(&publisher.Event{Fields: mapstr.M{"level": "info"}})
+		require.Error(t, err)
+	})
+
+	t.Run("close closes both branches", func(t *testing.T) {
+		then, otherwise := &fakeProcessor{name: "a"}, &fakeProcessor{name: "b"}
+		p := NewConditional(isError, then, otherwise)
+		require.NoError(t, p.(io.Closer).Close())
+		require.Equal(t, 1, then.closed)
+		require.Equal(t, 1, otherwise.closed)
+	})
+}
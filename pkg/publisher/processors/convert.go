@@ -0,0 +1,189 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// ConvertFailureTag is added to the tags of events the convert processor has
+// failed to convert a field of.
+const ConvertFailureTag = "_convert_failure"
+
+var errConvert = errors.New("value can not be converted")
+
+// converters maps the supported type names to their conversion functions.
+var converters = map[string]func(interface{}) (interface{}, error){
+	"long":    toLong,
+	"double":  toDouble,
+	"boolean": toBoolean,
+	"ip":      toIP,
+}
+
+type convert struct {
+	conversions   map[string]string
+	fields        []string // converted fields in sorted order
+	ignoreMissing bool
+}
+
+// NewConvert creates a processor that converts the values of fields to other
+// types. Keys of conversions are the dotted paths of the fields, and values
+// the target type names:
+//
+//   - `long`: integer numbers and strings holding an integer, stored as int64
+//   - `double`: numbers and strings holding a number, stored as float64
+//   - `boolean`: booleans and strings accepted by strconv.ParseBool
+//   - `ip`: strings holding an IPv4 or IPv6 address, stored in canonical form
+//
+// The event is not dropped if a value can not be converted. The value is left
+// unchanged and ConvertFailureTag is added to the tags of the event. Missing
+// fields are treated as conversion failures, unless ignoreMissing is set.
+// An error is returned if a type name is not supported.
+func NewConvert(conversions map[string]string, ignoreMissing bool) (publisher.Processor, error) {
+	fields := make([]string, 0, len(conversions))
+	for field, typ := range conversions {
+		if _, ok := converters[typ]; !ok {
+			return nil, fmt.Errorf("unsupported type '%v' for field '%v'", typ, field)
+		}
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	return &convert{conversions: conversions, fields: fields, ignoreMissing: ignoreMissing}, nil
+}
+
+func (p *convert) String() string {
+	return fmt.Sprintf("convert=[conversions=%v, ignore_missing=%v]", p.conversions, p.ignoreMissing)
+}
+
+func (p *convert) Run(event *publisher.Event) (*publisher.Event, error) {
+	failed := false
+	for _, field := range p.fields {
+		value, err := event.Fields.GetValue(field)
+		if errors.Is(err, mapstr.ErrKeyNotFound) {
+			failed = failed || !p.ignoreMissing
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field '%v': %w", field, err)
+		}
+
+		converted, err := converters[p.conversions[field]](value)
+		if err != nil {
+			failed = true
+			continue
+		}
+		if _, err := event.Fields.Put(field, converted); err != nil {
+			return nil, fmt.Errorf("failed to store field '%v': %w", field, err)
+		}
+	}
+
+	if failed {
+		if err := mapstr.AddTags(event.Fields, []string{ConvertFailureTag}); err != nil {
+			return nil, fmt.Errorf("failed to tag event: %w", err)
+		}
+	}
+	return event, nil
+}
+
+func toLong(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), nil
+	case int8:
+		return int64(v), nil
+	case int16:
+		return int64(v), nil
+	case int32:
+		return int64(v), nil
+	case int64:
+		return v, nil
+	case uint:
+		return toLongUnsigned(uint64(v))
+	case uint8:
+		return int64(v), nil
+	case uint16:
+		return int64(v), nil
+	case uint32:
+		return int64(v), nil
+	case uint64:
+		return toLongUnsigned(v)
+	case float32:
+		return toLongFloat(float64(v))
+	case float64:
+		return toLongFloat(v)
+	case string:
+		return strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	default:
+		return nil, errConvert
+	}
+}
+
+func toLongUnsigned(v uint64) (interface{}, error) {
+	if v > math.MaxInt64 {
+		return nil, errConvert
+	}
+	return int64(v), nil
+}
+
+func toLongFloat(v float64) (interface{}, error) {
+	if v != math.Trunc(v) || v < math.MinInt64 || v >= math.MaxInt64 {
+		return nil, errConvert
+	}
+	return int64(v), nil
+}
+
+func toDouble(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case uint:
+		return float64(v), nil
+	case uint64:
+		return float64(v), nil
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	}
+
+	// the remaining integer types fit into int64
+	l, err := toLong(value)
+	if err != nil {
+		return nil, err
+	}
+	return float64(l.(int64)), nil
+}
+
+func toBoolean(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		return strconv.ParseBool(strings.TrimSpace(v))
+	default:
+		return nil, errConvert
+	}
+}
+
+func toIP(value interface{}) (interface{}, error) {
+	str, ok := value.(string)
+	if !ok {
+		return nil, errConvert
+	}
+	ip := net.ParseIP(strings.TrimSpace(str))
+	if ip == nil {
+		return nil, errConvert
+	}
+	return ip.String(), nil
+}
@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestConvert(t *testing.T) {
+	cases := map[string]struct {
+		typ      string
+		value    interface{}
+		expected interface{}
+		fail     bool
+	}{
+		"long from string":      {typ: "long", value: " 42 ", expected: int64(42)},
+		"long from int":         {typ: "long", value: 42, expected: int64(42)},
+		"long from float":       {typ: "long", value: 42.0, expected: int64(42)},
+		"long from fraction":    {typ: "long", value: 42.5, fail: true},
+		"long from text":        {typ: "long", value: "abc", fail: true},
+		"double from string":    {typ: "double", value: "1.5", expected: 1.5},
+		"double from int":       {typ: "double", value: 2, expected: 2.0},
+		"double from bool":      {typ: "double", value: true, fail: true},
+		"boolean from string":   {typ: "boolean", value: "true", expected: true},
+		"boolean from bool":     {typ: "boolean", value: false, expected: false},
+		"boolean from text":     {typ: "boolean", value: "yes", fail: true},
+		"ipv4":                  {typ: "ip", value: "10.0.0.1", expected: "10.0.0.1"},
+		"ipv6 is canonicalized": {typ: "ip", value: "2001:DB8:0:0::1", expected: "2001:db8::1"},
+		"invalid ip":            {typ: "ip", value: "10.0.0.256", fail: true},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			p, err := NewConvert(map[string]string{"a.b": test.typ}, false)
+			require.NoError(t, err)
+
+			out, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": mapstr.M{"b": test.value}}})
+			require.NoError(t, err)
+
+			if test.fail {
+				require.Equal(t, mapstr.M{"a": mapstr.M{"b": test.value}, "tags": []string{ConvertFailureTag}}, out.Fields)
+			} else {
+				require.Equal(t, mapstr.M{"a": mapstr.M{"b": test.expected}}, out.Fields)
+			}
+		})
+	}
+
+	t.Run("missing fields are tagged", func(t *testing.T) {
+		p, err := NewConvert(map[string]string{"port": "long", "other": "long"}, false)
+		require.NoError(t, err)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"port": "80"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"port": int64(80), "tags": []string{ConvertFailureTag}}, out.Fields)
+	})
+
+	t.Run("missing fields are ignored", func(t *testing.T) {
+		p, err := NewConvert(map[string]string{"port": "long", "other": "long"}, true)
+		require.NoError(t, err)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"port": "80"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"port": int64(80)}, out.Fields)
+	})
+
+	t.Run("unsupported types are rejected", func(t *testing.T) {
+		_, err := NewConvert(map[string]string{"a": "float"}, false)
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p, err := NewConvert(map[string]string{"a": "ip"}, true)
+		require.NoError(t, err)
+		require.Equal(t, "convert=[conversions=map[a:ip], ignore_missing=true]", p.String())
+	})
+}
@@ -0,0 +1,102 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// DecodeFailureTag is added to the tags of events the decode processor has
+// failed to decode.
+const DecodeFailureTag = "_decode_failure"
+
+// decoders maps the supported encoding names to their decoding functions.
+var decoders = map[string]func(string) ([]byte, error){
+	"base64":    decodeBase64(base64.StdEncoding, base64.RawStdEncoding),
+	"base64url": decodeBase64(base64.URLEncoding, base64.RawURLEncoding),
+	"hex":       hex.DecodeString,
+}
+
+type decode struct {
+	field    string
+	encoding string
+	target   string
+	raw      bool
+	decoder  func(string) ([]byte, error)
+}
+
+// NewDecode creates a processor that decodes the string value of field, and
+// stores the result in targetField, or in field if targetField is empty.
+// Encoding is one of base64, base64url, or hex. Padding is optional for the
+// base64 encodings. The decoded bytes are stored as []byte if raw is set,
+// otherwise they are stored as string.
+//
+// Events without field are returned unchanged. If the value is not a string
+// or can not be decoded, the event is not dropped, but DecodeFailureTag is
+// added to the tags of the event. An error is returned if encoding is not
+// supported.
+func NewDecode(field, encoding, targetField string, raw bool) (publisher.Processor, error) {
+	decoder, ok := decoders[encoding]
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding '%v'", encoding)
+	}
+	if targetField == "" {
+		targetField = field
+	}
+	return &decode{field: field, encoding: encoding, target: targetField, raw: raw, decoder: decoder}, nil
+}
+
+func (p *decode) String() string {
+	return fmt.Sprintf("decode=[field=%v, encoding=%v, target=%v, raw=%v]", p.field, p.encoding, p.target, p.raw)
+}
+
+func (p *decode) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.field)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+	}
+
+	str, ok := value.(string)
+	var decoded []byte
+	if ok {
+		decoded, err = p.decoder(str)
+	}
+	if !ok || err != nil {
+		if err := mapstr.AddTags(event.Fields, []string{DecodeFailureTag}); err != nil {
+			return nil, fmt.Errorf("failed to tag event: %w", err)
+		}
+		return event, nil
+	}
+
+	var result interface{} = string(decoded)
+	if p.raw {
+		result = decoded
+	}
+	if _, err := event.Fields.Put(p.target, result); err != nil {
+		return nil, fmt.Errorf("failed to store field '%v': %w", p.target, err)
+	}
+	return event, nil
+}
+
+// decodeBase64 returns a decoding function using padded if the value ends
+// with padding, and unpadded otherwise.
+func decodeBase64(padded, unpadded *base64.Encoding) func(string) ([]byte, error) {
+	return func(str string) ([]byte, error) {
+		if strings.HasSuffix(str, "=") {
+			return padded.DecodeString(str)
+		}
+		return unpadded.DecodeString(str)
+	}
+}
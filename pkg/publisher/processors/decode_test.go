@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDecode(t *testing.T) {
+	run := func(t *testing.T, encoding, target string, raw bool, fields mapstr.M) mapstr.M {
+		p, err := NewDecode("payload", encoding, target, raw)
+		require.NoError(t, err)
+		out, err := p.Run(&publisher.Event{Fields: fields})
+		require.NoError(t, err)
+		return out.Fields
+	}
+
+	t.Run("encodings", func(t *testing.T) {
+		cases := map[string]map[string]string{
+			"base64":    {"aGk/Pz4+": "hi??>>", "aGVsbG8=": "hello", "aGVsbG8": "hello"},
+			"base64url": {"aGk_Pz4-": "hi??>>", "aGVsbG8=": "hello", "aGVsbG8": "hello"},
+			"hex":       {"68656c6c6f": "hello", "68656C6C6F": "hello"},
+		}
+		for encoding, values := range cases {
+			for encoded, decoded := range values {
+				fields := run(t, encoding, "", false, mapstr.M{"payload": encoded})
+				require.Equal(t, mapstr.M{"payload": decoded}, fields, "%v: %v", encoding, encoded)
+			}
+		}
+	})
+
+	t.Run("decoded value is stored in target", func(t *testing.T) {
+		fields := run(t, "hex", "decoded.payload", true, mapstr.M{"payload": "00ff"})
+		require.Equal(t, mapstr.M{
+			"payload": "00ff",
+			"decoded": mapstr.M{"payload": []byte{0x00, 0xff}},
+		}, fields)
+	})
+
+	t.Run("invalid values are tagged", func(t *testing.T) {
+		for _, value := range []interface{}{"not hex", 42} {
+			fields := run(t, "hex", "", false, mapstr.M{"payload": value})
+			require.Equal(t, mapstr.M{"payload": value, "tags": []string{DecodeFailureTag}}, fields)
+		}
+	})
+
+	t.Run("missing field is ignored", func(t *testing.T) {
+		fields := run(t, "base64", "", false, mapstr.M{"message": "test"})
+		require.Equal(t, mapstr.M{"message": "test"}, fields)
+	})
+
+	t.Run("unsupported encoding", func(t *testing.T) {
+		_, err := NewDecode("payload", "base32", "", false)
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p, err := NewDecode("payload", "hex", "", false)
+		require.NoError(t, err)
+		require.Equal(t, "decode=[field=payload, encoding=hex, target=payload, raw=false]", p.String())
+	})
+}
@@ -0,0 +1,97 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	lrulist "container/list"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type dedupe struct {
+	keyField   string
+	window     time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*lrulist.Element
+	lru     *lrulist.List // of *dedupeEntry, most recently seen first
+}
+
+type dedupeEntry struct {
+	key  string
+	seen time.Time
+}
+
+// NewDedupe creates a processor that drops events whose keyField value has
+// been seen within the last window. The time a key has been seen last is
+// updated for duplicates as well. Events without keyField are never dropped.
+//
+// At most maxEntries keys are tracked. If the limit is reached, the least
+// recently seen key is removed. No limit is applied if maxEntries is <= 0.
+func NewDedupe(keyField string, window time.Duration, maxEntries int) publisher.Processor {
+	return &dedupe{
+		keyField:   keyField,
+		window:     window,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    map[string]*lrulist.Element{},
+		lru:        lrulist.New(),
+	}
+}
+
+func (p *dedupe) String() string {
+	return fmt.Sprintf("dedupe=[field=%v, window=%v, max_entries=%v]", p.keyField, p.window, p.maxEntries)
+}
+
+func (p *dedupe) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.keyField)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.keyField, err)
+	}
+	key := fmt.Sprint(value)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	p.removeExpired(now)
+
+	if elem, exists := p.entries[key]; exists {
+		elem.Value.(*dedupeEntry).seen = now
+		p.lru.MoveToFront(elem)
+		return nil, nil
+	}
+
+	p.entries[key] = p.lru.PushFront(&dedupeEntry{key: key, seen: now})
+	if p.maxEntries > 0 && p.lru.Len() > p.maxEntries {
+		p.removeElement(p.lru.Back())
+	}
+	return event, nil
+}
+
+// removeExpired removes all keys that have not been seen within the window.
+func (p *dedupe) removeExpired(now time.Time) {
+	for elem := p.lru.Back(); elem != nil; elem = p.lru.Back() {
+		if now.Sub(elem.Value.(*dedupeEntry).seen) < p.window {
+			return
+		}
+		p.removeElement(elem)
+	}
+}
+
+func (p *dedupe) removeElement(elem *lrulist.Element) {
+	entry := p.lru.Remove(elem).(*dedupeEntry)
+	delete(p.entries, entry.key)
+}
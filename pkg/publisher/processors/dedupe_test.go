@@ -0,0 +1,73 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDedupe(t *testing.T) {
+	newDedupe := func(window time.Duration, maxEntries int) (*dedupe, *time.Time) {
+		now := time.Now()
+		p := NewDedupe("id", window, maxEntries).(*dedupe)
+		p.now = func() time.Time { return now }
+		return p, &now
+	}
+
+	run := func(p publisher.Processor, id interface{}) bool {
+		event := &publisher.Event{Fields: mapstr.M{}}
+		if id != nil {
+			event.Fields["id"] = id
+		}
+		out, err := p.Run(event)
+		require.NoError(t, err)
+		return out != nil
+	}
+
+	t.Run("duplicates within window are dropped", func(t *testing.T) {
+		p, _ := newDedupe(time.Minute, 0)
+		require.True(t, run(p, "a"))
+		require.False(t, run(p, "a"))
+		require.True(t, run(p, "b"))
+		require.True(t, run(p, 1))
+		require.False(t, run(p, 1))
+	})
+
+	t.Run("keys expire after window", func(t *testing.T) {
+		p, now := newDedupe(time.Minute, 0)
+		require.True(t, run(p, "a"))
+
+		*now = now.Add(30 * time.Second)
+		require.False(t, run(p, "a"))
+
+		*now = now.Add(time.Minute)
+		require.True(t, run(p, "a"))
+		require.Len(t, p.entries, 1)
+	})
+
+	t.Run("least recently seen key is evicted", func(t *testing.T) {
+		p, _ := newDedupe(time.Minute, 2)
+		require.True(t, run(p, "a"))
+		require.True(t, run(p, "b"))
+		require.False(t, run(p, "a"))
+		require.True(t, run(p, "c")) // evicts b
+
+		require.False(t, run(p, "a"))
+		require.True(t, run(p, "b"))
+		require.Len(t, p.entries, 2)
+	})
+
+	t.Run("events without key are kept", func(t *testing.T) {
+		p, _ := newDedupe(time.Minute, 0)
+		require.True(t, run(p, nil))
+		require.True(t, run(p, nil))
+	})
+}
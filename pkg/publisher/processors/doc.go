@@ -0,0 +1,12 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+// Package processors provides common publisher.Processor implementations
+// inputs can use to modify or filter events before they are passed to the
+// pipeline processors.
+//
+// Processors follow the publisher.Processor contract: an event is dropped by
+// returning a nil event and a nil error. If an error is returned the event
+// returned must be nil.
+package processors
@@ -0,0 +1,68 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type encodeJSON struct {
+	field        string
+	target       string
+	keepOriginal bool
+}
+
+// NewEncodeJSON creates a processor that serializes the value of field to a
+// JSON string, and stores the string under target. All event fields are
+// serialized if field is empty. The original field is removed, unless
+// keepOriginal is set. Events without field are returned unchanged.
+//
+// Run fails if the value can not be serialized.
+func NewEncodeJSON(field, target string, keepOriginal bool) publisher.Processor {
+	return &encodeJSON{field: field, target: target, keepOriginal: keepOriginal}
+}
+
+func (p *encodeJSON) String() string {
+	return fmt.Sprintf("encode_json=[field=%v, target=%v, keep_original=%v]", p.field, p.target, p.keepOriginal)
+}
+
+func (p *encodeJSON) Run(event *publisher.Event) (*publisher.Event, error) {
+	var value interface{} = event.Fields
+	if p.field != "" {
+		v, err := event.Fields.GetValue(p.field)
+		if errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+		}
+		value = v
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode field '%v' to JSON: %w", p.field, err)
+	}
+
+	if !p.keepOriginal {
+		if p.field == "" {
+			event.Fields = mapstr.M{}
+		} else {
+			_ = event.Fields.Delete(p.field)
+		}
+	}
+	if event.Fields == nil {
+		event.Fields = mapstr.M{}
+	}
+	if _, err := event.Fields.Put(p.target, string(raw)); err != nil {
+		return nil, fmt.Errorf("failed to store JSON in field '%v': %w", p.target, err)
+	}
+	return event, nil
+}
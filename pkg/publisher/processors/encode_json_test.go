@@ -0,0 +1,60 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestEncodeJSON(t *testing.T) {
+	newEvent := func() *publisher.Event {
+		return &publisher.Event{Fields: mapstr.M{
+			"data":    mapstr.M{"a": 1, "b": []string{"x"}},
+			"message": "test",
+		}}
+	}
+
+	t.Run("field is replaced", func(t *testing.T) {
+		out, err := NewEncodeJSON("data", "data_json", false).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"data_json": `{"a":1,"b":["x"]}`,
+			"message":   "test",
+		}, out.Fields)
+	})
+
+	t.Run("original field is kept", func(t *testing.T) {
+		out, err := NewEncodeJSON("data", "raw.data", true).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, `{"a":1,"b":["x"]}`, out.Fields["raw"].(mapstr.M)["data"])
+		require.Contains(t, out.Fields, "data")
+	})
+
+	t.Run("all fields are encoded if field is empty", func(t *testing.T) {
+		out, err := NewEncodeJSON("", "event", false).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"event": `{"data":{"a":1,"b":["x"]},"message":"test"}`,
+		}, out.Fields)
+	})
+
+	t.Run("event without field is unchanged", func(t *testing.T) {
+		out, err := NewEncodeJSON("missing", "target", false).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, newEvent(), out)
+	})
+
+	t.Run("fail if value can not be encoded", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{"data": make(chan int)}}
+		out, err := NewEncodeJSON("data", "target", false).Run(event)
+		require.Error(t, err)
+		require.Nil(t, out)
+	})
+}
@@ -0,0 +1,127 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// protectedFields are never removed by the include and drop processors.
+var protectedFields = []string{"@timestamp", "@metadata"}
+
+type includeFields struct {
+	fields []string
+}
+
+type dropFields struct {
+	fields []string
+}
+
+// NewIncludeFields creates a processor that removes all fields from events,
+// except for the given fields. Fields are given as dotted paths, and include
+// all fields nested below them. A path ending in `.*`, like `internal.*`,
+// includes all fields nested below its prefix, if the prefix holds an
+// object. A single `*` includes all fields. Missing fields are ignored.
+// The `@timestamp` and `@metadata` fields are always kept.
+func NewIncludeFields(fields []string) publisher.Processor {
+	return &includeFields{fields: fields}
+}
+
+// NewDropFields creates a processor that removes the given fields from
+// events. Fields are given as dotted paths, and include all fields nested
+// below them. A path ending in `.*`, like `internal.*`, removes all fields
+// nested below its prefix, if the prefix holds an object. A single `*`
+// removes all fields. Missing fields are ignored. The `@timestamp` and
+// `@metadata` fields are never removed.
+func NewDropFields(fields []string) publisher.Processor {
+	return &dropFields{fields: fields}
+}
+
+func (p *includeFields) String() string {
+	return fmt.Sprintf("include_fields=[fields=%v]", p.fields)
+}
+
+func (p *includeFields) Run(event *publisher.Event) (*publisher.Event, error) {
+	included := mapstr.M{}
+	for _, fields := range [][]string{p.fields, protectedFields} {
+		for _, field := range fields {
+			if field == "*" {
+				return event, nil
+			}
+
+			value, ok := lookupFieldPattern(event.Fields, field)
+			if !ok {
+				continue
+			}
+			if _, err := included.Put(strings.TrimSuffix(field, ".*"), value); err != nil {
+				return nil, fmt.Errorf("failed to include field '%v': %w", field, err)
+			}
+		}
+	}
+	event.Fields = included
+	return event, nil
+}
+
+func (p *dropFields) String() string {
+	return fmt.Sprintf("drop_fields=[fields=%v]", p.fields)
+}
+
+func (p *dropFields) Run(event *publisher.Event) (*publisher.Event, error) {
+	for _, field := range p.fields {
+		if field == "*" {
+			for key := range event.Fields {
+				if !isProtectedField(key) {
+					delete(event.Fields, key)
+				}
+			}
+			continue
+		}
+
+		if isProtectedField(field) {
+			continue
+		}
+		if _, ok := lookupFieldPattern(event.Fields, field); !ok {
+			continue
+		}
+		if err := event.Fields.Delete(strings.TrimSuffix(field, ".*")); err != nil {
+			return nil, fmt.Errorf("failed to drop field '%v': %w", field, err)
+		}
+	}
+	return event, nil
+}
+
+// lookupFieldPattern returns the value of the dotted path field. If field
+// ends in `.*` the value of its prefix is returned, if the prefix holds an
+// object.
+func lookupFieldPattern(fields mapstr.M, field string) (interface{}, bool) {
+	prefix := strings.TrimSuffix(field, ".*")
+	value, err := fields.GetValue(prefix)
+	if err != nil {
+		return nil, false
+	}
+	if prefix != field {
+		switch value.(type) {
+		case mapstr.M, map[string]interface{}:
+		default:
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// isProtectedField reports whether field is or is nested below a protected
+// field.
+func isProtectedField(field string) bool {
+	for _, protected := range protectedFields {
+		if field == protected || strings.HasPrefix(field, protected+".") {
+			return true
+		}
+	}
+	return false
+}
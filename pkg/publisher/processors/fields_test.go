@@ -0,0 +1,111 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestIncludeFields(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	newEvent := func() *publisher.Event {
+		return &publisher.Event{Fields: mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+			"message":    "test",
+			"host":       mapstr.M{"name": "web-1", "ip": "10.0.0.1"},
+			"internal":   mapstr.M{"a": 1, "b": mapstr.M{"c": 2}},
+			"level":      "info",
+		}}
+	}
+
+	t.Run("listed fields are kept", func(t *testing.T) {
+		out, err := NewIncludeFields([]string{"message", "host.name", "missing"}).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+			"message":    "test",
+			"host":       mapstr.M{"name": "web-1"},
+		}, out.Fields)
+	})
+
+	t.Run("wildcards keep nested fields", func(t *testing.T) {
+		out, err := NewIncludeFields([]string{"internal.*", "level.*"}).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+			"internal":   mapstr.M{"a": 1, "b": mapstr.M{"c": 2}},
+		}, out.Fields)
+	})
+
+	t.Run("single wildcard keeps all fields", func(t *testing.T) {
+		out, err := NewIncludeFields([]string{"*"}).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, newEvent().Fields, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "include_fields=[fields=[a b.*]]", NewIncludeFields([]string{"a", "b.*"}).String())
+	})
+}
+
+func TestDropFields(t *testing.T) {
+	ts := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	newEvent := func() *publisher.Event {
+		return &publisher.Event{Fields: mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+			"message":    "test",
+			"host":       mapstr.M{"name": "web-1", "ip": "10.0.0.1"},
+			"internal":   mapstr.M{"a": 1},
+			"level":      "info",
+		}}
+	}
+
+	t.Run("listed fields are removed", func(t *testing.T) {
+		out, err := NewDropFields([]string{"message", "host.ip", "missing.field"}).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+			"host":       mapstr.M{"name": "web-1"},
+			"internal":   mapstr.M{"a": 1},
+			"level":      "info",
+		}, out.Fields)
+	})
+
+	t.Run("wildcards remove nested fields", func(t *testing.T) {
+		out, err := NewDropFields([]string{"internal.*", "level.*"}).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+			"message":    "test",
+			"host":       mapstr.M{"name": "web-1", "ip": "10.0.0.1"},
+			"level":      "info",
+		}, out.Fields)
+	})
+
+	t.Run("protected fields are kept", func(t *testing.T) {
+		out, err := NewDropFields([]string{"*", "@timestamp", "@metadata.id"}).Run(newEvent())
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"@timestamp": ts,
+			"@metadata":  mapstr.M{"id": "1"},
+		}, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "drop_fields=[fields=[a b.*]]", NewDropFields([]string{"a", "b.*"}).String())
+	})
+}
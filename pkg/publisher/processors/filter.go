@@ -0,0 +1,28 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import "github.com/elastic/elastic-agent-inputs/pkg/publisher"
+
+type filter struct {
+	name string
+	keep func(*publisher.Event) bool
+}
+
+// NewFilter creates a processor that drops all events for which keep returns
+// false. Events for which keep returns true are returned unchanged.
+// The name is reported by the processors String method.
+func NewFilter(name string, keep func(*publisher.Event) bool) publisher.Processor {
+	return &filter{name: name, keep: keep}
+}
+
+func (p *filter) String() string { return p.name }
+
+func (p *filter) Run(in *publisher.Event) (*publisher.Event, error) {
+	if !p.keep(in) {
+		return nil, nil
+	}
+	return in, nil
+}
@@ -0,0 +1,34 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFilter(t *testing.T) {
+	p := NewFilter("drop_debug", func(event *publisher.Event) bool {
+		return event.Fields["level"] != "debug"
+	})
+	require.Equal(t, "drop_debug", p.String())
+
+	t.Run("event is kept", func(t *testing.T) {
+		in := &publisher.Event{Fields: mapstr.M{"level": "info"}}
+		out, err := p.Run(in)
+		require.NoError(t, err)
+		require.Equal(t, in, out)
+	})
+
+	t.Run("event is dropped", func(t *testing.T) {
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"level": "debug"}})
+		require.NoError(t, err)
+		require.Nil(t, out)
+	})
+}
@@ -0,0 +1,83 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// fingerprintHashes maps the supported algorithm names to their hash
+// constructors.
+var fingerprintHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+type fingerprint struct {
+	fields  []string
+	target  string
+	algo    string
+	newHash func() hash.Hash
+}
+
+// NewFingerprint creates a processor that computes a hash of fields and
+// stores its hex digest in targetField, e.g. to derive idempotent document
+// IDs. algo is one of md5, sha1, sha256, sha384, or sha512.
+//
+// Fields are hashed in the given order. Each field is added to the hash as
+// `|<field>|<value>`, such that the boundaries between values are part of the
+// hash. Missing fields are hashed with an empty value. Times are formatted
+// as RFC3339 in UTC, other values using the default format of the fmt
+// package. An error is returned if algo is not supported.
+func NewFingerprint(fields []string, targetField, algo string) (publisher.Processor, error) {
+	newHash, ok := fingerprintHashes[algo]
+	if !ok {
+		return nil, fmt.Errorf("unsupported fingerprint algorithm '%v'", algo)
+	}
+	return &fingerprint{fields: fields, target: targetField, algo: algo, newHash: newHash}, nil
+}
+
+func (p *fingerprint) String() string {
+	return fmt.Sprintf("fingerprint=[fields=%v, target=%v, method=%v]", p.fields, p.target, p.algo)
+}
+
+func (p *fingerprint) Run(event *publisher.Event) (*publisher.Event, error) {
+	h := p.newHash()
+	for _, field := range p.fields {
+		value, err := event.Fields.GetValue(field)
+		if err != nil && !errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil, fmt.Errorf("failed to read field '%v': %w", field, err)
+		}
+
+		if ts, ok := value.(time.Time); ok {
+			value = ts.UTC().Format(time.RFC3339Nano)
+		} else if value == nil {
+			value = ""
+		}
+		fmt.Fprintf(h, "|%v|%v", field, value)
+	}
+
+	if event.Fields == nil {
+		event.Fields = mapstr.M{}
+	}
+	if _, err := event.Fields.Put(p.target, hex.EncodeToString(h.Sum(nil))); err != nil {
+		return nil, fmt.Errorf("failed to store field '%v': %w", p.target, err)
+	}
+	return event, nil
+}
@@ -0,0 +1,72 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFingerprint(t *testing.T) {
+	sha := func(s string) string {
+		sum := sha256.Sum256([]byte(s))
+		return hex.EncodeToString(sum[:])
+	}
+
+	t.Run("fields are hashed in order", func(t *testing.T) {
+		p, err := NewFingerprint([]string{"b", "a.x", "missing"}, "event.id", "sha256")
+		require.NoError(t, err)
+
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": mapstr.M{"x": 1}, "b": "test"}})
+		require.NoError(t, err)
+		require.Equal(t, sha("|b|test|a.x|1|missing|"), out.Fields["event"].(mapstr.M)["id"])
+	})
+
+	t.Run("times are hashed in UTC", func(t *testing.T) {
+		p, err := NewFingerprint([]string{"ts"}, "id", "md5")
+		require.NoError(t, err)
+
+		ts := time.Date(2022, 8, 1, 14, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"ts": ts}})
+		require.NoError(t, err)
+
+		sum := md5.Sum([]byte("|ts|2022-08-01T12:00:00Z"))
+		require.Equal(t, hex.EncodeToString(sum[:]), out.Fields["id"])
+	})
+
+	t.Run("equal fields produce equal hashes", func(t *testing.T) {
+		p, err := NewFingerprint([]string{"a", "b"}, "id", "sha1")
+		require.NoError(t, err)
+
+		out1, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": "ab", "b": "c"}})
+		require.NoError(t, err)
+		out2, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": "ab", "b": "c", "other": 1}})
+		require.NoError(t, err)
+		out3, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": "a", "b": "bc"}})
+		require.NoError(t, err)
+
+		require.Equal(t, out1.Fields["id"], out2.Fields["id"])
+		require.NotEqual(t, out1.Fields["id"], out3.Fields["id"])
+	})
+
+	t.Run("unsupported algorithms are rejected", func(t *testing.T) {
+		_, err := NewFingerprint([]string{"a"}, "id", "crc32")
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p, err := NewFingerprint([]string{"a", "b"}, "id", "sha256")
+		require.NoError(t, err)
+		require.Equal(t, "fingerprint=[fields=[a b], target=id, method=sha256]", p.String())
+	})
+}
@@ -0,0 +1,138 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// GeoIP is a processor adding geographic information about the IP address
+// stored in an event field. The information is read from a database in the
+// MaxMind DB format, e.g. GeoLite2-City.
+//
+// The following fields are added to the target field, if present in the
+// database: country_iso_code, country_name, city_name, and location (with
+// lat and lon). Names are added in English.
+// Events are passed through unchanged if the IP field is missing, does not
+// contain a valid IP address, or if the address is not found in the
+// database.
+type GeoIP struct {
+	path    string
+	ipField string
+	target  string
+
+	mu     sync.RWMutex
+	reader *maxminddb.Reader
+}
+
+var errGeoIPClosed = errors.New("geoip database has been closed")
+
+// NewGeoIP creates a GeoIP processor. The database at dbPath is opened
+// once, and released on Close.
+func NewGeoIP(dbPath, ipField, targetField string) (*GeoIP, error) {
+	reader, err := maxminddb.Open(dbPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open geoip database '%v': %w", dbPath, err)
+	}
+	return &GeoIP{path: dbPath, ipField: ipField, target: targetField, reader: reader}, nil
+}
+
+func (p *GeoIP) String() string {
+	return fmt.Sprintf("geoip=[database=%v, field=%v, target=%v]", p.path, p.ipField, p.target)
+}
+
+func (p *GeoIP) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.ipField)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	str, ok := value.(string)
+	if !ok {
+		return event, nil
+	}
+	ip := net.ParseIP(str)
+	if ip == nil {
+		return event, nil
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.reader == nil {
+		return nil, errGeoIPClosed
+	}
+
+	var record interface{}
+	if err := p.reader.Lookup(ip, &record); err != nil {
+		return nil, fmt.Errorf("geoip lookup of '%v' failed: %w", ip, err)
+	}
+	geo := geoFields(record)
+	if len(geo) == 0 {
+		return event, nil
+	}
+	if _, err := event.Fields.Put(p.target, geo); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Close releases the database. Run fails after Close has been called.
+func (p *GeoIP) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reader == nil {
+		return nil
+	}
+	err := p.reader.Close()
+	p.reader = nil
+	return err
+}
+
+// geoFields extracts the fields to add to the event from a database record.
+func geoFields(record interface{}) mapstr.M {
+	m, ok := record.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	geo := mapstr.M{}
+	if country, ok := m["country"].(map[string]interface{}); ok {
+		if iso, ok := country["iso_code"].(string); ok {
+			geo["country_iso_code"] = iso
+		}
+		if name := englishName(country); name != "" {
+			geo["country_name"] = name
+		}
+	}
+	if city, ok := m["city"].(map[string]interface{}); ok {
+		if name := englishName(city); name != "" {
+			geo["city_name"] = name
+		}
+	}
+	if location, ok := m["location"].(map[string]interface{}); ok {
+		lat, hasLat := location["latitude"].(float64)
+		lon, hasLon := location["longitude"].(float64)
+		if hasLat && hasLon {
+			geo["location"] = mapstr.M{"lat": lat, "lon": lon}
+		}
+	}
+	return geo
+}
+
+func englishName(m map[string]interface{}) string {
+	names, _ := m["names"].(map[string]interface{})
+	name, _ := names["en"].(string)
+	return name
+}
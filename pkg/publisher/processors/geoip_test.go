@@ -0,0 +1,363 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestGeoIPCorruptDatabase(t *testing.T) {
+	record := map[string]interface{}{
+		"country":  map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom"}},
+		"location": map[string]interface{}{"latitude": 51.5142, "longitude": -0.0931},
+	}
+	networks := []mmdbNetwork{
+		{cidr: "81.2.69.0/24", record: record},
+		{cidr: "2001:db8::/32", record: mmdbPointerTo(0)},
+	}
+	ips := []string{"81.2.69.160", "2001:db8::1", "10.0.0.1", "::1"}
+
+	// run opens the database at path, and looks up all ips. The first error
+	// is returned.
+	run := func(t *testing.T, path string) error {
+		p, err := NewGeoIP(path, "source.ip", "source.geo")
+		if err != nil {
+			return err
+		}
+		defer p.Close()
+
+		for _, ip := range ips {
+			if _, err := p.Run(&publisher.Event{Fields: mapstr.M{"source": mapstr.M{"ip": ip}}}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	valid := buildTestMMDB(t, 24, networks)
+	require.NoError(t, run(t, writeTestFile(t, valid)))
+
+	dataStart := bytes.Index(valid, make([]byte, mmdbDataSeparatorSize)) + mmdbDataSeparatorSize
+	metadataStart := bytes.LastIndex(valid, mmdbMetadataMarker) + len(mmdbMetadataMarker)
+
+	corrupt := map[string][]byte{
+		// the record of 81.2.69.0/24 is a map {"a": <pointer to the map>}
+		"pointer cycle": buildTestMMDB(t, 24, []mmdbNetwork{
+			{cidr: "81.2.69.0/24", record: map[string]interface{}{"a": mmdbPointerTo(0)}},
+		}),
+		// map with 65821+0xFFFFFF entries
+		"map size exceeds data": append(append(append([]byte(nil), valid[:dataStart]...),
+			mmdbMap<<5|31, 0xFF, 0xFF, 0xFF), valid[metadataStart-len(mmdbMetadataMarker):]...),
+		// array with 65821+0xFFFFFF elements
+		"array size exceeds data": append(append(append([]byte(nil), valid[:dataStart]...),
+			31, mmdbArray-7, 0xFF, 0xFF, 0xFF), valid[metadataStart-len(mmdbMetadataMarker):]...),
+		"truncated data section": append(append([]byte(nil), valid[:dataStart+4]...),
+			valid[metadataStart-len(mmdbMetadataMarker):]...),
+		"truncated metadata": valid[:metadataStart+8],
+		"missing metadata":   valid[:metadataStart-len(mmdbMetadataMarker)],
+		"node count exceeds file": append(append([]byte(nil), valid[:metadataStart]...), encodeTestMMDB(map[string]interface{}{
+			"node_count":  uint64(1 << 30),
+			"record_size": uint64(24),
+			"ip_version":  uint64(6),
+		}, nil)...),
+		"unknown record size": append(append([]byte(nil), valid[:metadataStart]...), encodeTestMMDB(map[string]interface{}{
+			"node_count":  uint64(1),
+			"record_size": uint64(20),
+			"ip_version":  uint64(6),
+		}, nil)...),
+	}
+	for name, buf := range corrupt {
+		buf := buf
+		t.Run(name, func(t *testing.T) {
+			path := writeTestFile(t, buf)
+			require.NotPanics(t, func() {
+				require.Error(t, run(t, path))
+			})
+		})
+	}
+
+	// Without native fuzzing support, random corruptions of a valid database
+	// are checked with a fixed seed, such that failures can be reproduced.
+	t.Run("random corruption", func(t *testing.T) {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 1000; i++ {
+			buf := append([]byte(nil), valid...)
+			for n := rng.Intn(8) + 1; n > 0; n-- {
+				buf[rng.Intn(len(buf))] = byte(rng.Intn(256))
+			}
+			if rng.Intn(4) == 0 {
+				buf = buf[:rng.Intn(len(buf))]
+			}
+
+			path := writeTestFile(t, buf)
+			require.NotPanics(t, func() { _ = run(t, path) }, "corrupted database: %x", buf)
+		}
+	})
+}
+
+// mmdbMetadataMarker separates the search tree and data section from the
+// metadata section at the end of the file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdbDataSeparatorSize is the number of zero bytes between the search tree
+// and the data section.
+const mmdbDataSeparatorSize = 16
+
+// Data types of the MaxMind DB format written by encodeTestMMDB.
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbDouble  = 3
+	mmdbUint32  = 6
+	mmdbMap     = 7
+	mmdbArray   = 11
+)
+
+// mmdbPointerTo is encoded as a pointer to the data section offset of the
+// record with the given index by writeTestMMDB.
+type mmdbPointerTo int
+
+type mmdbNetwork struct {
+	cidr   string
+	record interface{}
+}
+
+func TestGeoIP(t *testing.T) {
+	london := map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": "GB",
+			"names":    map[string]interface{}{"en": "United Kingdom", "de": "Vereinigtes Königreich"},
+		},
+		"city":     map[string]interface{}{"names": map[string]interface{}{"en": "London"}},
+		"location": map[string]interface{}{"latitude": 51.5142, "longitude": -0.0931},
+	}
+	networks := []mmdbNetwork{
+		{cidr: "81.2.69.0/24", record: london},
+		{cidr: "2001:db8::/32", record: mmdbPointerTo(0)},
+		{cidr: "2001:db9::/32", record: map[string]interface{}{"connection_type": "Cable/DSL"}},
+	}
+
+	for _, recordSize := range []int{24, 28, 32} {
+		recordSize := recordSize
+		path := writeTestMMDB(t, recordSize, networks)
+
+		t.Run(fmt.Sprintf("record size %v", recordSize), func(t *testing.T) {
+			p, err := NewGeoIP(path, "source.ip", "source.geo")
+			require.NoError(t, err)
+			defer p.Close()
+
+			t.Run("ipv4 address is enriched", func(t *testing.T) {
+				event := &publisher.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.160"}}}
+				out, err := p.Run(event)
+				require.NoError(t, err)
+				require.Equal(t, mapstr.M{
+					"country_iso_code": "GB",
+					"country_name":     "United Kingdom",
+					"city_name":        "London",
+					"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+				}, out.Fields["source"].(mapstr.M)["geo"])
+			})
+
+			t.Run("ipv6 address is enriched", func(t *testing.T) {
+				event := &publisher.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "2001:db8::1"}}}
+				out, err := p.Run(event)
+				require.NoError(t, err)
+				require.Equal(t, mapstr.M{
+					"country_iso_code": "GB",
+					"country_name":     "United Kingdom",
+					"city_name":        "London",
+					"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+				}, out.Fields["source"].(mapstr.M)["geo"])
+			})
+
+			t.Run("events are passed through if no geo data is found", func(t *testing.T) {
+				for _, ip := range []string{"10.0.0.1", "2001:db9::1", "not an ip"} {
+					event := &publisher.Event{Fields: mapstr.M{"source": mapstr.M{"ip": ip}}}
+					out, err := p.Run(event)
+					require.NoError(t, err)
+					require.Equal(t, mapstr.M{"source": mapstr.M{"ip": ip}}, out.Fields)
+				}
+
+				event := &publisher.Event{Fields: mapstr.M{"message": "test"}}
+				out, err := p.Run(event)
+				require.NoError(t, err)
+				require.Equal(t, mapstr.M{"message": "test"}, out.Fields)
+			})
+		})
+	}
+
+	t.Run("fail if database is missing", func(t *testing.T) {
+		_, err := NewGeoIP(filepath.Join(t.TempDir(), "missing.mmdb"), "source.ip", "source.geo")
+		require.Error(t, err)
+	})
+
+	t.Run("fail if database is invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "invalid.mmdb")
+		require.NoError(t, os.WriteFile(path, []byte("not a database"), 0o600))
+		_, err := NewGeoIP(path, "source.ip", "source.geo")
+		require.True(t, errors.As(err, &maxminddb.InvalidDatabaseError{}))
+	})
+
+	t.Run("run fails after close", func(t *testing.T) {
+		p, err := NewGeoIP(writeTestMMDB(t, 24, networks), "source.ip", "source.geo")
+		require.NoError(t, err)
+		require.NoError(t, p.Close())
+
+		_, err = p.Run(&publisher.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.160"}}})
+		require.Error(t, err)
+	})
+}
+
+// writeTestMMDB writes an IPv6 database in the MaxMind DB format, and
+// returns its path.
+func writeTestMMDB(t *testing.T, recordSize int, networks []mmdbNetwork) string {
+	t.Helper()
+	return writeTestFile(t, buildTestMMDB(t, recordSize, networks))
+}
+
+func writeTestFile(t *testing.T, buf []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "test.mmdb")
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+	return path
+}
+
+// buildTestMMDB encodes an IPv6 database in the MaxMind DB format.
+func buildTestMMDB(t *testing.T, recordSize int, networks []mmdbNetwork) []byte {
+	t.Helper()
+
+	var data []byte
+	offsets := make([]int, len(networks))
+	for i, network := range networks {
+		offsets[i] = len(data)
+		data = append(data, encodeTestMMDB(network.record, offsets)...)
+	}
+
+	// nodes stores the left and right record of each node. Records are node
+	// indices, -1 for empty records, or -2-offset for data records.
+	nodes := [][2]int{{-1, -1}}
+	for i, network := range networks {
+		_, ipnet, err := net.ParseCIDR(network.cidr)
+		require.NoError(t, err)
+		ip := ipnet.IP.To16()
+		ones, bits := ipnet.Mask.Size()
+		if bits == 32 {
+			// IPv4 networks are stored as ::a.b.c.d
+			ip = append(make(net.IP, 12), ipnet.IP.To4()...)
+			ones += 96
+		}
+
+		node := 0
+		for bit := 0; bit < ones; bit++ {
+			b := (ip[bit/8] >> (7 - uint(bit%8))) & 1
+			if bit == ones-1 {
+				nodes[node][b] = -2 - offsets[i]
+				break
+			}
+			if nodes[node][b] < 0 {
+				nodes = append(nodes, [2]int{-1, -1})
+				nodes[node][b] = len(nodes) - 1
+			}
+			node = nodes[node][b]
+		}
+	}
+
+	nodeCount := len(nodes)
+	record := func(v int) uint32 {
+		switch {
+		case v == -1:
+			return uint32(nodeCount)
+		case v < -1:
+			return uint32(nodeCount + mmdbDataSeparatorSize + (-2 - v))
+		default:
+			return uint32(v)
+		}
+	}
+
+	var buf []byte
+	for _, node := range nodes {
+		left, right := record(node[0]), record(node[1])
+		switch recordSize {
+		case 24:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left), byte(right>>16), byte(right>>8), byte(right))
+		case 28:
+			buf = append(buf, byte(left>>16), byte(left>>8), byte(left),
+				byte((left>>20)&0xF0|(right>>24)&0x0F),
+				byte(right>>16), byte(right>>8), byte(right))
+		case 32:
+			buf = appendUint32(buf, left)
+			buf = appendUint32(buf, right)
+		}
+	}
+	buf = append(buf, make([]byte, mmdbDataSeparatorSize)...)
+	buf = append(buf, data...)
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, encodeTestMMDB(map[string]interface{}{
+		"node_count":    uint64(nodeCount),
+		"record_size":   uint64(recordSize),
+		"ip_version":    uint64(6),
+		"database_type": "Test-City",
+	}, nil)...)
+	return buf
+}
+
+func encodeTestMMDB(value interface{}, offsets []int) []byte {
+	control := func(typ, size int) []byte {
+		if size >= 29 {
+			panic("size not supported by test encoder")
+		}
+		if typ <= 7 {
+			return []byte{byte(typ<<5 | size)}
+		}
+		return []byte{byte(size), byte(typ - 7)}
+	}
+
+	switch v := value.(type) {
+	case mmdbPointerTo:
+		target := offsets[v]
+		return []byte{byte(mmdbPointer<<5 | (target>>8)&0x7), byte(target)}
+	case string:
+		return append(control(mmdbString, len(v)), v...)
+	case float64:
+		bits := math.Float64bits(v)
+		return appendUint32(appendUint32(control(mmdbDouble, 8), uint32(bits>>32)), uint32(bits))
+	case uint64:
+		return appendUint32(control(mmdbUint32, 4), uint32(v))
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		buf := control(mmdbMap, len(v))
+		for _, k := range keys {
+			buf = append(buf, encodeTestMMDB(k, offsets)...)
+			buf = append(buf, encodeTestMMDB(v[k], offsets)...)
+		}
+		return buf
+	default:
+		panic(fmt.Sprintf("type %T not supported by test encoder", value))
+	}
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	return append(buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
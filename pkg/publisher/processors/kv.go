@@ -0,0 +1,157 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// KVParseFailureTag is added to the tags of events the key=value processor
+// has failed to parse.
+const KVParseFailureTag = "_kv_parse_failure"
+
+var errKVMalformed = errors.New("malformed key=value string")
+
+type kv struct {
+	field       string
+	separator   string
+	kvSeparator string
+	prefix      string
+}
+
+// NewKV creates a processor that splits the string in sourceField into
+// key/value pairs, and adds each key under targetPrefix. Keys are added to
+// the event root if targetPrefix is empty. Pairs are separated by separator,
+// and keys are separated from their values by kvSeparator, e.g. " " and "="
+// for logfmt.
+//
+// Values can be quoted with double quotes, to include separators. A
+// backslash escapes the next character in keys, unquoted values, and quoted
+// values, such that separators and quotes can be escaped. Consecutive
+// separators are ignored.
+//
+// Events without sourceField are returned unchanged. If the string is
+// malformed, e.g. a pair misses kvSeparator or a quote is not terminated, no
+// fields are added and KVParseFailureTag is added to the tags of the event.
+func NewKV(sourceField, separator, kvSeparator, targetPrefix string) publisher.Processor {
+	return &kv{field: sourceField, separator: separator, kvSeparator: kvSeparator, prefix: targetPrefix}
+}
+
+func (p *kv) String() string {
+	return fmt.Sprintf("kv=[field=%v, separator=%q, kv_separator=%q, target_prefix=%v]",
+		p.field, p.separator, p.kvSeparator, p.prefix)
+}
+
+func (p *kv) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.field)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+	}
+
+	str, ok := value.(string)
+	var pairs [][2]string
+	if ok {
+		pairs, err = p.parse(str)
+	}
+	if !ok || err != nil {
+		if err := mapstr.AddTags(event.Fields, []string{KVParseFailureTag}); err != nil {
+			return nil, fmt.Errorf("failed to tag event: %w", err)
+		}
+		return event, nil
+	}
+
+	for _, pair := range pairs {
+		key := pair[0]
+		if p.prefix != "" {
+			key = p.prefix + "." + key
+		}
+		if _, err := event.Fields.Put(key, pair[1]); err != nil {
+			return nil, fmt.Errorf("failed to store field '%v': %w", key, err)
+		}
+	}
+	return event, nil
+}
+
+// parse splits s into key/value pairs.
+func (p *kv) parse(s string) ([][2]string, error) {
+	var pairs [][2]string
+	for {
+		for p.separator != "" && strings.HasPrefix(s, p.separator) {
+			s = s[len(p.separator):]
+		}
+		if s == "" {
+			return pairs, nil
+		}
+
+		key, rest, found := scanUnquoted(s, p.kvSeparator, p.separator)
+		if !found || key == "" {
+			return nil, errKVMalformed
+		}
+		s = rest[len(p.kvSeparator):]
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var ok bool
+			value, s, ok = scanQuoted(s[1:])
+			if !ok || (s != "" && !strings.HasPrefix(s, p.separator)) {
+				return nil, errKVMalformed
+			}
+		} else {
+			value, s, _ = scanUnquoted(s, p.separator, "")
+		}
+		pairs = append(pairs, [2]string{key, value})
+	}
+}
+
+// scanUnquoted reads s until the first unescaped occurrence of delim. The
+// unescaped text and the remainder of s, starting with delim, are returned.
+// If stop is found before delim, or delim is not found, found is false and
+// the remainder starts with stop or is empty.
+func scanUnquoted(s, delim, stop string) (text, rest string, found bool) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			i++
+			sb.WriteByte(s[i])
+		case delim != "" && strings.HasPrefix(s[i:], delim):
+			return sb.String(), s[i:], true
+		case stop != "" && strings.HasPrefix(s[i:], stop):
+			return sb.String(), s[i:], false
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return sb.String(), "", false
+}
+
+// scanQuoted reads a quoted string up to the closing quote. s must not
+// include the opening quote. The remainder after the closing quote is
+// returned. Ok is false if the quote is not terminated.
+func scanQuoted(s string) (text, rest string, ok bool) {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				sb.WriteByte(s[i])
+			}
+		case '"':
+			return sb.String(), s[i+1:], true
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", false
+}
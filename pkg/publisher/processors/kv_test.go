@@ -0,0 +1,82 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestKV(t *testing.T) {
+	cases := map[string]struct {
+		separator, kvSeparator, prefix string
+		message                        string
+		expected                       mapstr.M
+	}{
+		"logfmt": {
+			separator: " ", kvSeparator: "=", prefix: "log",
+			message:  `level=info  msg="user logged in" user=alice`,
+			expected: mapstr.M{"log": mapstr.M{"level": "info", "msg": "user logged in", "user": "alice"}},
+		},
+		"no prefix": {
+			separator: "&", kvSeparator: "=",
+			message:  "a=1&b=2",
+			expected: mapstr.M{"a": "1", "b": "2"},
+		},
+		"escaped separators": {
+			separator: ",", kvSeparator: ":",
+			message:  `path:C\:\\temp,list:a\,b`,
+			expected: mapstr.M{"path": `C:\temp`, "list": "a,b"},
+		},
+		"escaped quotes": {
+			separator: " ", kvSeparator: "=",
+			message:  `msg="say \"hi\"" empty=""`,
+			expected: mapstr.M{"msg": `say "hi"`, "empty": ""},
+		},
+		"multi character separators": {
+			separator: " | ", kvSeparator: " => ",
+			message:  "a => 1 | b => x => y",
+			expected: mapstr.M{"a": "1", "b": "x => y"},
+		},
+	}
+
+	for name, test := range cases {
+		test := test
+		t.Run(name, func(t *testing.T) {
+			p := NewKV("message", test.separator, test.kvSeparator, test.prefix)
+			out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": test.message}})
+			require.NoError(t, err)
+
+			expected := test.expected.Clone()
+			expected["message"] = test.message
+			require.Equal(t, expected, out.Fields)
+		})
+	}
+
+	t.Run("malformed input is tagged", func(t *testing.T) {
+		p := NewKV("message", " ", "=", "kv")
+		for _, message := range []interface{}{`a=1 b`, `a=1 =2`, `a="open`, `a="x"y`, 42} {
+			out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": message}})
+			require.NoError(t, err)
+			require.Equal(t, mapstr.M{"message": message, "tags": []string{KVParseFailureTag}}, out.Fields, "message: %v", message)
+		}
+	})
+
+	t.Run("events without field are unchanged", func(t *testing.T) {
+		p := NewKV("message", " ", "=", "")
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"other": "a=1"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"other": "a=1"}, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p := NewKV("message", " ", "=", "kv")
+		require.Equal(t, `kv=[field=message, separator=" ", kv_separator="=", target_prefix=kv]`, p.String())
+	})
+}
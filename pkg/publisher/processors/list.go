@@ -0,0 +1,74 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"io"
+	"strings"
+
+	"github.com/urso/sderr"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+type list struct {
+	procs []publisher.Processor
+}
+
+// NewList creates a publisher.ProcessorList running the given processors in
+// order. Nil processors are ignored.
+func NewList(procs ...publisher.Processor) publisher.ProcessorList {
+	l := &list{procs: make([]publisher.Processor, 0, len(procs))}
+	for _, p := range procs {
+		if p != nil {
+			l.procs = append(l.procs, p)
+		}
+	}
+	return l
+}
+
+func (l *list) String() string {
+	names := make([]string, len(l.procs))
+	for i, p := range l.procs {
+		names[i] = p.String()
+	}
+	return "processors=[" + strings.Join(names, ", ") + "]"
+}
+
+// Run passes the event to each processor in order. Processing stops as soon
+// as a processor drops the event or returns an error.
+func (l *list) Run(event *publisher.Event) (*publisher.Event, error) {
+	for _, p := range l.procs {
+		var err error
+		event, err = p.Run(event)
+		if err != nil {
+			return nil, err
+		}
+		if event == nil {
+			return nil, nil
+		}
+	}
+	return event, nil
+}
+
+// All returns the processors in the list.
+func (l *list) All() []publisher.Processor { return l.procs }
+
+// Close closes all processors implementing io.Closer. All processors are
+// closed, even if one of them fails.
+func (l *list) Close() error {
+	var errs []error
+	for _, p := range l.procs {
+		if c, ok := p.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return sderr.WrapAll(errs, "failed to close processors")
+	}
+	return nil
+}
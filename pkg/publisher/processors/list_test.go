@@ -0,0 +1,93 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type fakeProcessor struct {
+	name     string
+	run      func(*publisher.Event) (*publisher.Event, error)
+	closed   int
+	closeErr error
+}
+
+func TestList(t *testing.T) {
+	addField := func(name string) *fakeProcessor {
+		return &fakeProcessor{name: name, run: func(event *publisher.Event) (*publisher.Event, error) {
+			event.Fields[name] = true
+			return event, nil
+		}}
+	}
+
+	t.Run("processors run in order", func(t *testing.T) {
+		var order []string
+		record := func(name string) *fakeProcessor {
+			return &fakeProcessor{name: name, run: func(event *publisher.Event) (*publisher.Event, error) {
+				order = append(order, name)
+				return event, nil
+			}}
+		}
+
+		l := NewList(record("a"), nil, record("b"))
+		require.Len(t, l.All(), 2)
+		require.Equal(t, "processors=[a, b]", l.String())
+
+		out, err := l.Run(&publisher.Event{})
+		require.NoError(t, err)
+		require.NotNil(t, out)
+		require.Equal(t, []string{"a", "b"}, order)
+	})
+
+	t.Run("drop stops processing", func(t *testing.T) {
+		l := NewList(addField("first"), NewFilter("drop", func(*publisher.Event) bool { return false }), addField("last"))
+
+		in := &publisher.Event{Fields: mapstr.M{}}
+		out, err := l.Run(in)
+		require.NoError(t, err)
+		require.Nil(t, out)
+		require.Equal(t, mapstr.M{"first": true}, in.Fields)
+	})
+
+	t.Run("errors are propagated", func(t *testing.T) {
+		failing := &fakeProcessor{name: "fail", run: func(*publisher.Event) (*publisher.Event, error) {
+			return nil, errors.New("oops")
+		}}
+		l := NewList(addField("first"), failing, addField("last"))
+
+		out, err := l.Run(&publisher.Event{Fields: mapstr.M{}})
+		require.Error(t, err)
+		require.Nil(t, out)
+	})
+
+	t.Run("close closes all processors", func(t *testing.T) {
+		p1 := addField("a")
+		p1.closeErr = errors.New("oops")
+		p2 := addField("b")
+
+		err := NewList(p1, p2).Close()
+		require.Error(t, err)
+		require.Equal(t, 1, p1.closed)
+		require.Equal(t, 1, p2.closed)
+	})
+}
+
+func (p *fakeProcessor) String() string { return p.name }
+
+func (p *fakeProcessor) Run(event *publisher.Event) (*publisher.Event, error) {
+	return p.run(event)
+}
+
+func (p *fakeProcessor) Close() error {
+	p.closed++
+	return p.closeErr
+}
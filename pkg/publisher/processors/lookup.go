@@ -0,0 +1,128 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type lookup struct {
+	keyField string
+	table    map[string]mapstr.M
+	target   string
+}
+
+// NewLookup creates a processor that enriches events with rows of a static
+// lookup table, e.g. to add the team owning a host. The value of keyField is
+// used as key into table. Non-string values are formatted using the default
+// format of the fmt package. If a row is found, its fields are merged under
+// targetPrefix, replacing existing fields. Rows are merged into the event
+// root if targetPrefix is empty.
+//
+// Events are passed through unchanged if keyField is missing or its value is
+// not found in table.
+func NewLookup(keyField string, table map[string]mapstr.M, targetPrefix string) publisher.Processor {
+	return &lookup{keyField: keyField, table: table, target: targetPrefix}
+}
+
+func (p *lookup) String() string {
+	return fmt.Sprintf("lookup=[field=%v, target=%v, entries=%v]", p.keyField, p.target, len(p.table))
+}
+
+func (p *lookup) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.keyField)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.keyField, err)
+	}
+
+	key, ok := value.(string)
+	if !ok {
+		key = fmt.Sprint(value)
+	}
+	row, exists := p.table[key]
+	if !exists {
+		return event, nil
+	}
+
+	// clone the row, so events do not share nested objects
+	fields := row.Clone()
+	if p.target != "" {
+		fields = mapstr.M{}
+		if _, err := fields.Put(p.target, row.Clone()); err != nil {
+			return nil, fmt.Errorf("failed to store field '%v': %w", p.target, err)
+		}
+	}
+	event.Fields.DeepUpdate(fields)
+	return event, nil
+}
+
+// LoadLookupCSV reads a lookup table for NewLookup from the CSV file at path.
+// The first record of the file must hold the column names. The values of
+// keyColumn are used as keys of the table, the other columns of a record
+// become the fields of its row. Dotted column names create nested fields.
+//
+// An error is returned if keyColumn is missing, records have a different
+// number of columns than the header, or if a key is not unique.
+func LoadLookupCSV(path, keyColumn string) (map[string]mapstr.M, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lookup table: %w", err)
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read header of lookup table '%v': %w", path, err)
+	}
+
+	keyIdx := -1
+	for i, name := range header {
+		if name == keyColumn {
+			keyIdx = i
+			break
+		}
+	}
+	if keyIdx < 0 {
+		return nil, fmt.Errorf("key column '%v' not found in lookup table '%v'", keyColumn, path)
+	}
+
+	table := map[string]mapstr.M{}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read lookup table '%v': %w", path, err)
+		}
+
+		key := record[keyIdx]
+		if _, exists := table[key]; exists {
+			return nil, fmt.Errorf("duplicate key '%v' in lookup table '%v'", key, path)
+		}
+
+		row := mapstr.M{}
+		for i, value := range record {
+			if i == keyIdx {
+				continue
+			}
+			if _, err := row.Put(header[i], value); err != nil {
+				return nil, fmt.Errorf("invalid column '%v' in lookup table '%v': %w", header[i], path, err)
+			}
+		}
+		table[key] = row
+	}
+	return table, nil
+}
@@ -0,0 +1,96 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestLookup(t *testing.T) {
+	table := map[string]mapstr.M{
+		"web-1": {"team": "frontend", "owner": mapstr.M{"email": "fe@example.com"}},
+		"42":    {"team": "numbers"},
+	}
+
+	t.Run("row is merged under target prefix", func(t *testing.T) {
+		p := NewLookup("host.name", table, "host.meta")
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"host": mapstr.M{"name": "web-1"}}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"host": mapstr.M{
+			"name": "web-1",
+			"meta": mapstr.M{"team": "frontend", "owner": mapstr.M{"email": "fe@example.com"}},
+		}}, out.Fields)
+
+		// events do not share the row
+		out.Fields.Put("host.meta.owner.email", "changed")
+		require.Equal(t, "fe@example.com", table["web-1"]["owner"].(mapstr.M)["email"])
+	})
+
+	t.Run("row is merged into the root without prefix", func(t *testing.T) {
+		p := NewLookup("id", table, "")
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"id": 42, "team": "old"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"id": 42, "team": "numbers"}, out.Fields)
+	})
+
+	t.Run("missing keys pass through", func(t *testing.T) {
+		p := NewLookup("host.name", table, "meta")
+		for _, fields := range []mapstr.M{{"host": mapstr.M{"name": "db-1"}}, {"message": "test"}} {
+			out, err := p.Run(&publisher.Event{Fields: fields.Clone()})
+			require.NoError(t, err)
+			require.Equal(t, fields, out.Fields)
+		}
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p := NewLookup("host.name", table, "meta")
+		require.Equal(t, "lookup=[field=host.name, target=meta, entries=2]", p.String())
+	})
+}
+
+func TestLoadLookupCSV(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "table.csv")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+		return path
+	}
+
+	t.Run("rows are keyed by key column", func(t *testing.T) {
+		path := write(t, "team,host,owner.email\nfrontend,web-1,fe@example.com\nbackend,api-1,be@example.com\n")
+		table, err := LoadLookupCSV(path, "host")
+		require.NoError(t, err)
+		require.Equal(t, map[string]mapstr.M{
+			"web-1": {"team": "frontend", "owner": mapstr.M{"email": "fe@example.com"}},
+			"api-1": {"team": "backend", "owner": mapstr.M{"email": "be@example.com"}},
+		}, table)
+	})
+
+	t.Run("missing key column fails", func(t *testing.T) {
+		_, err := LoadLookupCSV(write(t, "team,host\nfrontend,web-1\n"), "name")
+		require.Error(t, err)
+	})
+
+	t.Run("duplicate keys fail", func(t *testing.T) {
+		_, err := LoadLookupCSV(write(t, "team,host\nfrontend,web-1\nbackend,web-1\n"), "host")
+		require.Error(t, err)
+	})
+
+	t.Run("invalid records fail", func(t *testing.T) {
+		_, err := LoadLookupCSV(write(t, "team,host\nfrontend\n"), "host")
+		require.Error(t, err)
+	})
+
+	t.Run("missing file fails", func(t *testing.T) {
+		_, err := LoadLookupCSV(filepath.Join(t.TempDir(), "missing.csv"), "host")
+		require.Error(t, err)
+	})
+}
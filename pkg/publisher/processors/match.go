@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+type matchFilter struct {
+	name    string
+	field   string
+	pattern *regexp.Regexp
+	drop    bool
+}
+
+// NewDropOnMatch creates a processor that drops all events where the string
+// value of field matches pattern, e.g. to drop noisy log messages. The field
+// is given as a dotted path. Events without the field, or where the field is
+// not a string, do not match and are returned unchanged.
+// An error is returned if pattern can not be compiled.
+func NewDropOnMatch(field, pattern string) (publisher.Processor, error) {
+	return newMatchFilter("drop_on_match", field, pattern, true)
+}
+
+// NewKeepOnMatch creates a processor that keeps only the events where the
+// string value of field matches pattern. It is the inverse of NewDropOnMatch:
+// events without the field, or where the field is not a string, do not match
+// and are dropped.
+// An error is returned if pattern can not be compiled.
+func NewKeepOnMatch(field, pattern string) (publisher.Processor, error) {
+	return newMatchFilter("keep_on_match", field, pattern, false)
+}
+
+func newMatchFilter(name, field, pattern string, drop bool) (publisher.Processor, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern for field '%v': %w", field, err)
+	}
+	return &matchFilter{name: name, field: field, pattern: re, drop: drop}, nil
+}
+
+func (p *matchFilter) String() string {
+	return fmt.Sprintf("%v=[field=%v, pattern=%v]", p.name, p.field, p.pattern)
+}
+
+func (p *matchFilter) Run(event *publisher.Event) (*publisher.Event, error) {
+	if p.matches(event) == p.drop {
+		return nil, nil
+	}
+	return event, nil
+}
+
+func (p *matchFilter) matches(event *publisher.Event) bool {
+	value, err := event.Fields.GetValue(p.field)
+	if err != nil {
+		return false
+	}
+	s, ok := value.(string)
+	return ok && p.pattern.MatchString(s)
+}
@@ -0,0 +1,79 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDropOnMatch(t *testing.T) {
+	p, err := NewDropOnMatch("log.message", "^DEBUG ")
+	require.NoError(t, err)
+
+	t.Run("matching event is dropped", func(t *testing.T) {
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"log": mapstr.M{"message": "DEBUG connected"}}})
+		require.NoError(t, err)
+		require.Nil(t, out)
+	})
+
+	t.Run("other events are kept", func(t *testing.T) {
+		for name, fields := range map[string]mapstr.M{
+			"no match":      {"log": mapstr.M{"message": "ERROR connection refused"}},
+			"missing field": {"message": "DEBUG connected"},
+			"not a string":  {"log": mapstr.M{"message": 42}},
+		} {
+			in := &publisher.Event{Fields: fields}
+			out, err := p.Run(in)
+			require.NoError(t, err, name)
+			require.Equal(t, in, out, name)
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := NewDropOnMatch("message", "([a-z]")
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "drop_on_match=[field=log.message, pattern=^DEBUG ]", p.String())
+	})
+}
+
+func TestKeepOnMatch(t *testing.T) {
+	p, err := NewKeepOnMatch("message", "(?i)error")
+	require.NoError(t, err)
+
+	t.Run("matching event is kept", func(t *testing.T) {
+		in := &publisher.Event{Fields: mapstr.M{"message": "Error: connection refused"}}
+		out, err := p.Run(in)
+		require.NoError(t, err)
+		require.Equal(t, in, out)
+	})
+
+	t.Run("other events are dropped", func(t *testing.T) {
+		for name, fields := range map[string]mapstr.M{
+			"no match":      {"message": "connected"},
+			"missing field": {"msg": "error"},
+		} {
+			out, err := p.Run(&publisher.Event{Fields: fields})
+			require.NoError(t, err, name)
+			require.Nil(t, out, name)
+		}
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := NewKeepOnMatch("message", "*")
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "keep_on_match=[field=message, pattern=(?i)error]", p.String())
+	})
+}
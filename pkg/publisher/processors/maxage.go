@@ -0,0 +1,69 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// MaxAge is a processor dropping events with a timestamp older than the
+// configured maximum age. The timestamp field must hold a time.Time, or a
+// string in RFC3339 format. Events without the timestamp field, or with a
+// value that is not a valid timestamp, are passed through unchanged.
+type MaxAge struct {
+	field   string
+	maxAge  time.Duration
+	dropped atomic.Uint64
+}
+
+// NewMaxAge creates a MaxAge processor dropping events whose timestamp in
+// timestampField is older than now minus maxAge.
+func NewMaxAge(timestampField string, maxAge time.Duration) *MaxAge {
+	return &MaxAge{field: timestampField, maxAge: maxAge}
+}
+
+func (p *MaxAge) String() string {
+	return fmt.Sprintf("max_age=[field=%v, max_age=%v]", p.field, p.maxAge)
+}
+
+func (p *MaxAge) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.field)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+	}
+
+	var ts time.Time
+	switch v := value.(type) {
+	case time.Time:
+		ts = v
+	case string:
+		if ts, err = time.Parse(time.RFC3339Nano, v); err != nil {
+			return event, nil
+		}
+	default:
+		return event, nil
+	}
+
+	if time.Since(ts) > p.maxAge {
+		p.dropped.Inc()
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Dropped returns the number of events dropped by the processor.
+func (p *MaxAge) Dropped() uint64 {
+	return p.dropped.Load()
+}
@@ -0,0 +1,51 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMaxAge(t *testing.T) {
+	p := NewMaxAge("@timestamp", time.Hour)
+	now := time.Now()
+
+	keep := []interface{}{
+		now,
+		now.Add(-30 * time.Minute).Format(time.RFC3339Nano),
+		now.Add(time.Hour),
+		"not a timestamp",
+		42,
+	}
+	for _, ts := range keep {
+		in := &publisher.Event{Fields: mapstr.M{"@timestamp": ts}}
+		out, err := p.Run(in)
+		require.NoError(t, err)
+		require.Same(t, in, out, "event with timestamp %v must be kept", ts)
+	}
+
+	out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": "no timestamp"}})
+	require.NoError(t, err)
+	require.Equal(t, mapstr.M{"message": "no timestamp"}, out.Fields)
+
+	drop := []interface{}{
+		now.Add(-2 * time.Hour),
+		now.Add(-24 * time.Hour).UTC().Format(time.RFC3339),
+	}
+	for _, ts := range drop {
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"@timestamp": ts}})
+		require.NoError(t, err)
+		require.Nil(t, out, "event with timestamp %v must be dropped", ts)
+	}
+
+	require.Equal(t, uint64(2), p.Dropped())
+	require.Equal(t, "max_age=[field=@timestamp, max_age=1h0m0s]", p.String())
+}
@@ -0,0 +1,47 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type metadata struct {
+	fields    mapstr.M
+	overwrite bool
+}
+
+// NewMetadata creates a processor that merges fields into every event, e.g.
+// to add the input provenance like `input.id`, `input.type`, and
+// `input.source`. Nested objects are merged. Existing keys in the event are
+// only replaced if overwrite is set.
+//
+// Unlike ProcessingConfig.Fields the processor runs per event and can be
+// combined with other processors.
+func NewMetadata(fields mapstr.M, overwrite bool) publisher.Processor {
+	return &metadata{fields: fields, overwrite: overwrite}
+}
+
+func (p *metadata) String() string {
+	return fmt.Sprintf("add_metadata=[fields=%v, overwrite=%v]", p.fields.String(), p.overwrite)
+}
+
+func (p *metadata) Run(event *publisher.Event) (*publisher.Event, error) {
+	if event.Fields == nil {
+		event.Fields = mapstr.M{}
+	}
+
+	// clone fields, so events do not share nested objects
+	fields := p.fields.Clone()
+	if p.overwrite {
+		event.Fields.DeepUpdate(fields)
+	} else {
+		event.Fields.DeepUpdateNoOverwrite(fields)
+	}
+	return event, nil
+}
@@ -0,0 +1,55 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestMetadata(t *testing.T) {
+	fields := mapstr.M{
+		"input": mapstr.M{"id": "my-id", "type": "test", "source": "a"},
+	}
+
+	t.Run("fields are added to empty event", func(t *testing.T) {
+		out, err := NewMetadata(fields, false).Run(&publisher.Event{})
+		require.NoError(t, err)
+		require.Equal(t, fields, out.Fields)
+	})
+
+	t.Run("existing fields are not overwritten", func(t *testing.T) {
+		out, err := NewMetadata(fields, false).Run(&publisher.Event{
+			Fields: mapstr.M{"input": mapstr.M{"id": "other"}, "message": "test"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"input":   mapstr.M{"id": "other", "type": "test", "source": "a"},
+			"message": "test",
+		}, out.Fields)
+	})
+
+	t.Run("existing fields are overwritten", func(t *testing.T) {
+		out, err := NewMetadata(fields, true).Run(&publisher.Event{
+			Fields: mapstr.M{"input": mapstr.M{"id": "other"}},
+		})
+		require.NoError(t, err)
+		require.Equal(t, fields, out.Fields)
+	})
+
+	t.Run("events do not share fields", func(t *testing.T) {
+		p := NewMetadata(fields, false)
+		e1, _ := p.Run(&publisher.Event{})
+		e2, _ := p.Run(&publisher.Event{})
+
+		_, err := e1.Fields.Put("input.id", "changed")
+		require.NoError(t, err)
+		require.Equal(t, fields, e2.Fields)
+	})
+}
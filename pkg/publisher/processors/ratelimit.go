@@ -0,0 +1,117 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+// RateLimit is a processor limiting the number of events per second passed
+// through the processor. The limit is implemented using a token bucket that
+// is refilled at the configured rate and can hold up to burst tokens.
+// Run blocks until a token becomes available. If the context passed to
+// NewRateLimit is cancelled, Run returns an error instead of the event.
+type RateLimit struct {
+	ctx context.Context
+
+	mu      sync.Mutex
+	rate    float64
+	burst   float64
+	tokens  float64
+	last    time.Time
+	changed chan struct{} // closed and replaced by SetRate to wake up waiting go-routines
+}
+
+// NewRateLimit creates a RateLimit processor allowing eventsPerSecond events
+// per second with bursts of up to burst events. A rate <= 0 disables rate
+// limiting.
+func NewRateLimit(ctx context.Context, eventsPerSecond float64, burst int) *RateLimit {
+	if burst < 1 {
+		burst = 1
+	}
+	return &RateLimit{
+		ctx:     ctx,
+		rate:    eventsPerSecond,
+		burst:   float64(burst),
+		tokens:  float64(burst),
+		last:    time.Now(),
+		changed: make(chan struct{}),
+	}
+}
+
+func (p *RateLimit) String() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return fmt.Sprintf("rate_limit=[rate=%v, burst=%v]", p.rate, p.burst)
+}
+
+// SetRate updates the number of events per second. Go-routines waiting for
+// a token recompute their wait time using the new rate.
+func (p *RateLimit) SetRate(eventsPerSecond float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.refill(time.Now())
+	p.rate = eventsPerSecond
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// Run waits for a token to become available and returns the event unchanged.
+func (p *RateLimit) Run(in *publisher.Event) (*publisher.Event, error) {
+	for {
+		wait, changed := p.take()
+		if wait == 0 {
+			return in, nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-p.ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("rate limit wait aborted: %w", p.ctx.Err())
+		case <-changed:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// take tries to take a token from the bucket. If no token is available, take
+// returns the duration to wait for the next token.
+func (p *RateLimit) take() (time.Duration, <-chan struct{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.rate <= 0 {
+		return 0, nil
+	}
+
+	p.refill(time.Now())
+	if p.tokens >= 1 {
+		p.tokens--
+		return 0, nil
+	}
+
+	wait := time.Duration((1 - p.tokens) / p.rate * float64(time.Second))
+	if wait <= 0 {
+		wait = time.Nanosecond
+	}
+	return wait, p.changed
+}
+
+func (p *RateLimit) refill(now time.Time) {
+	if p.rate > 0 {
+		p.tokens += now.Sub(p.last).Seconds() * p.rate
+		if p.tokens > p.burst {
+			p.tokens = p.burst
+		}
+	}
+	p.last = now
+}
@@ -0,0 +1,65 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+func TestRateLimit(t *testing.T) {
+	t.Run("burst passes without waiting", func(t *testing.T) {
+		p := NewRateLimit(context.Background(), 0.001, 3)
+		for i := 0; i < 3; i++ {
+			out, err := p.Run(&publisher.Event{})
+			require.NoError(t, err)
+			require.NotNil(t, out)
+		}
+	})
+
+	t.Run("wait for token", func(t *testing.T) {
+		p := NewRateLimit(context.Background(), 100, 1)
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			_, err := p.Run(&publisher.Event{})
+			require.NoError(t, err)
+		}
+		require.GreaterOrEqual(t, time.Since(start), 15*time.Millisecond)
+	})
+
+	t.Run("cancel returns error", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		p := NewRateLimit(ctx, 0.001, 1)
+		_, err := p.Run(&publisher.Event{})
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+		}()
+		out, err := p.Run(&publisher.Event{})
+		require.ErrorIs(t, err, context.Canceled)
+		require.Nil(t, out)
+	})
+
+	t.Run("SetRate wakes up waiting events", func(t *testing.T) {
+		p := NewRateLimit(context.Background(), 0.001, 1)
+		_, err := p.Run(&publisher.Event{})
+		require.NoError(t, err)
+
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			p.SetRate(1000)
+		}()
+		out, err := p.Run(&publisher.Event{})
+		require.NoError(t, err)
+		require.NotNil(t, out)
+	})
+}
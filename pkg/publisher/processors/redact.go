@@ -0,0 +1,100 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// DefaultRedactReplacement is used by the redact processors if no replacement
+// is configured.
+const DefaultRedactReplacement = "[REDACTED]"
+
+type redactFields struct {
+	fields      []string
+	replacement string
+}
+
+type redactMatching struct {
+	patterns    []*regexp.Regexp
+	replacement string
+}
+
+// NewRedact creates a processor that replaces the values of fields with
+// replacement. Fields are given as dotted paths. Missing fields are ignored.
+// DefaultRedactReplacement is used if replacement is empty.
+func NewRedact(fields []string, replacement string) publisher.Processor {
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	return &redactFields{fields: fields, replacement: replacement}
+}
+
+// NewRedactMatching creates a processor that replaces all parts of string
+// values matching one of patterns with replacement, e.g. to remove credit
+// card numbers from messages. All string values of the event, including
+// values nested in objects and arrays, are checked.
+// DefaultRedactReplacement is used if replacement is empty.
+func NewRedactMatching(patterns []*regexp.Regexp, replacement string) publisher.Processor {
+	if replacement == "" {
+		replacement = DefaultRedactReplacement
+	}
+	return &redactMatching{patterns: patterns, replacement: replacement}
+}
+
+func (p *redactFields) String() string {
+	return fmt.Sprintf("redact=[fields=%v]", p.fields)
+}
+
+func (p *redactFields) Run(event *publisher.Event) (*publisher.Event, error) {
+	for _, field := range p.fields {
+		if has, _ := event.Fields.HasKey(field); has {
+			_, _ = event.Fields.Put(field, p.replacement)
+		}
+	}
+	return event, nil
+}
+
+func (p *redactMatching) String() string {
+	return fmt.Sprintf("redact=[patterns=%v]", p.patterns)
+}
+
+func (p *redactMatching) Run(event *publisher.Event) (*publisher.Event, error) {
+	for key, value := range event.Fields {
+		event.Fields[key] = p.redact(value)
+	}
+	return event, nil
+}
+
+func (p *redactMatching) redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, pattern := range p.patterns {
+			v = pattern.ReplaceAllLiteralString(v, p.replacement)
+		}
+		return v
+	case mapstr.M:
+		for key, nested := range v {
+			v[key] = p.redact(nested)
+		}
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = p.redact(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = p.redact(nested)
+		}
+	case []string:
+		for i, nested := range v {
+			v[i] = p.redact(nested).(string)
+		}
+	}
+	return value
+}
@@ -0,0 +1,48 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestRedact(t *testing.T) {
+	t.Run("fields are replaced", func(t *testing.T) {
+		event := &publisher.Event{Fields: mapstr.M{
+			"user":    mapstr.M{"name": "alice", "password": "secret"},
+			"token":   "abc",
+			"message": "hello",
+		}}
+		out, err := NewRedact([]string{"user.password", "token", "missing.field"}, "").Run(event)
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"user":    mapstr.M{"name": "alice", "password": DefaultRedactReplacement},
+			"token":   DefaultRedactReplacement,
+			"message": "hello",
+		}, out.Fields)
+	})
+
+	t.Run("matching values are replaced", func(t *testing.T) {
+		cardNumber := regexp.MustCompile(`\b\d{4}-\d{4}-\d{4}-\d{4}\b`)
+		event := &publisher.Event{Fields: mapstr.M{
+			"message": "paid with 1234-5678-9012-3456 today",
+			"nested":  mapstr.M{"list": []interface{}{"1111-2222-3333-4444", 42}},
+			"tags":    []string{"card 0000-0000-0000-0000"},
+		}}
+		out, err := NewRedactMatching([]*regexp.Regexp{cardNumber}, "****").Run(event)
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"message": "paid with **** today",
+			"nested":  mapstr.M{"list": []interface{}{"****", 42}},
+			"tags":    []string{"card ****"},
+		}, out.Fields)
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type rename struct {
+	mappings  map[string]string
+	sources   []string // source fields in sorted order
+	overwrite bool
+}
+
+// NewRename creates a processor that moves fields according to mappings.
+// Keys are the dotted paths of the source fields, and values the dotted
+// paths of the target fields. Missing source fields are ignored.
+//
+// All source fields are removed before the target fields are written, such
+// that fields can be swapped. If a target field already exists, Run returns
+// an error, unless overwrite is set.
+func NewRename(mappings map[string]string, overwrite bool) publisher.Processor {
+	sources := make([]string, 0, len(mappings))
+	for from := range mappings {
+		sources = append(sources, from)
+	}
+	sort.Strings(sources)
+	return &rename{mappings: mappings, sources: sources, overwrite: overwrite}
+}
+
+func (p *rename) String() string {
+	return fmt.Sprintf("rename=[mappings=%v, overwrite=%v]", p.mappings, p.overwrite)
+}
+
+func (p *rename) Run(event *publisher.Event) (*publisher.Event, error) {
+	type move struct {
+		from, to string
+		value    interface{}
+	}
+
+	var moves []move
+	for _, from := range p.sources {
+		value, err := event.Fields.GetValue(from)
+		if errors.Is(err, mapstr.ErrKeyNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read field '%v': %w", from, err)
+		}
+		moves = append(moves, move{from: from, to: p.mappings[from], value: value})
+	}
+
+	for _, m := range moves {
+		if err := event.Fields.Delete(m.from); err != nil {
+			return nil, fmt.Errorf("failed to remove field '%v': %w", m.from, err)
+		}
+	}
+
+	for _, m := range moves {
+		if !p.overwrite {
+			if has, _ := event.Fields.HasKey(m.to); has {
+				return nil, fmt.Errorf("failed to rename '%v': target field '%v' already exists", m.from, m.to)
+			}
+		}
+		if _, err := event.Fields.Put(m.to, m.value); err != nil {
+			return nil, fmt.Errorf("failed to store field '%v': %w", m.to, err)
+		}
+	}
+	return event, nil
+}
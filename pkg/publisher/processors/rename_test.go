@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestRename(t *testing.T) {
+	t.Run("fields are moved", func(t *testing.T) {
+		p := NewRename(map[string]string{"src_ip": "source.ip", "msg": "message", "missing": "other"}, false)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"src_ip": "10.0.0.1", "msg": "test", "level": "info"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"source":  mapstr.M{"ip": "10.0.0.1"},
+			"message": "test",
+			"level":   "info",
+		}, out.Fields)
+	})
+
+	t.Run("nested fields are moved", func(t *testing.T) {
+		p := NewRename(map[string]string{"a.b": "c.d"}, false)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": mapstr.M{"b": 1, "x": 2}}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"a": mapstr.M{"x": 2}, "c": mapstr.M{"d": 1}}, out.Fields)
+	})
+
+	t.Run("fields can be swapped", func(t *testing.T) {
+		p := NewRename(map[string]string{"a": "b", "b": "a"}, false)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"a": 1, "b": 2}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"a": 2, "b": 1}, out.Fields)
+	})
+
+	t.Run("collisions fail", func(t *testing.T) {
+		p := NewRename(map[string]string{"msg": "message"}, false)
+		_, err := p.Run(&publisher.Event{Fields: mapstr.M{"msg": "new", "message": "old"}})
+		require.Error(t, err)
+	})
+
+	t.Run("collisions are overwritten", func(t *testing.T) {
+		p := NewRename(map[string]string{"msg": "message"}, true)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"msg": "new", "message": "old"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"message": "new"}, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p := NewRename(map[string]string{"a": "b"}, false)
+		require.Equal(t, "rename=[mappings=map[a:b], overwrite=false]", p.String())
+	})
+}
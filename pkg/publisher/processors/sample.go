@@ -0,0 +1,71 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"go.uber.org/atomic"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+type sampling struct {
+	rate float64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+type everyNth struct {
+	n     uint64
+	count atomic.Uint64
+}
+
+// NewSampling creates a processor that keeps events with probability rate,
+// with rate being between 0 and 1. All events are dropped if rate is <= 0,
+// and all events are kept if rate is >= 1.
+// Random numbers are read from src. If src is nil, a source seeded with the
+// current time is used.
+func NewSampling(rate float64, src rand.Source) publisher.Processor {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	return &sampling{rate: rate, rnd: rand.New(src)} //nolint:gosec // sampling does not require a secure random source
+}
+
+func (p *sampling) String() string { return fmt.Sprintf("sample=[rate=%v]", p.rate) }
+
+func (p *sampling) Run(event *publisher.Event) (*publisher.Event, error) {
+	p.mu.Lock()
+	keep := p.rnd.Float64() < p.rate
+	p.mu.Unlock()
+
+	if !keep {
+		return nil, nil
+	}
+	return event, nil
+}
+
+// NewEveryNth creates a processor that keeps every n-th event, starting with
+// the n-th event. All events are kept if n is <= 1.
+func NewEveryNth(n int) publisher.Processor {
+	if n < 1 {
+		n = 1
+	}
+	return &everyNth{n: uint64(n)}
+}
+
+func (p *everyNth) String() string { return fmt.Sprintf("every_nth=[n=%v]", p.n) }
+
+func (p *everyNth) Run(event *publisher.Event) (*publisher.Event, error) {
+	if p.count.Inc()%p.n != 0 {
+		return nil, nil
+	}
+	return event, nil
+}
@@ -0,0 +1,91 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+)
+
+func TestSampling(t *testing.T) {
+	countKept := func(p publisher.Processor, n int) int {
+		kept := 0
+		for i := 0; i < n; i++ {
+			out, err := p.Run(&publisher.Event{})
+			require.NoError(t, err)
+			if out != nil {
+				kept++
+			}
+		}
+		return kept
+	}
+
+	t.Run("rate 0 drops all events", func(t *testing.T) {
+		require.Equal(t, 0, countKept(NewSampling(0, nil), 100))
+	})
+
+	t.Run("rate 1 keeps all events", func(t *testing.T) {
+		require.Equal(t, 100, countKept(NewSampling(1, nil), 100))
+	})
+
+	t.Run("same source produces same sample", func(t *testing.T) {
+		kept1 := countKept(NewSampling(0.5, rand.NewSource(42)), 1000)
+		kept2 := countKept(NewSampling(0.5, rand.NewSource(42)), 1000)
+		require.Equal(t, kept1, kept2)
+		require.InDelta(t, 500, kept1, 100)
+	})
+}
+
+func TestEveryNth(t *testing.T) {
+	t.Run("keeps every n-th event", func(t *testing.T) {
+		p := NewEveryNth(3)
+		var kept []int
+		for i := 1; i <= 9; i++ {
+			out, err := p.Run(&publisher.Event{Private: i})
+			require.NoError(t, err)
+			if out != nil {
+				kept = append(kept, out.Private.(int))
+			}
+		}
+		require.Equal(t, []int{3, 6, 9}, kept)
+	})
+
+	t.Run("keeps all events if n <= 1", func(t *testing.T) {
+		p := NewEveryNth(0)
+		out, err := p.Run(&publisher.Event{})
+		require.NoError(t, err)
+		require.NotNil(t, out)
+	})
+
+	t.Run("concurrent use", func(t *testing.T) {
+		const workers, events = 4, 100
+
+		p := NewEveryNth(4)
+		var mu sync.Mutex
+		kept := 0
+
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < events; i++ {
+					if out, _ := p.Run(&publisher.Event{}); out != nil {
+						mu.Lock()
+						kept++
+						mu.Unlock()
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, workers*events/4, kept)
+	})
+}
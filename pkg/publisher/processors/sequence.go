@@ -0,0 +1,56 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"fmt"
+
+	"go.uber.org/atomic"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// Sequence is a processor adding a monotonically increasing sequence number
+// to each event, such that consumers can detect gaps in the event stream.
+// The sequence is shared by all events processed by the processor, e.g. all
+// events of a client if the processor is configured via ProcessingConfig.
+type Sequence struct {
+	target string
+	last   atomic.Uint64
+}
+
+// NewSequence creates a Sequence processor writing the sequence number as
+// uint64 to targetField. The first event gets the sequence number 1.
+func NewSequence(targetField string) *Sequence {
+	return &Sequence{target: targetField}
+}
+
+func (p *Sequence) String() string {
+	return fmt.Sprintf("sequence=[target=%v]", p.target)
+}
+
+func (p *Sequence) Run(event *publisher.Event) (*publisher.Event, error) {
+	if event.Fields == nil {
+		event.Fields = mapstr.M{}
+	}
+	if _, err := event.Fields.Put(p.target, p.last.Inc()); err != nil {
+		return nil, fmt.Errorf("failed to store field '%v': %w", p.target, err)
+	}
+	return event, nil
+}
+
+// Last returns the sequence number of the last event processed, or 0 if no
+// event has been processed yet. Last can be persisted, to continue the
+// sequence after a restart via Reset.
+func (p *Sequence) Last() uint64 {
+	return p.last.Load()
+}
+
+// Reset sets the sequence number of the last event processed. The next event
+// gets the sequence number last+1. Reset(0) restarts the sequence at 1.
+func (p *Sequence) Reset(last uint64) {
+	p.last.Store(last)
+}
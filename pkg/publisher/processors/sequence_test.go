@@ -0,0 +1,76 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestSequence(t *testing.T) {
+	run := func(t *testing.T, p *Sequence) uint64 {
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": "test"}})
+		require.NoError(t, err)
+		seq, err := out.Fields.GetValue("event.sequence")
+		require.NoError(t, err)
+		return seq.(uint64)
+	}
+
+	t.Run("sequence increases per event", func(t *testing.T) {
+		p := NewSequence("event.sequence")
+		require.Equal(t, uint64(0), p.Last())
+		for i := uint64(1); i <= 3; i++ {
+			require.Equal(t, i, run(t, p))
+		}
+		require.Equal(t, uint64(3), p.Last())
+	})
+
+	t.Run("reset continues the sequence", func(t *testing.T) {
+		p := NewSequence("event.sequence")
+		p.Reset(41)
+		require.Equal(t, uint64(42), run(t, p))
+
+		p.Reset(0)
+		require.Equal(t, uint64(1), run(t, p))
+	})
+
+	t.Run("concurrent events get unique numbers", func(t *testing.T) {
+		p := NewSequence("event.sequence")
+
+		var mu sync.Mutex
+		seen := map[uint64]bool{}
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					out, _ := p.Run(&publisher.Event{})
+					mu.Lock()
+					seen[out.Fields["event"].(mapstr.M)["sequence"].(uint64)] = true
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		require.Len(t, seen, 400)
+		require.Equal(t, uint64(400), p.Last())
+	})
+
+	t.Run("event without fields", func(t *testing.T) {
+		out, err := NewSequence("seq").Run(&publisher.Event{})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"seq": uint64(1)}, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		require.Equal(t, "sequence=[target=event.sequence]", NewSequence("event.sequence").String())
+	})
+}
@@ -0,0 +1,88 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// TimestampParseFailureTag is added to the tags of events the timestamp
+// processor has failed to parse.
+const TimestampParseFailureTag = "_timestamp_parse_failure"
+
+const defaultTimestampTarget = "@timestamp"
+
+type timestamp struct {
+	field   string
+	target  string
+	layouts []string
+}
+
+// NewTimestamp creates a processor that parses the value of sourceField
+// using layout, and stores the parsed time in UTC as time.Time under
+// targetField. The target defaults to `@timestamp` if targetField is empty.
+// If layout does not match, the fallback layouts are tried in order. Layouts
+// use the format of time.Parse.
+//
+// Events without sourceField are returned unchanged. If the value can not be
+// parsed, the event is not dropped, but TimestampParseFailureTag is added to
+// its tags.
+func NewTimestamp(sourceField, layout, targetField string, fallbacks ...string) publisher.Processor {
+	if targetField == "" {
+		targetField = defaultTimestampTarget
+	}
+	return &timestamp{
+		field:   sourceField,
+		target:  targetField,
+		layouts: append([]string{layout}, fallbacks...),
+	}
+}
+
+func (p *timestamp) String() string {
+	return fmt.Sprintf("timestamp=[field=%v, target=%v, layouts=%v]", p.field, p.target, strings.Join(p.layouts, "|"))
+}
+
+func (p *timestamp) Run(event *publisher.Event) (*publisher.Event, error) {
+	value, err := event.Fields.GetValue(p.field)
+	if errors.Is(err, mapstr.ErrKeyNotFound) {
+		return event, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read field '%v': %w", p.field, err)
+	}
+
+	ts, ok := p.parse(value)
+	if !ok {
+		if err := mapstr.AddTags(event.Fields, []string{TimestampParseFailureTag}); err != nil {
+			return nil, fmt.Errorf("failed to tag event: %w", err)
+		}
+		return event, nil
+	}
+
+	if _, err := event.Fields.Put(p.target, ts); err != nil {
+		return nil, fmt.Errorf("failed to store timestamp in field '%v': %w", p.target, err)
+	}
+	return event, nil
+}
+
+func (p *timestamp) parse(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v.UTC(), true
+	case string:
+		for _, layout := range p.layouts {
+			if ts, err := time.Parse(layout, v); err == nil {
+				return ts.UTC(), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,59 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestTimestamp(t *testing.T) {
+	expected := time.Date(2022, 8, 15, 10, 30, 0, 0, time.UTC)
+
+	t.Run("parse with layout", func(t *testing.T) {
+		p := NewTimestamp("time", time.RFC3339, "")
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"time": "2022-08-15T12:30:00+02:00"}})
+		require.NoError(t, err)
+		require.Equal(t, expected, out.Fields["@timestamp"])
+		require.Equal(t, time.UTC, out.Fields["@timestamp"].(time.Time).Location())
+	})
+
+	t.Run("fallback layouts are tried in order", func(t *testing.T) {
+		p := NewTimestamp("log.time", time.RFC3339, "event.created", "2006-01-02 15:04:05", time.RFC1123)
+		for _, value := range []string{"2022-08-15 10:30:00", "Mon, 15 Aug 2022 10:30:00 UTC"} {
+			out, err := p.Run(&publisher.Event{Fields: mapstr.M{"log": mapstr.M{"time": value}}})
+			require.NoError(t, err)
+			ts, err := out.Fields.GetValue("event.created")
+			require.NoError(t, err)
+			require.Equal(t, expected, ts)
+		}
+	})
+
+	t.Run("tag event on parse failure", func(t *testing.T) {
+		p := NewTimestamp("time", time.RFC3339, "")
+		for _, value := range []interface{}{"yesterday", 42} {
+			out, err := p.Run(&publisher.Event{Fields: mapstr.M{"time": value}})
+			require.NoError(t, err)
+			require.Equal(t, mapstr.M{"time": value, "tags": []string{TimestampParseFailureTag}}, out.Fields)
+		}
+	})
+
+	t.Run("events without field are unchanged", func(t *testing.T) {
+		p := NewTimestamp("time", time.RFC3339, "")
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": "test"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"message": "test"}, out.Fields)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p := NewTimestamp("time", time.RFC3339, "", time.RFC1123)
+		require.Equal(t, "timestamp=[field=time, target=@timestamp, layouts="+time.RFC3339+"|"+time.RFC1123+"]", p.String())
+	})
+}
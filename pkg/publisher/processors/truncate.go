@@ -0,0 +1,81 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// TruncatedTag is added to the tags of events the truncate processor has
+// shortened a field of.
+const TruncatedTag = "truncated"
+
+type truncate struct {
+	fields   []string
+	maxBytes int
+	suffix   string
+}
+
+// NewTruncate creates a processor that truncates the string values of fields
+// to at most maxBytes bytes, e.g. to prevent outputs from rejecting events
+// with huge fields. Values are cut at the last UTF-8 character boundary
+// before maxBytes, such that no character is split. Suffix is appended to
+// truncated values, like `...[truncated]`, and is not included in maxBytes.
+// TruncatedTag is added to the tags of events with at least one truncated
+// field. Missing fields and non-string values are ignored.
+// An error is returned if maxBytes is not positive.
+func NewTruncate(fields []string, maxBytes int, suffix string) (publisher.Processor, error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("max bytes must be positive, got %v", maxBytes)
+	}
+	return &truncate{fields: fields, maxBytes: maxBytes, suffix: suffix}, nil
+}
+
+func (p *truncate) String() string {
+	return fmt.Sprintf("truncate=[fields=%v, max_bytes=%v, suffix=%v]", p.fields, p.maxBytes, p.suffix)
+}
+
+func (p *truncate) Run(event *publisher.Event) (*publisher.Event, error) {
+	truncated := false
+	for _, field := range p.fields {
+		value, err := event.Fields.GetValue(field)
+		if errors.Is(err, mapstr.ErrKeyNotFound) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read field '%v': %w", field, err)
+		}
+
+		str, ok := value.(string)
+		if !ok || len(str) <= p.maxBytes {
+			continue
+		}
+		if _, err := event.Fields.Put(field, truncateUTF8(str, p.maxBytes)+p.suffix); err != nil {
+			return nil, fmt.Errorf("failed to store field '%v': %w", field, err)
+		}
+		truncated = true
+	}
+
+	if truncated {
+		if err := mapstr.AddTags(event.Fields, []string{TruncatedTag}); err != nil {
+			return nil, fmt.Errorf("failed to tag event: %w", err)
+		}
+	}
+	return event, nil
+}
+
+// truncateUTF8 returns the longest prefix of str with at most maxBytes bytes,
+// that does not end within a multi-byte character.
+func truncateUTF8(str string, maxBytes int) string {
+	end := maxBytes
+	for end > 0 && !utf8.RuneStart(str[end]) {
+		end--
+	}
+	return str[:end]
+}
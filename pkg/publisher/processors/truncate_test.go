@@ -0,0 +1,66 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package processors
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestTruncate(t *testing.T) {
+	t.Run("long values are truncated", func(t *testing.T) {
+		p, err := NewTruncate([]string{"message", "log.original", "short", "count", "missing"}, 5, "...")
+		require.NoError(t, err)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{
+			"message": "hello world",
+			"log":     mapstr.M{"original": "0123456789"},
+			"short":   "hello",
+			"count":   1234567,
+		}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{
+			"message": "hello...",
+			"log":     mapstr.M{"original": "01234..."},
+			"short":   "hello",
+			"count":   1234567,
+			"tags":    []string{TruncatedTag},
+		}, out.Fields)
+	})
+
+	t.Run("multi-byte characters are not split", func(t *testing.T) {
+		p, err := NewTruncate([]string{"message"}, 5, "")
+		require.NoError(t, err)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": "aa€€"}}) // € is 3 bytes
+		require.NoError(t, err)
+		require.Equal(t, "aa€", out.Fields["message"])
+
+		out, err = p.Run(&publisher.Event{Fields: mapstr.M{"message": "a€€"}})
+		require.NoError(t, err)
+		require.Equal(t, "a€", out.Fields["message"])
+	})
+
+	t.Run("events without long values are not tagged", func(t *testing.T) {
+		p, err := NewTruncate([]string{"message"}, 5, "...")
+		require.NoError(t, err)
+		out, err := p.Run(&publisher.Event{Fields: mapstr.M{"message": "test"}})
+		require.NoError(t, err)
+		require.Equal(t, mapstr.M{"message": "test"}, out.Fields)
+	})
+
+	t.Run("max bytes must be positive", func(t *testing.T) {
+		_, err := NewTruncate([]string{"message"}, 0, "")
+		require.Error(t, err)
+	})
+
+	t.Run("string", func(t *testing.T) {
+		p, err := NewTruncate([]string{"message"}, 5, "...")
+		require.NoError(t, err)
+		require.Equal(t, "truncate=[fields=[message], max_bytes=5, suffix=...]", p.String())
+	})
+}
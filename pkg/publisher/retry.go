@@ -0,0 +1,264 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// BackoffPolicy configures the wait time between retries. The wait time
+// starts at Initial and is multiplied by Multiplier after each failed attempt,
+// up to Max.
+type BackoffPolicy struct {
+	Initial    time.Duration
+	Max        time.Duration
+	Multiplier float64
+}
+
+// DefaultBackoffPolicy is used by NewRetryingClient for unset fields of the
+// BackoffPolicy.
+var DefaultBackoffPolicy = BackoffPolicy{
+	Initial:    100 * time.Millisecond,
+	Max:        10 * time.Second,
+	Multiplier: 2,
+}
+
+// RetryingClient is a Client that reconnects to the pipeline if the
+// underlying client has been closed by the pipeline, and publishes the event
+// again on the new client. Reconnects are retried according to the
+// BackoffPolicy until RetryingClient is closed, or the Context (or CloseRef)
+// of the ClientConfig is done.
+//
+// All connections share the ACKer and ClientEventer of the ClientConfig,
+// such that ACKers must be able to handle events from multiple connections.
+// Metrics reports the metrics of the current connection only.
+type RetryingClient struct {
+	pipeline Pipeline
+	cfg      ClientConfig
+	policy   BackoffPolicy
+
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu     sync.Mutex
+	client Client
+}
+
+var _ Client = (*RetryingClient)(nil)
+
+// NewRetryingClient connects to pipeline using cfg. An error is returned if
+// the initial connection attempt fails.
+func NewRetryingClient(pipeline Pipeline, cfg ClientConfig, policy BackoffPolicy) (*RetryingClient, error) {
+	if policy.Initial <= 0 {
+		policy.Initial = DefaultBackoffPolicy.Initial
+	}
+	if policy.Max <= 0 {
+		policy.Max = DefaultBackoffPolicy.Max
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = DefaultBackoffPolicy.Multiplier
+	}
+
+	client, err := pipeline.ConnectWith(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &RetryingClient{
+		pipeline: pipeline,
+		cfg:      cfg,
+		policy:   policy,
+		done:     make(chan struct{}),
+		client:   client,
+	}, nil
+}
+
+func (c *RetryingClient) Publish(event Event) {
+	_, _ = c.PublishChecked(event)
+}
+
+func (c *RetryingClient) PublishAll(events []Event) {
+	for _, event := range events {
+		c.Publish(event)
+	}
+}
+
+func (c *RetryingClient) PublishAllContext(ctx context.Context, events []Event) (int, error) {
+	for i, event := range events {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if _, err := c.PublishChecked(event); isClosedErr(err) {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// TryPublish publishes the event like PublishChecked, and reports if the
+// event has not been dropped.
+func (c *RetryingClient) TryPublish(event Event) bool {
+	result, _ := c.PublishChecked(event)
+	return result != Dropped
+}
+
+func (c *RetryingClient) PublishWait(ctx context.Context, event Event) error {
+	return c.retry(func(client Client) error {
+		return client.PublishWait(ctx, event)
+	})
+}
+
+func (c *RetryingClient) PublishDeadline(event Event, deadline time.Time) error {
+	return c.retry(func(client Client) error {
+		return client.PublishDeadline(event, deadline)
+	})
+}
+
+func (c *RetryingClient) PublishBatch(events []Event) error {
+	return c.retry(func(client Client) error {
+		return client.PublishBatch(events)
+	})
+}
+
+func (c *RetryingClient) PublishChecked(event Event) (PublishResult, error) {
+	result := Dropped
+	err := c.retry(func(client Client) (err error) {
+		result, err = client.PublishChecked(event)
+		return err
+	})
+	return result, err
+}
+
+// Flush waits for the events of the current connection to be ACKed.
+func (c *RetryingClient) Flush(ctx context.Context) error {
+	return c.current().Flush(ctx)
+}
+
+// Metrics returns the metrics of the current connection.
+func (c *RetryingClient) Metrics() ClientMetrics {
+	return c.current().Metrics()
+}
+
+// Backpressure returns the backpressure signal of the current connection.
+func (c *RetryingClient) Backpressure() <-chan struct{} {
+	return c.current().Backpressure()
+}
+
+// Close stops retries and closes the current connection.
+func (c *RetryingClient) Close() error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.current().Close()
+}
+
+// CloseWithTimeout stops retries and closes the current connection using
+// CloseWithTimeout.
+func (c *RetryingClient) CloseWithTimeout(ctx context.Context) error {
+	c.closeOnce.Do(func() { close(c.done) })
+	return c.current().CloseWithTimeout(ctx)
+}
+
+func (c *RetryingClient) current() Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.client
+}
+
+// retry runs fn with the current client. If fn fails because the client has
+// been closed, a new client is connected and fn is run again.
+func (c *RetryingClient) retry(fn func(Client) error) error {
+	backoff := c.policy.Initial
+	for {
+		client := c.current()
+		err := fn(client)
+		if !isClosedErr(err) {
+			return err
+		}
+
+		if err := c.reconnect(client, &backoff); err != nil {
+			return err
+		}
+	}
+}
+
+// reconnect replaces the closed client with a new connection, unless another
+// go-routine has reconnected already. Connection attempts are retried until
+// the RetryingClient is closed. The pipeline is connected without holding
+// mu, such that a slow connection attempt does not block Close. A new client
+// is closed again if the RetryingClient has been closed in the meantime.
+func (c *RetryingClient) reconnect(closed Client, backoff *time.Duration) error {
+	for {
+		if err := c.wait(*backoff); err != nil {
+			return err
+		}
+		*backoff = time.Duration(float64(*backoff) * c.policy.Multiplier)
+		if *backoff > c.policy.Max {
+			*backoff = c.policy.Max
+		}
+
+		if c.isDone() {
+			return ErrClientClosed
+		}
+		if c.current() != closed {
+			return nil
+		}
+		client, err := c.pipeline.ConnectWith(c.cfg)
+		if err != nil {
+			continue
+		}
+
+		c.mu.Lock()
+		replaced := c.client != closed
+		done := c.isDone()
+		if !replaced && !done {
+			c.client = client
+		}
+		c.mu.Unlock()
+
+		switch {
+		case done:
+			_ = client.Close()
+			return ErrClientClosed
+		case replaced:
+			_ = client.Close()
+		}
+		return nil
+	}
+}
+
+// isDone reports whether the RetryingClient has been closed.
+func (c *RetryingClient) isDone() bool {
+	select {
+	case <-c.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// wait blocks for d. ErrClientClosed is returned if the client is closed
+// while waiting.
+func (c *RetryingClient) wait(d time.Duration) error {
+	var signal <-chan struct{}
+	if ref := c.cfg.CloseSignal(); ref != nil {
+		signal = ref.Done()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-c.done:
+		return ErrClientClosed
+	case <-signal:
+		return ErrClientClosed
+	case <-timer.C:
+		return nil
+	}
+}
+
+func isClosedErr(err error) bool {
+	return errors.Is(err, ErrClientClosed) || errors.Is(err, ErrPipelineClosed)
+}
@@ -0,0 +1,146 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// retryTestPipeline creates clients that record published events, and
+// fail with ErrClientClosed once closed.
+type retryTestPipeline struct {
+	mu        sync.Mutex
+	connects  int
+	failNext  int // number of connection attempts to fail
+	published []Event
+	clients   []*retryTestClient
+
+	// onConnect is called by ConnectWith, before the client is created.
+	onConnect func()
+}
+
+type retryTestClient struct {
+	Client // not implemented methods panic
+
+	pipeline *retryTestPipeline
+	closed   bool
+}
+
+func (p *retryTestPipeline) Connect() (Client, error) { return p.ConnectWith(ClientConfig{}) }
+
+func (p *retryTestPipeline) ConnectWith(ClientConfig) (Client, error) {
+	if p.onConnect != nil {
+		p.onConnect()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.connects++
+	if p.failNext > 0 {
+		p.failNext--
+		return nil, errors.New("connection failed")
+	}
+	client := &retryTestClient{pipeline: p}
+	p.clients = append(p.clients, client)
+	return client, nil
+}
+
+func (p *retryTestPipeline) closeClients() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.clients {
+		c.closed = true
+	}
+}
+
+func (c *retryTestClient) PublishChecked(event Event) (PublishResult, error) {
+	c.pipeline.mu.Lock()
+	defer c.pipeline.mu.Unlock()
+	if c.closed {
+		return Dropped, ErrClientClosed
+	}
+	c.pipeline.published = append(c.pipeline.published, event)
+	return Accepted, nil
+}
+
+func (c *retryTestClient) Close() error {
+	c.pipeline.mu.Lock()
+	defer c.pipeline.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestRetryingClient(t *testing.T) {
+	policy := BackoffPolicy{Initial: time.Millisecond, Max: 5 * time.Millisecond, Multiplier: 2}
+
+	t.Run("event is published again after reconnect", func(t *testing.T) {
+		pipeline := &retryTestPipeline{}
+		client, err := NewRetryingClient(pipeline, ClientConfig{}, policy)
+		require.NoError(t, err)
+
+		client.Publish(Event{Private: 1})
+		pipeline.closeClients()
+		pipeline.failNext = 2
+		result, err := client.PublishChecked(Event{Private: 2})
+		require.NoError(t, err)
+		require.Equal(t, Accepted, result)
+
+		require.Equal(t, []Event{{Private: 1}, {Private: 2}}, pipeline.published)
+		require.Equal(t, 4, pipeline.connects)
+	})
+
+	t.Run("retries stop once client is closed", func(t *testing.T) {
+		pipeline := &retryTestPipeline{}
+		client, err := NewRetryingClient(pipeline, ClientConfig{}, policy)
+		require.NoError(t, err)
+		require.NoError(t, client.Close())
+
+		result, err := client.PublishChecked(Event{})
+		require.ErrorIs(t, err, ErrClientClosed)
+		require.Equal(t, Dropped, result)
+		require.Equal(t, 1, pipeline.connects)
+	})
+
+	t.Run("retries stop once context is cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		pipeline := &retryTestPipeline{}
+		client, err := NewRetryingClient(pipeline, ClientConfig{Context: ctx}, policy)
+		require.NoError(t, err)
+
+		pipeline.closeClients()
+		pipeline.failNext = 1000
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			cancel()
+		}()
+		require.False(t, client.TryPublish(Event{}))
+	})
+
+	t.Run("client connected while closing is closed", func(t *testing.T) {
+		pipeline := &retryTestPipeline{}
+		client, err := NewRetryingClient(pipeline, ClientConfig{}, policy)
+		require.NoError(t, err)
+
+		pipeline.closeClients()
+		pipeline.onConnect = func() { require.NoError(t, client.Close()) }
+		_, err = client.PublishChecked(Event{})
+		require.ErrorIs(t, err, ErrClientClosed)
+
+		require.Len(t, pipeline.clients, 2)
+		require.True(t, pipeline.clients[1].closed, "new client must be closed")
+		require.Empty(t, pipeline.published)
+	})
+
+	t.Run("fail if initial connection fails", func(t *testing.T) {
+		_, err := NewRetryingClient(&retryTestPipeline{failNext: 1}, ClientConfig{}, policy)
+		require.Error(t, err)
+	})
+}
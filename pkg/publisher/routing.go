@@ -0,0 +1,260 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// routingClient dispatches events to per-key clients.
+type routingClient struct {
+	factory func(key string) Client
+	keyFn   func(Event) string
+
+	mu      sync.Mutex
+	clients map[string]Client
+	closed  bool
+}
+
+// NewRoutingClient creates a Client that dispatches events to one client per
+// routing key, e.g. to send the events of each tenant via a separate output
+// connection. The routing key of an event is computed by keyFn. The client
+// for a key is created by factory once the first event with that key is
+// published. The factory must return a connected client.
+//
+// Batches passed to PublishAll, PublishAllContext, or PublishBatch are split
+// by routing key. Events with the same key are passed to their client as a
+// single batch, keeping their order. PublishBatch is not atomic across keys:
+// if the batch of a key fails, the batches of other keys might have been
+// published already.
+//
+// Close closes all per-key clients concurrently, such that each client waits
+// for its pending events according to its own WaitClose setting. Events
+// published after Close are dropped.
+func NewRoutingClient(factory func(key string) Client, keyFn func(Event) string) Client {
+	return &routingClient{
+		factory: factory,
+		keyFn:   keyFn,
+		clients: map[string]Client{},
+	}
+}
+
+// routingGroup holds the events of a batch with the same routing key.
+type routingGroup struct {
+	client Client
+	events []Event
+}
+
+func (c *routingClient) Publish(event Event) {
+	if client, err := c.route(event); err == nil {
+		client.Publish(event)
+	}
+}
+
+func (c *routingClient) PublishAll(events []Event) {
+	groups, _ := c.group(events)
+	for _, g := range groups {
+		g.client.PublishAll(g.events)
+	}
+}
+
+func (c *routingClient) PublishAllContext(ctx context.Context, events []Event) (int, error) {
+	groups, err := c.group(events)
+	if err != nil {
+		return 0, err
+	}
+
+	published := 0
+	for _, g := range groups {
+		n, err := g.client.PublishAllContext(ctx, g.events)
+		published += n
+		if err != nil {
+			return published, err
+		}
+	}
+	return published, nil
+}
+
+func (c *routingClient) TryPublish(event Event) bool {
+	client, err := c.route(event)
+	return err == nil && client.TryPublish(event)
+}
+
+func (c *routingClient) PublishWait(ctx context.Context, event Event) error {
+	client, err := c.route(event)
+	if err != nil {
+		return err
+	}
+	return client.PublishWait(ctx, event)
+}
+
+func (c *routingClient) PublishDeadline(event Event, deadline time.Time) error {
+	client, err := c.route(event)
+	if err != nil {
+		return err
+	}
+	return client.PublishDeadline(event, deadline)
+}
+
+func (c *routingClient) PublishBatch(events []Event) error {
+	groups, err := c.group(events)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := g.client.PublishBatch(g.events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *routingClient) PublishChecked(event Event) (PublishResult, error) {
+	client, err := c.route(event)
+	if err != nil {
+		return Dropped, err
+	}
+	return client.PublishChecked(event)
+}
+
+// Flush flushes all per-key clients.
+func (c *routingClient) Flush(ctx context.Context) error {
+	for _, client := range c.active() {
+		if err := client.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metrics returns the sum of the metrics of all per-key clients.
+func (c *routingClient) Metrics() ClientMetrics {
+	var m ClientMetrics
+	for _, client := range c.active() {
+		cm := client.Metrics()
+		m.Published += cm.Published
+		m.Dropped += cm.Dropped
+		m.Filtered += cm.Filtered
+		m.ActiveEvents += cm.ActiveEvents
+		m.QueueLen += cm.QueueLen
+		m.Buffered += cm.Buffered
+		m.Invalid += cm.Invalid
+	}
+	return m
+}
+
+// Backpressure returns the backpressure signal of a per-key client that is
+// currently under backpressure. If no client is under backpressure, nil is
+// returned. Unlike the channels of other clients, the returned channel is
+// not closed if a client comes under backpressure later, so Backpressure
+// must be called again before each fetch.
+func (c *routingClient) Backpressure() <-chan struct{} {
+	for _, client := range c.active() {
+		ch := client.Backpressure()
+		select {
+		case <-ch:
+			return ch
+		default:
+		}
+	}
+	return nil
+}
+
+func (c *routingClient) Close() error {
+	return c.closeAll(func(client Client) error { return client.Close() })
+}
+
+func (c *routingClient) CloseWithTimeout(ctx context.Context) error {
+	return c.closeAll(func(client Client) error { return client.CloseWithTimeout(ctx) })
+}
+
+// closeAll marks the client as closed and closes all per-key clients
+// concurrently. The first error reported is returned.
+func (c *routingClient) closeAll(closeFn func(Client) error) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	clients := c.clients
+	c.clients = nil
+	c.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, len(clients))
+	for _, client := range clients {
+		client := client
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := closeFn(client); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// route returns the client for the routing key of event.
+func (c *routingClient) route(event Event) (Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clientFor(c.keyFn(event))
+}
+
+// group splits events by routing key, keeping the order of the events per
+// key. Groups are ordered by the first event of each key.
+func (c *routingClient) group(events []Event) ([]routingGroup, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var groups []routingGroup
+	index := map[string]int{}
+	for _, event := range events {
+		key := c.keyFn(event)
+		i, exists := index[key]
+		if !exists {
+			client, err := c.clientFor(key)
+			if err != nil {
+				return nil, err
+			}
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, routingGroup{client: client})
+		}
+		groups[i].events = append(groups[i].events, event)
+	}
+	return groups, nil
+}
+
+// clientFor returns the client for key, creating the client if required.
+// c.mu must be held.
+func (c *routingClient) clientFor(key string) (Client, error) {
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	client, exists := c.clients[key]
+	if !exists {
+		client = c.factory(key)
+		c.clients[key] = client
+	}
+	return client, nil
+}
+
+// active returns the per-key clients.
+func (c *routingClient) active() []Client {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	clients := make([]Client, 0, len(c.clients))
+	for _, client := range c.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
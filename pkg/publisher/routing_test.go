@@ -0,0 +1,119 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// routingTestClient records published events. Close blocks for closeDelay.
+type routingTestClient struct {
+	Client // not implemented methods panic
+
+	closeDelay   time.Duration
+	backpressure chan struct{}
+
+	mu     sync.Mutex
+	events []Event
+	closed bool
+}
+
+func (c *routingTestClient) Publish(event Event) { c.PublishAll([]Event{event}) }
+
+func (c *routingTestClient) PublishAll(events []Event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.events = append(c.events, events...)
+}
+
+func (c *routingTestClient) Metrics() ClientMetrics {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return ClientMetrics{Published: uint64(len(c.events))}
+}
+
+func (c *routingTestClient) Backpressure() <-chan struct{} { return c.backpressure }
+
+func (c *routingTestClient) Close() error {
+	time.Sleep(c.closeDelay)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func TestRoutingClient(t *testing.T) {
+	event := func(tenant string, i int) Event {
+		return Event{Fields: mapstr.M{"tenant": tenant, "i": i}}
+	}
+	keyFn := func(e Event) string { return e.Fields["tenant"].(string) }
+	ids := func(events []Event) []int {
+		var ids []int
+		for _, e := range events {
+			ids = append(ids, e.Fields["i"].(int))
+		}
+		return ids
+	}
+
+	newClient := func(closeDelay time.Duration) (Client, map[string]*routingTestClient) {
+		clients := map[string]*routingTestClient{}
+		factory := func(key string) Client {
+			client := &routingTestClient{closeDelay: closeDelay}
+			clients[key] = client
+			return client
+		}
+		return NewRoutingClient(factory, keyFn), clients
+	}
+
+	t.Run("events are dispatched by key", func(t *testing.T) {
+		client, clients := newClient(0)
+		client.Publish(event("a", 0))
+		client.PublishAll([]Event{event("b", 1), event("a", 2), event("b", 3)})
+		client.Publish(event("a", 4))
+
+		require.Len(t, clients, 2)
+		require.Equal(t, []int{0, 2, 4}, ids(clients["a"].events))
+		require.Equal(t, []int{1, 3}, ids(clients["b"].events))
+		require.Equal(t, uint64(5), client.Metrics().Published)
+	})
+
+	t.Run("backpressure of any client is reported", func(t *testing.T) {
+		client, clients := newClient(0)
+		client.Publish(event("a", 0))
+		client.Publish(event("b", 1))
+		require.Nil(t, client.Backpressure())
+
+		clients["b"].backpressure = make(chan struct{})
+		close(clients["b"].backpressure)
+		require.NotNil(t, client.Backpressure())
+		<-client.Backpressure()
+	})
+
+	t.Run("close closes all clients concurrently", func(t *testing.T) {
+		client, clients := newClient(50 * time.Millisecond)
+		for i, tenant := range []string{"a", "b", "c", "d"} {
+			client.Publish(event(tenant, i))
+		}
+
+		start := time.Now()
+		require.NoError(t, client.Close())
+		require.Less(t, time.Since(start), 150*time.Millisecond)
+		for key, c := range clients {
+			require.True(t, c.closed, "client %v must be closed", key)
+		}
+
+		// no new clients are created after close
+		client.Publish(event("e", 4))
+		_, err := client.PublishChecked(event("e", 5))
+		require.ErrorIs(t, err, ErrClientClosed)
+		require.Len(t, clients, 4)
+	})
+}
@@ -0,0 +1,738 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	spillFilePrefix = "spill-"
+	spillFileSuffix = ".log"
+
+	// spillSegmentEvents is the number of events written to a spill file,
+	// before a new file is started. Files are removed once all events have
+	// been replayed.
+	spillSegmentEvents = 4096
+
+	// spillMaxRecordSize limits the size of a single record. Larger length
+	// prefixes are treated as a corrupted file.
+	spillMaxRecordSize = 64 * 1024 * 1024
+
+	// spillInitialSeq is the sequence number of the first spill file in an
+	// empty directory. Files written on Close must sort before existing files,
+	// such that sequence numbers are counted down from there.
+	spillInitialSeq = 1 << 32
+)
+
+func init() {
+	// Types commonly found in event fields. Values of other types are
+	// normalized before being spilled, see encodeSpillEvent.
+	gob.Register(mapstr.M{})
+	gob.Register(map[string]interface{}{})
+	gob.Register([]interface{}{})
+	gob.Register([]mapstr.M{})
+	gob.Register([]map[string]interface{}{})
+	gob.Register(time.Time{})
+}
+
+// spillingClient implements Client by buffering events in memory, and
+// spilling events to disk once the memory buffer is full. A go-routine
+// forwards buffered events to the inner client.
+type spillingClient struct {
+	inner  Client
+	dir    string
+	maxMem int
+	log    *logp.Logger
+
+	mu       sync.Mutex
+	mem      []Event         // events older than all events on disk
+	segments []*spillSegment // spill files, oldest first
+	writer   *os.File        // open file of the last segment, if still written to
+	reader   *bufio.Reader   // reader of the first segment
+	readFile *os.File
+	private  []interface{} // Private of events spilled by this process, in order
+	spilled  int           // number of events on disk
+	nextSeq  uint64
+	inflight bool // the worker is forwarding an event to inner
+	closed   bool // no new events are accepted
+	stopped  bool // the worker must return
+	dropped  uint64
+	changed  chan struct{} // closed and replaced on state changes
+
+	backpressure *BackpressureSignal
+
+	done chan struct{} // closed once the worker has returned
+}
+
+type spillSegment struct {
+	seq       uint64
+	path      string
+	written   int
+	read      int
+	recovered bool // written by a previous process, events have no Private
+}
+
+var _ Client = (*spillingClient)(nil)
+
+// NewSpillingClient creates a Client that buffers up to maxMemEvents events
+// in memory, and writes events exceeding the limit to spill files in
+// spillDir. A go-routine forwards events to inner, replaying spilled events
+// in order once the memory buffer has been drained. Once events have been
+// spilled, new events are spilled as well until all spilled events have been
+// replayed. The disk usage is not limited. A maxMemEvents < 1 is treated as 1.
+// Backpressure is signaled while the number of buffered events, in memory and
+// on disk, is above the thresholds of DefaultBackpressureConfig for a capacity
+// of maxMemEvents.
+//
+// Spilled events are written as length-prefixed records, holding the event
+// fields encoded with encoding/gob, such that replayed events keep the field
+// types, including time.Time and 64 bit integers. Events holding values of
+// types not registered with encoding/gob are normalized like encoding/json
+// does, with integers kept as int64 or uint64. Event.Private is kept in
+// memory, such that ACK handling works for events replayed by the same
+// process.
+//
+// Spill files found in spillDir are replayed before new events, such that
+// events are recovered after a restart. Recovered events have no Private.
+// On Close the inner client is closed, and events still buffered in memory
+// are written to disk for the next process to recover. Events are delivered
+// at least once: events of a partially replayed spill file are replayed
+// again after a restart.
+//
+// An error is returned if spillDir can not be created, or if existing spill
+// files can not be read.
+func NewSpillingClient(inner Client, spillDir string, maxMemEvents int) (Client, error) {
+	if maxMemEvents < 1 {
+		maxMemEvents = 1
+	}
+	c := &spillingClient{
+		inner:   inner,
+		dir:     spillDir,
+		maxMem:  maxMemEvents,
+		log:     logp.NewLogger("spill"),
+		nextSeq: spillInitialSeq,
+		changed: make(chan struct{}),
+		done:    make(chan struct{}),
+
+		backpressure: NewBackpressureSignal(DefaultBackpressureConfig, maxMemEvents),
+	}
+	if err := c.recover(); err != nil {
+		return nil, err
+	}
+	go c.run()
+	return c, nil
+}
+
+func (c *spillingClient) Publish(event Event) {
+	_ = c.enqueue([]Event{event})
+}
+
+func (c *spillingClient) PublishAll(events []Event) {
+	_ = c.enqueue(events)
+}
+
+func (c *spillingClient) PublishAllContext(ctx context.Context, events []Event) (int, error) {
+	for i, event := range events {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		if err := c.enqueue([]Event{event}); err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// TryPublish buffers the event, and reports if the event has been buffered
+// in memory or on disk.
+func (c *spillingClient) TryPublish(event Event) bool {
+	return c.enqueue([]Event{event}) == nil
+}
+
+func (c *spillingClient) PublishWait(ctx context.Context, event Event) error {
+	if err := c.enqueue([]Event{event}); err != nil {
+		return err
+	}
+	return c.Flush(ctx)
+}
+
+// PublishDeadline buffers the event. Buffering never blocks, such that the
+// deadline is not checked.
+func (c *spillingClient) PublishDeadline(event Event, _ time.Time) error {
+	return c.enqueue([]Event{event})
+}
+
+func (c *spillingClient) PublishBatch(events []Event) error {
+	return c.enqueue(events)
+}
+
+// PublishChecked buffers the event. Buffered events are reported as
+// Accepted, even if they are filtered by the processors of the inner client
+// later.
+func (c *spillingClient) PublishChecked(event Event) (PublishResult, error) {
+	if err := c.enqueue([]Event{event}); err != nil {
+		return Dropped, err
+	}
+	return Accepted, nil
+}
+
+// Flush waits for all buffered and spilled events to be forwarded to the
+// inner client, and flushes the inner client.
+func (c *spillingClient) Flush(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		empty := len(c.mem) == 0 && len(c.segments) == 0 && !c.inflight
+		closed, changed := c.closed, c.changed
+		c.mu.Unlock()
+
+		if empty {
+			return c.inner.Flush(ctx)
+		}
+		if closed {
+			return ErrClientClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Metrics returns the metrics of the inner client. Buffered reports the
+// number of events in memory and on disk.
+func (c *spillingClient) Metrics() ClientMetrics {
+	m := c.inner.Metrics()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	m.Dropped += c.dropped
+	m.Buffered = len(c.mem) + c.spilled
+	return m
+}
+
+// Backpressure signals backpressure while the number of buffered events is
+// above the thresholds of DefaultBackpressureConfig for a capacity of
+// maxMemEvents. Events are still accepted and spilled to disk while
+// backpressure is signaled, such that sources pausing on the signal limit
+// the disk usage, while other sources can keep publishing.
+func (c *spillingClient) Backpressure() <-chan struct{} {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.backpressure.Update(len(c.mem) + c.spilled)
+}
+
+func (c *spillingClient) Close() error {
+	return c.close(c.inner.Close)
+}
+
+func (c *spillingClient) CloseWithTimeout(ctx context.Context) error {
+	return c.close(func() error { return c.inner.CloseWithTimeout(ctx) })
+}
+
+// close stops the worker, closes the inner client, and writes the events
+// buffered in memory to disk.
+func (c *spillingClient) close(closeInner func() error) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.stopped = true
+	c.notify()
+	c.mu.Unlock()
+
+	// closing the inner client unblocks the worker
+	err := closeInner()
+	<-c.done
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closeFiles()
+	if spillErr := c.spillFront(c.mem); spillErr != nil {
+		c.dropped += uint64(len(c.mem))
+		if err == nil {
+			err = spillErr
+		}
+	}
+	c.mem = nil
+	return err
+}
+
+// enqueue adds events to the memory buffer, or spills them to disk.
+func (c *spillingClient) enqueue(events []Event) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		c.dropped += uint64(len(events))
+		return ErrClientClosed
+	}
+	for i, event := range events {
+		if len(c.segments) == 0 && len(c.mem) < c.maxMem {
+			c.mem = append(c.mem, event)
+			continue
+		}
+		if err := c.spill(event); err != nil {
+			c.log.Errorf("Failed to spill event to disk: %v", err)
+			c.dropped += uint64(len(events) - i)
+			c.notify()
+			return err
+		}
+	}
+	c.notify()
+	return nil
+}
+
+// run forwards buffered events to the inner client until the client is
+// stopped. An event rejected by the inner client, because the client is being
+// closed, is returned to the memory buffer.
+func (c *spillingClient) run() {
+	defer close(c.done)
+
+	for {
+		event, ok := c.next()
+		if !ok {
+			return
+		}
+
+		_, err := c.inner.PublishChecked(event)
+
+		c.mu.Lock()
+		c.inflight = false
+		if c.stopped && errors.Is(err, ErrClientClosed) {
+			c.mem = append([]Event{event}, c.mem...)
+		}
+		c.notify()
+		c.mu.Unlock()
+	}
+}
+
+// next returns the oldest buffered event. False is returned if the worker
+// has been stopped.
+func (c *spillingClient) next() (Event, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for {
+		if c.stopped {
+			return Event{}, false
+		}
+		if len(c.mem) > 0 {
+			event := c.mem[0]
+			c.mem[0] = Event{}
+			c.mem = c.mem[1:]
+			c.inflight = true
+			c.notify()
+			return event, true
+		}
+		if len(c.segments) > 0 {
+			if event, ok := c.replay(); ok {
+				c.inflight = true
+				c.notify()
+				return event, true
+			}
+			continue
+		}
+
+		changed := c.changed
+		c.mu.Unlock()
+		<-changed
+		c.mu.Lock()
+	}
+}
+
+// replay reads the next event from the oldest spill file. Once all events
+// of the file have been read, the file is removed and false is returned.
+// Events that can not be read are dropped. c.mu must be held.
+func (c *spillingClient) replay() (Event, bool) {
+	seg := c.segments[0]
+	if seg.read >= seg.written {
+		c.removeSegment()
+		return Event{}, false
+	}
+
+	if c.reader == nil {
+		f, err := os.Open(seg.path)
+		if err != nil {
+			c.log.Errorf("Failed to open spill file, %v events are lost: %v", seg.written-seg.read, err)
+			c.dropSegment()
+			return Event{}, false
+		}
+		c.readFile, c.reader = f, bufio.NewReader(f)
+	}
+
+	payload, err := readSpillRecord(c.reader)
+	if err != nil {
+		c.log.Errorf("Failed to read spill file, %v events are lost: %v", seg.written-seg.read, err)
+		c.dropSegment()
+		return Event{}, false
+	}
+	seg.read++
+	c.spilled--
+
+	var event Event
+	if !seg.recovered {
+		event.Private = c.private[0]
+		c.private[0] = nil
+		c.private = c.private[1:]
+	}
+	if err := decodeSpillEvent(payload, &event.Fields); err != nil {
+		c.log.Errorf("Failed to decode spilled event, event is lost: %v", err)
+		c.dropped++
+		return Event{}, false
+	}
+	if event.Fields == nil {
+		event.Fields = mapstr.M{}
+	}
+	return event, true
+}
+
+// dropSegment removes the oldest spill file, dropping the events that have
+// not been read yet. c.mu must be held.
+func (c *spillingClient) dropSegment() {
+	seg := c.segments[0]
+	n := seg.written - seg.read
+	c.dropped += uint64(n)
+	c.spilled -= n
+	if !seg.recovered {
+		for i := 0; i < n; i++ {
+			c.private[i] = nil
+		}
+		c.private = c.private[n:]
+	}
+	seg.read = seg.written
+	c.removeSegment()
+}
+
+// removeSegment closes and deletes the oldest spill file. c.mu must be held.
+func (c *spillingClient) removeSegment() {
+	if c.readFile != nil {
+		c.readFile.Close()
+		c.readFile, c.reader = nil, nil
+	}
+	if len(c.segments) == 1 && c.writer != nil {
+		c.writer.Close()
+		c.writer = nil
+	}
+	if err := os.Remove(c.segments[0].path); err != nil && !os.IsNotExist(err) {
+		c.log.Warnf("Failed to remove replayed spill file: %v", err)
+	}
+	c.segments[0] = nil
+	c.segments = c.segments[1:]
+	c.notify()
+}
+
+// spill appends an event to the newest spill file. A new file is created if
+// no file is open for writing. c.mu must be held.
+func (c *spillingClient) spill(event Event) error {
+	payload, err := encodeSpillEvent(event.Fields)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	if c.writer == nil {
+		seg, f, err := c.createSegment(c.nextSeq)
+		if err != nil {
+			return err
+		}
+		c.nextSeq++
+		c.segments = append(c.segments, seg)
+		c.writer = f
+	}
+
+	seg := c.segments[len(c.segments)-1]
+	if _, err := c.writer.Write(appendSpillRecord(nil, payload)); err != nil {
+		// the file might end with a partial record, that must not be read
+		c.writer.Close()
+		c.writer = nil
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	seg.written++
+	c.spilled++
+	c.private = append(c.private, event.Private)
+
+	if seg.written >= spillSegmentEvents {
+		c.writer.Close()
+		c.writer = nil
+	}
+	return nil
+}
+
+// spillFront writes events to a new spill file, that is replayed before all
+// existing spill files. c.mu must be held, and all files must be closed.
+func (c *spillingClient) spillFront(events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	seq := c.nextSeq
+	if len(c.segments) > 0 {
+		seq = c.segments[0].seq - 1
+	}
+	_, f, err := c.createSegment(seq)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	for _, event := range events {
+		payload, err := encodeSpillEvent(event.Fields)
+		if err != nil {
+			c.log.Errorf("Failed to encode event, event is lost: %v", err)
+			c.dropped++
+			continue
+		}
+		if _, err := w.Write(appendSpillRecord(nil, payload)); err != nil {
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+	return nil
+}
+
+func (c *spillingClient) createSegment(seq uint64) (*spillSegment, *os.File, error) {
+	path := filepath.Join(c.dir, fmt.Sprintf("%v%020d%v", spillFilePrefix, seq, spillFileSuffix))
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create spill file: %w", err)
+	}
+	return &spillSegment{seq: seq, path: path}, f, nil
+}
+
+// closeFiles closes the files used for reading and writing. c.mu must be
+// held.
+func (c *spillingClient) closeFiles() {
+	if c.readFile != nil {
+		c.readFile.Close()
+		c.readFile, c.reader = nil, nil
+	}
+	if c.writer != nil {
+		c.writer.Close()
+		c.writer = nil
+	}
+}
+
+// recover loads the spill files found in the spill directory. Files are
+// replayed in order of their sequence number. Incomplete records at the end
+// of a file are ignored.
+func (c *spillingClient) recover() error {
+	if err := os.MkdirAll(c.dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spill directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, spillFilePrefix) || !strings.HasSuffix(name, spillFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spillFilePrefix), spillFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+
+		path := filepath.Join(c.dir, name)
+		n, err := countSpillRecords(path)
+		if err != nil {
+			return fmt.Errorf("failed to read spill file '%v': %w", path, err)
+		}
+		if n == 0 {
+			_ = os.Remove(path)
+			continue
+		}
+		c.segments = append(c.segments, &spillSegment{seq: seq, path: path, written: n, recovered: true})
+		c.spilled += n
+	}
+
+	sort.Slice(c.segments, func(i, j int) bool { return c.segments[i].seq < c.segments[j].seq })
+	if n := len(c.segments); n > 0 {
+		c.nextSeq = c.segments[n-1].seq + 1
+		c.log.Infof("Recovered %v spilled events from %v files", c.spilled, n)
+	}
+	return nil
+}
+
+// notify wakes up go-routines waiting for state changes, and updates the
+// backpressure signal. c.mu must be held.
+func (c *spillingClient) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+	c.backpressure.Update(len(c.mem) + c.spilled)
+}
+
+// countSpillRecords returns the number of complete records in a spill file.
+func countSpillRecords(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	n := 0
+	for {
+		_, err := readSpillRecord(r)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, errSpillRecordSize) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// encodeSpillEvent encodes the fields of an event with encoding/gob. If the
+// fields hold values of types not registered with encoding/gob, these values
+// are normalized by a JSON round trip first.
+func encodeSpillEvent(fields mapstr.M) ([]byte, error) {
+	var buf bytes.Buffer
+	err := gob.NewEncoder(&buf).Encode(fields)
+	if err == nil {
+		return buf.Bytes(), nil
+	}
+
+	normalized, err := normalizeSpillValue(fields)
+	if err != nil {
+		return nil, err
+	}
+	buf.Reset()
+	if err := gob.NewEncoder(&buf).Encode(normalized); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeSpillEvent(payload []byte, fields *mapstr.M) error {
+	return gob.NewDecoder(bytes.NewReader(payload)).Decode(fields)
+}
+
+// normalizeSpillValue returns a copy of value, with all values that can not
+// be encoded by encoding/gob converted into the types produced by
+// encoding/json. Integers are converted into int64 or uint64, such that
+// large values do not lose precision.
+func normalizeSpillValue(value interface{}) (interface{}, error) {
+	var err error
+	switch v := value.(type) {
+	case mapstr.M:
+		m := make(mapstr.M, len(v))
+		for key, nested := range v {
+			if m[key], err = normalizeSpillValue(nested); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			if m[key], err = normalizeSpillValue(nested); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	case []interface{}:
+		a := make([]interface{}, len(v))
+		for i, nested := range v {
+			if a[i], err = normalizeSpillValue(nested); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+
+	if gob.NewEncoder(io.Discard).Encode(&value) == nil {
+		return value, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var normalized interface{}
+	if err := dec.Decode(&normalized); err != nil {
+		return nil, err
+	}
+	return restoreJSONNumbers(normalized), nil
+}
+
+// restoreJSONNumbers replaces the json.Number values decoded by
+// normalizeSpillValue with int64, uint64, or float64 values.
+func restoreJSONNumbers(value interface{}) interface{} {
+	switch v := value.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(string(v), 10, 64); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = restoreJSONNumbers(nested)
+		}
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = restoreJSONNumbers(nested)
+		}
+	}
+	return value
+}
+
+var errSpillRecordSize = errors.New("spill record exceeds maximum size")
+
+func appendSpillRecord(buf, payload []byte) []byte {
+	var prefix [4]byte
+	binary.BigEndian.PutUint32(prefix[:], uint32(len(payload)))
+	buf = append(buf, prefix[:]...)
+	return append(buf, payload...)
+}
+
+func readSpillRecord(r io.Reader) ([]byte, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[:])
+	if size > spillMaxRecordSize {
+		return nil, errSpillRecordSize
+	}
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+	return payload, nil
+}
@@ -0,0 +1,233 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package publisher
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// spillTestClient records published events. PublishChecked blocks while the
+// client is paused, and fails with ErrClientClosed once the client is closed.
+type spillTestClient struct {
+	Client // not implemented methods panic
+
+	mu        sync.Mutex
+	published []Event
+	closed    bool
+	resume    chan struct{}
+}
+
+func newSpillTestClient(paused bool) *spillTestClient {
+	c := &spillTestClient{resume: make(chan struct{})}
+	if !paused {
+		close(c.resume)
+	}
+	return c
+}
+
+func (c *spillTestClient) PublishChecked(event Event) (PublishResult, error) {
+	c.mu.Lock()
+	resume := c.resume
+	c.mu.Unlock()
+	<-resume
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closed {
+		return Dropped, ErrClientClosed
+	}
+	c.published = append(c.published, event)
+	return Accepted, nil
+}
+
+func (c *spillTestClient) Resume() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	close(c.resume)
+}
+
+func (c *spillTestClient) Events() []Event {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Event(nil), c.published...)
+}
+
+func (c *spillTestClient) Flush(context.Context) error { return nil }
+
+func (c *spillTestClient) Metrics() ClientMetrics { return ClientMetrics{} }
+
+func (c *spillTestClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	select {
+	case <-c.resume:
+	default:
+		close(c.resume) // unblock the publishing go-routine
+	}
+	return nil
+}
+
+func TestSpillingClient(t *testing.T) {
+	event := func(i int) Event { return Event{Fields: mapstr.M{"i": i}, Private: i} }
+	ids := func(events []Event) []float64 {
+		var ids []float64
+		for _, e := range events {
+			switch v := e.Fields["i"].(type) {
+			case int:
+				ids = append(ids, float64(v))
+			case float64:
+				ids = append(ids, v)
+			}
+		}
+		return ids
+	}
+	spillFiles := func(t *testing.T, dir string) []string {
+		files, err := filepath.Glob(filepath.Join(dir, spillFilePrefix+"*"))
+		require.NoError(t, err)
+		return files
+	}
+
+	t.Run("events exceeding the memory limit are spilled and replayed in order", func(t *testing.T) {
+		dir := t.TempDir()
+		inner := newSpillTestClient(true)
+		client, err := NewSpillingClient(inner, dir, 2)
+		require.NoError(t, err)
+
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+		client.PublishAll([]Event{event(1), event(2), event(3), event(4)})
+		require.Equal(t, 4, client.Metrics().Buffered)
+		require.Len(t, spillFiles(t, dir), 1)
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []float64{0, 1, 2, 3, 4}, ids(inner.Events()))
+		require.Equal(t, 4, inner.Events()[4].Private, "Private of spilled events must be retained")
+		require.Empty(t, spillFiles(t, dir))
+
+		// memory buffer is used again, once all events have been replayed
+		client.Publish(event(5))
+		require.NoError(t, client.Flush(context.Background()))
+		require.Empty(t, spillFiles(t, dir))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("backpressure is signaled while events are buffered above the memory limit", func(t *testing.T) {
+		isClosed := func(ch <-chan struct{}) bool {
+			select {
+			case <-ch:
+				return true
+			default:
+				return false
+			}
+		}
+
+		dir := t.TempDir()
+		inner := newSpillTestClient(true)
+		client, err := NewSpillingClient(inner, dir, 4)
+		require.NoError(t, err)
+
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+
+		ch := client.Backpressure()
+		client.PublishAll([]Event{event(1), event(2), event(3)})
+		require.False(t, isClosed(ch), "buffer is below the high water mark")
+		client.PublishAll([]Event{event(4), event(5), event(6)})
+		require.True(t, isClosed(ch), "buffer has reached the high water mark")
+		require.Len(t, spillFiles(t, dir), 1, "events are still accepted under backpressure")
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		require.False(t, isClosed(client.Backpressure()), "buffer has been drained")
+		require.Equal(t, []float64{0, 1, 2, 3, 4, 5, 6}, ids(inner.Events()))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("buffered events are recovered after restart", func(t *testing.T) {
+		dir := t.TempDir()
+		inner := newSpillTestClient(true)
+		client, err := NewSpillingClient(inner, dir, 2)
+		require.NoError(t, err)
+
+		client.Publish(event(0))
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+		for i := 1; i < 6; i++ {
+			client.Publish(event(i))
+		}
+		require.NoError(t, client.Close())
+		require.Empty(t, inner.Events())
+		require.ErrorIs(t, client.PublishBatch([]Event{event(6)}), ErrClientClosed)
+
+		inner = newSpillTestClient(false)
+		client, err = NewSpillingClient(inner, dir, 2)
+		require.NoError(t, err)
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []float64{0, 1, 2, 3, 4, 5}, ids(inner.Events()))
+		require.Empty(t, spillFiles(t, dir))
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("replayed events keep field types", func(t *testing.T) {
+		type custom struct{ N int64 }
+		ts := time.Date(2022, 3, 4, 5, 6, 7, 89, time.UTC)
+		fields := mapstr.M{
+			"@timestamp": ts,
+			"big":        int64(1<<60 + 1),
+			"unsigned":   uint64(1<<64 - 1),
+			"nested":     mapstr.M{"list": []interface{}{"a", int64(1), nil}},
+		}
+
+		dir := t.TempDir()
+		inner := newSpillTestClient(true)
+		client, err := NewSpillingClient(inner, dir, 1)
+		require.NoError(t, err)
+
+		client.Publish(Event{Fields: mapstr.M{"i": 0}})
+		require.Eventually(t, func() bool { return client.Metrics().Buffered == 0 }, time.Second, time.Millisecond)
+		client.Publish(Event{Fields: fields.Clone()})
+		client.Publish(Event{Fields: mapstr.M{"value": custom{N: 1<<60 + 1}, "@timestamp": ts}})
+		require.Len(t, spillFiles(t, dir), 1)
+
+		inner.Resume()
+		require.NoError(t, client.Flush(context.Background()))
+		events := inner.Events()
+		require.Len(t, events, 3)
+		require.Equal(t, fields, events[1].Fields)
+		require.Equal(t, mapstr.M{"value": map[string]interface{}{"N": int64(1<<60 + 1)}, "@timestamp": ts}, events[2].Fields,
+			"values of unregistered types are normalized")
+		require.NoError(t, client.Close())
+	})
+
+	t.Run("incomplete records are ignored on recovery", func(t *testing.T) {
+		dir := t.TempDir()
+		var buf []byte
+		for i := 1; i <= 3; i++ {
+			payload, err := encodeSpillEvent(mapstr.M{"i": i})
+			require.NoError(t, err)
+			buf = appendSpillRecord(buf, payload)
+		}
+		buf = buf[:len(buf)-5]
+		path := filepath.Join(dir, spillFilePrefix+"00000000000000000001"+spillFileSuffix)
+		require.NoError(t, os.WriteFile(path, buf, 0o600))
+
+		inner := newSpillTestClient(false)
+		client, err := NewSpillingClient(inner, dir, 2)
+		require.NoError(t, err)
+		require.NoError(t, client.Flush(context.Background()))
+		require.Equal(t, []float64{1, 2}, ids(inner.Events()))
+		require.NoError(t, client.Close())
+	})
+}
@@ -5,6 +5,9 @@
 package testing
 
 import (
+	"context"
+	"time"
+
 	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
 	"github.com/elastic/elastic-agent-libs/atomic"
 )
@@ -30,6 +33,40 @@ type FakeClient struct {
 	// If set PublishFunc is called for each event that is published by a producer.
 	PublishFunc func(publisher.Event)
 
+	// If set TryPublishFunc is called for each event passed to TryPublish.
+	// Otherwise the event is passed to Publish and reported as accepted.
+	TryPublishFunc func(publisher.Event) bool
+
+	// If set PublishBatchFunc is called for each batch passed to
+	// PublishBatch. Otherwise the events are passed to PublishAll.
+	PublishBatchFunc func([]publisher.Event) error
+
+	// If set PublishCheckedFunc is called for each event passed to
+	// PublishChecked. Otherwise the event is passed to Publish and reported as
+	// accepted.
+	PublishCheckedFunc func(publisher.Event) (publisher.PublishResult, error)
+
+	// If set PublishDeadlineFunc is called for each event passed to
+	// PublishDeadline. Otherwise the event is passed to Publish and nil is
+	// returned.
+	PublishDeadlineFunc func(publisher.Event, time.Time) error
+
+	// If set PublishWaitFunc is called for each event passed to PublishWait.
+	// Otherwise the event is passed to Publish and assumed to be ACKed.
+	PublishWaitFunc func(context.Context, publisher.Event) error
+
+	// If set FlushFunc is called on Flush. Otherwise Flush returns the
+	// context error.
+	FlushFunc func(context.Context) error
+
+	// If set MetricsFunc is called on Metrics. Otherwise Metrics returns zero
+	// metrics.
+	MetricsFunc func() publisher.ClientMetrics
+
+	// If set BackpressureFunc is called on Backpressure. Otherwise
+	// Backpressure returns nil, never signaling backpressure.
+	BackpressureFunc func() <-chan struct{}
+
 	// If set CloseFunc is called on Close. Otherwise Close returns nil.
 	CloseFunc func() error
 }
@@ -54,6 +91,83 @@ func (c *FakeClient) Publish(event publisher.Event) {
 	}
 }
 
+// TryPublish calls TryPublishFunc, if TryPublishFunc is not nil. Otherwise
+// the event is forwarded to Publish and true is returned.
+func (c *FakeClient) TryPublish(event publisher.Event) bool {
+	if c.TryPublishFunc != nil {
+		return c.TryPublishFunc(event)
+	}
+	c.Publish(event)
+	return true
+}
+
+// PublishBatch calls PublishBatchFunc, if PublishBatchFunc is not nil.
+// Otherwise the events are forwarded to PublishAll and nil is returned.
+func (c *FakeClient) PublishBatch(events []publisher.Event) error {
+	if c.PublishBatchFunc != nil {
+		return c.PublishBatchFunc(events)
+	}
+	c.PublishAll(events)
+	return nil
+}
+
+// PublishChecked calls PublishCheckedFunc, if PublishCheckedFunc is not nil.
+// Otherwise the event is forwarded to Publish and reported as accepted.
+func (c *FakeClient) PublishChecked(event publisher.Event) (publisher.PublishResult, error) {
+	if c.PublishCheckedFunc != nil {
+		return c.PublishCheckedFunc(event)
+	}
+	c.Publish(event)
+	return publisher.Accepted, nil
+}
+
+// PublishWait calls PublishWaitFunc, if PublishWaitFunc is not nil. Otherwise
+// the event is forwarded to Publish and the context error is returned.
+func (c *FakeClient) PublishWait(ctx context.Context, event publisher.Event) error {
+	if c.PublishWaitFunc != nil {
+		return c.PublishWaitFunc(ctx, event)
+	}
+	c.Publish(event)
+	return ctx.Err()
+}
+
+// PublishDeadline calls PublishDeadlineFunc, if PublishDeadlineFunc is not
+// nil. Otherwise the event is forwarded to Publish and nil is returned.
+func (c *FakeClient) PublishDeadline(event publisher.Event, deadline time.Time) error {
+	if c.PublishDeadlineFunc != nil {
+		return c.PublishDeadlineFunc(event, deadline)
+	}
+	c.Publish(event)
+	return nil
+}
+
+// Flush calls FlushFunc, if FlushFunc is not nil. Otherwise the context
+// error is returned.
+func (c *FakeClient) Flush(ctx context.Context) error {
+	if c.FlushFunc != nil {
+		return c.FlushFunc(ctx)
+	}
+	return ctx.Err()
+}
+
+// Metrics calls MetricsFunc, if MetricsFunc is not nil. Otherwise an empty
+// ClientMetrics is returned.
+func (c *FakeClient) Metrics() publisher.ClientMetrics {
+	if c.MetricsFunc == nil {
+		return publisher.ClientMetrics{}
+	}
+	return c.MetricsFunc()
+}
+
+// Backpressure calls BackpressureFunc, if BackpressureFunc is not nil.
+// Otherwise nil is returned.
+func (c *FakeClient) Backpressure() <-chan struct{} {
+	if c.BackpressureFunc == nil {
+		return nil
+	}
+	return c.BackpressureFunc()
+}
+
 // Close calls CloseFunc, if CloseFunc is not nil. Otherwise it returns nil.
 func (c *FakeClient) Close() error {
 	if c.CloseFunc == nil {
@@ -62,6 +176,11 @@ func (c *FakeClient) Close() error {
 	return c.CloseFunc()
 }
 
+// CloseWithTimeout calls Close. FakeClient does not track pending events.
+func (c *FakeClient) CloseWithTimeout(_ context.Context) error {
+	return c.Close()
+}
+
 // PublishAll calls PublishFunc for each event in the given slice.
 func (c *FakeClient) PublishAll(events []publisher.Event) {
 	for _, event := range events {
@@ -69,6 +188,18 @@ func (c *FakeClient) PublishAll(events []publisher.Event) {
 	}
 }
 
+// PublishAllContext calls Publish for each event in the given slice until
+// ctx is cancelled.
+func (c *FakeClient) PublishAllContext(ctx context.Context, events []publisher.Event) (int, error) {
+	for i, event := range events {
+		if err := ctx.Err(); err != nil {
+			return i, err
+		}
+		c.Publish(event)
+	}
+	return len(events), nil
+}
+
 // FailingConnector creates a pipeline that will always fail with the
 // configured error value.
 func FailingConnector(err error) publisher.PipelineConnector {
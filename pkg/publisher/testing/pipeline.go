@@ -0,0 +1,696 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package testing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher/acker"
+)
+
+// TestPipeline implements the publisher.Pipeline interface. All events
+// published by its clients are recorded and can be read via Events.
+// Clients run the processors, the ACKer, and the ClientEventer passed via
+// the ClientConfig, such that inputs can be tested with their full
+// publishing setup.
+//
+// If AutoACK is set, events are ACKed immediately after they have been
+// published. Otherwise events must be ACKed via ACK.
+//
+// Clients honor the ValidateEvents and IdleTimeout settings of the
+// ClientConfig.
+//
+// Clients honor the WaitClose setting of the ClientConfig. Events passed to
+// the client before Close, that are still being processed, are accounted
+// for as active events, such that Close waits for them to be published and
+// ACKed.
+//
+// If QueueSize is set, clients honor the PublishMode of the ClientConfig.
+// Events published with DropIfFull or AtMostOnce are dropped while the queue
+// is full, all other events are blocked until the queue has space available.
+// Output failures can be simulated via Fail and Reject. Events that are not
+// retried are reported as failed to ACKers implementing PartialACKer.
+type TestPipeline struct {
+	AutoACK bool
+
+	// QueueSize limits the number of published events that have not been
+	// ACKed yet. The queue is unbounded if QueueSize is not positive, or if
+	// AutoACK is set.
+	QueueSize int
+
+	mu       sync.Mutex
+	events   []publisher.Event
+	pending  []queuedEvent // published events not yet ACKed, in publishing order
+	reserved int           // queue space reserved for events about to be published
+	changed  chan struct{} // closed and replaced when events are removed from the queue
+}
+
+// queuedEvent is a published event waiting for its ACK.
+type queuedEvent struct {
+	client *testClient
+	event  publisher.Event
+}
+
+type testClient struct {
+	pipeline  *TestPipeline
+	acker     publisher.ACKer
+	eventer   publisher.ClientEventer
+	procs     publisher.ProcessorList
+	waitClose time.Duration
+	validate  bool
+	mode      publisher.PublishMode
+
+	deadLetter func(publisher.Event, error)
+
+	idleTimeout time.Duration
+	idleTimer   *time.Timer // nil if idleTimeout is not set
+
+	mu         sync.Mutex
+	closed     bool
+	idle       bool // closed after IdleTimeout, reconnects on publish
+	processing int  // events accepted by the client, that have not been published or filtered yet
+	published  uint64
+	dropped    uint64
+	filtered   uint64
+	invalid    uint64
+	acked      uint64
+	changed    chan struct{} // closed and replaced on ACKs, when events have been processed, or the client is closed
+}
+
+var _ publisher.Pipeline = (*TestPipeline)(nil)
+var _ publisher.Client = (*testClient)(nil)
+
+// NewTestPipeline creates a TestPipeline. Events are not ACKed automatically.
+func NewTestPipeline() *TestPipeline {
+	return &TestPipeline{}
+}
+
+// Connect creates a new client with an empty configuration.
+func (p *TestPipeline) Connect() (publisher.Client, error) {
+	return p.ConnectWith(publisher.ClientConfig{})
+}
+
+// ConnectWith creates a new client using the ACKer, ClientEventer, and
+// processors of cfg.
+func (p *TestPipeline) ConnectWith(cfg publisher.ClientConfig) (publisher.Client, error) {
+	c := &testClient{
+		pipeline:  p,
+		acker:     cfg.ACKHandler,
+		eventer:   cfg.Events,
+		procs:     cfg.Processing.Processor,
+		waitClose: cfg.WaitClose,
+		validate:  cfg.ValidateEvents,
+		mode:      cfg.PublishMode,
+		changed:   make(chan struct{}),
+
+		deadLetter: cfg.DeadLetterHandler,
+	}
+	if c.acker == nil {
+		c.acker = acker.Nil()
+	}
+	c.acker = acker.Batching(cfg.ACKBatchWindow, c.acker)
+	if cfg.IdleTimeout > 0 {
+		c.idleTimeout = cfg.IdleTimeout
+		c.idleTimer = time.AfterFunc(cfg.IdleTimeout, c.onIdle)
+	}
+	return c, nil
+}
+
+// Events returns a copy of all events published by all clients.
+func (p *TestPipeline) Events() []publisher.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]publisher.Event(nil), p.events...)
+}
+
+// ACK ACKs the n oldest events that have not been ACKed yet. The ACKers of
+// the clients that have published the events are called.
+func (p *TestPipeline) ACK(n int) {
+	p.mu.Lock()
+	if n > len(p.pending) {
+		n = len(p.pending)
+	}
+	events := p.pending[:n]
+	p.pending = p.pending[n:]
+	p.notify()
+	p.mu.Unlock()
+
+	ackEvents(events, false)
+}
+
+// Fail simulates the outputs failing to send the n oldest events that have
+// not been ACKed yet. Events published with AtMostOnce are not retried, and
+// are ACKed as failed. All other events are kept in the queue to be retried, and must
+// still be ACKed via ACK.
+func (p *TestPipeline) Fail(n int) {
+	ackEvents(p.remove(n, func(e queuedEvent) bool {
+		return e.client.mode == publisher.AtMostOnce
+	}), true)
+}
+
+// Reject simulates the outputs permanently rejecting the n oldest events
+// that have not been ACKed yet. Events published with DeadLetter are passed
+// to the DeadLetterHandler of the client, and are ACKed as failed. Events
+// published with AtMostOnce are ACKed as failed. All other events are kept in the queue, like
+// with Fail.
+func (p *TestPipeline) Reject(n int, err error) {
+	events := p.remove(n, func(e queuedEvent) bool {
+		return e.client.mode == publisher.AtMostOnce || e.client.mode == publisher.DeadLetter
+	})
+	for _, e := range events {
+		if e.client.mode == publisher.DeadLetter && e.client.deadLetter != nil {
+			e.client.deadLetter(e.event, err)
+		}
+	}
+	ackEvents(events, true)
+}
+
+// remove removes the events matching drop from the n oldest events in the
+// queue, and returns them. The other events are kept in order, such that they
+// are retried first.
+func (p *TestPipeline) remove(n int, drop func(queuedEvent) bool) []queuedEvent {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if n > len(p.pending) {
+		n = len(p.pending)
+	}
+	var removed []queuedEvent
+	retry := make([]queuedEvent, 0, len(p.pending))
+	for _, e := range p.pending[:n] {
+		if drop(e) {
+			removed = append(removed, e)
+		} else {
+			retry = append(retry, e)
+		}
+	}
+	p.pending = append(retry, p.pending[n:]...)
+	p.notify()
+	return removed
+}
+
+// ackEvents ACKs events with the clients that have published them.
+// Consecutive events of the same client are ACKed at once.
+func ackEvents(events []queuedEvent, failed bool) {
+	for len(events) > 0 {
+		client, count := events[0].client, 1
+		for count < len(events) && events[count].client == client {
+			count++
+		}
+		client.ack(count, failed)
+		events = events[count:]
+	}
+}
+
+// reserve reserves space for a single event in the queue, which is consumed
+// by add. If the queue is full, ErrQueueFull is returned if the client drops
+// events on a full queue. Otherwise reserve waits until the queue has space
+// available, ctx is done, or the client has been closed.
+func (p *TestPipeline) reserve(ctx context.Context, client *testClient) error {
+	for {
+		p.mu.Lock()
+		if p.hasSpace(1) {
+			p.reserved++
+			p.mu.Unlock()
+			return nil
+		}
+		if p.changed == nil {
+			p.changed = make(chan struct{})
+		}
+		changed := p.changed
+		p.mu.Unlock()
+
+		if client.dropsIfFull() {
+			return publisher.ErrQueueFull
+		}
+
+		client.mu.Lock()
+		closed, clientChanged := client.closed, client.changed
+		client.mu.Unlock()
+		if closed {
+			return publisher.ErrClientClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		case <-clientChanged:
+		}
+	}
+}
+
+// hasSpace reports if the queue has space for n more events. p.mu must be
+// held.
+func (p *TestPipeline) hasSpace(n int) bool {
+	return p.AutoACK || p.QueueSize <= 0 || len(p.pending)+p.reserved+n <= p.QueueSize
+}
+
+// queueLen returns the number of events waiting for their ACK.
+func (p *TestPipeline) queueLen() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.pending)
+}
+
+// spaceAvailable reports if the queue has space for n more events.
+func (p *TestPipeline) spaceAvailable(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.hasSpace(n)
+}
+
+// notify wakes up go-routines waiting for space in the queue. p.mu must be
+// held.
+func (p *TestPipeline) notify() {
+	if p.changed != nil {
+		close(p.changed)
+		p.changed = nil
+	}
+}
+
+// add publishes event, consuming the queue space reserved via reserve.
+func (p *TestPipeline) add(client *testClient, event publisher.Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.reserved--
+	p.events = append(p.events, event)
+	if !p.AutoACK {
+		p.pending = append(p.pending, queuedEvent{client: client, event: event})
+	}
+}
+
+func (c *testClient) Publish(event publisher.Event) {
+	_, _ = c.PublishChecked(event)
+}
+
+// PublishAll accounts for all events as active before the first event is
+// processed, such that Close waits for the complete batch.
+func (c *testClient) PublishAll(events []publisher.Event) {
+	events = c.validEvents(events)
+	if !c.begin(events) {
+		return
+	}
+	for _, event := range events {
+		_, _ = c.process(context.Background(), event)
+	}
+}
+
+func (c *testClient) PublishAllContext(ctx context.Context, events []publisher.Event) (int, error) {
+	events = c.validEvents(events)
+	if !c.begin(events) {
+		return 0, publisher.ErrClientClosed
+	}
+	for i, event := range events {
+		if err := ctx.Err(); err != nil {
+			c.skip(len(events) - i)
+			return i, err
+		}
+		if result, _ := c.process(ctx, event); result == publisher.Dropped && ctx.Err() != nil {
+			c.skip(len(events) - i - 1)
+			return i, ctx.Err()
+		}
+	}
+	return len(events), nil
+}
+
+func (c *testClient) TryPublish(event publisher.Event) bool {
+	result, _ := c.PublishChecked(event)
+	return result != publisher.Dropped
+}
+
+// PublishBatch publishes all events. With DropIfFull or AtMostOnce no event
+// is published if the queue has no space for all events, and ErrQueueFull is
+// returned. The check is not atomic with respect to other clients publishing
+// concurrently.
+func (c *testClient) PublishBatch(events []publisher.Event) error {
+	events = c.validEvents(events)
+	if c.dropsIfFull() && !c.pipeline.spaceAvailable(len(events)) {
+		for _, event := range events {
+			c.reportDropped(event, publisher.DropReasonQueueFull)
+		}
+		return publisher.ErrQueueFull
+	}
+	if !c.begin(events) {
+		return publisher.ErrClientClosed
+	}
+	for _, event := range events {
+		_, _ = c.process(context.Background(), event)
+	}
+	return nil
+}
+
+func (c *testClient) PublishWait(ctx context.Context, event publisher.Event) error {
+	result, err := c.publish(ctx, event)
+	if err != nil || result != publisher.Accepted {
+		return err
+	}
+	return c.Flush(ctx)
+}
+
+// PublishDeadline publishes the event like PublishChecked. If the queue is
+// full, PublishDeadline waits for space until deadline, and returns
+// ErrPublishTimeout afterwards.
+func (c *testClient) PublishDeadline(event publisher.Event, deadline time.Time) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	_, err := c.publish(ctx, event)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return publisher.ErrPublishTimeout
+	}
+	return err
+}
+
+func (c *testClient) PublishChecked(event publisher.Event) (publisher.PublishResult, error) {
+	return c.publish(context.Background(), event)
+}
+
+// publish publishes a single event. If the queue is full, publish waits for
+// space until ctx is done, unless the client drops events on a full queue.
+func (c *testClient) publish(ctx context.Context, event publisher.Event) (publisher.PublishResult, error) {
+	if len(c.validEvents([]publisher.Event{event})) == 0 {
+		return publisher.Dropped, publisher.ErrInvalidEvent
+	}
+	if !c.begin([]publisher.Event{event}) {
+		return publisher.Dropped, publisher.ErrClientClosed
+	}
+	return c.process(ctx, event)
+}
+
+// dropsIfFull reports if the client drops events while the queue is full,
+// instead of waiting for space.
+func (c *testClient) dropsIfFull() bool {
+	return c.mode == publisher.DropIfFull || c.mode == publisher.AtMostOnce
+}
+
+// validEvents removes zero events from events, if the client has been
+// configured to validate events. Events is not modified.
+func (c *testClient) validEvents(events []publisher.Event) []publisher.Event {
+	if !c.validate {
+		return events
+	}
+
+	valid := make([]publisher.Event, 0, len(events))
+	for _, event := range events {
+		if !event.IsZero() {
+			valid = append(valid, event)
+		}
+	}
+	if skipped := len(events) - len(valid); skipped > 0 {
+		c.mu.Lock()
+		c.invalid += uint64(skipped)
+		c.mu.Unlock()
+	}
+	return valid
+}
+
+// begin accounts for events as being processed. If the client has been
+// closed, the events are dropped and false is returned.
+func (c *testClient) begin(events []publisher.Event) bool {
+	c.mu.Lock()
+	closed := c.closed
+	if !closed {
+		c.processing += len(events)
+		c.idle = false
+		if c.idleTimer != nil {
+			c.idleTimer.Reset(c.idleTimeout)
+		}
+	}
+	c.mu.Unlock()
+
+	if closed {
+		for _, event := range events {
+			c.reportDropped(event, publisher.DropReasonClientClosed)
+		}
+	}
+	return !closed
+}
+
+// reportDropped counts event as dropped, and informs the ClientEventer.
+func (c *testClient) reportDropped(event publisher.Event, reason string) {
+	c.mu.Lock()
+	c.dropped++
+	c.mu.Unlock()
+	publisher.ReportDropped(c.eventer, event, reason)
+}
+
+// onIdle closes the connection of the client after IdleTimeout. If events
+// are still active, closing is postponed, such that their ACKs are still
+// delivered.
+func (c *testClient) onIdle() {
+	c.mu.Lock()
+	if c.closed || c.idle {
+		c.mu.Unlock()
+		return
+	}
+	if c.active() > 0 {
+		c.idleTimer.Reset(c.idleTimeout)
+		c.mu.Unlock()
+		return
+	}
+	c.idle = true
+	c.mu.Unlock()
+
+	if c.eventer != nil {
+		c.eventer.Closing()
+		c.eventer.Closed()
+	}
+}
+
+// skip removes n events accounted for by begin, that will not be processed.
+func (c *testClient) skip(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.processing -= n
+	c.notify()
+}
+
+// runProcessors runs the processors in order, like the ProcessorList does.
+// If the event is dropped, the description of the processor that has dropped
+// the event, or that has failed, is returned as reason.
+func (c *testClient) runProcessors(event *publisher.Event) (*publisher.Event, string, error) {
+	for _, p := range c.procs.All() {
+		var err error
+		event, err = p.Run(event)
+		if err != nil {
+			return nil, p.String(), err
+		}
+		if event == nil {
+			return nil, p.String(), nil
+		}
+	}
+	return event, "", nil
+}
+
+// process runs the processors and publishes a single event accounted for by
+// begin. If the queue is full, the event is dropped or process waits for
+// space until ctx is done, depending on the publish mode.
+func (c *testClient) process(ctx context.Context, event publisher.Event) (publisher.PublishResult, error) {
+	out := &event
+	if c.procs != nil {
+		var err error
+		var reason string
+		out, reason, err = c.runProcessors(&event)
+		if err != nil || out == nil {
+			c.mu.Lock()
+			c.processing--
+			if err != nil {
+				c.dropped++
+			} else {
+				c.filtered++
+			}
+			c.notify()
+			c.mu.Unlock()
+			publisher.ReportFilteredOut(c.eventer, event, reason)
+			c.acker.AddEvent(event, false)
+			if err != nil {
+				return publisher.Dropped, err
+			}
+			return publisher.Filtered, nil
+		}
+	}
+
+	if err := c.pipeline.reserve(ctx, c); err != nil {
+		c.mu.Lock()
+		c.processing--
+		c.notify()
+		c.mu.Unlock()
+		switch {
+		case errors.Is(err, publisher.ErrQueueFull):
+			c.reportDropped(*out, publisher.DropReasonQueueFull)
+		case errors.Is(err, publisher.ErrClientClosed):
+			c.reportDropped(*out, publisher.DropReasonClientClosed)
+		}
+		return publisher.Dropped, err
+	}
+
+	c.mu.Lock()
+	c.processing--
+	c.published++
+	c.mu.Unlock()
+
+	c.acker.AddEvent(*out, true)
+	if c.eventer != nil {
+		c.eventer.Published()
+	}
+	c.pipeline.add(c, *out)
+	if c.pipeline.AutoACK {
+		c.ack(1, false)
+	}
+	return publisher.Accepted, nil
+}
+
+// Flush waits until all events published by the client have been ACKed.
+func (c *testClient) Flush(ctx context.Context) error {
+	c.mu.Lock()
+	target := c.published
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		acked, closed, changed := c.acked, c.closed, c.changed
+		c.mu.Unlock()
+
+		if acked >= target {
+			return nil
+		}
+		if closed {
+			return publisher.ErrClientClosed
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Backpressure returns nil, as the TestPipeline has no queue.
+func (c *testClient) Backpressure() <-chan struct{} { return nil }
+
+// Metrics reports the counters of the client. Events failing a processor are
+// counted as Dropped. QueueLen is the number of events of all clients waiting
+// for their ACK.
+func (c *testClient) Metrics() publisher.ClientMetrics {
+	queueLen := c.pipeline.queueLen()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return publisher.ClientMetrics{
+		Published:    c.published,
+		Dropped:      c.dropped,
+		Filtered:     c.filtered,
+		Invalid:      c.invalid,
+		ActiveEvents: c.active(),
+		QueueLen:     queueLen,
+	}
+}
+
+// Close closes the client. If WaitClose is configured, Close waits for the
+// events still being processed to be published, and for all published events
+// to be ACKed.
+func (c *testClient) Close() error {
+	if c.waitClose <= 0 {
+		return c.close(nil)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.waitClose)
+	defer cancel()
+	return c.close(ctx)
+}
+
+// CloseWithTimeout closes the client, waiting for active events until ctx is
+// done.
+func (c *testClient) CloseWithTimeout(ctx context.Context) error {
+	return c.close(ctx)
+}
+
+// close closes the client. Active events are waited for if ctx is not nil.
+func (c *testClient) close(ctx context.Context) error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return nil
+	}
+	c.closed = true
+	idle := c.idle
+	if c.idleTimer != nil {
+		c.idleTimer.Stop()
+	}
+	c.notify()
+	c.mu.Unlock()
+
+	// the eventer has been informed already if the client has been idle
+	eventer := c.eventer
+	if idle {
+		eventer = nil
+	}
+
+	if eventer != nil {
+		eventer.Closing()
+	}
+	var err error
+	if ctx != nil {
+		err = c.waitActive(ctx)
+	}
+	c.acker.Close()
+	if eventer != nil {
+		eventer.Closed()
+	}
+	return err
+}
+
+// waitActive waits until all events have been processed and ACKed, or ctx
+// is done.
+func (c *testClient) waitActive(ctx context.Context) error {
+	for {
+		c.mu.Lock()
+		pending, changed := c.active(), c.changed
+		c.mu.Unlock()
+
+		if pending == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return publisher.ErrCloseTimeout{Pending: pending}
+		case <-changed:
+		}
+	}
+}
+
+// active returns the number of events being processed or waiting for their
+// ACK. c.mu must be held.
+func (c *testClient) active() int {
+	return c.processing + int(c.published-c.acked)
+}
+
+// ack ACKs the n oldest events of the client. If failed is set, the events
+// are reported as failed to a PartialACKer.
+func (c *testClient) ack(n int, failed bool) {
+	if failed {
+		indices := make([]int, n)
+		for i := range indices {
+			indices[i] = i
+		}
+		acker.ACKIndexed(c.acker, nil, indices)
+	} else {
+		c.acker.ACKEvents(n)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.acked += uint64(n)
+	c.notify()
+}
+
+// notify wakes up go-routines waiting in Flush or Close. c.mu must be held.
+func (c *testClient) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
@@ -0,0 +1,610 @@
+// Copyright Elasticsearch B.V. and/or licensed to Elasticsearch B.V. under one
+// or more contributor license agreements. Licensed under the Elastic License;
+// you may not use this file except in compliance with the Elastic License.
+
+package testing
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher/acker"
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher/processors"
+)
+
+type countingEventer struct {
+	published, filtered, dropped, closed int
+}
+
+func (e *countingEventer) Closing()                         {}
+func (e *countingEventer) Closed()                          { e.closed++ }
+func (e *countingEventer) Published()                       { e.published++ }
+func (e *countingEventer) FilteredOut(publisher.Event)      { e.filtered++ }
+func (e *countingEventer) DroppedOnPublish(publisher.Event) { e.dropped++ }
+
+func TestTestPipelineRecordsEvents(t *testing.T) {
+	pipeline := NewTestPipeline()
+	eventer := &countingEventer{}
+	client, err := pipeline.ConnectWith(publisher.ClientConfig{
+		Events: eventer,
+		Processing: publisher.ProcessingConfig{
+			Processor: processors.NewList(processors.NewFilter("drop_odd", func(e *publisher.Event) bool {
+				return e.Private.(int)%2 == 0
+			})),
+		},
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		client.Publish(publisher.Event{Private: i})
+	}
+	assert.NoError(t, client.Close())
+	client.Publish(publisher.Event{Private: 4})
+
+	assert.Equal(t, []publisher.Event{{Private: 0}, {Private: 2}}, pipeline.Events())
+	assert.Equal(t, &countingEventer{published: 2, filtered: 2, dropped: 1, closed: 1}, eventer)
+	assert.Equal(t, publisher.ClientMetrics{Published: 2, Dropped: 1, Filtered: 2, ActiveEvents: 2, QueueLen: 2}, client.Metrics())
+}
+
+type reasonedEventer struct {
+	countingEventer
+	reasons []string
+}
+
+func (e *reasonedEventer) FilteredOutReason(_ publisher.Event, reason string) {
+	e.reasons = append(e.reasons, "filtered: "+reason)
+}
+
+func (e *reasonedEventer) DroppedReason(_ publisher.Event, reason string) {
+	e.reasons = append(e.reasons, "dropped: "+reason)
+}
+
+func TestTestPipelineDropReasons(t *testing.T) {
+	pipeline := NewTestPipeline()
+	eventer := &reasonedEventer{}
+	client, err := pipeline.ConnectWith(publisher.ClientConfig{
+		Events: eventer,
+		Processing: publisher.ProcessingConfig{
+			Processor: processors.NewList(
+				processors.NewFilter("drop_odd", func(e *publisher.Event) bool {
+					return e.Private.(int)%2 == 0
+				}),
+				processors.NewFilter("drop_two", func(e *publisher.Event) bool {
+					return e.Private.(int) != 2
+				}),
+			),
+		},
+	})
+	assert.NoError(t, err)
+
+	for i := 0; i < 4; i++ {
+		client.Publish(publisher.Event{Private: i})
+	}
+	assert.NoError(t, client.Close())
+	client.Publish(publisher.Event{Private: 4})
+
+	assert.Equal(t, []publisher.Event{{Private: 0}}, pipeline.Events())
+	assert.Equal(t, []string{
+		"filtered: drop_odd",
+		"filtered: drop_two",
+		"filtered: drop_odd",
+		"dropped: " + publisher.DropReasonClientClosed,
+	}, eventer.reasons)
+	assert.Equal(t, countingEventer{published: 1, closed: 1}, eventer.countingEventer)
+}
+
+func TestTestPipelineValidateEvents(t *testing.T) {
+	pipeline := NewTestPipeline()
+	pipeline.AutoACK = true
+
+	var acked int
+	client, err := pipeline.ConnectWith(publisher.ClientConfig{
+		ACKHandler:     acker.RawCounting(func(n int) { acked += n }),
+		ValidateEvents: true,
+	})
+	assert.NoError(t, err)
+
+	client.PublishAll([]publisher.Event{testEvent(), {}, testEvent()})
+	n, err := client.PublishAllContext(context.Background(), []publisher.Event{{Private: 1}, testEvent()})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	_, err = client.PublishChecked(publisher.Event{})
+	assert.ErrorIs(t, err, publisher.ErrInvalidEvent)
+	assert.False(t, client.TryPublish(publisher.Event{}))
+
+	assert.Len(t, pipeline.Events(), 3)
+	assert.Equal(t, 3, acked)
+	assert.Equal(t, publisher.ClientMetrics{Published: 3, Invalid: 4}, client.Metrics())
+}
+
+// syncEventer counts the close events of a client. It is safe for
+// concurrent use.
+type syncEventer struct {
+	countingEventer
+	mu sync.Mutex
+}
+
+func (e *syncEventer) Closing() {}
+func (e *syncEventer) Closed() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.closed++
+}
+
+func (e *syncEventer) closedCount() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
+
+func TestTestPipelineIdleTimeout(t *testing.T) {
+	pipeline := NewTestPipeline()
+	eventer := &syncEventer{}
+	var mu sync.Mutex
+	var acked int
+	client, err := pipeline.ConnectWith(publisher.ClientConfig{
+		Events:      eventer,
+		IdleTimeout: 20 * time.Millisecond,
+		ACKHandler: acker.RawCounting(func(n int) {
+			mu.Lock()
+			defer mu.Unlock()
+			acked += n
+		}),
+	})
+	assert.NoError(t, err)
+
+	// the idle close waits for pending ACKs
+	client.Publish(testEvent())
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, eventer.closedCount())
+	pipeline.ACK(1)
+	assert.Eventually(t, func() bool { return eventer.closedCount() == 1 }, time.Second, time.Millisecond)
+
+	// the client reconnects on publish
+	client.Publish(testEvent())
+	pipeline.ACK(1)
+	assert.Eventually(t, func() bool { return eventer.closedCount() == 2 }, time.Second, time.Millisecond)
+	assert.Len(t, pipeline.Events(), 2)
+	mu.Lock()
+	assert.Equal(t, 2, acked)
+	mu.Unlock()
+
+	// closing an idle client does not inform the eventer again
+	assert.NoError(t, client.Close())
+	assert.Equal(t, 2, eventer.closedCount())
+}
+
+func TestTestPipelineAutoACK(t *testing.T) {
+	pipeline := NewTestPipeline()
+	pipeline.AutoACK = true
+
+	var acked int
+	client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+		ACKHandler: acker.RawCounting(func(n int) { acked += n }),
+	})
+	client.PublishAll([]publisher.Event{testEvent(), testEvent()})
+	assert.Equal(t, 2, acked)
+	assert.NoError(t, client.PublishWait(context.Background(), testEvent()))
+	assert.Equal(t, 3, acked)
+}
+
+func TestTestPipelineACK(t *testing.T) {
+	pipeline := NewTestPipeline()
+
+	var acked1, acked2 int
+	client1, _ := pipeline.ConnectWith(publisher.ClientConfig{
+		ACKHandler: acker.RawCounting(func(n int) { acked1 += n }),
+	})
+	client2, _ := pipeline.ConnectWith(publisher.ClientConfig{
+		ACKHandler: acker.RawCounting(func(n int) { acked2 += n }),
+	})
+
+	client1.Publish(testEvent())
+	client2.Publish(testEvent())
+	client1.Publish(testEvent())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.True(t, errors.Is(client1.Flush(ctx), context.DeadlineExceeded))
+
+	pipeline.ACK(2)
+	assert.Equal(t, 1, acked1)
+	assert.Equal(t, 1, acked2)
+
+	done := make(chan error)
+	go func() { done <- client1.Flush(context.Background()) }()
+	pipeline.ACK(5)
+	assert.NoError(t, <-done)
+	assert.Equal(t, 2, acked1)
+	assert.Equal(t, 1, acked2)
+}
+
+func TestTestPipelineACKBatchWindow(t *testing.T) {
+	pipeline := NewTestPipeline()
+
+	var calls []int
+	client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+		ACKHandler:     acker.RawCounting(func(n int) { calls = append(calls, n) }),
+		ACKBatchWindow: time.Hour,
+	})
+
+	client.Publish(testEvent())
+	client.Publish(testEvent())
+	client.Publish(testEvent())
+	pipeline.ACK(1)
+	pipeline.ACK(2)
+	assert.Empty(t, calls)
+
+	assert.NoError(t, client.Close())
+	assert.Equal(t, []int{3}, calls)
+}
+
+// blockingProcessor blocks the first event until release is closed.
+type blockingProcessor struct {
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (p *blockingProcessor) String() string { return "blocking" }
+
+func (p *blockingProcessor) Run(event *publisher.Event) (*publisher.Event, error) {
+	p.once.Do(func() {
+		close(p.started)
+		<-p.release
+	})
+	return event, nil
+}
+
+func TestTestPipelineCloseWaitsForProcessing(t *testing.T) {
+	pipeline := NewTestPipeline()
+	pipeline.AutoACK = true
+
+	var mu sync.Mutex
+	var acked int
+	proc := &blockingProcessor{started: make(chan struct{}), release: make(chan struct{})}
+	client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+		WaitClose:  time.Second,
+		ACKHandler: acker.RawCounting(func(n int) { mu.Lock(); acked += n; mu.Unlock() }),
+		Processing: publisher.ProcessingConfig{Processor: processors.NewList(proc)},
+	})
+
+	events := make([]publisher.Event, 10)
+	go client.PublishAll(events)
+	<-proc.started
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(proc.release)
+	}()
+	assert.NoError(t, client.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, 10, acked)
+	assert.Len(t, pipeline.Events(), 10)
+	assert.Equal(t, 0, client.Metrics().ActiveEvents)
+}
+
+func TestTestPipelineCloseTimeout(t *testing.T) {
+	pipeline := NewTestPipeline()
+	client, _ := pipeline.ConnectWith(publisher.ClientConfig{WaitClose: 10 * time.Millisecond})
+
+	client.PublishAll([]publisher.Event{testEvent(), testEvent()})
+	pipeline.ACK(1)
+
+	var timeoutErr publisher.ErrCloseTimeout
+	assert.True(t, errors.As(client.Close(), &timeoutErr))
+	assert.Equal(t, 1, timeoutErr.Pending)
+}
+
+func TestTestPipelineCloseWithTimeout(t *testing.T) {
+	t.Run("return after deadline if ACK is blocked", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		client, _ := pipeline.ConnectWith(publisher.ClientConfig{WaitClose: time.Hour})
+		client.PublishAll([]publisher.Event{testEvent(), testEvent()})
+
+		const timeout = 20 * time.Millisecond
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		start := time.Now()
+		err := client.CloseWithTimeout(ctx)
+		elapsed := time.Since(start)
+
+		var timeoutErr publisher.ErrCloseTimeout
+		assert.True(t, errors.As(err, &timeoutErr))
+		assert.Equal(t, 2, timeoutErr.Pending)
+		assert.GreaterOrEqual(t, elapsed, timeout)
+		assert.Less(t, elapsed, time.Second, "WaitClose must not be used")
+	})
+
+	t.Run("return once all events are ACKed", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		client, _ := pipeline.ConnectWith(publisher.ClientConfig{})
+		client.PublishAll([]publisher.Event{testEvent(), testEvent()})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		go func() {
+			time.Sleep(10 * time.Millisecond)
+			pipeline.ACK(2)
+		}()
+		assert.NoError(t, client.CloseWithTimeout(ctx))
+		assert.Equal(t, 0, client.Metrics().ActiveEvents)
+	})
+}
+
+func TestTestPipelinePublishMode(t *testing.T) {
+	connect := func(pipeline *TestPipeline, mode publisher.PublishMode, eventer publisher.ClientEventer, acked *int) publisher.Client {
+		client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+			PublishMode: mode,
+			Events:      eventer,
+			ACKHandler:  acker.RawCounting(func(n int) { *acked += n }),
+		})
+		return client
+	}
+
+	t.Run("AtMostOnce drops events if the queue is full", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		pipeline.QueueSize = 1
+		eventer := &countingEventer{}
+		var acked int
+		client := connect(pipeline, publisher.AtMostOnce, eventer, &acked)
+
+		result, err := client.PublishChecked(testEvent())
+		assert.NoError(t, err)
+		assert.Equal(t, publisher.Accepted, result)
+
+		result, err = client.PublishChecked(testEvent())
+		assert.True(t, errors.Is(err, publisher.ErrQueueFull))
+		assert.Equal(t, publisher.Dropped, result)
+		assert.False(t, client.TryPublish(testEvent()))
+		assert.Len(t, pipeline.Events(), 1)
+		assert.Equal(t, 2, eventer.dropped)
+
+		pipeline.ACK(1)
+		assert.True(t, client.TryPublish(testEvent()))
+	})
+
+	t.Run("AtMostOnce ACKs failed events", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		var acked int
+		client := connect(pipeline, publisher.AtMostOnce, nil, &acked)
+
+		client.PublishAll([]publisher.Event{testEvent(), testEvent()})
+		pipeline.Fail(1)
+		assert.Equal(t, 1, acked)
+		pipeline.Fail(1)
+		assert.Equal(t, 2, acked)
+		assert.Equal(t, 0, client.Metrics().ActiveEvents)
+	})
+
+	t.Run("GuaranteedSend retries failed events", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		var acked int
+		client := connect(pipeline, publisher.GuaranteedSend, nil, &acked)
+
+		client.PublishAll([]publisher.Event{testEvent(), testEvent()})
+		pipeline.Fail(1)
+		assert.Equal(t, 0, acked)
+		pipeline.ACK(2)
+		assert.Equal(t, 2, acked)
+	})
+
+	t.Run("GuaranteedSend blocks if the queue is full", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		pipeline.QueueSize = 1
+		var acked int
+		client := connect(pipeline, publisher.GuaranteedSend, nil, &acked)
+		client.Publish(testEvent())
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		n, err := client.PublishAllContext(ctx, []publisher.Event{testEvent(), testEvent()})
+		assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		assert.Equal(t, 0, n)
+		assert.Equal(t, 1, client.Metrics().ActiveEvents)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			client.Publish(testEvent())
+		}()
+		pipeline.ACK(1)
+		<-done
+		assert.Len(t, pipeline.Events(), 2)
+	})
+
+	t.Run("blocked event is dropped on close", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		pipeline.QueueSize = 1
+		var acked int
+		client := connect(pipeline, publisher.GuaranteedSend, nil, &acked)
+		client.Publish(testEvent())
+
+		done := make(chan error)
+		go func() {
+			_, err := client.PublishChecked(testEvent())
+			done <- err
+		}()
+		assert.Eventually(t, func() bool { return client.Metrics().ActiveEvents == 2 }, time.Second, time.Millisecond)
+		assert.NoError(t, client.Close())
+		assert.True(t, errors.Is(<-done, publisher.ErrClientClosed))
+	})
+
+	t.Run("PublishBatch fails if the queue has no space for all events", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		pipeline.QueueSize = 2
+		var acked int
+		client := connect(pipeline, publisher.DropIfFull, nil, &acked)
+		client.Publish(testEvent())
+
+		err := client.PublishBatch([]publisher.Event{testEvent(), testEvent()})
+		assert.True(t, errors.Is(err, publisher.ErrQueueFull))
+		assert.Len(t, pipeline.Events(), 1)
+		assert.NoError(t, client.PublishBatch([]publisher.Event{testEvent()}))
+	})
+}
+
+func TestTestPipelineReject(t *testing.T) {
+	connect := func(pipeline *TestPipeline, mode publisher.PublishMode, deadLetters *[]error) publisher.Client {
+		client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+			PublishMode: mode,
+			DeadLetterHandler: func(event publisher.Event, err error) {
+				*deadLetters = append(*deadLetters, err)
+			},
+		})
+		return client
+	}
+	errRejected := errors.New("mapping conflict")
+
+	t.Run("DeadLetter passes rejected events to the handler", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		pipeline.QueueSize = 1
+		var deadLetters []error
+		client := connect(pipeline, publisher.DeadLetter, &deadLetters)
+		client.Publish(testEvent())
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			client.Publish(testEvent())
+		}()
+
+		pipeline.Reject(1, errRejected)
+		<-done
+		assert.Equal(t, []error{errRejected}, deadLetters)
+		assert.Len(t, pipeline.Events(), 2)
+		assert.Equal(t, 1, client.Metrics().ActiveEvents)
+	})
+
+	t.Run("DeadLetter retries failed events", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		var deadLetters []error
+		client := connect(pipeline, publisher.DeadLetter, &deadLetters)
+		client.Publish(testEvent())
+
+		pipeline.Fail(1)
+		assert.Empty(t, deadLetters)
+		assert.Equal(t, 1, client.Metrics().ActiveEvents)
+	})
+
+	t.Run("GuaranteedSend retries rejected events", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		var deadLetters []error
+		client := connect(pipeline, publisher.GuaranteedSend, &deadLetters)
+		client.Publish(testEvent())
+
+		pipeline.Reject(1, errRejected)
+		assert.Empty(t, deadLetters)
+		assert.Equal(t, 1, client.Metrics().ActiveEvents)
+	})
+}
+
+type failingProcessor struct{}
+
+func (failingProcessor) String() string { return "failing" }
+
+func (failingProcessor) Run(_ *publisher.Event) (*publisher.Event, error) {
+	return nil, errors.New("oops")
+}
+
+func TestTestPipelineMetrics(t *testing.T) {
+	t.Run("failed processor drops the event", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+			Processing: publisher.ProcessingConfig{
+				Processor: processors.NewList(failingProcessor{}),
+			},
+		})
+
+		result, err := client.PublishChecked(testEvent())
+		assert.Error(t, err)
+		assert.Equal(t, publisher.Dropped, result)
+		assert.Equal(t, publisher.ClientMetrics{Dropped: 1}, client.Metrics())
+	})
+
+	t.Run("events dropped on a full queue are counted", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		pipeline.QueueSize = 2
+		client, _ := pipeline.ConnectWith(publisher.ClientConfig{PublishMode: publisher.DropIfFull})
+
+		client.PublishAll([]publisher.Event{testEvent(), testEvent(), testEvent()})
+		assert.Equal(t, publisher.ClientMetrics{Published: 2, Dropped: 1, ActiveEvents: 2, QueueLen: 2}, client.Metrics())
+
+		pipeline.ACK(1)
+		assert.Equal(t, publisher.ClientMetrics{Published: 2, Dropped: 1, ActiveEvents: 1, QueueLen: 1}, client.Metrics())
+	})
+
+	t.Run("queue length includes all clients", func(t *testing.T) {
+		pipeline := NewTestPipeline()
+		client1, _ := pipeline.Connect()
+		client2, _ := pipeline.Connect()
+
+		client1.Publish(testEvent())
+		client2.Publish(testEvent())
+		assert.Equal(t, 2, client1.Metrics().QueueLen)
+	})
+}
+
+func TestTestPipelinePublishDeadline(t *testing.T) {
+	pipeline := NewTestPipeline()
+	pipeline.QueueSize = 1
+	client, _ := pipeline.ConnectWith(publisher.ClientConfig{PublishMode: publisher.GuaranteedSend})
+	assert.NoError(t, client.PublishDeadline(testEvent(), time.Now().Add(time.Second)))
+
+	const timeout = 20 * time.Millisecond
+	start := time.Now()
+	err := client.PublishDeadline(testEvent(), start.Add(timeout))
+	assert.True(t, errors.Is(err, publisher.ErrPublishTimeout))
+	assert.GreaterOrEqual(t, time.Since(start), timeout)
+	assert.Equal(t, publisher.ClientMetrics{Published: 1, ActiveEvents: 1, QueueLen: 1}, client.Metrics())
+
+	pipeline.ACK(1)
+	assert.NoError(t, client.PublishDeadline(testEvent(), time.Now().Add(time.Second)))
+}
+
+func TestTestPipelineFailedIndices(t *testing.T) {
+	pipeline := NewTestPipeline()
+
+	var acked, failed []int
+	client, _ := pipeline.ConnectWith(publisher.ClientConfig{
+		PublishMode: publisher.AtMostOnce,
+		ACKHandler: acker.Partial(func(a, f []int) {
+			acked = append(acked, a...)
+			failed = append(failed, f...)
+		}),
+	})
+	client.PublishAll([]publisher.Event{testEvent(), testEvent(), testEvent()})
+
+	pipeline.ACK(1)
+	pipeline.Fail(2)
+	assert.Equal(t, []int{0}, acked)
+	assert.Equal(t, []int{0, 1}, failed)
+}
+
+func TestTestPipelineCircuitBreaker(t *testing.T) {
+	pipeline := NewTestPipeline()
+	client, err := publisher.NewCircuitBreakerClient(pipeline, publisher.ClientConfig{
+		PublishMode: publisher.AtMostOnce,
+	}, 2, time.Hour)
+	assert.NoError(t, err)
+
+	client.PublishAll([]publisher.Event{testEvent(), testEvent(), testEvent()})
+	pipeline.ACK(1)
+	pipeline.Fail(1)
+	assert.Equal(t, publisher.CircuitClosed, client.State())
+
+	pipeline.Fail(1)
+	assert.Equal(t, publisher.CircuitOpen, client.State())
+	_, err = client.PublishChecked(testEvent())
+	assert.True(t, errors.Is(err, publisher.ErrCircuitOpen))
+	assert.Len(t, pipeline.Events(), 3)
+}
@@ -4,7 +4,13 @@
 
 package testing
 
-import "github.com/elastic/elastic-agent-inputs/pkg/publisher"
+import (
+	"context"
+	"time"
+
+	"github.com/elastic/elastic-agent-inputs/pkg/publisher"
+	"github.com/elastic/elastic-agent-libs/atomic"
+)
 
 // ChanClient implements Client interface, forwarding published events to some
 
@@ -17,6 +23,8 @@ type ChanClient struct {
 	done            chan struct{}
 	Channel         chan publisher.Event
 	publishCallback func(event publisher.Event)
+	published       atomic.Uint64
+	backpressure    *publisher.BackpressureSignal
 }
 
 func PublisherWithClient(client publisher.Client) publisher.Pipeline {
@@ -47,8 +55,9 @@ func NewChanClientWith(ch chan publisher.Event) *ChanClient {
 		ch = make(chan publisher.Event, 1)
 	}
 	c := &ChanClient{
-		done:    make(chan struct{}),
-		Channel: ch,
+		done:         make(chan struct{}),
+		Channel:      ch,
+		backpressure: publisher.NewBackpressureSignal(publisher.DefaultBackpressureConfig, cap(ch)),
 	}
 	return c
 }
@@ -58,16 +67,76 @@ func (c *ChanClient) Close() error {
 	return nil
 }
 
+// CloseWithTimeout closes the client. ChanClient does not track pending events.
+func (c *ChanClient) CloseWithTimeout(_ context.Context) error {
+	return c.Close()
+}
+
 // PublishEvent will publish the event on the channel. Options will be ignored.
 // Always returns true.
 func (c *ChanClient) Publish(event publisher.Event) {
 	select {
 	case <-c.done:
 	case c.Channel <- event:
-		if c.publishCallback != nil {
-			c.publishCallback(event)
-			<-c.Channel
-		}
+		c.onPublished(event)
+	}
+}
+
+// TryPublish publishes the event on the channel without blocking. False is
+// returned if the channel is full or the client has been closed.
+func (c *ChanClient) TryPublish(event publisher.Event) bool {
+	select {
+	case <-c.done:
+		return false
+	default:
+	}
+
+	select {
+	case c.Channel <- event:
+		c.onPublished(event)
+		return true
+	default:
+		return false
+	}
+}
+
+// PublishBatch publishes all events on the channel if the channel has space
+// for all events, otherwise ErrQueueFull is returned without publishing any
+// event. The check is not atomic with respect to other go-routines
+// publishing on the same channel concurrently.
+func (c *ChanClient) PublishBatch(events []publisher.Event) error {
+	select {
+	case <-c.done:
+		return publisher.ErrClientClosed
+	default:
+	}
+
+	if cap(c.Channel)-len(c.Channel) < len(events) {
+		return publisher.ErrQueueFull
+	}
+	for _, event := range events {
+		c.Channel <- event
+		c.onPublished(event)
+	}
+	return nil
+}
+
+// PublishChecked publishes the event on the channel. The event is reported
+// as dropped, with ErrClientClosed, if the client is closed before the event
+// could be written.
+func (c *ChanClient) PublishChecked(event publisher.Event) (publisher.PublishResult, error) {
+	select {
+	case <-c.done:
+		return publisher.Dropped, publisher.ErrClientClosed
+	default:
+	}
+
+	select {
+	case <-c.done:
+		return publisher.Dropped, publisher.ErrClientClosed
+	case c.Channel <- event:
+		c.onPublished(event)
+		return publisher.Accepted, nil
 	}
 }
 
@@ -77,6 +146,97 @@ func (c *ChanClient) PublishAll(event []publisher.Event) {
 	}
 }
 
+// PublishAllContext publishes the events on the channel until ctx is cancelled
+// or the client has been closed.
+func (c *ChanClient) PublishAllContext(ctx context.Context, events []publisher.Event) (int, error) {
+	for i, event := range events {
+		select {
+		case <-ctx.Done():
+			return i, ctx.Err()
+		case <-c.done:
+			return i, nil
+		case c.Channel <- event:
+			c.onPublished(event)
+		}
+	}
+	return len(events), nil
+}
+
+// PublishWait publishes the event on the channel. The event is assumed to be
+// ACKed once it has been written to the channel. ErrClientClosed is returned
+// if the client is closed before the event could be written.
+func (c *ChanClient) PublishWait(ctx context.Context, event publisher.Event) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.done:
+		return publisher.ErrClientClosed
+	case c.Channel <- event:
+		c.onPublished(event)
+		return nil
+	}
+}
+
+// PublishDeadline publishes the event on the channel. ErrPublishTimeout is
+// returned if the channel has no space available before deadline.
+func (c *ChanClient) PublishDeadline(event publisher.Event, deadline time.Time) error {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+
+	select {
+	case <-c.done:
+		return publisher.ErrClientClosed
+	default:
+	}
+
+	select {
+	case <-c.done:
+		return publisher.ErrClientClosed
+	case c.Channel <- event:
+		c.onPublished(event)
+		return nil
+	case <-timer.C:
+		return publisher.ErrPublishTimeout
+	}
+}
+
+// Flush returns immediately, as events are assumed to be ACKed once they have
+// been written to the channel. ErrClientClosed is returned if the client has
+// been closed.
+func (c *ChanClient) Flush(ctx context.Context) error {
+	select {
+	case <-c.done:
+		return publisher.ErrClientClosed
+	default:
+		return ctx.Err()
+	}
+}
+
+// Metrics reports the number of events published on the channel. QueueLen
+// reports the number of events in the channel not yet received.
+func (c *ChanClient) Metrics() publisher.ClientMetrics {
+	return publisher.ClientMetrics{
+		Published: c.published.Load(),
+		QueueLen:  len(c.Channel),
+	}
+}
+
+// Backpressure signals backpressure while the channel is filled above the
+// thresholds of DefaultBackpressureConfig.
+func (c *ChanClient) Backpressure() <-chan struct{} {
+	return c.backpressure.Update(len(c.Channel))
+}
+
+// onPublished updates the client state after event has been written to the channel.
+func (c *ChanClient) onPublished(event publisher.Event) {
+	c.published.Inc()
+	c.backpressure.Update(len(c.Channel))
+	if c.publishCallback != nil {
+		c.publishCallback(event)
+		<-c.Channel
+	}
+}
+
 func (c *ChanClient) ReceiveEvent() publisher.Event {
 	return <-c.Channel
 }
@@ -5,7 +5,9 @@
 package testing
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -43,3 +45,133 @@ func TestChanClientPublishEvents(t *testing.T) {
 	assert.Equal(t, e1, cc.ReceiveEvent())
 	assert.Equal(t, e2, cc.ReceiveEvent())
 }
+
+// Test that ChanClient only accepts events if the Channel has space available.
+func TestChanClientTryPublish(t *testing.T) {
+	cc := NewChanClient(1)
+
+	e1, e2 := testEvent(), testEvent()
+	assert.True(t, cc.TryPublish(e1))
+	assert.False(t, cc.TryPublish(e2))
+	assert.Equal(t, e1, cc.ReceiveEvent())
+
+	assert.NoError(t, cc.Close())
+	assert.False(t, cc.TryPublish(e2))
+}
+
+// Test that ChanClient stops publishing events once the context is cancelled.
+func TestChanClientPublishAllContext(t *testing.T) {
+	cc := NewChanClient(1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	e1, e2 := testEvent(), testEvent()
+	go func() {
+		assert.Equal(t, e1, cc.ReceiveEvent())
+		cancel()
+	}()
+
+	n, err := cc.PublishAllContext(ctx, []publisher.Event{e1, e2, testEvent()})
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.LessOrEqual(t, n, 2)
+	assert.GreaterOrEqual(t, n, 1)
+}
+
+// Test that ChanClient reports published events and the channel length.
+func TestChanClientMetrics(t *testing.T) {
+	cc := NewChanClient(2)
+	cc.PublishAll([]publisher.Event{testEvent(), testEvent()})
+	assert.Equal(t, publisher.ClientMetrics{Published: 2, QueueLen: 2}, cc.Metrics())
+
+	cc.ReceiveEvent()
+	assert.Equal(t, publisher.ClientMetrics{Published: 2, QueueLen: 1}, cc.Metrics())
+}
+
+// Test that ChanClient PublishWait returns once the event is written or the client is closed.
+func TestChanClientPublishWait(t *testing.T) {
+	cc := NewChanClient(1)
+
+	e1 := testEvent()
+	assert.NoError(t, cc.PublishWait(context.Background(), e1))
+	assert.Equal(t, e1, cc.ReceiveEvent())
+
+	cc.Publish(testEvent())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, cc.PublishWait(ctx, testEvent()), context.Canceled)
+
+	assert.NoError(t, cc.Close())
+	assert.ErrorIs(t, cc.PublishWait(context.Background(), testEvent()), publisher.ErrClientClosed)
+}
+
+func TestChanClientPublishChecked(t *testing.T) {
+	cc := NewChanClient(1)
+
+	e1 := testEvent()
+	result, err := cc.PublishChecked(e1)
+	assert.NoError(t, err)
+	assert.Equal(t, publisher.Accepted, result)
+	assert.Equal(t, e1, cc.ReceiveEvent())
+
+	assert.NoError(t, cc.Close())
+	result, err = cc.PublishChecked(testEvent())
+	assert.ErrorIs(t, err, publisher.ErrClientClosed)
+	assert.Equal(t, publisher.Dropped, result)
+}
+
+func TestChanClientPublishBatch(t *testing.T) {
+	cc := NewChanClient(2)
+
+	assert.ErrorIs(t, cc.PublishBatch([]publisher.Event{testEvent(), testEvent(), testEvent()}), publisher.ErrQueueFull)
+	assert.Equal(t, 0, len(cc.Channel))
+
+	assert.NoError(t, cc.PublishBatch([]publisher.Event{testEvent(), testEvent()}))
+	assert.Equal(t, 2, len(cc.Channel))
+
+	assert.NoError(t, cc.Close())
+	assert.ErrorIs(t, cc.PublishBatch([]publisher.Event{testEvent()}), publisher.ErrClientClosed)
+}
+
+func TestChanClientPublishDeadline(t *testing.T) {
+	cc := NewChanClient(1)
+
+	assert.NoError(t, cc.PublishDeadline(testEvent(), time.Now().Add(time.Second)))
+	assert.ErrorIs(t, cc.PublishDeadline(testEvent(), time.Now().Add(10*time.Millisecond)), publisher.ErrPublishTimeout)
+	assert.Equal(t, uint64(1), cc.Metrics().Published)
+
+	assert.NoError(t, cc.Close())
+	assert.ErrorIs(t, cc.PublishDeadline(testEvent(), time.Now().Add(time.Second)), publisher.ErrClientClosed)
+}
+
+func TestChanClientBackpressure(t *testing.T) {
+	cc := NewChanClient(10)
+	ch := cc.Backpressure()
+	for i := 0; i < 8; i++ {
+		select {
+		case <-ch:
+			t.Fatalf("backpressure signaled after %v events", i)
+		default:
+		}
+		cc.Publish(testEvent())
+	}
+
+	// publishing the 8th event has signaled backpressure
+	<-ch
+
+	for i := 0; i < 4; i++ {
+		cc.ReceiveEvent()
+	}
+	select {
+	case <-cc.Backpressure():
+		t.Fatal("backpressure not released below low water mark")
+	default:
+	}
+}
+
+func TestChanClientFlush(t *testing.T) {
+	cc := NewChanClient(1)
+	cc.Publish(testEvent())
+	assert.NoError(t, cc.Flush(context.Background()))
+
+	assert.NoError(t, cc.Close())
+	assert.ErrorIs(t, cc.Flush(context.Background()), publisher.ErrClientClosed)
+}
@@ -89,7 +89,11 @@ const (
 	activeDataTmpFileName = "active.dat.new"
 	checkpointTmpFileName = "checkpoint.new"
 
-	storeVersion = "1"
+	// storeVersion 2 adds the set_all operation to the update log. Stores
+	// of version 1 are upgraded when opened, such that older readers reject
+	// the store, instead of failing on the unknown operation.
+	storeVersion  = "2"
+	storeVersion1 = "1"
 
 	keyField = "_key"
 )
@@ -214,6 +218,31 @@ func (s *diskstore) Close() error {
 	return nil
 }
 
+// Size returns the size in bytes of the update log file, and of the active
+// data file written by the last checkpoint. Missing files have size 0.
+func (s *diskstore) Size() (logSize, checkpointSize int64, err error) {
+	if logSize, err = fileSize(s.logFilePath); err != nil {
+		return 0, 0, err
+	}
+	if s.activeDataFile.path != "" {
+		if checkpointSize, err = fileSize(s.activeDataFile.path); err != nil {
+			return 0, 0, err
+		}
+	}
+	return logSize, checkpointSize, nil
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
 // log operation adds another entry to the update log file.
 // The log file is marked as invalid if the write fails. This will trigger a
 // checkpoint operation in the future.
@@ -570,6 +599,11 @@ func loadLogFile(
 		case *opRemove:
 			entries++
 			store.Remove(op.K)
+		case *opSetAll:
+			entries++
+			for _, kv := range op.KV {
+				store.Set(kv.K, kv.V)
+			}
 		}
 		return nil
 	})
@@ -602,6 +636,8 @@ func readLogFile(home string, fn func(op, uint64) error) error {
 			op = &opSet{}
 		case opValRemove:
 			op = &opRemove{}
+		case opValSetAll:
+			op = &opSetAll{}
 		}
 
 		if err := dec.Decode(op); err != nil {
@@ -617,7 +653,7 @@ func readLogFile(home string, fn func(op, uint64) error) error {
 }
 
 func checkMeta(meta storeMeta) error {
-	if meta.Version != storeVersion {
+	if meta.Version != storeVersion && meta.Version != storeVersion1 {
 		return fmt.Errorf("store version %v not supported", meta.Version)
 	}
 
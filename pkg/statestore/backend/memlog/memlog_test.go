@@ -6,6 +6,7 @@ package memlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"math"
 	"os"
@@ -45,6 +46,125 @@ func TestCompliance_AlwaysCheckpoint(t *testing.T) {
 	})
 }
 
+func TestSetAll(t *testing.T) {
+	openTestStore := func(t *testing.T, path string) (*Registry, backend.Store) {
+		reg, err := New(logp.NewLogger("test"), Settings{Root: path})
+		require.NoError(t, err)
+		st, err := reg.Access("test")
+		require.NoError(t, err)
+		return reg, st
+	}
+	closeTestStore := func(t *testing.T, reg *Registry, st backend.Store) {
+		require.NoError(t, st.Close())
+		require.NoError(t, reg.Close())
+	}
+	get := func(t *testing.T, st backend.Store, key string) map[string]interface{} {
+		var v map[string]interface{}
+		if has, _ := st.Has(key); !has {
+			return nil
+		}
+		require.NoError(t, st.Get(key, &v))
+		return v
+	}
+
+	t.Run("pairs are restored from the log", func(t *testing.T) {
+		path := t.TempDir()
+		reg, st := openTestStore(t, path)
+		require.NoError(t, st.(*store).SetAll(map[string]interface{}{
+			"a": map[string]interface{}{"x": "1"},
+			"b": map[string]interface{}{"x": "2"},
+		}))
+		assert.Equal(t, map[string]interface{}{"x": "1"}, get(t, st, "a"))
+		closeTestStore(t, reg, st)
+
+		reg, st = openTestStore(t, path)
+		defer closeTestStore(t, reg, st)
+		assert.Equal(t, map[string]interface{}{"x": "1"}, get(t, st, "a"))
+		assert.Equal(t, map[string]interface{}{"x": "2"}, get(t, st, "b"))
+	})
+
+	t.Run("incomplete batch is ignored", func(t *testing.T) {
+		path := t.TempDir()
+		reg, st := openTestStore(t, path)
+		require.NoError(t, st.Set("a", map[string]interface{}{"x": "1"}))
+		require.NoError(t, st.(*store).SetAll(map[string]interface{}{
+			"b": map[string]interface{}{"x": "2"},
+			"c": map[string]interface{}{"x": "3"},
+		}))
+		closeTestStore(t, reg, st)
+
+		// simulate a crash while the batch has been written
+		logPath := filepath.Join(path, "test", logFileName)
+		fi, err := os.Stat(logPath)
+		require.NoError(t, err)
+		require.NoError(t, os.Truncate(logPath, fi.Size()-10))
+
+		reg, st = openTestStore(t, path)
+		defer closeTestStore(t, reg, st)
+		assert.Equal(t, map[string]interface{}{"x": "1"}, get(t, st, "a"))
+		assert.Nil(t, get(t, st, "b"))
+		assert.Nil(t, get(t, st, "c"))
+	})
+}
+
+func TestSize(t *testing.T) {
+	reg, err := New(logp.NewLogger("test"), Settings{Root: t.TempDir()})
+	require.NoError(t, err)
+	defer reg.Close()
+	st, err := reg.Access("test")
+	require.NoError(t, err)
+	defer st.Close()
+	sz := st.(*store)
+
+	logSize, checkpointSize, err := sz.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), logSize)
+	assert.Equal(t, int64(0), checkpointSize)
+
+	require.NoError(t, st.Set("a", map[string]interface{}{"x": "1"}))
+	logSize, checkpointSize, err = sz.Size()
+	require.NoError(t, err)
+	assert.Greater(t, logSize, int64(0))
+	assert.Equal(t, int64(0), checkpointSize)
+
+	require.NoError(t, sz.Checkpoint())
+	logSize, checkpointSize, err = sz.Size()
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), logSize)
+	assert.Greater(t, checkpointSize, int64(0))
+}
+
+func TestStoreVersion(t *testing.T) {
+	open := func(t *testing.T, version string) (string, error) {
+		home := filepath.Join(t.TempDir(), "test")
+		require.NoError(t, os.MkdirAll(home, 0770))
+		meta := fmt.Sprintf(`{"version": "%v"}`, version)
+		require.NoError(t, os.WriteFile(filepath.Join(home, metaFileName), []byte(meta), 0600))
+
+		reg, err := New(logp.NewLogger("test"), Settings{Root: filepath.Dir(home)})
+		require.NoError(t, err)
+		defer reg.Close()
+		st, err := reg.Access("test")
+		if err != nil {
+			return home, err
+		}
+		return home, st.Close()
+	}
+
+	t.Run("version 1 is upgraded", func(t *testing.T) {
+		home, err := open(t, storeVersion1)
+		require.NoError(t, err)
+		meta, err := readMetaFile(home)
+		require.NoError(t, err)
+		assert.Equal(t, storeVersion, meta.Version)
+	})
+
+	t.Run("unknown version is rejected", func(t *testing.T) {
+		_, err := open(t, "3")
+		require.Error(t, err)
+	})
+}
+
 func TestLoadVersion1(t *testing.T) {
 	dataHome := "testdata/1"
 
@@ -21,13 +21,22 @@ type (
 	opRemove struct {
 		K string
 	}
+
+	// opSetAll encodes the 'SetAll' operation in the update log. All key
+	// value pairs are written as a single operation, such that they are
+	// either applied all together or not at all when the log is read.
+	opSetAll struct {
+		KV []opSet
+	}
 )
 
 // operation type names
 const (
 	opValSet    = "set"
 	opValRemove = "remove"
+	opValSetAll = "set_all"
 )
 
 func (*opSet) name() string    { return opValSet }
 func (*opRemove) name() string { return opValRemove }
+func (*opSetAll) name() string { return opValSetAll }
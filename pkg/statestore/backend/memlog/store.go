@@ -9,6 +9,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 
 	"github.com/elastic/elastic-agent-inputs/pkg/statestore/backend"
@@ -67,8 +68,8 @@ func openStore(log *logp.Logger, home string, mode os.FileMode, bufSz uint, igno
 		}
 	}
 
+	meta, err := readMetaFile(home)
 	if !ignoreVersionCheck {
-		meta, err := readMetaFile(home)
 		if err != nil {
 			return nil, err
 		}
@@ -76,6 +77,11 @@ func openStore(log *logp.Logger, home string, mode os.FileMode, bufSz uint, igno
 			return nil, err
 		}
 	}
+	if err == nil && meta.Version == storeVersion1 {
+		if err := writeMetaFile(home, mode); err != nil {
+			return nil, fmt.Errorf("failed to upgrade store version: %w", err)
+		}
+	}
 
 	if err := pathEnsurePermissions(filepath.Join(home, activeDataFileName), mode); err != nil {
 		return nil, fmt.Errorf("failed to update active file permissions: %w", err)
@@ -183,6 +189,30 @@ func (s *store) Set(key string, value interface{}) error {
 	return s.logOperation(&opSet{K: key, V: tmp})
 }
 
+// SetAll inserts or overwrites multiple key-value pairs. If all values can be
+// encoded, the in-memory state is updated, and a single set_all-operation is
+// logged to the diskstore. An incomplete set_all-operation is ignored as a
+// whole when the log is read, such that the pairs are written atomically.
+func (s *store) SetAll(values map[string]interface{}) error {
+	op := &opSetAll{KV: make([]opSet, 0, len(values))}
+	for key, value := range values {
+		var tmp mapstr.M
+		if err := typeconv.Convert(&tmp, value); err != nil {
+			return err
+		}
+		op.KV = append(op.KV, opSet{K: key, V: tmp})
+	}
+	sort.Slice(op.KV, func(i, j int) bool { return op.KV[i].K < op.KV[j].K })
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, kv := range op.KV {
+		s.mem.Set(kv.K, kv.V)
+	}
+	return s.logOperation(op)
+}
+
 // Remove removes a key from the in memory store and logs a remove operation to
 // the diskstore. The operation does not check if the key exists.
 func (s *store) Remove(key string) error {
@@ -203,6 +233,15 @@ func (s *store) Checkpoint() error {
 	return s.disk.WriteCheckpoint(s.mem.table)
 }
 
+// Size reports the size in bytes of the update log file, and of the data
+// file written by the last checkpoint.
+func (s *store) Size() (logSize, checkpointSize int64, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.disk.Size()
+}
+
 // lopOperation ensures that the diskstore reflects the recent changes to the
 // in memory store by either triggering a checkpoint operations or adding the
 // operation type to the update log file.
@@ -9,6 +9,14 @@ import (
 	"fmt"
 )
 
+// ErrBatchNotSupported is returned by Store.SetAll if the storage backend can
+// not write multiple key value pairs atomically.
+var ErrBatchNotSupported = errors.New("store backend does not support batch writes")
+
+// ErrSizeNotSupported is returned by Store.Size if the storage backend can
+// not report the size of its storage.
+var ErrSizeNotSupported = errors.New("store backend does not support size reporting")
+
 // ErrorAccess indicates that an error occurred when trying to open a Store.
 type ErrorAccess struct {
 	name  string
@@ -80,3 +80,25 @@ func (m *mockStore) Each(fn func(string, backend.ValueDecoder) (bool, error)) er
 	args := m.Called(fn)
 	return args.Error(0)
 }
+
+// mockCheckpointStore is a mockStore supporting checkpoints.
+type mockCheckpointStore struct {
+	mockStore
+}
+
+func (m *mockCheckpointStore) OnCheckpoint() *mock.Call { return m.On("Checkpoint") }
+func (m *mockCheckpointStore) Checkpoint() error {
+	args := m.Called()
+	return args.Error(0)
+}
+
+// mockSizeStore is a mockStore reporting its size.
+type mockSizeStore struct {
+	mockStore
+}
+
+func (m *mockSizeStore) OnSize() *mock.Call { return m.On("Size") }
+func (m *mockSizeStore) Size() (int64, int64, error) {
+	args := m.Called()
+	return args.Get(0).(int64), args.Get(1).(int64), args.Error(2)
+}
@@ -10,6 +10,23 @@ import (
 	"github.com/elastic/go-concert/unison"
 )
 
+// checkpointer is implemented by backends that can compact their storage.
+type checkpointer interface {
+	Checkpoint() error
+}
+
+// batchWriter is implemented by backends that can write multiple key value
+// pairs atomically.
+type batchWriter interface {
+	SetAll(values map[string]interface{}) error
+}
+
+// sizer is implemented by backends that can report the size of their
+// storage.
+type sizer interface {
+	Size() (logSize, checkpointSize int64, err error)
+}
+
 type sharedStore struct {
 	reg      *Registry
 	refCount atomic.Int
@@ -108,6 +125,29 @@ func (s *Store) Set(key string, from interface{}) error {
 	return nil
 }
 
+// SetAll inserts or overwrites multiple key value pairs atomically: either
+// all or none of the pairs are written, also if the process crashes during
+// the write.
+// SetAll returns an error if the store has been closed, the backend does not
+// support atomic batch writes (ErrBatchNotSupported), a value can not be
+// encoded by the store, or the storage backend did fail.
+func (s *Store) SetAll(values map[string]interface{}) error {
+	const operation = "store/set-all"
+	if err := s.active.Add(1); err != nil {
+		return &ErrorClosed{operation: operation, name: s.shared.name}
+	}
+	defer s.active.Done()
+
+	bw, ok := s.shared.backend.(batchWriter)
+	if !ok {
+		return &ErrorOperation{name: s.shared.name, operation: operation, cause: ErrBatchNotSupported}
+	}
+	if err := bw.SetAll(values); err != nil {
+		return &ErrorOperation{name: s.shared.name, operation: operation, cause: err}
+	}
+	return nil
+}
+
 // Remove removes a key value pair from the store. Remove does not error if the
 // key is unknown to the store.
 // An error is returned if the store has already been closed or the operation
@@ -137,6 +177,45 @@ func (s *Store) Each(fn func(string, ValueDecoder) (bool, error)) error {
 	return s.shared.backend.Each(fn)
 }
 
+// Checkpoint asks the backend to write a compact snapshot of all key-value
+// pairs, e.g. replacing the update log of the memlog backend with a new data
+// file. Checkpoint does nothing if the backend does not support checkpoints.
+// If the store has been closed already an error is returned.
+func (s *Store) Checkpoint() error {
+	if err := s.active.Add(1); err != nil {
+		return &ErrorClosed{operation: "store/checkpoint", name: s.shared.name}
+	}
+	defer s.active.Done()
+
+	if cp, ok := s.shared.backend.(checkpointer); ok {
+		return cp.Checkpoint()
+	}
+	return nil
+}
+
+// Size reports the size in bytes of the storage used by the backend, split
+// into the update log and the last checkpoint, e.g. the log file and the
+// active data file of the memlog backend. Size returns an error if the store
+// has been closed, the backend can not report its size (ErrSizeNotSupported),
+// or the storage backend did fail.
+func (s *Store) Size() (logSize, checkpointSize int64, err error) {
+	const operation = "store/size"
+	if err := s.active.Add(1); err != nil {
+		return 0, 0, &ErrorClosed{operation: operation, name: s.shared.name}
+	}
+	defer s.active.Done()
+
+	sz, ok := s.shared.backend.(sizer)
+	if !ok {
+		return 0, 0, &ErrorOperation{name: s.shared.name, operation: operation, cause: ErrSizeNotSupported}
+	}
+	logSize, checkpointSize, err = sz.Size()
+	if err != nil {
+		return 0, 0, &ErrorOperation{name: s.shared.name, operation: operation, cause: err}
+	}
+	return logSize, checkpointSize, nil
+}
+
 func (s *sharedStore) Retain() {
 	s.refCount.Inc()
 }
@@ -113,6 +113,32 @@ func TestStore_Set(t *testing.T) {
 	})
 }
 
+func TestStore_SetAll(t *testing.T) {
+	t.Run("fails if store has been closed", func(t *testing.T) {
+		store := makeClosedTestStore(t)
+		assertClosed(t, store.SetAll(map[string]interface{}{"test": "value"}))
+	})
+	t.Run("fails if backend does not support batch writes", func(t *testing.T) {
+		ms := newMockStore()
+		defer ms.AssertExpectations(t)
+
+		store := makeTestMockedStore(t, ms)
+		defer store.Close()
+
+		err := store.SetAll(map[string]interface{}{"test": "value"})
+		assert.ErrorIs(t, err, ErrBatchNotSupported)
+	})
+	t.Run("set keys in backend", func(t *testing.T) {
+		data := map[string]interface{}{}
+		store := makeTestStore(t, data)
+		defer store.Close()
+
+		err := store.SetAll(map[string]interface{}{"a": "value a", "b": "value b"})
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"a": "value a", "b": "value b"}, data)
+	})
+}
+
 func TestStore_Remove(t *testing.T) {
 	t.Run("fails if store has been closed", func(t *testing.T) {
 		store := makeClosedTestStore(t)
@@ -168,6 +194,61 @@ func TestStore_Each(t *testing.T) {
 	})
 }
 
+func TestStore_Checkpoint(t *testing.T) {
+	t.Run("fails if store has been closed", func(t *testing.T) {
+		assertClosed(t, makeClosedTestStore(t).Checkpoint())
+	})
+	t.Run("ignored if backend does not support checkpoints", func(t *testing.T) {
+		store := makeTestStore(t, nil)
+		defer store.Close()
+		assert.NoError(t, store.Checkpoint())
+	})
+	t.Run("checkpoint is passed to backend", func(t *testing.T) {
+		ms := &mockCheckpointStore{}
+		ms.OnCheckpoint().Once().Return(errors.New("oops"))
+		defer ms.AssertExpectations(t)
+
+		mr := newMockRegistry()
+		mr.OnAccess("test").Once().Return(ms, nil)
+		store, err := NewRegistry(mr).Get("test")
+		require.NoError(t, err)
+		ms.OnClose().Return(nil)
+		defer store.Close()
+
+		assert.Error(t, store.Checkpoint())
+	})
+}
+
+func TestStore_Size(t *testing.T) {
+	t.Run("fails if store has been closed", func(t *testing.T) {
+		_, _, err := makeClosedTestStore(t).Size()
+		assertClosed(t, err)
+	})
+	t.Run("fails if backend does not report its size", func(t *testing.T) {
+		store := makeTestStore(t, nil)
+		defer store.Close()
+		_, _, err := store.Size()
+		assert.True(t, errors.Is(err, ErrSizeNotSupported))
+	})
+	t.Run("size is read from backend", func(t *testing.T) {
+		ms := &mockSizeStore{}
+		ms.OnSize().Once().Return(int64(10), int64(20), nil)
+		defer ms.AssertExpectations(t)
+
+		mr := newMockRegistry()
+		mr.OnAccess("test").Once().Return(ms, nil)
+		store, err := NewRegistry(mr).Get("test")
+		require.NoError(t, err)
+		ms.OnClose().Return(nil)
+		defer store.Close()
+
+		logSize, checkpointSize, err := store.Size()
+		assert.NoError(t, err)
+		assert.Equal(t, int64(10), logSize)
+		assert.Equal(t, int64(20), checkpointSize)
+	})
+}
+
 func makeTestStore(t *testing.T, data map[string]interface{}) *Store {
 	memstore := &storetest.MapStore{Table: data}
 	reg := NewRegistry(&storetest.MemoryStore{
@@ -162,6 +162,30 @@ func (s *MapStore) Set(key string, from interface{}) error {
 	return nil
 }
 
+// SetAll inserts or overwrites multiple key-value pairs. No pair is written
+// if the store is marked as closed, or any of the values can not be encoded.
+func (s *MapStore) SetAll(values map[string]interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errMapStoreClosed
+	}
+
+	s.init()
+	tmp := make(map[string]interface{}, len(values))
+	for key, from := range values {
+		var v interface{}
+		if err := typeconv.Convert(&v, from); err != nil {
+			return err
+		}
+		tmp[key] = v
+	}
+	for key, v := range tmp {
+		s.Table[key] = v
+	}
+	return nil
+}
+
 // Remove removes a key value pair from the store.
 // An error is returned if the store is marked as closed.
 func (s *MapStore) Remove(key string) error {